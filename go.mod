@@ -6,6 +6,7 @@ require (
 	github.com/GoogleCloudPlatform/cloudsql-proxy v1.37.3
 	github.com/clerk/clerk-sdk-go/v2 v2.2.0
 	github.com/gorilla/mux v1.8.1
+	github.com/gorilla/websocket v1.5.3
 	github.com/joho/godotenv v1.5.1
 	github.com/lib/pq v1.10.9
 )
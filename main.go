@@ -2,7 +2,10 @@ package main
 
 import (
 	"car-backend/pkg/handlers"
+	"car-backend/pkg/models"
+	"car-backend/pkg/realtime"
 	"car-backend/pkg/repository"
+	"car-backend/pkg/services"
 	"context"
 	"database/sql"
 	"encoding/json"
@@ -11,6 +14,8 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"time"
 
 	_ "github.com/GoogleCloudPlatform/cloudsql-proxy/proxy/dialers/postgres"
@@ -45,6 +50,8 @@ func checkEnvironment() {
 			"DB_PASSWORD",
 			"DB_NAME",
 			"CLERK_SECRET_KEY",
+			"CLERK_WEBHOOK_SECRET",
+			"INVITE_SIGNING_SECRET",
 		}
 	} else {
 		requiredEnvVars = []string{
@@ -53,6 +60,8 @@ func checkEnvironment() {
 			"DB_PASSWORD",
 			"DB_NAME",
 			"CLERK_SECRET_KEY",
+			"CLERK_WEBHOOK_SECRET",
+			"INVITE_SIGNING_SECRET",
 		}
 	}
 
@@ -64,7 +73,7 @@ func checkEnvironment() {
 			log.Printf("{\"severity\":\"ERROR\",\"message\":\"Missing required environment variable: %s\"}", envVar)
 			os.Exit(1)
 		}
-		if envVar != "DB_PASSWORD" && envVar != "CLERK_SECRET_KEY" {
+		if envVar != "DB_PASSWORD" && envVar != "CLERK_SECRET_KEY" && envVar != "CLERK_WEBHOOK_SECRET" && envVar != "INVITE_SIGNING_SECRET" {
 			log.Printf("{\"severity\":\"INFO\",\"message\":\"Found environment variable %s: %s\"}", envVar, value)
 		} else {
 			log.Printf("{\"severity\":\"INFO\",\"message\":\"Found environment variable %s: [REDACTED]\"}", envVar)
@@ -121,6 +130,91 @@ func setupDatabase() *sql.DB {
 	return db
 }
 
+// getDurationEnv parses a duration such as "10m" from the environment, falling back to def
+func getDurationEnv(key string, def time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("{\"severity\":\"WARNING\",\"message\":\"Invalid duration for %s: %v, using %s\"}", key, err, def)
+		return def
+	}
+	return d
+}
+
+// getFloatEnv parses a number from the environment, falling back to def
+func getFloatEnv(key string, def float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("{\"severity\":\"WARNING\",\"message\":\"Invalid number for %s: %v, using %v\"}", key, err, def)
+		return def
+	}
+	return f
+}
+
+// getIntEnv parses an integer from the environment, falling back to def
+func getIntEnv(key string, def int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("{\"severity\":\"WARNING\",\"message\":\"Invalid integer for %s: %v, using %d\"}", key, err, def)
+		return def
+	}
+	return n
+}
+
+// setupPaymentProvider picks the provider named by PAYMENT_PROVIDER. Only the
+// fake provider exists so far; with it, FAKE_PAYMENT_WEBHOOK_URL makes every
+// payment succeed on its own. Payments are disabled when none is configured.
+func setupPaymentProvider() services.PaymentProvider {
+	switch name := os.Getenv("PAYMENT_PROVIDER"); name {
+	case "":
+		return nil
+	case "fake":
+		secret := os.Getenv("PAYMENT_WEBHOOK_SECRET")
+		if secret == "" {
+			log.Printf("{\"severity\":\"ERROR\",\"message\":\"PAYMENT_WEBHOOK_SECRET is required\"}")
+			os.Exit(1)
+		}
+		provider := services.NewFakePaymentProvider(secret)
+		provider.WebhookURL = os.Getenv("FAKE_PAYMENT_WEBHOOK_URL")
+		provider.ConfirmDelay = getDurationEnv("FAKE_PAYMENT_CONFIRM_DELAY", provider.ConfirmDelay)
+		return provider
+	default:
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Unknown PAYMENT_PROVIDER %s\"}", name)
+		os.Exit(1)
+		return nil
+	}
+}
+
+// setupNotifier registers a channel for each delivery medium. In-app notifications
+// go to the user's inbox. Until real push, email and SMS providers are configured
+// those channels are logged, or written to NOTIFICATION_LOG_FILE when it is set.
+func setupNotifier(userRepo *repository.UserRepository, carpoolRepo *repository.CarPoolRepository, notificationRepo *repository.NotificationRepository, hub *realtime.Hub) *services.Notifier {
+	notifier := services.NewNotifier(userRepo, carpoolRepo)
+	notifier.RegisterChannel(models.ChannelInApp, services.NewInAppChannel(notificationRepo, hub))
+
+	logFile := os.Getenv("NOTIFICATION_LOG_FILE")
+	for _, name := range []string{models.ChannelPush, models.ChannelEmail, models.ChannelSMS} {
+		if logFile != "" {
+			notifier.RegisterChannel(name, services.NewFileChannel(name, logFile))
+		} else {
+			notifier.RegisterChannel(name, services.LogChannel{Name: name})
+		}
+	}
+
+	return notifier
+}
+
 func setupClerk() {
 	clerkSecretKey := os.Getenv("CLERK_SECRET_KEY")
 	if clerkSecretKey == "" {
@@ -130,7 +224,16 @@ func setupClerk() {
 	clerk.SetKey(clerkSecretKey)
 }
 
-func setupRouter(userHandler *handlers.UserHandler, carpoolHandler *handlers.CarPoolHandler, inviteHandler *handlers.InviteHandler, carpoolRideHandler *handlers.CarPoolRideHandler) *mux.Router {
+// sessionToken reads the Clerk session token from the Authorization header, or
+// from the token query parameter for browser WebSocket connections that cannot set headers.
+func sessionToken(r *http.Request) string {
+	if token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "); token != "" {
+		return token
+	}
+	return r.URL.Query().Get("token")
+}
+
+func setupRouter(userHandler *handlers.UserHandler, carpoolHandler *handlers.CarPoolHandler, inviteHandler *handlers.InviteHandler, carpoolRideHandler *handlers.CarPoolRideHandler, realtimeHandler *handlers.RealtimeHandler, joinRequestHandler *handlers.JoinRequestHandler, inviteLinkHandler *handlers.InviteLinkHandler, chatHandler *handlers.ChatHandler, dmHandler *handlers.DirectMessageHandler, moderationHandler *handlers.ModerationHandler, notificationHandler *handlers.NotificationHandler, calendarHandler *handlers.CalendarHandler, closureHandler *handlers.ClosureHandler, ratingHandler *handlers.RatingHandler, rideHistoryHandler *handlers.RideHistoryHandler, savingsHandler *handlers.SavingsHandler, expenseHandler *handlers.ExpenseHandler, paymentHandler *handlers.PaymentHandler, rewardsHandler *handlers.RewardsHandler, orgHandler *handlers.OrganizationHandler) *mux.Router {
 	r := mux.NewRouter()
 
 	// Health check endpoint (public)
@@ -150,6 +253,14 @@ func setupRouter(userHandler *handlers.UserHandler, carpoolHandler *handlers.Car
 
 	// Public routes
 	r.HandleFunc("/webhook/clerk", userHandler.HandleWebhook).Methods("POST")
+	r.HandleFunc("/webhook/payments", paymentHandler.HandleWebhook).Methods("POST")
+
+	// Calendar subscriptions authenticate with the token in the URL
+	r.HandleFunc("/calendar/{token}.ics", calendarHandler.ServeFeed).Methods("GET")
+
+	// Realtime updates over WebSocket
+	r.Handle("/ws", clerkhttp.WithHeaderAuthorization(clerkhttp.AuthorizationJWTExtractor(sessionToken))(
+		http.HandlerFunc(realtimeHandler.Connect))).Methods("GET")
 
 	// Protected routes with Clerk authentication
 	protected := r.PathPrefix("/api").Subrouter()
@@ -157,22 +268,135 @@ func setupRouter(userHandler *handlers.UserHandler, carpoolHandler *handlers.Car
 	protected.HandleFunc("/profile", userHandler.CreateProfile).Methods("POST")
 	protected.HandleFunc("/profile", userHandler.GetProfile).Methods("GET")
 	protected.HandleFunc("/profile", userHandler.UpdateProfile).Methods("PUT")
+	protected.HandleFunc("/profile/stats", userHandler.GetStats).Methods("GET")
+	protected.HandleFunc("/profile/rewards", rewardsHandler.GetMyRewards).Methods("GET")
+	protected.HandleFunc("/profile/notifications", userHandler.GetNotificationSettings).Methods("GET")
+	protected.HandleFunc("/profile/notifications", userHandler.UpdateNotificationSettings).Methods("PUT")
+	protected.HandleFunc("/profile/calendar-feed", calendarHandler.CreateUserFeed).Methods("POST")
+	protected.HandleFunc("/profile/calendar-feed", calendarHandler.RevokeUserFeed).Methods("DELETE")
 
-	// Make these carpool endpoints public for testing
-	r.HandleFunc("/api/carpools", carpoolHandler.CreateCarPool).Methods("POST")
-	r.HandleFunc("/api/carpools/{id}", carpoolHandler.GetCarPool).Methods("GET")
+	protected.HandleFunc("/carpools/recommendations", carpoolHandler.GetRecommendations).Methods("GET")
 
-	//protected.HandleFunc("/carpools", carpoolHandler.CreateCarPool).Methods("POST")
-	//protected.HandleFunc("/carpools/{id}", carpoolHandler.GetCarPool).Methods("GET")
+	protected.HandleFunc("/carpools", carpoolHandler.CreateCarPool).Methods("POST")
+	protected.HandleFunc("/carpools/{id}", carpoolHandler.GetCarPool).Methods("GET")
 	protected.HandleFunc("/carpools/{id}", carpoolHandler.UpdateCarPool).Methods("PUT")
 	protected.HandleFunc("/carpools/{id}", carpoolHandler.DeleteCarPool).Methods("DELETE")
 	protected.HandleFunc("/carpools/search", carpoolHandler.SearchCarPools).Methods("POST")
+	protected.HandleFunc("/carpools/{id}/members/{userID}", carpoolHandler.RemoveMember).Methods("DELETE")
+	protected.HandleFunc("/carpools/{id}/members/{userID}/role", carpoolHandler.UpdateMemberRole).Methods("PUT")
+
+	protected.HandleFunc("/carpools/{id}/join-requests", joinRequestHandler.CreateJoinRequest).Methods("POST")
+	protected.HandleFunc("/carpools/{id}/join-requests", joinRequestHandler.ListJoinRequests).Methods("GET")
+	protected.HandleFunc("/carpools/{id}/join-requests/{requestID}/approve", joinRequestHandler.ApproveJoinRequest).Methods("POST")
+	protected.HandleFunc("/carpools/{id}/join-requests/{requestID}/deny", joinRequestHandler.DenyJoinRequest).Methods("POST")
+	protected.HandleFunc("/carpools/{id}/join-requests/{requestID}", joinRequestHandler.CancelJoinRequest).Methods("DELETE")
 
 	protected.HandleFunc("/carpools/{id}/rides", carpoolRideHandler.CreateCarpoolRide).Methods("POST")
+	protected.HandleFunc("/carpools/{id}/rides/optimize", carpoolRideHandler.OptimizeRoute).Methods("POST")
 	protected.HandleFunc("/carpools/{id}/rides/{rideID}", carpoolRideHandler.GetCarpoolRide).Methods("GET")
+	protected.HandleFunc("/carpools/{id}/rides/{rideID}/start", carpoolRideHandler.StartRide).Methods("POST")
+	protected.HandleFunc("/carpools/{id}/rides/{rideID}/location", carpoolRideHandler.UpdateLocation).Methods("POST")
+	protected.HandleFunc("/carpools/{id}/rides/{rideID}/complete", carpoolRideHandler.CompleteRide).Methods("POST")
+	protected.HandleFunc("/carpools/{id}/rides/{rideID}/stops/{stopID}/arrive", carpoolRideHandler.ArriveAtStop).Methods("POST")
+	protected.HandleFunc("/carpools/{id}/rides/{rideID}/stops/{stopID}/no-show", carpoolRideHandler.ReportRiderNoShow).Methods("POST")
+	protected.HandleFunc("/carpools/{id}/rides/{rideID}/ratings", ratingHandler.ListRideRatings).Methods("GET")
+	protected.HandleFunc("/carpools/{id}/rides/{rideID}/ratings", ratingHandler.RateParticipant).Methods("POST")
+	protected.HandleFunc("/carpools/{id}/rides/{rideID}/expenses", expenseHandler.ListRideExpenses).Methods("GET")
+	protected.HandleFunc("/carpools/{id}/rides/{rideID}/expenses", expenseHandler.LogExpense).Methods("POST")
+
+	protected.HandleFunc("/carpools/{id}/expenses", expenseHandler.ListExpenses).Methods("GET")
+	protected.HandleFunc("/carpools/{id}/expenses/settings", expenseHandler.GetExpenseSettings).Methods("GET")
+	protected.HandleFunc("/carpools/{id}/expenses/settings", expenseHandler.UpdateExpenseSettings).Methods("PUT")
+	protected.HandleFunc("/carpools/{id}/expenses/{expenseID}", expenseHandler.DeleteExpense).Methods("DELETE")
+	protected.HandleFunc("/carpools/{id}/seats", expenseHandler.UpdateMySeats).Methods("PUT")
+	protected.HandleFunc("/carpools/{id}/balances", expenseHandler.GetBalances).Methods("GET")
+	protected.HandleFunc("/carpools/{id}/settlements", expenseHandler.RecordSettlement).Methods("POST")
+	protected.HandleFunc("/carpools/{id}/settlements", expenseHandler.ListSettlements).Methods("GET")
+	protected.HandleFunc("/carpools/{id}/settlements/{settlementID}", expenseHandler.DeleteSettlement).Methods("DELETE")
+	protected.HandleFunc("/carpools/{id}/settlements/{settlementID}/confirm", expenseHandler.ConfirmSettlement).Methods("POST")
+	protected.HandleFunc("/carpools/{id}/settlements/{settlementID}/reject", expenseHandler.RejectSettlement).Methods("POST")
+	protected.HandleFunc("/carpools/{id}/payments", paymentHandler.CreatePayment).Methods("POST")
+	protected.HandleFunc("/carpools/{id}/payments/{paymentID}", paymentHandler.GetPayment).Methods("GET")
+
+	protected.HandleFunc("/rides/history", rideHistoryHandler.ListRideHistory).Methods("GET")
+	protected.HandleFunc("/rides/history/export", rideHistoryHandler.ExportRideHistory).Methods("GET")
+
+	protected.HandleFunc("/reports/savings", savingsHandler.GetUserSavings).Methods("GET")
+	protected.HandleFunc("/reports/savings/school", savingsHandler.GetSchoolSavings).Methods("GET")
+	protected.HandleFunc("/carpools/{id}/reports/savings", savingsHandler.GetCarpoolSavings).Methods("GET")
+	protected.HandleFunc("/organizations/{id}/reports/savings", savingsHandler.GetOrganizationSavings).Methods("GET")
+
+	protected.HandleFunc("/carpools/{id}/leaderboard", rewardsHandler.GetCarpoolLeaderboard).Methods("GET")
+	protected.HandleFunc("/leaderboards/school", rewardsHandler.GetSchoolLeaderboard).Methods("GET")
+
+	protected.HandleFunc("/carpools/{id}/calendar-feed", calendarHandler.CreateCarpoolFeed).Methods("POST")
+	protected.HandleFunc("/carpools/{id}/calendar-feed", calendarHandler.RevokeCarpoolFeed).Methods("DELETE")
+	protected.HandleFunc("/carpools/{id}/closures", closureHandler.ListClosures).Methods("GET")
+	protected.HandleFunc("/carpools/{id}/closures", closureHandler.ImportClosures).Methods("POST")
+	protected.HandleFunc("/carpools/{id}/closures/{calendarID}", closureHandler.AttachClosureCalendar).Methods("POST")
+	protected.HandleFunc("/carpools/{id}/closures/{calendarID}", closureHandler.DetachClosureCalendar).Methods("DELETE")
+
+	protected.HandleFunc("/carpools/{id}/messages", chatHandler.ListMessages).Methods("GET")
+	protected.HandleFunc("/carpools/{id}/messages", chatHandler.SendMessage).Methods("POST")
+	protected.HandleFunc("/carpools/{id}/messages/read", chatHandler.ListReadReceipts).Methods("GET")
+	protected.HandleFunc("/carpools/{id}/messages/read", chatHandler.MarkRead).Methods("POST")
+	protected.HandleFunc("/carpools/{id}/messages/{messageID}", chatHandler.EditMessage).Methods("PUT")
+	protected.HandleFunc("/carpools/{id}/messages/{messageID}", chatHandler.DeleteMessage).Methods("DELETE")
+
+	protected.HandleFunc("/carpools/{id}/invite-links", inviteLinkHandler.CreateInviteLink).Methods("POST")
+	protected.HandleFunc("/carpools/{id}/invite-links", inviteLinkHandler.ListInviteLinks).Methods("GET")
+	protected.HandleFunc("/carpools/{id}/invite-links/{linkID}", inviteLinkHandler.RevokeInviteLink).Methods("DELETE")
+
+	protected.HandleFunc("/conversations", dmHandler.StartConversation).Methods("POST")
+	protected.HandleFunc("/conversations", dmHandler.ListConversations).Methods("GET")
+	protected.HandleFunc("/conversations/{id}/messages", dmHandler.ListMessages).Methods("GET")
+	protected.HandleFunc("/conversations/{id}/messages", dmHandler.SendMessage).Methods("POST")
+	protected.HandleFunc("/conversations/{id}/read", dmHandler.MarkRead).Methods("POST")
+	protected.HandleFunc("/conversations/{id}/messages/{messageID}/report", dmHandler.ReportMessage).Methods("POST")
+
+	protected.HandleFunc("/blocks", dmHandler.ListBlocks).Methods("GET")
+	protected.HandleFunc("/users/{id}/block", dmHandler.BlockUser).Methods("POST")
+	protected.HandleFunc("/users/{id}/block", dmHandler.UnblockUser).Methods("DELETE")
+	protected.HandleFunc("/users/{id}/ratings", ratingHandler.ListUserRatings).Methods("GET")
+	protected.HandleFunc("/users/{id}/rewards", rewardsHandler.GetUserRewards).Methods("GET")
+	protected.HandleFunc("/ratings/{id}/dispute", ratingHandler.DisputeRating).Methods("POST")
+
+	protected.HandleFunc("/moderation/reports", moderationHandler.ListReports).Methods("GET")
+	protected.HandleFunc("/moderation/reports/{id}/resolve", moderationHandler.ResolveReport).Methods("POST")
+	protected.HandleFunc("/moderation/ratings", moderationHandler.ListRatingDisputes).Methods("GET")
+	protected.HandleFunc("/moderation/ratings/{id}/resolve", moderationHandler.ResolveRatingDispute).Methods("POST")
+	protected.HandleFunc("/moderation/email-domains", moderationHandler.ListPendingEmailDomains).Methods("GET")
+	protected.HandleFunc("/moderation/organizations/{id}/email-domains", moderationHandler.ReviewEmailDomains).Methods("POST")
+
+	// Organizations (schools and workplaces)
+	protected.HandleFunc("/organizations", orgHandler.CreateOrganization).Methods("POST")
+	protected.HandleFunc("/organizations", orgHandler.ListMyOrganizations).Methods("GET")
+	protected.HandleFunc("/organizations/join", orgHandler.JoinOrganizationByCode).Methods("POST")
+	protected.HandleFunc("/organizations/{id}", orgHandler.GetOrganization).Methods("GET")
+	protected.HandleFunc("/organizations/{id}", orgHandler.UpdateOrganization).Methods("PUT")
+	protected.HandleFunc("/organizations/{id}/join", orgHandler.JoinOrganization).Methods("POST")
+	protected.HandleFunc("/organizations/{id}/members", orgHandler.ListMembers).Methods("GET")
+	protected.HandleFunc("/organizations/{id}/members/{userID}", orgHandler.UpdateMemberRole).Methods("PUT")
+	protected.HandleFunc("/organizations/{id}/members/{userID}", orgHandler.RemoveMember).Methods("DELETE")
+	protected.HandleFunc("/organizations/{id}/members/{userID}/approve", orgHandler.ApproveMember).Methods("POST")
+	protected.HandleFunc("/organizations/{id}/moderation/ratings", orgHandler.ListRatingDisputes).Methods("GET")
+	protected.HandleFunc("/organizations/{id}/moderation/ratings/{ratingID}/resolve", orgHandler.ResolveRatingDispute).Methods("POST")
+	protected.HandleFunc("/organizations/{id}/moderation/reports", orgHandler.ListMessageReports).Methods("GET")
+	protected.HandleFunc("/organizations/{id}/moderation/reports/{reportID}/resolve", orgHandler.ResolveMessageReport).Methods("POST")
+	protected.HandleFunc("/carpools/{id}/organization", orgHandler.SetCarpoolOrganization).Methods("PUT")
+
+	// In-app notification inbox
+	protected.HandleFunc("/notifications", notificationHandler.ListNotifications).Methods("GET")
+	protected.HandleFunc("/notifications/unread-count", notificationHandler.UnreadCount).Methods("GET")
+	protected.HandleFunc("/notifications/read-all", notificationHandler.MarkAllRead).Methods("POST")
+	protected.HandleFunc("/notifications/{id}/read", notificationHandler.MarkRead).Methods("POST")
 
 	protected.HandleFunc("/invites", inviteHandler.CreateInvite).Methods("POST")
+	protected.HandleFunc("/invites", inviteHandler.ListInvites).Methods("GET")
+	protected.HandleFunc("/invites/redeem", inviteLinkHandler.RedeemInviteLink).Methods("POST")
 	protected.HandleFunc("/invites/{id}", inviteHandler.GetInvite).Methods("GET")
+	protected.HandleFunc("/invites/{id}", inviteHandler.RespondToInvite).Methods("PUT")
+	protected.HandleFunc("/invites/{id}", inviteHandler.WithdrawInvite).Methods("DELETE")
 	return r
 }
 
@@ -196,8 +420,9 @@ func main() {
 	debugLog("DB_USER: %s", os.Getenv("DB_USER"))
 
 	// CORS middleware configuration
+	allowedOrigins := []string{"http://localhost:3000"}
 	corsMiddleware := cors.New(cors.Options{
-		AllowedOrigins:   []string{"http://localhost:3000"},
+		AllowedOrigins:   allowedOrigins,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Content-Type", "Accept", "Authorization"},
 		AllowCredentials: true,
@@ -215,14 +440,106 @@ func main() {
 	carpoolRepo := repository.NewCarPoolRepository(db)
 	inviteRepo := repository.NewInviteRepository(db)
 	carpoolRideRepo := repository.NewCarPoolRideRepository(db)
+	incidentRepo := repository.NewIncidentRepository(db)
+	joinRequestRepo := repository.NewJoinRequestRepository(db)
+	inviteLinkRepo := repository.NewInviteLinkRepository(db)
+	chatRepo := repository.NewChatRepository(db)
+	dmRepo := repository.NewDirectMessageRepository(db)
+	blockRepo := repository.NewBlockRepository(db)
+	reportRepo := repository.NewReportRepository(db)
+	ratingRepo := repository.NewRatingRepository(db)
+	notificationRepo := repository.NewNotificationRepository(db)
+	outboxRepo := repository.NewOutboxRepository(db)
+	calendarRepo := repository.NewCalendarRepository(db)
+	closureRepo := repository.NewClosureRepository(db)
+	analyticsRepo := repository.NewAnalyticsRepository(db)
+	savingsRepo := repository.NewSavingsRepository(db)
+	expenseRepo := repository.NewExpenseRepository(db)
+	paymentRepo := repository.NewPaymentRepository(db)
+	rewardsRepo := repository.NewRewardsRepository(db)
+	orgRepo := repository.NewOrganizationRepository(db)
+
+	hub := realtime.NewHub()
+	notifier := setupNotifier(userRepo, carpoolRepo, notificationRepo, hub)
+	analytics := services.NewAnalyticsService(analyticsRepo, carpoolRideRepo)
+	analytics.Interval = getDurationEnv("ANALYTICS_RECONCILE_INTERVAL", analytics.Interval)
+	rewards := services.NewRewardsEngine(rewardsRepo, carpoolRideRepo)
 
 	// Initialize handlers
-	userHandler := handlers.NewUserHandler(userRepo)
-	carpoolHandler := handlers.NewCarPoolHandler(carpoolRepo)
-	inviteHandler := handlers.NewInviteHandler(inviteRepo)
-	carpoolRideHandler := handlers.NewCarPoolRideHandler(carpoolRideRepo)
-
-	router := setupRouter(userHandler, carpoolHandler, inviteHandler, carpoolRideHandler)
+	userHandler := handlers.NewUserHandler(userRepo, inviteRepo, analytics, os.Getenv("CLERK_WEBHOOK_SECRET"))
+	carpoolHandler := handlers.NewCarPoolHandler(carpoolRepo, userRepo, services.NewMatchingService(carpoolRepo))
+	inviteHandler := handlers.NewInviteHandler(inviteRepo, userRepo, carpoolRepo, blockRepo)
+	inviteHandler.InviteTTL = getDurationEnv("INVITE_TTL", inviteHandler.InviteTTL)
+	inviteHandler.DailyLimit = getIntEnv("INVITE_DAILY_LIMIT", inviteHandler.DailyLimit)
+	inviteLinkHandler := handlers.NewInviteLinkHandler(inviteLinkRepo, carpoolRepo, userRepo, services.NewInviteTokenSigner(os.Getenv("INVITE_SIGNING_SECRET")))
+	geofencer := services.NewGeofencer(carpoolRideRepo, carpoolRepo, notifier)
+	geofencer.ArrivedRadiusM = getFloatEnv("GEOFENCE_ARRIVED_RADIUS_M", geofencer.ArrivedRadiusM)
+	geofencer.ArrivingRadiusM = getFloatEnv("GEOFENCE_ARRIVING_RADIUS_M", geofencer.ArrivingRadiusM)
+	travelEstimator := services.NewAverageSpeedEstimator()
+	etaCalculator := services.NewETACalculator(travelEstimator)
+	routeOptimizer := services.NewRouteOptimizer(travelEstimator)
+	carpoolRideHandler := handlers.NewCarPoolRideHandler(carpoolRideRepo, userRepo, incidentRepo, geofencer, etaCalculator, routeOptimizer, hub, closureRepo, carpoolRepo)
+	joinRequestHandler := handlers.NewJoinRequestHandler(joinRequestRepo, carpoolRepo, userRepo)
+	chatHandler := handlers.NewChatHandler(chatRepo, carpoolRepo, carpoolRideRepo, userRepo, hub)
+	dmHandler := handlers.NewDirectMessageHandler(dmRepo, blockRepo, reportRepo, userRepo, hub)
+	moderationHandler := handlers.NewModerationHandler(reportRepo, ratingRepo, orgRepo, userRepo)
+	notificationHandler := handlers.NewNotificationHandler(notificationRepo, userRepo, hub)
+	calendarHandler := handlers.NewCalendarHandler(calendarRepo, carpoolRepo, carpoolRideRepo, userRepo)
+	calendarHandler.BaseURL = os.Getenv("PUBLIC_BASE_URL")
+	closureHandler := handlers.NewClosureHandler(closureRepo, carpoolRepo, userRepo)
+	ratingHandler := handlers.NewRatingHandler(ratingRepo, carpoolRepo, carpoolRideRepo, userRepo)
+	rideHistoryHandler := handlers.NewRideHistoryHandler(carpoolRideRepo, userRepo)
+	savings := services.NewSavingsCalculator(savingsRepo)
+	savings.KgCO2PerGallon = getFloatEnv("SAVINGS_KG_CO2_PER_GALLON", savings.KgCO2PerGallon)
+	savings.FuelPriceMinorPerGallon = int64(getIntEnv("SAVINGS_FUEL_PRICE_MINOR_PER_GALLON", int(savings.FuelPriceMinorPerGallon)))
+	savings.DefaultMPG = getFloatEnv("SAVINGS_DEFAULT_MPG", savings.DefaultMPG)
+	if currency := os.Getenv("SAVINGS_CURRENCY"); currency != "" {
+		savings.Currency = currency
+	}
+	savingsHandler := handlers.NewSavingsHandler(savings, carpoolRepo, orgRepo, userRepo)
+	expenseHandler := handlers.NewExpenseHandler(expenseRepo, carpoolRepo, carpoolRideRepo, userRepo)
+	rewardsHandler := handlers.NewRewardsHandler(rewards, carpoolRepo, userRepo)
+	orgHandler := handlers.NewOrganizationHandler(orgRepo, carpoolRepo, ratingRepo, reportRepo, userRepo)
+	paymentHandler := handlers.NewPaymentHandler(paymentRepo, expenseRepo, carpoolRepo, userRepo, setupPaymentProvider())
+	realtimeHandler := handlers.NewRealtimeHandler(hub, userRepo, carpoolRepo, carpoolRideRepo, dmRepo, allowedOrigins)
+
+	// Background jobs stop when the server shuts down
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+
+	rideMonitor := services.NewRideMonitor(carpoolRideRepo, carpoolRepo, incidentRepo, notifier)
+	rideMonitor.LateTolerance = getDurationEnv("RIDE_LATE_TOLERANCE", rideMonitor.LateTolerance)
+	rideMonitor.NoShowTolerance = getDurationEnv("RIDE_NO_SHOW_TOLERANCE", rideMonitor.NoShowTolerance)
+	rideMonitor.NoShowWindow = getDurationEnv("RIDE_NO_SHOW_WINDOW", rideMonitor.NoShowWindow)
+	rideMonitor.BatchSize = getIntEnv("RIDE_MONITOR_BATCH_SIZE", rideMonitor.BatchSize)
+	rideMonitor.Interval = getDurationEnv("RIDE_MONITOR_INTERVAL", rideMonitor.Interval)
+	go rideMonitor.Run(jobsCtx)
+
+	inviteSweeper := services.NewInviteSweeper(inviteRepo)
+	inviteSweeper.ReminderLead = getDurationEnv("INVITE_REMINDER_LEAD", inviteSweeper.ReminderLead)
+	inviteSweeper.Interval = getDurationEnv("INVITE_SWEEP_INTERVAL", inviteSweeper.Interval)
+	go inviteSweeper.Run(jobsCtx)
+
+	rideReminders := services.NewRideReminderScheduler(carpoolRideRepo)
+	rideReminders.DriverTimeOfDay = getDurationEnv("RIDE_REMINDER_DRIVER_TIME", rideReminders.DriverTimeOfDay)
+	rideReminders.RiderLead = getDurationEnv("RIDE_REMINDER_RIDER_LEAD", rideReminders.RiderLead)
+	rideReminders.Interval = getDurationEnv("RIDE_REMINDER_INTERVAL", rideReminders.Interval)
+	go rideReminders.Run(jobsCtx)
+
+	outboxDispatcher := services.NewOutboxDispatcher(outboxRepo)
+	outboxDispatcher.Interval = getDurationEnv("OUTBOX_POLL_INTERVAL", outboxDispatcher.Interval)
+	outboxDispatcher.MaxAttempts = getIntEnv("OUTBOX_MAX_ATTEMPTS", outboxDispatcher.MaxAttempts)
+	notifier.SubscribeOutbox(outboxDispatcher)
+	analytics.SubscribeOutbox(outboxDispatcher)
+	rewards.SubscribeOutbox(outboxDispatcher)
+	go outboxDispatcher.Run(jobsCtx)
+	go analytics.Run(jobsCtx)
+
+	rewards.PerfectWeekLookback = getDurationEnv("REWARDS_PERFECT_WEEK_LOOKBACK", rewards.PerfectWeekLookback)
+	rewards.Interval = getDurationEnv("REWARDS_PERFECT_WEEK_INTERVAL", rewards.Interval)
+	go rewards.Run(jobsCtx)
+
+	router := setupRouter(userHandler, carpoolHandler, inviteHandler, carpoolRideHandler, realtimeHandler, joinRequestHandler, inviteLinkHandler, chatHandler, dmHandler, moderationHandler, notificationHandler, calendarHandler, closureHandler, ratingHandler, rideHistoryHandler, savingsHandler, expenseHandler, paymentHandler, rewardsHandler, orgHandler)
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -245,6 +562,7 @@ func main() {
 		signal.Notify(sigint, os.Interrupt)
 		<-sigint
 
+		stopJobs()
 		if err := server.Shutdown(context.Background()); err != nil {
 			log.Printf("{\"severity\":\"ERROR\",\"message\":\"HTTP server Shutdown: %v\"}", err)
 		}
@@ -0,0 +1,34 @@
+-- Track when rides and stops are scheduled to happen and when they actually did
+ALTER TABLE carpool_rides
+ADD COLUMN scheduled_at TIMESTAMP WITH TIME ZONE,
+ADD COLUMN started_at TIMESTAMP WITH TIME ZONE,
+ADD COLUMN completed_at TIMESTAMP WITH TIME ZONE;
+
+ALTER TABLE carpool_stops
+ADD COLUMN scheduled_at TIMESTAMP WITH TIME ZONE,
+ADD COLUMN arrived_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX idx_carpool_rides_status_scheduled ON carpool_rides (status, scheduled_at);
+
+-- Late arrivals and no-shows recorded against a driver or rider for reliability scoring
+CREATE TABLE ride_incidents (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    carpool_ride_id UUID NOT NULL,
+    carpool_stop_id UUID,
+    user_id UUID NOT NULL,
+    incident_type VARCHAR(20) NOT NULL CHECK (incident_type IN ('LATE', 'DRIVER_NO_SHOW', 'RIDER_NO_SHOW')),
+    details TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (carpool_ride_id) REFERENCES carpool_rides(id) ON DELETE CASCADE,
+    FOREIGN KEY (carpool_stop_id) REFERENCES carpool_stops(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+-- One incident of each type per ride, stop and user so the monitor can run repeatedly
+CREATE UNIQUE INDEX idx_ride_incidents_unique ON ride_incidents (
+    carpool_ride_id,
+    COALESCE(carpool_stop_id, '00000000-0000-0000-0000-000000000000'::uuid),
+    user_id,
+    incident_type
+);
+CREATE INDEX idx_ride_incidents_user ON ride_incidents (user_id);
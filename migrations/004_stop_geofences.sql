@@ -0,0 +1,20 @@
+-- Stop coordinates and an optional per-stop geofence radius
+ALTER TABLE carpool_stops
+ADD COLUMN lat FLOAT,
+ADD COLUMN lng FLOAT,
+ADD COLUMN geofence_radius_m FLOAT,
+ADD COLUMN departed_at TIMESTAMP WITH TIME ZONE;
+
+-- Arriving, arrived and departed events detected from driver location pings
+CREATE TABLE ride_stop_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    carpool_ride_id UUID NOT NULL,
+    carpool_stop_id UUID NOT NULL,
+    event_type VARCHAR(20) NOT NULL CHECK (event_type IN ('arriving', 'arrived', 'departed')),
+    lat FLOAT,
+    lng FLOAT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (carpool_ride_id) REFERENCES carpool_rides(id) ON DELETE CASCADE,
+    FOREIGN KEY (carpool_stop_id) REFERENCES carpool_stops(id) ON DELETE CASCADE,
+    UNIQUE (carpool_stop_id, event_type)
+);
@@ -0,0 +1,28 @@
+-- Route, schedule and preference details used to match users with carpools
+ALTER TABLE carpools
+ADD COLUMN origin_address TEXT NOT NULL DEFAULT '',
+ADD COLUMN origin_lat FLOAT,
+ADD COLUMN origin_lng FLOAT,
+ADD COLUMN destination_lat FLOAT,
+ADD COLUMN destination_lng FLOAT,
+ADD COLUMN departure_time VARCHAR(5) NOT NULL DEFAULT '',
+ADD COLUMN schedule_days VARCHAR(64) NOT NULL DEFAULT '',
+ADD COLUMN music_preference VARCHAR(50) NOT NULL DEFAULT '',
+ADD COLUMN smoking_allowed BOOLEAN NOT NULL DEFAULT FALSE,
+ADD COLUMN pets_allowed BOOLEAN NOT NULL DEFAULT FALSE,
+ADD COLUMN school_name VARCHAR(255) NOT NULL DEFAULT '';
+
+ALTER TABLE users
+ADD COLUMN home_lat FLOAT,
+ADD COLUMN home_lng FLOAT,
+ADD COLUMN destination_lat FLOAT,
+ADD COLUMN destination_lng FLOAT,
+ADD COLUMN preferred_departure_time VARCHAR(5) NOT NULL DEFAULT '',
+ADD COLUMN preferred_days VARCHAR(64) NOT NULL DEFAULT '',
+ADD COLUMN music_preference VARCHAR(50) NOT NULL DEFAULT '',
+ADD COLUMN smoking_ok BOOLEAN NOT NULL DEFAULT FALSE,
+ADD COLUMN pets_ok BOOLEAN NOT NULL DEFAULT FALSE,
+ADD COLUMN school_name VARCHAR(255) NOT NULL DEFAULT '';
+
+CREATE INDEX idx_carpools_school_name ON carpools (school_name);
+CREATE INDEX idx_carpool_members_user ON carpool_members (user_id);
@@ -0,0 +1,22 @@
+-- Members can be designated carpool admins alongside the creator
+ALTER TABLE carpool_members
+ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'MEMBER' CHECK (role IN ('MEMBER', 'ADMIN'));
+
+-- Requests from users asking to join a carpool
+CREATE TABLE join_requests (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    carpool_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    message TEXT,
+    status INTEGER NOT NULL DEFAULT 0,
+    decided_by UUID,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (carpool_id) REFERENCES carpools(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (decided_by) REFERENCES users(id)
+);
+
+-- A user can only have one open (pending or waitlisted) request per carpool
+CREATE UNIQUE INDEX idx_join_requests_open ON join_requests (carpool_id, user_id) WHERE status IN (0, 3);
+CREATE INDEX idx_join_requests_waitlist ON join_requests (carpool_id, status, created_at);
@@ -0,0 +1,29 @@
+-- Invites can be addressed to people who have not signed up yet
+ALTER TABLE invites
+ALTER COLUMN to_user DROP NOT NULL,
+ADD COLUMN to_email VARCHAR(255),
+ADD COLUMN to_phone VARCHAR(32),
+ADD CONSTRAINT invites_recipient CHECK (to_user IS NOT NULL OR to_email IS NOT NULL OR to_phone IS NOT NULL);
+
+CREATE INDEX idx_invites_unclaimed_email ON invites (LOWER(to_email)) WHERE to_user IS NULL;
+CREATE INDEX idx_invites_unclaimed_phone ON invites (to_phone) WHERE to_user IS NULL;
+
+ALTER TABLE users
+ADD COLUMN phone VARCHAR(32);
+
+-- Shareable links and codes that let anyone holding them join a carpool
+CREATE TABLE invite_links (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    carpool_id UUID NOT NULL,
+    created_by UUID NOT NULL,
+    code VARCHAR(16) NOT NULL UNIQUE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    max_uses INTEGER,
+    use_count INTEGER NOT NULL DEFAULT 0,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (carpool_id) REFERENCES carpools(id) ON DELETE CASCADE,
+    FOREIGN KEY (created_by) REFERENCES users(id)
+);
+
+CREATE INDEX idx_invite_links_carpool ON invite_links (carpool_id);
@@ -0,0 +1,31 @@
+-- Invites expire after a while instead of staying pending forever
+ALTER TABLE invites
+ADD COLUMN expires_at TIMESTAMP WITH TIME ZONE,
+ADD COLUMN reminder_sent_at TIMESTAMP WITH TIME ZONE;
+
+UPDATE invites SET expires_at = created_at + INTERVAL '14 days' WHERE expires_at IS NULL;
+
+ALTER TABLE invites
+ALTER COLUMN expires_at SET NOT NULL,
+ALTER COLUMN expires_at SET DEFAULT CURRENT_TIMESTAMP + INTERVAL '14 days';
+
+-- Keep only the newest pending invite per carpool and recipient before enforcing uniqueness
+UPDATE invites SET status = 4, updated_at = CURRENT_TIMESTAMP
+WHERE COALESCE(status, 0) = 0
+  AND id NOT IN (
+    SELECT DISTINCT ON (carpool_id, COALESCE(to_user::text, LOWER(to_email), to_phone)) id
+    FROM invites
+    WHERE COALESCE(status, 0) = 0
+    ORDER BY carpool_id, COALESCE(to_user::text, LOWER(to_email), to_phone), created_at DESC
+  );
+
+-- One pending invite per carpool and recipient
+CREATE UNIQUE INDEX idx_invites_pending_user ON invites (carpool_id, to_user)
+    WHERE COALESCE(status, 0) = 0 AND to_user IS NOT NULL;
+CREATE UNIQUE INDEX idx_invites_pending_email ON invites (carpool_id, LOWER(to_email))
+    WHERE COALESCE(status, 0) = 0 AND to_user IS NULL AND to_email IS NOT NULL;
+CREATE UNIQUE INDEX idx_invites_pending_phone ON invites (carpool_id, to_phone)
+    WHERE COALESCE(status, 0) = 0 AND to_user IS NULL AND to_phone IS NOT NULL;
+
+CREATE INDEX idx_invites_pending_expiry ON invites (expires_at) WHERE COALESCE(status, 0) = 0;
+CREATE INDEX idx_invites_sender_created ON invites (from_user, created_at);
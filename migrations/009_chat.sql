@@ -0,0 +1,29 @@
+-- Group chat between the members of a carpool, optionally about a single ride
+CREATE TABLE chat_messages (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    carpool_id UUID NOT NULL,
+    carpool_ride_id UUID,
+    sender_id UUID NOT NULL,
+    body TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    edited_at TIMESTAMP WITH TIME ZONE,
+    deleted_at TIMESTAMP WITH TIME ZONE,
+    FOREIGN KEY (carpool_id) REFERENCES carpools(id) ON DELETE CASCADE,
+    FOREIGN KEY (carpool_ride_id) REFERENCES carpool_rides(id) ON DELETE SET NULL,
+    FOREIGN KEY (sender_id) REFERENCES users(id)
+);
+
+CREATE INDEX idx_chat_messages_history ON chat_messages (carpool_id, created_at DESC, id DESC);
+CREATE INDEX idx_chat_messages_ride ON chat_messages (carpool_ride_id, created_at DESC, id DESC) WHERE carpool_ride_id IS NOT NULL;
+
+-- The newest message each member has read in a carpool's chat
+CREATE TABLE chat_read_receipts (
+    carpool_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    last_read_message_id UUID NOT NULL,
+    last_read_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (carpool_id, user_id),
+    FOREIGN KEY (carpool_id) REFERENCES carpools(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (last_read_message_id) REFERENCES chat_messages(id) ON DELETE CASCADE
+);
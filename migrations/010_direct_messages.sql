@@ -0,0 +1,64 @@
+-- One-to-one conversations. user_a is always the smaller id so each pair has one row.
+CREATE TABLE conversations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_a UUID NOT NULL,
+    user_b UUID NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_message_at TIMESTAMP WITH TIME ZONE,
+    FOREIGN KEY (user_a) REFERENCES users(id),
+    FOREIGN KEY (user_b) REFERENCES users(id),
+    CONSTRAINT conversations_ordered CHECK (user_a < user_b),
+    CONSTRAINT conversations_pair UNIQUE (user_a, user_b)
+);
+
+CREATE INDEX idx_conversations_user_b ON conversations (user_b);
+
+CREATE TABLE direct_messages (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    conversation_id UUID NOT NULL,
+    sender_id UUID NOT NULL,
+    body TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    read_at TIMESTAMP WITH TIME ZONE,
+    FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE,
+    FOREIGN KEY (sender_id) REFERENCES users(id)
+);
+
+CREATE INDEX idx_direct_messages_history ON direct_messages (conversation_id, created_at DESC, id DESC);
+CREATE INDEX idx_direct_messages_unread ON direct_messages (conversation_id, sender_id) WHERE read_at IS NULL;
+
+-- A block stops direct messages and invites between the two users in both directions
+CREATE TABLE user_blocks (
+    blocker_id UUID NOT NULL,
+    blocked_id UUID NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (blocker_id, blocked_id),
+    FOREIGN KEY (blocker_id) REFERENCES users(id),
+    FOREIGN KEY (blocked_id) REFERENCES users(id),
+    CONSTRAINT user_blocks_not_self CHECK (blocker_id <> blocked_id)
+);
+
+CREATE INDEX idx_user_blocks_blocked ON user_blocks (blocked_id);
+
+-- Moderation queue of reported direct messages
+ALTER TABLE users
+ADD COLUMN is_moderator BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE message_reports (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    direct_message_id UUID NOT NULL,
+    reporter_id UUID NOT NULL,
+    reported_user_id UUID NOT NULL,
+    reason TEXT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'OPEN' CHECK (status IN ('OPEN', 'DISMISSED', 'ACTIONED')),
+    reviewed_by UUID,
+    reviewed_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (direct_message_id) REFERENCES direct_messages(id) ON DELETE CASCADE,
+    FOREIGN KEY (reporter_id) REFERENCES users(id),
+    FOREIGN KEY (reported_user_id) REFERENCES users(id),
+    FOREIGN KEY (reviewed_by) REFERENCES users(id),
+    CONSTRAINT message_reports_once UNIQUE (direct_message_id, reporter_id)
+);
+
+CREATE INDEX idx_message_reports_queue ON message_reports (status, created_at);
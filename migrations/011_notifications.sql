@@ -0,0 +1,7 @@
+-- Per-user notification settings stored on the profile.
+-- notification_preferences maps event type to channel to enabled, overriding the defaults.
+ALTER TABLE users
+ADD COLUMN notification_preferences JSONB NOT NULL DEFAULT '{}'::jsonb,
+ADD COLUMN quiet_hours_start VARCHAR(5),
+ADD COLUMN quiet_hours_end VARCHAR(5),
+ADD COLUMN timezone VARCHAR(64) NOT NULL DEFAULT 'UTC';
@@ -0,0 +1,22 @@
+-- Persisted in-app notifications, one row per recipient
+CREATE TABLE notifications (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL,
+    type VARCHAR(40) NOT NULL,
+    title TEXT NOT NULL,
+    body TEXT NOT NULL DEFAULT '',
+    data JSONB NOT NULL DEFAULT '{}'::jsonb,
+    carpool_id UUID,
+    carpool_ride_id UUID,
+    invite_id UUID,
+    link TEXT NOT NULL DEFAULT '',
+    read_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (carpool_id) REFERENCES carpools(id) ON DELETE SET NULL,
+    FOREIGN KEY (carpool_ride_id) REFERENCES carpool_rides(id) ON DELETE SET NULL,
+    FOREIGN KEY (invite_id) REFERENCES invites(id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_notifications_feed ON notifications (user_id, created_at DESC, id DESC);
+CREATE INDEX idx_notifications_unread ON notifications (user_id) WHERE read_at IS NULL;
@@ -0,0 +1,20 @@
+-- Domain events written in the same transaction as the change that caused them,
+-- delivered to subscribers by the outbox dispatcher
+CREATE TABLE outbox_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    event_type VARCHAR(60) NOT NULL,
+    aggregate_id UUID NOT NULL,
+    payload JSONB NOT NULL DEFAULT '{}'::jsonb,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    available_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    delivered_at TIMESTAMP WITH TIME ZONE,
+    dead_lettered_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Undelivered events in the order the dispatcher picks them up
+CREATE INDEX idx_outbox_events_pending ON outbox_events (available_at, created_at)
+    WHERE delivered_at IS NULL AND dead_lettered_at IS NULL;
+CREATE INDEX idx_outbox_events_dead ON outbox_events (dead_lettered_at)
+    WHERE dead_lettered_at IS NOT NULL;
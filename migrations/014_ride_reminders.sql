@@ -0,0 +1,11 @@
+-- One row per reminder sent for a ride. The primary key is the claim: whichever
+-- instance inserts it sends the reminder, and a restart never sends it again.
+CREATE TABLE ride_reminders (
+    carpool_ride_id UUID NOT NULL,
+    kind VARCHAR(20) NOT NULL,
+    claimed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (carpool_ride_id, kind),
+    FOREIGN KEY (carpool_ride_id) REFERENCES carpool_rides(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_carpool_rides_scheduled ON carpool_rides (scheduled_at) WHERE status = 0;
@@ -0,0 +1,18 @@
+-- Calendar subscription URLs. Calendar apps cannot send auth headers, so each
+-- feed is identified by a random token; only its hash is stored.
+CREATE TABLE calendar_feeds (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL,
+    carpool_id UUID,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (carpool_id) REFERENCES carpools(id) ON DELETE CASCADE
+);
+
+-- At most one live feed per user, and per user and carpool
+CREATE UNIQUE INDEX idx_calendar_feeds_user ON calendar_feeds (user_id)
+    WHERE carpool_id IS NULL AND revoked_at IS NULL;
+CREATE UNIQUE INDEX idx_calendar_feeds_carpool ON calendar_feeds (user_id, carpool_id)
+    WHERE carpool_id IS NOT NULL AND revoked_at IS NULL;
@@ -0,0 +1,31 @@
+-- Dates school is closed, imported from .ics or CSV. A calendar can be attached
+-- to any number of carpools, so one school calendar can be shared.
+CREATE TABLE closure_calendars (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(255) NOT NULL,
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    created_by UUID NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (created_by) REFERENCES users(id)
+);
+
+CREATE TABLE closure_dates (
+    calendar_id UUID NOT NULL,
+    closed_on DATE NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (calendar_id, closed_on),
+    FOREIGN KEY (calendar_id) REFERENCES closure_calendars(id) ON DELETE CASCADE
+);
+
+CREATE TABLE carpool_closure_calendars (
+    carpool_id UUID NOT NULL,
+    calendar_id UUID NOT NULL,
+    attached_by UUID NOT NULL,
+    attached_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (carpool_id, calendar_id),
+    FOREIGN KEY (carpool_id) REFERENCES carpools(id) ON DELETE CASCADE,
+    FOREIGN KEY (calendar_id) REFERENCES closure_calendars(id) ON DELETE CASCADE,
+    FOREIGN KEY (attached_by) REFERENCES users(id)
+);
+
+CREATE INDEX idx_carpool_closure_calendars_calendar ON carpool_closure_calendars (calendar_id);
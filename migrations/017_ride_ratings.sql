@@ -0,0 +1,30 @@
+-- Ratings and reviews that ride participants leave for each other after a completed ride
+CREATE TABLE ride_ratings (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    carpool_ride_id UUID NOT NULL,
+    rater_id UUID NOT NULL,
+    ratee_id UUID NOT NULL,
+    ratee_role VARCHAR(10) NOT NULL CHECK (ratee_role IN ('DRIVER', 'RIDER')),
+    score SMALLINT NOT NULL CHECK (score BETWEEN 1 AND 5),
+    review TEXT NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'VISIBLE' CHECK (status IN ('VISIBLE', 'DISPUTED', 'HIDDEN')),
+    dispute_reason TEXT,
+    disputed_at TIMESTAMP WITH TIME ZONE,
+    reviewed_by UUID,
+    reviewed_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (carpool_ride_id) REFERENCES carpool_rides(id) ON DELETE CASCADE,
+    FOREIGN KEY (rater_id) REFERENCES users(id),
+    FOREIGN KEY (ratee_id) REFERENCES users(id),
+    FOREIGN KEY (reviewed_by) REFERENCES users(id),
+    CONSTRAINT ride_ratings_once UNIQUE (carpool_ride_id, rater_id, ratee_id),
+    CONSTRAINT ride_ratings_not_self CHECK (rater_id <> ratee_id)
+);
+
+CREATE INDEX idx_ride_ratings_ratee ON ride_ratings (ratee_id, created_at DESC);
+CREATE INDEX idx_ride_ratings_disputes ON ride_ratings (status, disputed_at);
+
+-- Aggregate of a user's ratings that are not hidden, kept up to date as ratings change
+ALTER TABLE users
+ADD COLUMN rating_average FLOAT,
+ADD COLUMN rating_count INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,5 @@
+-- Fuel economy of the vehicle a user drives, used in carbon and cost savings reports
+ALTER TABLE users
+ADD COLUMN vehicle_mpg FLOAT CHECK (vehicle_mpg > 0);
+
+CREATE INDEX idx_carpool_rides_completed ON carpool_rides (completed_at) WHERE status = 2;
@@ -0,0 +1,55 @@
+-- How a carpool splits ride costs among riders, and the currency it keeps its ledger in
+ALTER TABLE carpools
+ADD COLUMN expense_split_rule VARCHAR(10) NOT NULL DEFAULT 'EQUAL' CHECK (expense_split_rule IN ('EQUAL', 'PER_MILE', 'PER_SEAT')),
+ADD COLUMN expense_currency CHAR(3) NOT NULL DEFAULT 'USD';
+
+-- Seats a member usually takes, weighting their share under the per-seat rule
+ALTER TABLE carpool_members
+ADD COLUMN seats INTEGER NOT NULL DEFAULT 1 CHECK (seats > 0);
+
+-- Costs a driver paid for a ride. Amounts are integer minor units (cents) of currency.
+CREATE TABLE ride_expenses (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    carpool_id UUID NOT NULL,
+    carpool_ride_id UUID NOT NULL,
+    payer_id UUID NOT NULL,
+    category VARCHAR(10) NOT NULL CHECK (category IN ('FUEL', 'TOLL', 'PARKING', 'OTHER')),
+    amount_minor BIGINT NOT NULL CHECK (amount_minor > 0),
+    currency CHAR(3) NOT NULL,
+    split_rule VARCHAR(10) NOT NULL CHECK (split_rule IN ('EQUAL', 'PER_MILE', 'PER_SEAT')),
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (carpool_id) REFERENCES carpools(id) ON DELETE CASCADE,
+    FOREIGN KEY (carpool_ride_id) REFERENCES carpool_rides(id) ON DELETE CASCADE,
+    FOREIGN KEY (payer_id) REFERENCES users(id)
+);
+
+CREATE INDEX idx_ride_expenses_carpool ON ride_expenses (carpool_id, created_at DESC);
+CREATE INDEX idx_ride_expenses_ride ON ride_expenses (carpool_ride_id);
+
+-- Each rider's share of an expense; shares of an expense sum to its amount
+CREATE TABLE ride_expense_shares (
+    expense_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    amount_minor BIGINT NOT NULL CHECK (amount_minor >= 0),
+    PRIMARY KEY (expense_id, user_id),
+    FOREIGN KEY (expense_id) REFERENCES ride_expenses(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+-- Payments members make to each other to settle their balances
+CREATE TABLE expense_settlements (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    carpool_id UUID NOT NULL,
+    from_user_id UUID NOT NULL,
+    to_user_id UUID NOT NULL,
+    amount_minor BIGINT NOT NULL CHECK (amount_minor > 0),
+    currency CHAR(3) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (carpool_id) REFERENCES carpools(id) ON DELETE CASCADE,
+    FOREIGN KEY (from_user_id) REFERENCES users(id),
+    FOREIGN KEY (to_user_id) REFERENCES users(id),
+    CONSTRAINT expense_settlements_not_self CHECK (from_user_id <> to_user_id)
+);
+
+CREATE INDEX idx_expense_settlements_carpool ON expense_settlements (carpool_id, created_at DESC);
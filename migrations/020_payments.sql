@@ -0,0 +1,33 @@
+-- Payments members make through a payment provider to settle their balances.
+-- A succeeded payment is recorded in the ledger as a settlement.
+CREATE TABLE payments (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    carpool_id UUID NOT NULL,
+    from_user_id UUID NOT NULL,
+    to_user_id UUID NOT NULL,
+    amount_minor BIGINT NOT NULL CHECK (amount_minor > 0),
+    currency CHAR(3) NOT NULL,
+    provider VARCHAR(50) NOT NULL,
+    provider_intent_id VARCHAR(255),
+    status VARCHAR(10) NOT NULL DEFAULT 'PENDING' CHECK (status IN ('PENDING', 'SUCCEEDED', 'FAILED', 'CANCELED')),
+    failure_reason TEXT,
+    settlement_id UUID,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (carpool_id) REFERENCES carpools(id) ON DELETE CASCADE,
+    FOREIGN KEY (from_user_id) REFERENCES users(id),
+    FOREIGN KEY (to_user_id) REFERENCES users(id),
+    FOREIGN KEY (settlement_id) REFERENCES expense_settlements(id) ON DELETE SET NULL,
+    CONSTRAINT payments_provider_intent UNIQUE (provider, provider_intent_id),
+    CONSTRAINT payments_not_self CHECK (from_user_id <> to_user_id)
+);
+
+CREATE INDEX idx_payments_carpool ON payments (carpool_id, created_at DESC);
+
+-- Provider webhook events already processed, so redelivered events are ignored
+CREATE TABLE payment_webhook_events (
+    provider VARCHAR(50) NOT NULL,
+    event_id VARCHAR(255) NOT NULL,
+    received_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (provider, event_id)
+);
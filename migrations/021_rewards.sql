@@ -0,0 +1,36 @@
+-- Points awarded by the rewards engine. source identifies what earned them, such
+-- as a ride, so replayed events never award the same points twice.
+CREATE TABLE reward_points (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL,
+    carpool_id UUID,
+    source VARCHAR(255) NOT NULL,
+    reason VARCHAR(50) NOT NULL,
+    points INTEGER NOT NULL,
+    earned_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (carpool_id) REFERENCES carpools(id) ON DELETE SET NULL,
+    CONSTRAINT reward_points_once UNIQUE (user_id, source)
+);
+
+CREATE INDEX idx_reward_points_carpool ON reward_points (carpool_id, earned_at);
+CREATE INDEX idx_reward_points_earned ON reward_points (earned_at);
+
+-- Badges a user has earned, each at most once
+CREATE TABLE user_badges (
+    user_id UUID NOT NULL,
+    badge_code VARCHAR(50) NOT NULL,
+    awarded_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, badge_code),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- On-time streaks, recomputed from ride history whenever the user completes a ride
+CREATE TABLE user_streaks (
+    user_id UUID PRIMARY KEY,
+    current_streak INTEGER NOT NULL DEFAULT 0,
+    best_streak INTEGER NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
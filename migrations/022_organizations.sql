@@ -0,0 +1,41 @@
+-- Schools and workplaces that carpools cluster around
+CREATE TABLE organizations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(255) NOT NULL,
+    kind VARCHAR(10) NOT NULL DEFAULT 'SCHOOL' CHECK (kind IN ('SCHOOL', 'WORKPLACE', 'OTHER')),
+    -- Users whose email is at one of these domains join without approval
+    email_domains TEXT[] NOT NULL DEFAULT '{}',
+    -- Anyone with the code joins without approval; NULL disables code joins
+    join_code VARCHAR(16) UNIQUE,
+    created_by UUID NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (created_by) REFERENCES users(id)
+);
+
+-- Membership is PENDING until an org admin approves it, unless it was verified
+-- by email domain or join code
+CREATE TABLE organization_members (
+    organization_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    role VARCHAR(10) NOT NULL DEFAULT 'MEMBER' CHECK (role IN ('ADMIN', 'MEMBER')),
+    status VARCHAR(10) NOT NULL CHECK (status IN ('PENDING', 'ACTIVE')),
+    verified_via VARCHAR(10) NOT NULL CHECK (verified_via IN ('CREATOR', 'DOMAIN', 'CODE', 'APPROVAL')),
+    approved_by UUID,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (organization_id, user_id),
+    FOREIGN KEY (organization_id) REFERENCES organizations(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (approved_by) REFERENCES users(id)
+);
+
+CREATE INDEX idx_organization_members_user ON organization_members (user_id, status);
+
+-- A carpool may belong to an organization; ORGANIZATION visibility hides it from
+-- everyone but the organization's active members
+ALTER TABLE carpools
+ADD COLUMN organization_id UUID REFERENCES organizations(id) ON DELETE SET NULL,
+ADD COLUMN visibility VARCHAR(15) NOT NULL DEFAULT 'PUBLIC' CHECK (visibility IN ('PUBLIC', 'ORGANIZATION'));
+
+CREATE INDEX idx_carpools_organization ON carpools (organization_id);
@@ -0,0 +1,5 @@
+-- Only requests an admin approved belong on the waitlist. Requests that were
+-- waitlisted automatically because the carpool was full go back to pending.
+UPDATE join_requests
+SET status = 0, updated_at = CURRENT_TIMESTAMP
+WHERE status = 3 AND decided_by IS NULL;
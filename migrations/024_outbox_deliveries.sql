@@ -0,0 +1,9 @@
+-- Which subscribers, and which steps of a subscriber's work, handled an outbox
+-- event, so a retry after one subscriber failed skips the ones that succeeded
+CREATE TABLE outbox_deliveries (
+    event_id UUID NOT NULL,
+    subscriber VARCHAR(200) NOT NULL,
+    delivered_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (event_id, subscriber),
+    FOREIGN KEY (event_id) REFERENCES outbox_events(id) ON DELETE CASCADE
+);
@@ -0,0 +1,3 @@
+-- Counts the changes to a ride that show in calendar feeds, so each edit gives
+-- its calendar entry a higher SEQUENCE
+ALTER TABLE carpool_rides ADD COLUMN revision INTEGER NOT NULL DEFAULT 0;
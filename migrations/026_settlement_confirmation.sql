@@ -0,0 +1,8 @@
+-- A settlement a member records by hand only counts towards balances once the
+-- member who was paid confirms it. Settlements recorded so far, and those from
+-- payments the provider reported as succeeded, are already confirmed.
+ALTER TABLE expense_settlements
+    ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'CONFIRMED',
+    ADD COLUMN decided_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX idx_expense_settlements_pending ON expense_settlements (to_user_id) WHERE status = 'PENDING';
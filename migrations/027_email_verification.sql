@@ -0,0 +1,5 @@
+-- Whether Clerk verified the user's primary email. Joining an organization by
+-- email domain requires it; existing users are unverified until Clerk next
+-- reports on them.
+ALTER TABLE users
+    ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,12 @@
+-- Email domains let users join an organization without approval, so a platform
+-- moderator must approve each domain first. Domains added so far were never
+-- checked and go back to waiting for approval.
+ALTER TABLE organizations
+    ADD COLUMN pending_email_domains TEXT[] NOT NULL DEFAULT '{}';
+
+UPDATE organizations
+SET pending_email_domains = email_domains, email_domains = '{}'
+WHERE cardinality(email_domains) > 0;
+
+CREATE INDEX idx_organizations_pending_domains ON organizations (updated_at)
+WHERE cardinality(pending_email_domains) > 0;
@@ -0,0 +1,52 @@
+package geo
+
+import "math"
+
+const earthRadiusMeters = 6371000.0
+
+// Point is a WGS84 coordinate
+type Point struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+// DistanceMeters returns the great-circle distance between two points using the haversine formula
+func DistanceMeters(a, b Point) float64 {
+	lat1 := a.Lat * math.Pi / 180
+	lat2 := b.Lat * math.Pi / 180
+	dLat := (b.Lat - a.Lat) * math.Pi / 180
+	dLng := (b.Lng - a.Lng) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+
+	return 2 * earthRadiusMeters * math.Asin(math.Sqrt(h))
+}
+
+// Bounds is a latitude and longitude box
+type Bounds struct {
+	MinLat float64
+	MaxLat float64
+	MinLng float64
+	MaxLng float64
+}
+
+// BoundsAround returns a box containing every point within radiusMeters of p.
+// It does not wrap across the antimeridian.
+func BoundsAround(p Point, radiusMeters float64) Bounds {
+	dLat := radiusMeters / earthRadiusMeters * 180 / math.Pi
+	b := Bounds{
+		MinLat: math.Max(-90, p.Lat-dLat),
+		MaxLat: math.Min(90, p.Lat+dLat),
+		MinLng: -180,
+		MaxLng: 180,
+	}
+
+	// Longitude degrees shrink towards the poles; near them any longitude can be in range
+	if cos := math.Cos(p.Lat * math.Pi / 180); cos > 0.01 {
+		dLng := dLat / cos
+		b.MinLng = math.Max(-180, p.Lng-dLng)
+		b.MaxLng = math.Min(180, p.Lng+dLng)
+	}
+	return b
+}
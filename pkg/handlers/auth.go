@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"car-backend/pkg/models"
+	"car-backend/pkg/repository"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/clerk/clerk-sdk-go/v2"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// requireUser resolves the Clerk session on the request to our user id.
+// It writes the error response and returns false when there is no valid user.
+func requireUser(w http.ResponseWriter, r *http.Request, userRepo *repository.UserRepository) (uuid.UUID, bool) {
+	claims, ok := clerk.SessionClaimsFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return uuid.Nil, false
+	}
+
+	user, err := userRepo.GetByClerkID(r.Context(), claims.Subject)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return uuid.Nil, false
+		}
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to resolve user: %v\"}", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return uuid.Nil, false
+	}
+
+	return user.ID, true
+}
+
+// requireCarpoolAdmin resolves the current user and the {id} carpool from the URL
+// and checks the user is the carpool's creator or a designated admin.
+func requireCarpoolAdmin(w http.ResponseWriter, r *http.Request, userRepo *repository.UserRepository, carpoolRepo *repository.CarPoolRepository) (uuid.UUID, uuid.UUID, bool) {
+	userID, ok := requireUser(w, r, userRepo)
+	if !ok {
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	carpoolID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid carpool ID", http.StatusBadRequest)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	admin, err := carpoolRepo.IsAdmin(r.Context(), carpoolID, userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to check permissions: %v", err), http.StatusInternalServerError)
+		return uuid.Nil, uuid.Nil, false
+	}
+	if !admin {
+		http.Error(w, "Only carpool admins can perform this action", http.StatusForbidden)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	return carpoolID, userID, true
+}
+
+// requireCarpoolMember resolves the current user and the {id} carpool from the URL
+// and checks the user is listed in the carpool's members.
+func requireCarpoolMember(w http.ResponseWriter, r *http.Request, userRepo *repository.UserRepository, carpoolRepo *repository.CarPoolRepository) (uuid.UUID, uuid.UUID, bool) {
+	userID, ok := requireUser(w, r, userRepo)
+	if !ok {
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	carpoolID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid carpool ID", http.StatusBadRequest)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	member, err := carpoolRepo.IsMember(r.Context(), carpoolID, userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to check membership: %v", err), http.StatusInternalServerError)
+		return uuid.Nil, uuid.Nil, false
+	}
+	if !member {
+		http.Error(w, "Only carpool members can perform this action", http.StatusForbidden)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	return carpoolID, userID, true
+}
+
+// requireCarpoolRide checks the current user is a member of the carpool in the
+// URL and returns the ride in the URL when it belongs to that carpool
+func requireCarpoolRide(w http.ResponseWriter, r *http.Request, userRepo *repository.UserRepository, carpoolRepo *repository.CarPoolRepository, carpoolRideRepo *repository.CarPoolRideRepository) (*models.CarpoolRide, uuid.UUID, bool) {
+	carpoolID, userID, ok := requireCarpoolMember(w, r, userRepo, carpoolRepo)
+	if !ok {
+		return nil, uuid.Nil, false
+	}
+
+	rideID, err := uuid.Parse(mux.Vars(r)["rideID"])
+	if err != nil {
+		http.Error(w, "Invalid ride ID", http.StatusBadRequest)
+		return nil, uuid.Nil, false
+	}
+
+	ride, err := carpoolRideRepo.GetCarpoolRide(r.Context(), rideID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get carpool ride: %v", err), http.StatusInternalServerError)
+		return nil, uuid.Nil, false
+	}
+	if ride == nil || ride.CarpoolID != carpoolID {
+		http.Error(w, "Carpool ride not found", http.StatusNotFound)
+		return nil, uuid.Nil, false
+	}
+
+	return ride, userID, true
+}
+
+// requireUserLocation returns the timezone from the user's settings, or UTC
+// when it is not a known zone
+func requireUserLocation(w http.ResponseWriter, r *http.Request, userRepo *repository.UserRepository, userID uuid.UUID) (*time.Location, bool) {
+	settings, err := userRepo.GetNotificationSettings(r.Context(), userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get user settings: %v", err), http.StatusInternalServerError)
+		return nil, false
+	}
+	loc, err := time.LoadLocation(settings.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	return loc, true
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"car-backend/pkg/models"
+	"car-backend/pkg/repository"
+	"car-backend/pkg/services"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+type CalendarHandler struct {
+	calendarRepo    *repository.CalendarRepository
+	carpoolRepo     *repository.CarPoolRepository
+	carpoolRideRepo *repository.CarPoolRideRepository
+	userRepo        *repository.UserRepository
+
+	// BaseURL is the public origin feed URLs are built on. When empty the
+	// request's host is used.
+	BaseURL string
+	// Lookback is how far into the past feeds list rides
+	Lookback time.Duration
+	// Horizon is how far into the future feeds list rides
+	Horizon time.Duration
+}
+
+func NewCalendarHandler(calendarRepo *repository.CalendarRepository, carpoolRepo *repository.CarPoolRepository, carpoolRideRepo *repository.CarPoolRideRepository, userRepo *repository.UserRepository) *CalendarHandler {
+	return &CalendarHandler{
+		calendarRepo:    calendarRepo,
+		carpoolRepo:     carpoolRepo,
+		carpoolRideRepo: carpoolRideRepo,
+		userRepo:        userRepo,
+		Lookback:        7 * 24 * time.Hour,
+		Horizon:         90 * 24 * time.Hour,
+	}
+}
+
+// CreateUserFeed issues the subscription URL for all of the user's rides,
+// replacing any previous one
+func (h *CalendarHandler) CreateUserFeed(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r, h.userRepo)
+	if !ok {
+		return
+	}
+	h.createFeed(w, r, userID, nil)
+}
+
+// RevokeUserFeed disables the user's subscription URL
+func (h *CalendarHandler) RevokeUserFeed(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r, h.userRepo)
+	if !ok {
+		return
+	}
+	h.revokeFeed(w, r, userID, nil)
+}
+
+// CreateCarpoolFeed issues a member's subscription URL for one carpool's rides
+func (h *CalendarHandler) CreateCarpoolFeed(w http.ResponseWriter, r *http.Request) {
+	carpoolID, userID, ok := requireCarpoolMember(w, r, h.userRepo, h.carpoolRepo)
+	if !ok {
+		return
+	}
+	h.createFeed(w, r, userID, &carpoolID)
+}
+
+// RevokeCarpoolFeed disables the member's subscription URL for the carpool
+func (h *CalendarHandler) RevokeCarpoolFeed(w http.ResponseWriter, r *http.Request) {
+	carpoolID, userID, ok := requireCarpoolMember(w, r, h.userRepo, h.carpoolRepo)
+	if !ok {
+		return
+	}
+	h.revokeFeed(w, r, userID, &carpoolID)
+}
+
+func (h *CalendarHandler) createFeed(w http.ResponseWriter, r *http.Request, userID uuid.UUID, carpoolID *uuid.UUID) {
+	token, hash, err := services.NewCalendarToken()
+	if err != nil {
+		http.Error(w, "Failed to generate feed token", http.StatusInternalServerError)
+		return
+	}
+
+	feed, err := h.calendarRepo.CreateFeed(r.Context(), userID, carpoolID, hash)
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to create calendar feed: %v\"}", err)
+		http.Error(w, "Failed to create calendar feed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(models.CalendarFeedResponse{
+		URL:       h.feedURL(r, token),
+		CarpoolID: feed.CarpoolID,
+		CreatedAt: feed.CreatedAt,
+	})
+}
+
+func (h *CalendarHandler) revokeFeed(w http.ResponseWriter, r *http.Request, userID uuid.UUID, carpoolID *uuid.UUID) {
+	revoked, err := h.calendarRepo.RevokeFeed(r.Context(), userID, carpoolID)
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to revoke calendar feed: %v\"}", err)
+		http.Error(w, "Failed to revoke calendar feed", http.StatusInternalServerError)
+		return
+	}
+	if revoked == 0 {
+		http.Error(w, "No calendar feed to revoke", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ServeFeed renders the feed for the token in the URL. It is public because
+// calendar apps cannot authenticate; the token is the credential.
+func (h *CalendarHandler) ServeFeed(w http.ResponseWriter, r *http.Request) {
+	feed, err := h.calendarRepo.GetFeedByTokenHash(r.Context(), services.HashCalendarToken(mux.Vars(r)["token"]))
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to get calendar feed: %v\"}", err)
+		http.Error(w, "Failed to load calendar", http.StatusInternalServerError)
+		return
+	}
+	if feed == nil {
+		http.Error(w, "Calendar not found", http.StatusNotFound)
+		return
+	}
+
+	settings, err := h.userRepo.GetNotificationSettings(r.Context(), feed.UserID)
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to get settings for calendar feed: %v\"}", err)
+		http.Error(w, "Failed to load calendar", http.StatusInternalServerError)
+		return
+	}
+	loc, err := time.LoadLocation(settings.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	carpools, err := h.carpoolRepo.ListUserCarpools(r.Context(), feed.UserID, feed.CarpoolID)
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to list carpools for calendar feed: %v\"}", err)
+		http.Error(w, "Failed to load calendar", http.StatusInternalServerError)
+		return
+	}
+
+	// A carpool feed stops working once the user leaves the carpool
+	name := "Carpool rides"
+	if feed.CarpoolID != nil {
+		if len(carpools) == 0 {
+			http.Error(w, "Calendar not found", http.StatusNotFound)
+			return
+		}
+		name = carpools[0].CarpoolName
+	}
+
+	now := time.Now()
+	rides, err := h.carpoolRideRepo.ListCalendarRides(r.Context(), feed.UserID, feed.CarpoolID, now.Add(-h.Lookback), now.Add(h.Horizon))
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to list rides for calendar feed: %v\"}", err)
+		http.Error(w, "Failed to load calendar", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="carpool.ics"`)
+	w.Header().Set("Cache-Control", "private, max-age=900")
+	w.Write(services.BuildCalendar(name, loc, rides, now))
+}
+
+func (h *CalendarHandler) feedURL(r *http.Request, token string) string {
+	base := strings.TrimSuffix(h.BaseURL, "/")
+	if base == "" {
+		scheme := "https"
+		if r.TLS == nil && r.Header.Get("X-Forwarded-Proto") == "http" {
+			scheme = "http"
+		}
+		base = scheme + "://" + r.Host
+	}
+	return fmt.Sprintf("%s/calendar/%s.ics", base, token)
+}
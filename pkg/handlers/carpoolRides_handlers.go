@@ -2,28 +2,49 @@ package handlers
 
 import (
 	"car-backend/pkg/models"
+	"car-backend/pkg/realtime"
 	"car-backend/pkg/repository"
+	"car-backend/pkg/services"
 	"context"
 	"encoding/json"
 	"log"
 	"fmt"
 	"database/sql"
 	"net/http"
+	"time"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
 
 type CarPoolRideHandler struct {
 	carpoolRideRepo *repository.CarPoolRideRepository
+	userRepo        *repository.UserRepository
+	incidentRepo    *repository.IncidentRepository
+	geofencer       *services.Geofencer
+	etaCalculator   *services.ETACalculator
+	routeOptimizer  *services.RouteOptimizer
+	hub             *realtime.Hub
+	closureRepo     *repository.ClosureRepository
+	carpoolRepo     *repository.CarPoolRepository
 }
 
 
-func NewCarPoolRideHandler(repo *repository.CarPoolRideRepository) *CarPoolRideHandler {
+func NewCarPoolRideHandler(repo *repository.CarPoolRideRepository, userRepo *repository.UserRepository, incidentRepo *repository.IncidentRepository, geofencer *services.Geofencer, etaCalculator *services.ETACalculator, routeOptimizer *services.RouteOptimizer, hub *realtime.Hub, closureRepo *repository.ClosureRepository, carpoolRepo *repository.CarPoolRepository) *CarPoolRideHandler {
 	return &CarPoolRideHandler{
 		carpoolRideRepo: repo,
+		userRepo:        userRepo,
+		incidentRepo:    incidentRepo,
+		geofencer:       geofencer,
+		etaCalculator:   etaCalculator,
+		routeOptimizer:  routeOptimizer,
+		hub:             hub,
+		closureRepo:     closureRepo,
+		carpoolRepo:     carpoolRepo,
 	}
 }
 
+// CreateCarpoolRide schedules a ride for the carpool in the URL. Any member may
+// schedule one; its driver and riders must be members too.
 func (h *CarPoolRideHandler) CreateCarpoolRide(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:3000") 
@@ -35,13 +56,8 @@ func (h *CarPoolRideHandler) CreateCarpoolRide(w http.ResponseWriter, r *http.Re
 			return
 	}
 
-	vars := mux.Vars(r)
-	carpoolIDStr := vars["id"] 
-
-	carpoolID, err := uuid.Parse(carpoolIDStr)
-	if err != nil {
-			log.Printf("Invalid carpool ID: %v", err)
-			http.Error(w, "Invalid carpool ID", http.StatusBadRequest)
+	carpoolID, userID, ok := requireCarpoolMember(w, r, h.userRepo, h.carpoolRepo)
+	if !ok {
 			return
 	}
 
@@ -49,7 +65,7 @@ func (h *CarPoolRideHandler) CreateCarpoolRide(w http.ResponseWriter, r *http.Re
 
 	var ride models.CarpoolRide
 	decoder := json.NewDecoder(r.Body)
-	err = decoder.Decode(&ride)
+	err := decoder.Decode(&ride)
 	if err != nil {
 			http.Error(w, "Invalid request body", http.StatusBadRequest)
 			return
@@ -58,7 +74,47 @@ func (h *CarPoolRideHandler) CreateCarpoolRide(w http.ResponseWriter, r *http.Re
 	// **Assign carpoolID from URL**
 	ride.CarpoolID = carpoolID 
 
-	ctx := context.Background()
+	// Rides always start out scheduled; only the driver moves them on
+	ride.Status = models.RideStatusScheduled
+	ride.StartedAt = nil
+	ride.CompletedAt = nil
+	if ride.DriverID == uuid.Nil {
+			ride.DriverID = userID
+	}
+
+	ctx := r.Context()
+
+	// The driver and every rider with a stop must belong to the carpool
+	participants := []uuid.UUID{ride.DriverID}
+	for _, stop := range ride.Stops {
+			if stop.UserID != uuid.Nil {
+					participants = append(participants, stop.UserID)
+			}
+	}
+	for _, participant := range participants {
+			member, err := h.carpoolRepo.IsMember(r.Context(), carpoolID, participant)
+			if err != nil {
+					http.Error(w, fmt.Sprintf("Failed to check membership: %v", err), http.StatusInternalServerError)
+					return
+			}
+			if !member {
+					http.Error(w, fmt.Sprintf("User %s is not a member of this carpool", participant), http.StatusBadRequest)
+					return
+			}
+	}
+
+	// No rides on days school is closed
+	if ride.ScheduledAt != nil {
+			closure, err := h.closureRepo.ClosureOn(ctx, carpoolID, *ride.ScheduledAt)
+			if err != nil {
+					http.Error(w, fmt.Sprintf("Failed to check closures: %v", err), http.StatusInternalServerError)
+					return
+			}
+			if closure != nil {
+					http.Error(w, fmt.Sprintf("School is closed on %s: %s", closure.Date, closure.Reason), http.StatusConflict)
+					return
+			}
+	}
 	err = h.carpoolRideRepo.CreateCarpoolRide(ctx, &ride)
 	if err != nil {
 			log.Printf("failed to create carpool ride: %v\n", err)
@@ -70,27 +126,257 @@ func (h *CarPoolRideHandler) CreateCarpoolRide(w http.ResponseWriter, r *http.Re
 	json.NewEncoder(w).Encode(ride)
 }
 
+// GetCarpoolRide returns a ride of the carpool in the URL with its stops and
+// live ETAs, for the carpool's members
 func (h *CarPoolRideHandler) GetCarpoolRide(w http.ResponseWriter, r *http.Request) {
+	ride, _, ok := requireCarpoolRide(w, r, h.userRepo, h.carpoolRepo, h.carpoolRideRepo)
+	if !ok {
+		return
+	}
+
+	etas, err := h.etaCalculator.Compute(r.Context(), ride, time.Now())
+	if err != nil {
+		log.Printf("{\"severity\":\"WARNING\",\"message\":\"Failed to compute ETAs for ride %s: %v\"}", ride.ID, err)
+	}
+	ride.ETAs = etas
+
 	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ride)
+}
+
+// StartRide marks a scheduled ride as in progress. Only the driver may start it.
+func (h *CarPoolRideHandler) StartRide(w http.ResponseWriter, r *http.Request) {
+	ride, ok := h.loadDriverRide(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.carpoolRideRepo.StartRide(r.Context(), ride.ID); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Ride is not scheduled", http.StatusConflict)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Failed to start ride: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CompleteRide marks an in-progress ride as completed. Only the driver may complete it.
+func (h *CarPoolRideHandler) CompleteRide(w http.ResponseWriter, r *http.Request) {
+	ride, ok := h.loadDriverRide(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.carpoolRideRepo.CompleteRide(r.Context(), ride.ID); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Ride is not in progress", http.StatusConflict)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Failed to complete ride: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
 
-	vars := mux.Vars(r)
-	rideIDStr := vars["rideID"]
+// ArriveAtStop records that the driver reached a stop
+func (h *CarPoolRideHandler) ArriveAtStop(w http.ResponseWriter, r *http.Request) {
+	ride, ok := h.loadDriverRide(w, r)
+	if !ok {
+		return
+	}
 
-	rideID, err := uuid.Parse(rideIDStr)
+	stopID, err := uuid.Parse(mux.Vars(r)["stopID"])
 	if err != nil {
-			http.Error(w, "Invalid ride ID", http.StatusBadRequest)
+		http.Error(w, "Invalid stop ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.carpoolRideRepo.MarkStopArrived(r.Context(), ride.ID, stopID); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Stop not found or ride not in progress", http.StatusConflict)
 			return
+		}
+		http.Error(w, fmt.Sprintf("Failed to mark stop arrived: %v", err), http.StatusInternalServerError)
+		return
 	}
 
-	ride, err := h.carpoolRideRepo.GetCarpoolRide(r.Context(), rideID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ReportRiderNoShow lets the driver record that the rider at a stop did not turn up
+func (h *CarPoolRideHandler) ReportRiderNoShow(w http.ResponseWriter, r *http.Request) {
+	ride, ok := h.loadDriverRide(w, r)
+	if !ok {
+		return
+	}
+
+	stopID, err := uuid.Parse(mux.Vars(r)["stopID"])
 	if err != nil {
-			if err == sql.ErrNoRows {
-					http.Error(w, "Carpool ride not found", http.StatusNotFound)
-					return
+		http.Error(w, "Invalid stop ID", http.StatusBadRequest)
+		return
+	}
+
+	var stop *models.Stop
+	for i := range ride.Stops {
+		if ride.Stops[i].ID == stopID {
+			stop = &ride.Stops[i]
+		}
+	}
+	if stop == nil || stop.UserID == uuid.Nil {
+		http.Error(w, "Stop has no rider", http.StatusNotFound)
+		return
+	}
+
+	incident := &models.RideIncident{
+		CarpoolRideID: ride.ID,
+		CarpoolStopID: &stop.ID,
+		UserID:        stop.UserID,
+		IncidentType:  models.IncidentTypeRiderNoShow,
+		Details:       fmt.Sprintf("Rider did not show at %s", stop.Address),
+	}
+	if _, err := h.incidentRepo.RecordIncident(r.Context(), incident); err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to record rider no-show: %v\"}", err)
+		http.Error(w, "Failed to record no-show", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UpdateLocation accepts a driver location ping and runs geofence detection on the ride's stops
+func (h *CarPoolRideHandler) UpdateLocation(w http.ResponseWriter, r *http.Request) {
+	ride, ok := h.loadDriverRide(w, r)
+	if !ok {
+		return
+	}
+
+	var update models.LocationUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.carpoolRideRepo.UpdateLocation(r.Context(), ride.ID, update.Lat, update.Lng); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Ride is not active", http.StatusConflict)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Failed to update location: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	events, err := h.geofencer.ProcessLocation(r.Context(), ride, update.Lat, update.Lng)
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to process geofences for ride %s: %v\"}", ride.ID, err)
+		http.Error(w, "Failed to process location", http.StatusInternalServerError)
+		return
+	}
+
+	ride.LocationLat, ride.LocationLng = update.Lat, update.Lng
+	h.publishLocation(r.Context(), ride, events)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": ride.Status,
+		"events": events,
+		"etas":   ride.ETAs,
+	})
+}
+
+// publishLocation recomputes ETAs for the ride and pushes the location, any
+// geofence events and the new ETAs to realtime subscribers of the ride.
+func (h *CarPoolRideHandler) publishLocation(ctx context.Context, ride *models.CarpoolRide, events []models.StopEvent) {
+	// Stops reached by this ping are no longer pending
+	for _, event := range events {
+		if event.EventType != models.StopEventArrived {
+			continue
+		}
+		for i := range ride.Stops {
+			if ride.Stops[i].ID == event.CarpoolStopID && ride.Stops[i].ArrivedAt == nil {
+				arrivedAt := event.CreatedAt
+				ride.Stops[i].ArrivedAt = &arrivedAt
 			}
-			http.Error(w, fmt.Sprintf("Failed to get carpool ride: %v", err), http.StatusInternalServerError)
+		}
+	}
+
+	etas, err := h.etaCalculator.Compute(ctx, ride, time.Now())
+	if err != nil {
+		log.Printf("{\"severity\":\"WARNING\",\"message\":\"Failed to compute ETAs for ride %s: %v\"}", ride.ID, err)
+	}
+	ride.ETAs = etas
+
+	topic := realtime.RideTopic(ride.ID)
+	h.hub.Publish(topic, "location", models.LocationUpdate{Lat: ride.LocationLat, Lng: ride.LocationLng})
+	for _, event := range events {
+		h.hub.Publish(topic, "stop_event", event)
+	}
+	h.hub.Publish(topic, "eta", etas)
+}
+
+// OptimizeRoute proposes the pickup order that minimises total distance for the
+// submitted stops. Only members of the carpool may plan its routes.
+func (h *CarPoolRideHandler) OptimizeRoute(w http.ResponseWriter, r *http.Request) {
+	if _, _, ok := requireCarpoolMember(w, r, h.userRepo, h.carpoolRepo); !ok {
+		return
+	}
+
+	var req models.OptimizeRouteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	route, err := h.routeOptimizer.Optimize(r.Context(), req)
+	if err != nil {
+		if err == services.ErrInfeasibleConstraints {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
 			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	json.NewEncoder(w).Encode(ride)
-}
\ No newline at end of file
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(route)
+}
+
+// loadDriverRide fetches the ride from the URL and checks it belongs to the
+// carpool in the URL and the caller is its driver
+func (h *CarPoolRideHandler) loadDriverRide(w http.ResponseWriter, r *http.Request) (*models.CarpoolRide, bool) {
+	userID, ok := requireUser(w, r, h.userRepo)
+	if !ok {
+		return nil, false
+	}
+
+	carpoolID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid carpool ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	rideID, err := uuid.Parse(mux.Vars(r)["rideID"])
+	if err != nil {
+		http.Error(w, "Invalid ride ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	ride, err := h.carpoolRideRepo.GetCarpoolRide(r.Context(), rideID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get carpool ride: %v", err), http.StatusInternalServerError)
+		return nil, false
+	}
+	if ride == nil || ride.CarpoolID != carpoolID {
+		http.Error(w, "Carpool ride not found", http.StatusNotFound)
+		return nil, false
+	}
+	if ride.DriverID != userID {
+		http.Error(w, "Only the driver can update this ride", http.StatusForbidden)
+		return nil, false
+	}
+
+	return ride, true
+}
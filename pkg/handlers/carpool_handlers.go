@@ -1,31 +1,44 @@
 package handlers
 
 import (
+	"car-backend/pkg/geo"
 	"car-backend/pkg/models"
 	"car-backend/pkg/repository"
+	"car-backend/pkg/services"
 	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
 
 type CarPoolHandler struct {
 	carpoolRepo *repository.CarPoolRepository
+	userRepo    *repository.UserRepository
+	matching    *services.MatchingService
 }
 
 
 
-func NewCarPoolHandler(repo *repository.CarPoolRepository) *CarPoolHandler {
+func NewCarPoolHandler(repo *repository.CarPoolRepository, userRepo *repository.UserRepository, matching *services.MatchingService) *CarPoolHandler {
 	return &CarPoolHandler{
 		carpoolRepo: repo,
+		userRepo:    userRepo,
+		matching:    matching,
 	}
 }
 
+// CreateCarPool creates a carpool with the current user as its creator and admin
 func (h *CarPoolHandler) CreateCarPool(w http.ResponseWriter, r *http.Request) {
+    userID, ok := requireUser(w, r, h.userRepo)
+    if !ok {
+        return
+    }
+
     var req models.CreateCarPoolRequest
     if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
         log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to decode request: %v\"}", err)
@@ -35,13 +48,24 @@ func (h *CarPoolHandler) CreateCarPool(w http.ResponseWriter, r *http.Request) {
 
     // Create carpool object
     carpool := &models.Carpool{
-        CreatorID:      "temp-creator", // TODO: Get from auth context
+        CreatorID:      userID.String(),
         CarpoolName:    req.CarpoolName,  // Use CarpoolName from request
         Status:         false,           // Default status (can be modified later)
         RecurringOption: req.RecurringOption,
         AvailableSeats:  req.AvailableSeats,
         DestinationAddress: req.DestinationAddress,
         Seats:           req.Seats,        // Use Seats from request
+        OriginAddress:   req.OriginAddress,
+        OriginLat:       req.OriginLat,
+        OriginLng:       req.OriginLng,
+        DestinationLat:  req.DestinationLat,
+        DestinationLng:  req.DestinationLng,
+        DepartureTime:   req.DepartureTime,
+        ScheduleDays:    req.ScheduleDays,
+        MusicPreference: req.MusicPreference,
+        SmokingAllowed:  req.SmokingAllowed,
+        PetsAllowed:     req.PetsAllowed,
+        SchoolName:      req.SchoolName,
     }
 
 
@@ -57,6 +81,11 @@ func (h *CarPoolHandler) CreateCarPool(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *CarPoolHandler) GetCarPool(w http.ResponseWriter, r *http.Request) {
+    userID, ok := requireUser(w, r, h.userRepo)
+    if !ok {
+        return
+    }
+
     w.Header().Set("Content-Type", "application/json")
 
     params := mux.Vars(r)
@@ -66,6 +95,17 @@ func (h *CarPoolHandler) GetCarPool(w http.ResponseWriter, r *http.Request) {
         return
     }
 
+    // Organization-only carpools are hidden from outsiders
+    visible, err := h.carpoolRepo.IsVisibleTo(r.Context(), carpoolID, userID)
+    if err != nil {
+        http.Error(w, fmt.Sprintf("Failed to get carpool: %v", err), http.StatusInternalServerError)
+        return
+    }
+    if !visible {
+        http.Error(w, "Carpool not found", http.StatusNotFound)
+        return
+    }
+
     carpool, err := h.carpoolRepo.GetCarPool(context.Background(), carpoolID)
     if err != nil {
         if err == sql.ErrNoRows {
@@ -109,6 +149,209 @@ func (h *CarPoolHandler) DeleteCarPool(w http.ResponseWriter, r *http.Request) {
 }
 
 
+// SearchCarPools returns carpools matching the filters in the body, each with the
+// aggregate rating of its members. max_distance is in kilometres from the
+// user's home location.
 func (h *CarPoolHandler) SearchCarPools(w http.ResponseWriter, r *http.Request) {
-	// TODO: Implement
-}
\ No newline at end of file
+	userID, ok := requireUser(w, r, h.userRepo)
+	if !ok {
+		return
+	}
+
+	var filters models.SearchFilters
+	if err := json.NewDecoder(r.Body).Decode(&filters); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if filters.MinRating != nil && (*filters.MinRating < 1 || *filters.MinRating > 5) {
+		http.Error(w, "min_rating must be between 1 and 5", http.StatusBadRequest)
+		return
+	}
+
+	var origin *geo.Point
+	if filters.MaxDistance != nil {
+		user, err := h.userRepo.GetByID(r.Context(), userID.String())
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get user: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if user.HomeLat == nil || user.HomeLng == nil {
+			http.Error(w, "Add a home location to your profile to search by distance", http.StatusBadRequest)
+			return
+		}
+		origin = &geo.Point{Lat: *user.HomeLat, Lng: *user.HomeLng}
+	}
+
+	carpools, err := h.carpoolRepo.SearchCarPools(r.Context(), userID, filters, origin, 50)
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to search carpools: %v\"}", err)
+		http.Error(w, "Failed to search carpools", http.StatusInternalServerError)
+		return
+	}
+	if err := h.carpoolRepo.AttachMemberRatings(r.Context(), carpools); err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to get member ratings: %v\"}", err)
+		http.Error(w, "Failed to search carpools", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(carpools)
+}
+
+// GetRecommendations returns carpools scored for the current user with an explanation of each score.
+// ?organization_id limits them to one organization's carpools.
+func (h *CarPoolHandler) GetRecommendations(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r, h.userRepo)
+	if !ok {
+		return
+	}
+
+	limit := 20
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 100 {
+			http.Error(w, "limit must be between 1 and 100", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	var organizationID *uuid.UUID
+	if value := r.URL.Query().Get("organization_id"); value != "" {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			http.Error(w, "Invalid organization ID", http.StatusBadRequest)
+			return
+		}
+		organizationID = &id
+	}
+
+	user, err := h.userRepo.GetByID(r.Context(), userID.String())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get user: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	recommendations, err := h.matching.Recommend(r.Context(), user, organizationID, limit)
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to recommend carpools: %v\"}", err)
+		http.Error(w, "Failed to get recommendations", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(recommendations)
+}
+
+// RemoveMember takes a member out of the carpool. Members may leave on their own;
+// carpool admins and admins of its organization may remove anyone. The freed
+// seat goes to the oldest waitlisted request.
+func (h *CarPoolHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := requireUser(w, r, h.userRepo)
+	if !ok {
+		return
+	}
+
+	carpoolID, memberID, ok := parseMemberPath(w, r)
+	if !ok {
+		return
+	}
+
+	if memberID != callerID {
+		admin, err := h.carpoolRepo.IsAdmin(r.Context(), carpoolID, callerID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to check permissions: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if !admin {
+			// Admins of the carpool's organization moderate its carpools
+			admin, err = h.carpoolRepo.IsOrgAdmin(r.Context(), carpoolID, callerID)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Failed to check permissions: %v", err), http.StatusInternalServerError)
+				return
+			}
+		}
+		if !admin {
+			http.Error(w, "Only carpool admins can remove other members", http.StatusForbidden)
+			return
+		}
+	}
+
+	promoted, err := h.carpoolRepo.RemoveMember(r.Context(), carpoolID, memberID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Member not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Failed to remove member: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	for _, request := range promoted {
+		log.Printf("{\"severity\":\"INFO\",\"message\":\"Promoted waitlisted user %s into carpool %s\"}", request.UserID, carpoolID)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UpdateMemberRole lets an admin designate or revoke other admins
+func (h *CarPoolHandler) UpdateMemberRole(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := requireUser(w, r, h.userRepo)
+	if !ok {
+		return
+	}
+
+	carpoolID, memberID, ok := parseMemberPath(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateMemberRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Role != models.MemberRoleMember && req.Role != models.MemberRoleAdmin {
+		http.Error(w, "role must be MEMBER or ADMIN", http.StatusBadRequest)
+		return
+	}
+
+	admin, err := h.carpoolRepo.IsAdmin(r.Context(), carpoolID, callerID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to check permissions: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if !admin {
+		http.Error(w, "Only carpool admins can change roles", http.StatusForbidden)
+		return
+	}
+
+	if err := h.carpoolRepo.SetMemberRole(r.Context(), carpoolID, memberID, req.Role); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Member not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Failed to update member role: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func parseMemberPath(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, bool) {
+	vars := mux.Vars(r)
+
+	carpoolID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid carpool ID", http.StatusBadRequest)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	memberID, err := uuid.Parse(vars["userID"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	return carpoolID, memberID, true
+}
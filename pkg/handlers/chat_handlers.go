@@ -0,0 +1,355 @@
+package handlers
+
+import (
+	"car-backend/pkg/models"
+	"car-backend/pkg/realtime"
+	"car-backend/pkg/repository"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultChatPageSize = 50
+	maxChatPageSize     = 100
+)
+
+type ChatHandler struct {
+	chatRepo        *repository.ChatRepository
+	carpoolRepo     *repository.CarPoolRepository
+	carpoolRideRepo *repository.CarPoolRideRepository
+	userRepo        *repository.UserRepository
+	hub             *realtime.Hub
+}
+
+func NewChatHandler(chatRepo *repository.ChatRepository, carpoolRepo *repository.CarPoolRepository, carpoolRideRepo *repository.CarPoolRideRepository, userRepo *repository.UserRepository, hub *realtime.Hub) *ChatHandler {
+	return &ChatHandler{
+		chatRepo:        chatRepo,
+		carpoolRepo:     carpoolRepo,
+		carpoolRideRepo: carpoolRideRepo,
+		userRepo:        userRepo,
+		hub:             hub,
+	}
+}
+
+// ListMessages returns a page of the carpool's chat, newest first.
+// Pass next_cursor back as before to fetch older messages, and ride_id to
+// narrow the history to one ride.
+func (h *ChatHandler) ListMessages(w http.ResponseWriter, r *http.Request) {
+	carpoolID, _, ok := requireCarpoolMember(w, r, h.userRepo, h.carpoolRepo)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+
+	var rideID *uuid.UUID
+	if value := query.Get("ride_id"); value != "" {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			http.Error(w, "Invalid ride ID", http.StatusBadRequest)
+			return
+		}
+		rideID = &id
+	}
+
+	var before *repository.PageCursor
+	if value := query.Get("before"); value != "" {
+		cursor, err := decodeCursor(value)
+		if err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		before = cursor
+	}
+
+	limit := defaultChatPageSize
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxChatPageSize {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxChatPageSize), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	messages, err := h.chatRepo.ListMessages(r.Context(), carpoolID, rideID, before, limit)
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to list chat messages: %v\"}", err)
+		http.Error(w, "Failed to list messages", http.StatusInternalServerError)
+		return
+	}
+
+	response := models.ChatHistoryResponse{Messages: messages}
+	if len(messages) == limit {
+		last := messages[len(messages)-1]
+		response.NextCursor = encodeCursor(repository.PageCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// SendMessage posts a message to the carpool's chat and delivers it to connected members
+func (h *ChatHandler) SendMessage(w http.ResponseWriter, r *http.Request) {
+	carpoolID, userID, ok := requireCarpoolMember(w, r, h.userRepo, h.carpoolRepo)
+	if !ok {
+		return
+	}
+
+	var req models.SendChatMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	body, ok := validChatBody(w, req.Body)
+	if !ok {
+		return
+	}
+
+	if req.CarpoolRideID != nil {
+		ride, err := h.carpoolRideRepo.GetCarpoolRide(r.Context(), *req.CarpoolRideID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get ride: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if ride == nil || ride.CarpoolID != carpoolID {
+			http.Error(w, "Ride not found in this carpool", http.StatusBadRequest)
+			return
+		}
+	}
+
+	message := &models.ChatMessage{
+		CarpoolID:     carpoolID,
+		CarpoolRideID: req.CarpoolRideID,
+		SenderID:      userID,
+		Body:          body,
+	}
+
+	if err := h.chatRepo.CreateMessage(r.Context(), message); err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to send chat message: %v\"}", err)
+		http.Error(w, "Failed to send message", http.StatusInternalServerError)
+		return
+	}
+
+	h.hub.Publish(realtime.ChatTopic(carpoolID), "message.created", message)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(message)
+}
+
+// EditMessage changes the body of the sender's own message within the edit window
+func (h *ChatHandler) EditMessage(w http.ResponseWriter, r *http.Request) {
+	carpoolID, userID, ok := requireCarpoolMember(w, r, h.userRepo, h.carpoolRepo)
+	if !ok {
+		return
+	}
+
+	message, ok := h.loadMessage(w, r, carpoolID)
+	if !ok {
+		return
+	}
+	if message.SenderID != userID {
+		http.Error(w, "Only the sender can edit this message", http.StatusForbidden)
+		return
+	}
+
+	var req models.EditChatMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	body, ok := validChatBody(w, req.Body)
+	if !ok {
+		return
+	}
+
+	updated, err := h.chatRepo.EditMessage(r.Context(), message.ID, userID, body, models.ChatEditWindow)
+	if err != nil {
+		if err == repository.ErrChatMessageNotEditable {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to edit chat message: %v\"}", err)
+		http.Error(w, "Failed to edit message", http.StatusInternalServerError)
+		return
+	}
+
+	h.hub.Publish(realtime.ChatTopic(carpoolID), "message.edited", updated)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// DeleteMessage soft-deletes a message. Senders can delete their own messages
+// and carpool admins can delete any message.
+func (h *ChatHandler) DeleteMessage(w http.ResponseWriter, r *http.Request) {
+	carpoolID, userID, ok := requireCarpoolMember(w, r, h.userRepo, h.carpoolRepo)
+	if !ok {
+		return
+	}
+
+	message, ok := h.loadMessage(w, r, carpoolID)
+	if !ok {
+		return
+	}
+	if message.SenderID != userID {
+		admin, err := h.carpoolRepo.IsAdmin(r.Context(), carpoolID, userID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to check permissions: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if !admin {
+			http.Error(w, "Only the sender or a carpool admin can delete this message", http.StatusForbidden)
+			return
+		}
+	}
+
+	deleted, err := h.chatRepo.DeleteMessage(r.Context(), message.ID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Message already deleted", http.StatusConflict)
+			return
+		}
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to delete chat message: %v\"}", err)
+		http.Error(w, "Failed to delete message", http.StatusInternalServerError)
+		return
+	}
+
+	h.hub.Publish(realtime.ChatTopic(carpoolID), "message.deleted", deleted)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// MarkRead records that the member has read the chat up to the given message
+func (h *ChatHandler) MarkRead(w http.ResponseWriter, r *http.Request) {
+	carpoolID, userID, ok := requireCarpoolMember(w, r, h.userRepo, h.carpoolRepo)
+	if !ok {
+		return
+	}
+
+	var req models.MarkChatReadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	message, err := h.chatRepo.GetMessage(r.Context(), req.MessageID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get message: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if message == nil || message.CarpoolID != carpoolID {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+
+	receipt, err := h.chatRepo.MarkRead(r.Context(), carpoolID, userID, message.ID)
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to mark chat read: %v\"}", err)
+		http.Error(w, "Failed to update read receipt", http.StatusInternalServerError)
+		return
+	}
+
+	h.hub.Publish(realtime.ChatTopic(carpoolID), "read_receipt", receipt)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(receipt)
+}
+
+// ListReadReceipts returns how far each member has read the carpool's chat
+func (h *ChatHandler) ListReadReceipts(w http.ResponseWriter, r *http.Request) {
+	carpoolID, _, ok := requireCarpoolMember(w, r, h.userRepo, h.carpoolRepo)
+	if !ok {
+		return
+	}
+
+	receipts, err := h.chatRepo.ListReadReceipts(r.Context(), carpoolID)
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to list read receipts: %v\"}", err)
+		http.Error(w, "Failed to list read receipts", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(receipts)
+}
+
+// loadMessage resolves the {messageID} URL var to a message in the carpool
+func (h *ChatHandler) loadMessage(w http.ResponseWriter, r *http.Request, carpoolID uuid.UUID) (*models.ChatMessage, bool) {
+	messageID, err := uuid.Parse(mux.Vars(r)["messageID"])
+	if err != nil {
+		http.Error(w, "Invalid message ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	message, err := h.chatRepo.GetMessage(r.Context(), messageID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get message: %v", err), http.StatusInternalServerError)
+		return nil, false
+	}
+	if message == nil || message.CarpoolID != carpoolID {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return nil, false
+	}
+	if message.DeletedAt != nil {
+		http.Error(w, "Message has been deleted", http.StatusConflict)
+		return nil, false
+	}
+
+	return message, true
+}
+
+func validChatBody(w http.ResponseWriter, body string) (string, bool) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		http.Error(w, "Message body is required", http.StatusBadRequest)
+		return "", false
+	}
+	if utf8.RuneCountInString(body) > models.ChatMessageMaxLength {
+		http.Error(w, fmt.Sprintf("Messages can be at most %d characters", models.ChatMessageMaxLength), http.StatusBadRequest)
+		return "", false
+	}
+	return body, true
+}
+
+// encodeCursor renders a listing position as an opaque token
+func encodeCursor(cursor repository.PageCursor) string {
+	raw := fmt.Sprintf("%d:%s", cursor.CreatedAt.UnixNano(), cursor.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(token string) (*repository.PageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, err
+	}
+
+	nanos, id, found := strings.Cut(string(raw), ":")
+	if !found {
+		return nil, fmt.Errorf("malformed cursor")
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	messageID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &repository.PageCursor{CreatedAt: time.Unix(0, n), ID: messageID}, nil
+}
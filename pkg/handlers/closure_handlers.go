@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"car-backend/pkg/models"
+	"car-backend/pkg/repository"
+	"car-backend/pkg/services"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// maxClosureUploadBytes caps the size of an uploaded closure calendar
+const maxClosureUploadBytes = 1 << 20
+
+type ClosureHandler struct {
+	closureRepo *repository.ClosureRepository
+	carpoolRepo *repository.CarPoolRepository
+	userRepo    *repository.UserRepository
+}
+
+func NewClosureHandler(closureRepo *repository.ClosureRepository, carpoolRepo *repository.CarPoolRepository, userRepo *repository.UserRepository) *ClosureHandler {
+	return &ClosureHandler{
+		closureRepo: closureRepo,
+		carpoolRepo: carpoolRepo,
+		userRepo:    userRepo,
+	}
+}
+
+// ImportClosures lets a carpool admin upload school closure dates as an .ics or
+// CSV body. The format comes from ?format= or the Content-Type. Upcoming rides on
+// the imported dates are cancelled and members are notified.
+func (h *ClosureHandler) ImportClosures(w http.ResponseWriter, r *http.Request) {
+	carpoolID, userID, ok := requireCarpoolAdmin(w, r, h.userRepo, h.carpoolRepo)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	name := strings.TrimSpace(query.Get("name"))
+	if name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxClosureUploadBytes))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Upload must be at most %d bytes", maxClosureUploadBytes), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	format := query.Get("format")
+	if format == "" {
+		switch contentType := r.Header.Get("Content-Type"); {
+		case strings.HasPrefix(contentType, "text/calendar"):
+			format = "ics"
+		case strings.HasPrefix(contentType, "text/csv"):
+			format = "csv"
+		}
+	}
+
+	calendar := &models.ClosureCalendar{Name: name, CreatedBy: userID}
+	switch format {
+	case "ics":
+		calendar.Dates, calendar.Timezone, err = services.ParseClosureICS(data)
+	case "csv":
+		calendar.Dates, err = services.ParseClosureCSV(data)
+	default:
+		http.Error(w, "format must be ics or csv", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid closure calendar: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	// Dates are local to the school; an explicit timezone wins over the file's,
+	// and the uploader's own timezone is the fallback
+	if tz := query.Get("timezone"); tz != "" {
+		if _, err := time.LoadLocation(tz); err != nil {
+			http.Error(w, "Invalid timezone", http.StatusBadRequest)
+			return
+		}
+		calendar.Timezone = tz
+	}
+	if _, err := time.LoadLocation(calendar.Timezone); calendar.Timezone == "" || err != nil {
+		calendar.Timezone = "UTC"
+		if settings, err := h.userRepo.GetNotificationSettings(r.Context(), userID); err == nil && settings.Timezone != "" {
+			calendar.Timezone = settings.Timezone
+		}
+	}
+
+	cancelled, err := h.closureRepo.CreateCalendar(r.Context(), calendar, carpoolID)
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to import closure calendar: %v\"}", err)
+		http.Error(w, "Failed to import closure calendar", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(models.ClosureImportResponse{
+		Calendar:       *calendar,
+		DatesImported:  len(calendar.Dates),
+		RidesCancelled: cancelled,
+	})
+}
+
+// ListClosures returns the closure calendars attached to the carpool
+func (h *ClosureHandler) ListClosures(w http.ResponseWriter, r *http.Request) {
+	carpoolID, _, ok := requireCarpoolMember(w, r, h.userRepo, h.carpoolRepo)
+	if !ok {
+		return
+	}
+
+	calendars, err := h.closureRepo.ListCarpoolCalendars(r.Context(), carpoolID)
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to list closure calendars: %v\"}", err)
+		http.Error(w, "Failed to list closure calendars", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(calendars)
+}
+
+// AttachClosureCalendar applies a calendar already imported for another carpool,
+// such as a shared school calendar, to this carpool
+func (h *ClosureHandler) AttachClosureCalendar(w http.ResponseWriter, r *http.Request) {
+	carpoolID, userID, ok := requireCarpoolAdmin(w, r, h.userRepo, h.carpoolRepo)
+	if !ok {
+		return
+	}
+
+	calendarID, err := uuid.Parse(mux.Vars(r)["calendarID"])
+	if err != nil {
+		http.Error(w, "Invalid calendar ID", http.StatusBadRequest)
+		return
+	}
+
+	calendar, err := h.closureRepo.GetCalendar(r.Context(), calendarID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get closure calendar: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if calendar == nil {
+		http.Error(w, "Closure calendar not found", http.StatusNotFound)
+		return
+	}
+
+	cancelled, err := h.closureRepo.AttachCalendar(r.Context(), carpoolID, calendar.ID, userID)
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to attach closure calendar: %v\"}", err)
+		http.Error(w, "Failed to attach closure calendar", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.AttachClosureCalendarResponse{CalendarID: calendar.ID, RidesCancelled: cancelled})
+}
+
+// DetachClosureCalendar stops applying a calendar to the carpool
+func (h *ClosureHandler) DetachClosureCalendar(w http.ResponseWriter, r *http.Request) {
+	carpoolID, _, ok := requireCarpoolAdmin(w, r, h.userRepo, h.carpoolRepo)
+	if !ok {
+		return
+	}
+
+	calendarID, err := uuid.Parse(mux.Vars(r)["calendarID"])
+	if err != nil {
+		http.Error(w, "Invalid calendar ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.closureRepo.DetachCalendar(r.Context(), carpoolID, calendarID); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Closure calendar is not attached to this carpool", http.StatusNotFound)
+			return
+		}
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to detach closure calendar: %v\"}", err)
+		http.Error(w, "Failed to detach closure calendar", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,399 @@
+package handlers
+
+import (
+	"car-backend/pkg/models"
+	"car-backend/pkg/realtime"
+	"car-backend/pkg/repository"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+type DirectMessageHandler struct {
+	dmRepo     *repository.DirectMessageRepository
+	blockRepo  *repository.BlockRepository
+	reportRepo *repository.ReportRepository
+	userRepo   *repository.UserRepository
+	hub        *realtime.Hub
+}
+
+func NewDirectMessageHandler(dmRepo *repository.DirectMessageRepository, blockRepo *repository.BlockRepository, reportRepo *repository.ReportRepository, userRepo *repository.UserRepository, hub *realtime.Hub) *DirectMessageHandler {
+	return &DirectMessageHandler{
+		dmRepo:     dmRepo,
+		blockRepo:  blockRepo,
+		reportRepo: reportRepo,
+		userRepo:   userRepo,
+		hub:        hub,
+	}
+}
+
+// StartConversation opens, or returns the existing, conversation with another user.
+// The users must share a carpool or a pending invite and must not have blocked each other.
+func (h *DirectMessageHandler) StartConversation(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r, h.userRepo)
+	if !ok {
+		return
+	}
+
+	var req models.StartConversationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.UserID == uuid.Nil || req.UserID == userID {
+		http.Error(w, "A different user is required", http.StatusBadRequest)
+		return
+	}
+
+	if !h.canMessage(w, r, userID, req.UserID) {
+		return
+	}
+
+	conversation, err := h.dmRepo.GetOrCreateConversation(r.Context(), userID, req.UserID)
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to start conversation: %v\"}", err)
+		http.Error(w, "Failed to start conversation", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(conversation)
+}
+
+// ListConversations returns the current user's conversations with unread counts
+func (h *DirectMessageHandler) ListConversations(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r, h.userRepo)
+	if !ok {
+		return
+	}
+
+	conversations, err := h.dmRepo.ListConversations(r.Context(), userID)
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to list conversations: %v\"}", err)
+		http.Error(w, "Failed to list conversations", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(conversations)
+}
+
+// ListMessages returns a page of the conversation, newest first
+func (h *DirectMessageHandler) ListMessages(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r, h.userRepo)
+	if !ok {
+		return
+	}
+
+	conversation, ok := h.loadConversation(w, r, userID)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+
+	var before *repository.PageCursor
+	if value := query.Get("before"); value != "" {
+		cursor, err := decodeCursor(value)
+		if err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		before = cursor
+	}
+
+	limit := defaultChatPageSize
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxChatPageSize {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxChatPageSize), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	messages, err := h.dmRepo.ListMessages(r.Context(), conversation.ID, before, limit)
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to list direct messages: %v\"}", err)
+		http.Error(w, "Failed to list messages", http.StatusInternalServerError)
+		return
+	}
+
+	response := models.DirectMessageHistoryResponse{Messages: messages}
+	if len(messages) == limit {
+		last := messages[len(messages)-1]
+		response.NextCursor = encodeCursor(repository.PageCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// SendMessage sends a direct message and delivers it to the other participant if connected
+func (h *DirectMessageHandler) SendMessage(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r, h.userRepo)
+	if !ok {
+		return
+	}
+
+	conversation, ok := h.loadConversation(w, r, userID)
+	if !ok {
+		return
+	}
+
+	var req models.SendDirectMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	body, ok := validChatBody(w, req.Body)
+	if !ok {
+		return
+	}
+
+	if !h.canMessage(w, r, userID, conversation.Other(userID)) {
+		return
+	}
+
+	message := &models.DirectMessage{
+		ConversationID: conversation.ID,
+		SenderID:       userID,
+		Body:           body,
+	}
+
+	if err := h.dmRepo.CreateMessage(r.Context(), message); err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to send direct message: %v\"}", err)
+		http.Error(w, "Failed to send message", http.StatusInternalServerError)
+		return
+	}
+
+	h.hub.Publish(realtime.ConversationTopic(conversation.ID), "message.created", message)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(message)
+}
+
+// MarkRead marks the other participant's messages in the conversation as read
+func (h *DirectMessageHandler) MarkRead(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r, h.userRepo)
+	if !ok {
+		return
+	}
+
+	conversation, ok := h.loadConversation(w, r, userID)
+	if !ok {
+		return
+	}
+
+	marked, err := h.dmRepo.MarkConversationRead(r.Context(), conversation.ID, userID)
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to mark conversation read: %v\"}", err)
+		http.Error(w, "Failed to mark conversation read", http.StatusInternalServerError)
+		return
+	}
+
+	if marked > 0 {
+		h.hub.Publish(realtime.ConversationTopic(conversation.ID), "read", map[string]uuid.UUID{"user_id": userID})
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ReportMessage puts a message the current user received into the moderation queue
+func (h *DirectMessageHandler) ReportMessage(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r, h.userRepo)
+	if !ok {
+		return
+	}
+
+	conversation, ok := h.loadConversation(w, r, userID)
+	if !ok {
+		return
+	}
+
+	messageID, err := uuid.Parse(mux.Vars(r)["messageID"])
+	if err != nil {
+		http.Error(w, "Invalid message ID", http.StatusBadRequest)
+		return
+	}
+
+	message, err := h.dmRepo.GetMessage(r.Context(), messageID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get message: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if message == nil || message.ConversationID != conversation.ID {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+	if message.SenderID == userID {
+		http.Error(w, "You cannot report your own message", http.StatusBadRequest)
+		return
+	}
+
+	var req models.CreateMessageReportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		http.Error(w, "A reason is required", http.StatusBadRequest)
+		return
+	}
+
+	report := &models.MessageReport{
+		DirectMessageID: message.ID,
+		ReporterID:      userID,
+		ReportedUserID:  message.SenderID,
+		Reason:          req.Reason,
+	}
+
+	if err := h.reportRepo.CreateReport(r.Context(), report); err != nil {
+		if err == repository.ErrAlreadyReported {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to report message: %v\"}", err)
+		http.Error(w, "Failed to report message", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(report)
+}
+
+// BlockUser blocks the {id} user from messaging or inviting the current user
+func (h *DirectMessageHandler) BlockUser(w http.ResponseWriter, r *http.Request) {
+	userID, blockedID, ok := h.parseBlockPath(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := h.userRepo.GetByID(r.Context(), blockedID.String()); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Failed to get user: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.blockRepo.Block(r.Context(), userID, blockedID); err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to block user: %v\"}", err)
+		http.Error(w, "Failed to block user", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UnblockUser removes the current user's block on the {id} user
+func (h *DirectMessageHandler) UnblockUser(w http.ResponseWriter, r *http.Request) {
+	userID, blockedID, ok := h.parseBlockPath(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.blockRepo.Unblock(r.Context(), userID, blockedID); err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to unblock user: %v\"}", err)
+		http.Error(w, "Failed to unblock user", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListBlocks returns the users the current user has blocked
+func (h *DirectMessageHandler) ListBlocks(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r, h.userRepo)
+	if !ok {
+		return
+	}
+
+	blocks, err := h.blockRepo.ListBlocks(r.Context(), userID)
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to list blocks: %v\"}", err)
+		http.Error(w, "Failed to list blocked users", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(blocks)
+}
+
+// canMessage checks neither user has blocked the other and that they share a
+// carpool or pending invite. It writes the error response when they cannot.
+func (h *DirectMessageHandler) canMessage(w http.ResponseWriter, r *http.Request, userID, otherID uuid.UUID) bool {
+	blocked, err := h.blockRepo.IsBlocked(r.Context(), userID, otherID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to check blocks: %v", err), http.StatusInternalServerError)
+		return false
+	}
+	if blocked {
+		http.Error(w, "You cannot message this user", http.StatusForbidden)
+		return false
+	}
+
+	shared, err := h.dmRepo.HasSharedContext(r.Context(), userID, otherID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to check shared carpools: %v", err), http.StatusInternalServerError)
+		return false
+	}
+	if !shared {
+		http.Error(w, "You can only message people you share a carpool or invite with", http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
+
+// loadConversation resolves the {id} URL var to a conversation the user takes part in
+func (h *DirectMessageHandler) loadConversation(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (*models.Conversation, bool) {
+	conversationID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid conversation ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	conversation, err := h.dmRepo.GetConversation(r.Context(), conversationID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get conversation: %v", err), http.StatusInternalServerError)
+		return nil, false
+	}
+	if conversation == nil || !conversation.Includes(userID) {
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return conversation, true
+}
+
+func (h *DirectMessageHandler) parseBlockPath(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, bool) {
+	userID, ok := requireUser(w, r, h.userRepo)
+	if !ok {
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	otherID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return uuid.Nil, uuid.Nil, false
+	}
+	if otherID == userID {
+		http.Error(w, "You cannot block yourself", http.StatusBadRequest)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	return userID, otherID, true
+}
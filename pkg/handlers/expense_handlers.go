@@ -0,0 +1,565 @@
+package handlers
+
+import (
+	"car-backend/pkg/models"
+	"car-backend/pkg/repository"
+	"car-backend/pkg/services"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultExpensePageSize = 25
+	maxExpensePageSize     = 100
+	// maxExpenseAmountMinor caps a single expense or settlement, in minor units
+	maxExpenseAmountMinor = 10_000_000
+	// maxMemberSeats caps the seats a member can claim for per-seat splits
+	maxMemberSeats = 8
+)
+
+var currencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+
+type ExpenseHandler struct {
+	expenseRepo     *repository.ExpenseRepository
+	carpoolRepo     *repository.CarPoolRepository
+	carpoolRideRepo *repository.CarPoolRideRepository
+	userRepo        *repository.UserRepository
+}
+
+func NewExpenseHandler(expenseRepo *repository.ExpenseRepository, carpoolRepo *repository.CarPoolRepository, carpoolRideRepo *repository.CarPoolRideRepository, userRepo *repository.UserRepository) *ExpenseHandler {
+	return &ExpenseHandler{
+		expenseRepo:     expenseRepo,
+		carpoolRepo:     carpoolRepo,
+		carpoolRideRepo: carpoolRideRepo,
+		userRepo:        userRepo,
+	}
+}
+
+// LogExpense records a cost the driver paid for a completed ride and splits it
+// among the riders by the requested rule, or the carpool's default
+func (h *ExpenseHandler) LogExpense(w http.ResponseWriter, r *http.Request) {
+	ride, userID, ok := requireCarpoolRide(w, r, h.userRepo, h.carpoolRepo, h.carpoolRideRepo)
+	if !ok {
+		return
+	}
+	if ride.DriverID != userID {
+		http.Error(w, "Only the ride's driver can log expenses", http.StatusForbidden)
+		return
+	}
+	// Riders are only charged for a ride that actually happened
+	if ride.Status != models.RideStatusCompleted {
+		http.Error(w, "Expenses can only be logged for completed rides", http.StatusConflict)
+		return
+	}
+
+	var req models.CreateExpenseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	req.Category = strings.ToUpper(req.Category)
+	switch req.Category {
+	case models.ExpenseCategoryFuel, models.ExpenseCategoryToll, models.ExpenseCategoryParking, models.ExpenseCategoryOther:
+	default:
+		http.Error(w, "category must be fuel, toll, parking or other", http.StatusBadRequest)
+		return
+	}
+	if req.AmountMinor <= 0 || req.AmountMinor > maxExpenseAmountMinor {
+		http.Error(w, fmt.Sprintf("amount_minor must be between 1 and %d", maxExpenseAmountMinor), http.StatusBadRequest)
+		return
+	}
+	req.Description = strings.TrimSpace(req.Description)
+	if len(req.Description) > models.MaxExpenseDescriptionLength {
+		http.Error(w, fmt.Sprintf("description must be at most %d characters", models.MaxExpenseDescriptionLength), http.StatusBadRequest)
+		return
+	}
+
+	settings, err := h.expenseRepo.GetSettings(r.Context(), ride.CarpoolID)
+	if err != nil || settings == nil {
+		http.Error(w, fmt.Sprintf("Failed to get expense settings: %v", err), http.StatusInternalServerError)
+		return
+	}
+	currency, ok := parseCurrency(w, req.Currency, settings.Currency)
+	if !ok {
+		return
+	}
+	rule, ok := parseSplitRule(w, req.SplitRule, settings.SplitRule)
+	if !ok {
+		return
+	}
+
+	seats, err := h.expenseRepo.MemberSeats(r.Context(), ride.CarpoolID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get member seats: %v", err), http.StatusInternalServerError)
+		return
+	}
+	shares, rule, err := services.SplitExpense(req.AmountMinor, rule, ride, seats)
+	if err != nil {
+		http.Error(w, "Ride has no riders to split the expense with", http.StatusConflict)
+		return
+	}
+
+	expense := &models.Expense{
+		CarpoolID:     ride.CarpoolID,
+		CarpoolRideID: ride.ID,
+		PayerID:       userID,
+		Category:      req.Category,
+		AmountMinor:   req.AmountMinor,
+		Currency:      currency,
+		SplitRule:     rule,
+		Description:   req.Description,
+		Shares:        shares,
+	}
+	if err := h.expenseRepo.CreateExpense(r.Context(), expense); err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to log expense: %v\"}", err)
+		http.Error(w, "Failed to log expense", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(expense)
+}
+
+// ListRideExpenses returns every expense logged against the ride
+func (h *ExpenseHandler) ListRideExpenses(w http.ResponseWriter, r *http.Request) {
+	ride, _, ok := requireCarpoolRide(w, r, h.userRepo, h.carpoolRepo, h.carpoolRideRepo)
+	if !ok {
+		return
+	}
+
+	expenses, err := h.expenseRepo.ListExpenses(r.Context(), ride.CarpoolID, &ride.ID, nil, maxExpensePageSize)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list expenses: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.ExpenseListResponse{Expenses: expenses})
+}
+
+// ListExpenses returns a page of the carpool's expenses, newest first
+func (h *ExpenseHandler) ListExpenses(w http.ResponseWriter, r *http.Request) {
+	carpoolID, _, ok := requireCarpoolMember(w, r, h.userRepo, h.carpoolRepo)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	var before *repository.PageCursor
+	if value := query.Get("before"); value != "" {
+		cursor, err := decodeCursor(value)
+		if err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		before = cursor
+	}
+
+	limit := defaultExpensePageSize
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxExpensePageSize {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxExpensePageSize), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	expenses, err := h.expenseRepo.ListExpenses(r.Context(), carpoolID, nil, before, limit)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list expenses: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	response := models.ExpenseListResponse{Expenses: expenses}
+	if len(expenses) == limit {
+		last := expenses[len(expenses)-1]
+		response.NextCursor = encodeCursor(repository.PageCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// DeleteExpense removes an expense logged in error. Only its payer can delete it.
+func (h *ExpenseHandler) DeleteExpense(w http.ResponseWriter, r *http.Request) {
+	carpoolID, userID, ok := requireCarpoolMember(w, r, h.userRepo, h.carpoolRepo)
+	if !ok {
+		return
+	}
+
+	expenseID, err := uuid.Parse(mux.Vars(r)["expenseID"])
+	if err != nil {
+		http.Error(w, "Invalid expense ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.expenseRepo.DeleteExpense(r.Context(), carpoolID, expenseID, userID); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Expense not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Failed to delete expense: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetExpenseSettings returns the carpool's default split rule and currency
+func (h *ExpenseHandler) GetExpenseSettings(w http.ResponseWriter, r *http.Request) {
+	carpoolID, _, ok := requireCarpoolMember(w, r, h.userRepo, h.carpoolRepo)
+	if !ok {
+		return
+	}
+
+	settings, err := h.expenseRepo.GetSettings(r.Context(), carpoolID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get expense settings: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if settings == nil {
+		http.Error(w, "Carpool not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+// UpdateExpenseSettings changes the carpool's default split rule and currency.
+// Admins only; expenses already logged are not re-split.
+func (h *ExpenseHandler) UpdateExpenseSettings(w http.ResponseWriter, r *http.Request) {
+	carpoolID, _, ok := requireCarpoolAdmin(w, r, h.userRepo, h.carpoolRepo)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateExpenseSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.SplitRule != nil {
+		rule, ok := parseSplitRule(w, *req.SplitRule, "")
+		if !ok {
+			return
+		}
+		req.SplitRule = &rule
+	}
+	if req.Currency != nil {
+		currency, ok := parseCurrency(w, *req.Currency, "")
+		if !ok {
+			return
+		}
+		req.Currency = &currency
+	}
+
+	settings, err := h.expenseRepo.UpdateSettings(r.Context(), carpoolID, &req)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to update expense settings: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+// UpdateMySeats sets how many seats the current member takes, which weights
+// their share of expenses split per seat
+func (h *ExpenseHandler) UpdateMySeats(w http.ResponseWriter, r *http.Request) {
+	carpoolID, userID, ok := requireCarpoolMember(w, r, h.userRepo, h.carpoolRepo)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateMemberSeatsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Seats < 1 || req.Seats > maxMemberSeats {
+		http.Error(w, fmt.Sprintf("seats must be between 1 and %d", maxMemberSeats), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.expenseRepo.SetMemberSeats(r.Context(), carpoolID, userID, req.Seats); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Only carpool members can perform this action", http.StatusForbidden)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Failed to update seats: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetBalances returns every member's running balance and the transfers that
+// would settle them all
+func (h *ExpenseHandler) GetBalances(w http.ResponseWriter, r *http.Request) {
+	carpoolID, _, ok := requireCarpoolMember(w, r, h.userRepo, h.carpoolRepo)
+	if !ok {
+		return
+	}
+
+	balances, err := h.expenseRepo.Balances(r.Context(), carpoolID)
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to get balances: %v\"}", err)
+		http.Error(w, "Failed to get balances", http.StatusInternalServerError)
+		return
+	}
+	if balances == nil {
+		balances = []models.MemberBalance{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.BalancesResponse{
+		Balances:  balances,
+		Transfers: services.SettleUp(balances),
+	})
+}
+
+// RecordSettlement records that the current user paid another member to settle
+// up. It stays pending, and out of the balances, until that member confirms it.
+func (h *ExpenseHandler) RecordSettlement(w http.ResponseWriter, r *http.Request) {
+	carpoolID, userID, ok := requireCarpoolMember(w, r, h.userRepo, h.carpoolRepo)
+	if !ok {
+		return
+	}
+
+	var req models.CreateSettlementRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	currency, ok := validateSettlement(w, r, h.expenseRepo, h.carpoolRepo, carpoolID, userID, req.ToUserID, req.AmountMinor, req.Currency)
+	if !ok {
+		return
+	}
+
+	settlement := &models.Settlement{
+		CarpoolID:   carpoolID,
+		FromUserID:  userID,
+		ToUserID:    req.ToUserID,
+		AmountMinor: req.AmountMinor,
+		Currency:    currency,
+		Status:      models.SettlementStatusPending,
+	}
+	if err := h.expenseRepo.CreateSettlement(r.Context(), settlement); err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to record settlement: %v\"}", err)
+		http.Error(w, "Failed to record settlement", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(settlement)
+}
+
+// ListSettlements returns the carpool's settlements, newest first. ?status=pending
+// shows those still waiting for the payee to confirm them.
+func (h *ExpenseHandler) ListSettlements(w http.ResponseWriter, r *http.Request) {
+	carpoolID, _, ok := requireCarpoolMember(w, r, h.userRepo, h.carpoolRepo)
+	if !ok {
+		return
+	}
+
+	status := strings.ToUpper(r.URL.Query().Get("status"))
+	switch status {
+	case "", models.SettlementStatusPending, models.SettlementStatusConfirmed, models.SettlementStatusRejected:
+	default:
+		http.Error(w, "status must be pending, confirmed or rejected", http.StatusBadRequest)
+		return
+	}
+
+	settlements, err := h.expenseRepo.ListSettlements(r.Context(), carpoolID, status)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list settlements: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settlements)
+}
+
+// ConfirmSettlement lets the member a settlement says was paid confirm they
+// received the money, so it counts towards balances
+func (h *ExpenseHandler) ConfirmSettlement(w http.ResponseWriter, r *http.Request) {
+	h.decideSettlement(w, r, models.SettlementStatusConfirmed)
+}
+
+// RejectSettlement lets the member a settlement says was paid dispute it. It
+// never counts towards balances.
+func (h *ExpenseHandler) RejectSettlement(w http.ResponseWriter, r *http.Request) {
+	h.decideSettlement(w, r, models.SettlementStatusRejected)
+}
+
+func (h *ExpenseHandler) decideSettlement(w http.ResponseWriter, r *http.Request, status string) {
+	settlement, userID, ok := h.loadSettlement(w, r)
+	if !ok {
+		return
+	}
+	if settlement.ToUserID != userID {
+		http.Error(w, "Only the member who was paid can confirm or reject a settlement", http.StatusForbidden)
+		return
+	}
+
+	if err := h.expenseRepo.DecideSettlement(r.Context(), settlement, status); err != nil {
+		if err == repository.ErrSettlementNotPending {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Failed to update settlement: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settlement)
+}
+
+// DeleteSettlement lets the payer withdraw a settlement recorded in error,
+// while it is still pending
+func (h *ExpenseHandler) DeleteSettlement(w http.ResponseWriter, r *http.Request) {
+	settlement, userID, ok := h.loadSettlement(w, r)
+	if !ok {
+		return
+	}
+	if settlement.FromUserID != userID {
+		http.Error(w, "Only the member who paid can withdraw a settlement", http.StatusForbidden)
+		return
+	}
+
+	if err := h.expenseRepo.DeleteSettlement(r.Context(), settlement.ID, userID); err != nil {
+		if err == repository.ErrSettlementNotPending {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Failed to delete settlement: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// loadSettlement fetches the settlement from the URL and checks it belongs to
+// the carpool the current user is a member of. Members who have left can still
+// be paid, so the payee only needs to be a party to the settlement.
+func (h *ExpenseHandler) loadSettlement(w http.ResponseWriter, r *http.Request) (*models.Settlement, uuid.UUID, bool) {
+	userID, ok := requireUser(w, r, h.userRepo)
+	if !ok {
+		return nil, uuid.Nil, false
+	}
+
+	carpoolID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid carpool ID", http.StatusBadRequest)
+		return nil, uuid.Nil, false
+	}
+	settlementID, err := uuid.Parse(mux.Vars(r)["settlementID"])
+	if err != nil {
+		http.Error(w, "Invalid settlement ID", http.StatusBadRequest)
+		return nil, uuid.Nil, false
+	}
+
+	settlement, err := h.expenseRepo.GetSettlement(r.Context(), settlementID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get settlement: %v", err), http.StatusInternalServerError)
+		return nil, uuid.Nil, false
+	}
+	if settlement == nil || settlement.CarpoolID != carpoolID ||
+		(settlement.FromUserID != userID && settlement.ToUserID != userID) {
+		http.Error(w, "Settlement not found", http.StatusNotFound)
+		return nil, uuid.Nil, false
+	}
+
+	return settlement, userID, true
+}
+
+// validateSettlement checks a payment from one member to another, defaulting
+// the currency to the carpool's. Members who have left can still be paid what
+// they are owed.
+func validateSettlement(w http.ResponseWriter, r *http.Request, expenseRepo *repository.ExpenseRepository, carpoolRepo *repository.CarPoolRepository, carpoolID, fromUserID, toUserID uuid.UUID, amountMinor int64, currency string) (string, bool) {
+	if toUserID == uuid.Nil || toUserID == fromUserID {
+		http.Error(w, "to_user_id must be another member", http.StatusBadRequest)
+		return "", false
+	}
+	if amountMinor <= 0 || amountMinor > maxExpenseAmountMinor {
+		http.Error(w, fmt.Sprintf("amount_minor must be between 1 and %d", maxExpenseAmountMinor), http.StatusBadRequest)
+		return "", false
+	}
+
+	settings, err := expenseRepo.GetSettings(r.Context(), carpoolID)
+	if err != nil || settings == nil {
+		http.Error(w, fmt.Sprintf("Failed to get expense settings: %v", err), http.StatusInternalServerError)
+		return "", false
+	}
+	currency, ok := parseCurrency(w, currency, settings.Currency)
+	if !ok {
+		return "", false
+	}
+
+	member, err := carpoolRepo.IsMember(r.Context(), carpoolID, toUserID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to check membership: %v", err), http.StatusInternalServerError)
+		return "", false
+	}
+	if !member {
+		balances, err := expenseRepo.Balances(r.Context(), carpoolID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get balances: %v", err), http.StatusInternalServerError)
+			return "", false
+		}
+		for _, b := range balances {
+			if b.UserID == toUserID && b.Currency == currency && b.NetMinor > 0 {
+				member = true
+				break
+			}
+		}
+	}
+	if !member {
+		http.Error(w, "to_user_id must be another member", http.StatusBadRequest)
+		return "", false
+	}
+
+	return currency, true
+}
+
+// parseCurrency validates an ISO 4217 code, using def when value is empty
+func parseCurrency(w http.ResponseWriter, value, def string) (string, bool) {
+	currency := strings.ToUpper(strings.TrimSpace(value))
+	if currency == "" {
+		currency = def
+	}
+	if !currencyCode.MatchString(currency) {
+		http.Error(w, "currency must be a three letter ISO 4217 code", http.StatusBadRequest)
+		return "", false
+	}
+	return currency, true
+}
+
+// parseSplitRule validates a split rule, using def when value is empty
+func parseSplitRule(w http.ResponseWriter, value, def string) (string, bool) {
+	rule := strings.ToUpper(strings.TrimSpace(value))
+	if rule == "" {
+		rule = def
+	}
+	switch rule {
+	case models.SplitRuleEqual, models.SplitRulePerMile, models.SplitRulePerSeat:
+		return rule, true
+	}
+	http.Error(w, "split_rule must be equal, per_mile or per_seat", http.StatusBadRequest)
+	return "", false
+}
@@ -10,19 +10,40 @@ import (
 	"github.com/gorilla/mux"
 	"fmt"
 	"database/sql"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type InviteHandler struct {
-	inviteRepo *repository.InviteRepository
+	inviteRepo  *repository.InviteRepository
+	userRepo    *repository.UserRepository
+	carpoolRepo *repository.CarPoolRepository
+	blockRepo   *repository.BlockRepository
+
+	// InviteTTL is how long a new invite stays pending before it expires
+	InviteTTL time.Duration
+	// DailyLimit caps how many invites one user can send per 24 hours; 0 disables it
+	DailyLimit int
 }
 
-func NewInviteHandler(repo *repository.InviteRepository) *InviteHandler {
+func NewInviteHandler(repo *repository.InviteRepository, userRepo *repository.UserRepository, carpoolRepo *repository.CarPoolRepository, blockRepo *repository.BlockRepository) *InviteHandler {
 	return &InviteHandler{
-		inviteRepo: repo,
+		inviteRepo:  repo,
+		userRepo:    userRepo,
+		carpoolRepo: carpoolRepo,
+		blockRepo:   blockRepo,
+		InviteTTL:   14 * 24 * time.Hour,
+		DailyLimit:  50,
 	}
 }
 
 func (h *InviteHandler) CreateInvite(w http.ResponseWriter, r *http.Request) {
+    userID, ok := requireUser(w, r, h.userRepo)
+    if !ok {
+            return
+    }
+
     var req models.CreateInviteRequest
     if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
             log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to decode request: %v\"}", err)
@@ -30,50 +51,267 @@ func (h *InviteHandler) CreateInvite(w http.ResponseWriter, r *http.Request) {
             return
     }
 
-    // Placeholder: Replace with actual user ID retrieval logic
-    userID, _ := uuid.Parse("user-123") 
+    recipients := 0
+    for _, set := range []bool{req.ToUser != nil, req.ToEmail != "", req.ToPhone != ""} {
+            if set {
+                    recipients++
+            }
+    }
+    if recipients != 1 {
+            http.Error(w, "Exactly one of to_user, to_email or to_phone is required", http.StatusBadRequest)
+            return
+    }
+
+    admin, err := h.carpoolRepo.IsAdmin(r.Context(), req.CarpoolID, userID)
+    if err != nil {
+            http.Error(w, fmt.Sprintf("Failed to check permissions: %v", err), http.StatusInternalServerError)
+            return
+    }
+    if !admin {
+            http.Error(w, "Only carpool admins can send invites", http.StatusForbidden)
+            return
+    }
 
     // Create Invite object
     invite := &models.Invite{
-            FromUser:  userID, 
+            FromUser:  userID,
             ToUser:    req.ToUser,
+            ToEmail:   strings.TrimSpace(req.ToEmail),
+            ToPhone:   strings.TrimSpace(req.ToPhone),
             CarpoolID: req.CarpoolID,
             Message:   req.Message,
-            Status:    0, // Initial status: pending
+            Status:    models.InviteStatusPending,
+            ExpiresAt: time.Now().Add(h.InviteTTL),
     }
 
-    if err := h.inviteRepo.CreateInvite(r.Context(), invite); err != nil {
+    // Address the invite directly when the email already belongs to a user
+    if invite.ToEmail != "" {
+            if user, err := h.userRepo.GetByEmail(r.Context(), invite.ToEmail); err == nil {
+                    invite.ToUser = &user.ID
+            } else if err != sql.ErrNoRows {
+                    http.Error(w, fmt.Sprintf("Failed to look up recipient: %v", err), http.StatusInternalServerError)
+                    return
+            }
+    }
+
+    if invite.ToUser != nil {
+            blocked, err := h.blockRepo.IsBlocked(r.Context(), userID, *invite.ToUser)
+            if err != nil {
+                    http.Error(w, fmt.Sprintf("Failed to check blocks: %v", err), http.StatusInternalServerError)
+                    return
+            }
+            if blocked {
+                    http.Error(w, "You cannot invite this user", http.StatusForbidden)
+                    return
+            }
+    }
+
+    if err := h.inviteRepo.CreateInvite(r.Context(), invite, h.DailyLimit); err != nil {
+            switch err {
+            case repository.ErrDuplicateInvite:
+                    http.Error(w, err.Error(), http.StatusConflict)
+                    return
+            case repository.ErrInviteLimitReached:
+                    http.Error(w, err.Error(), http.StatusTooManyRequests)
+                    return
+            }
             log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to create invite: %v\"}", err)
             http.Error(w, "Failed to create invite", http.StatusInternalServerError)
             return
     }
 
-    w.WriteHeader(http.StatusCreated) 
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(http.StatusCreated)
+    json.NewEncoder(w).Encode(invite)
 }
 
-
+// GetInvite returns an invite to its sender or recipient
 func (h *InviteHandler) GetInvite(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+	userID, ok := requireUser(w, r, h.userRepo)
+	if !ok {
+		return
+	}
 
-	vars := mux.Vars(r)
-	inviteIDStr := vars["id"]
+	inviteID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid invite ID", http.StatusBadRequest)
+		return
+	}
 
-	inviteID, err := uuid.Parse(inviteIDStr)
+	invite, err := h.inviteRepo.GetInvite(r.Context(), inviteID)
 	if err != nil {
-			http.Error(w, "Invalid invite ID", http.StatusBadRequest)
+		http.Error(w, fmt.Sprintf("Failed to get invite: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if invite == nil {
+		http.Error(w, "Invite not found", http.StatusNotFound)
+		return
+	}
+	if invite.FromUser != userID && (invite.ToUser == nil || *invite.ToUser != userID) {
+		http.Error(w, "Only the sender or recipient can view this invite", http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(invite)
+}
+
+var inviteStatusNames = map[string]int{
+	"pending":   models.InviteStatusPending,
+	"accepted":  models.InviteStatusAccepted,
+	"rejected":  models.InviteStatusRejected,
+	"withdrawn": models.InviteStatusWithdrawn,
+	"expired":   models.InviteStatusExpired,
+}
+
+// ListInvites returns the invites the current user received and sent.
+// Supports box, status, carpool_id, limit and offset query parameters.
+func (h *InviteHandler) ListInvites(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r, h.userRepo)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	filter := models.InviteListFilter{Limit: 20}
+
+	switch box := query.Get("box"); box {
+	case "", models.InviteBoxReceived, models.InviteBoxSent:
+		filter.Box = box
+	default:
+		http.Error(w, "box must be received or sent", http.StatusBadRequest)
+		return
+	}
+
+	if value := query.Get("status"); value != "" {
+		status, found := inviteStatusNames[strings.ToLower(value)]
+		if !found {
+			http.Error(w, "status must be pending, accepted, rejected, withdrawn or expired", http.StatusBadRequest)
+			return
+		}
+		filter.Status = &status
+	}
+
+	if value := query.Get("carpool_id"); value != "" {
+		carpoolID, err := uuid.Parse(value)
+		if err != nil {
+			http.Error(w, "Invalid carpool ID", http.StatusBadRequest)
+			return
+		}
+		filter.CarpoolID = &carpoolID
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > 100 {
+			http.Error(w, "limit must be between 1 and 100", http.StatusBadRequest)
 			return
+		}
+		filter.Limit = limit
+	}
+
+	if value := query.Get("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			http.Error(w, "offset must be zero or more", http.StatusBadRequest)
+			return
+		}
+		filter.Offset = offset
+	}
+
+	invites, total, err := h.inviteRepo.ListInvites(r.Context(), userID, filter)
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to list invites: %v\"}", err)
+		http.Error(w, "Failed to list invites", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.InviteListResponse{
+		Invites: invites,
+		Total:   total,
+		Limit:   filter.Limit,
+		Offset:  filter.Offset,
+	})
+}
+
+// WithdrawInvite lets the sender retract a pending invite
+func (h *InviteHandler) WithdrawInvite(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r, h.userRepo)
+	if !ok {
+		return
+	}
+
+	inviteID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid invite ID", http.StatusBadRequest)
+		return
 	}
 
 	invite, err := h.inviteRepo.GetInvite(r.Context(), inviteID)
 	if err != nil {
-			if err == sql.ErrNoRows {
-					http.Error(w, "Invite not found", http.StatusNotFound)
-					return
-			}
-			http.Error(w, fmt.Sprintf("Failed to get invite: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Failed to get invite: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if invite == nil {
+		http.Error(w, "Invite not found", http.StatusNotFound)
+		return
+	}
+	if invite.FromUser != userID {
+		http.Error(w, "Only the sender can withdraw this invite", http.StatusForbidden)
+		return
+	}
+
+	if err := h.inviteRepo.WithdrawInvite(r.Context(), invite.ID, userID); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Only pending invites can be withdrawn", http.StatusConflict)
 			return
+		}
+		http.Error(w, fmt.Sprintf("Failed to withdraw invite: %v", err), http.StatusInternalServerError)
+		return
 	}
 
-	json.NewEncoder(w).Encode(invite)
+	w.WriteHeader(http.StatusNoContent)
 }
 
+// RespondToInvite lets the recipient accept or reject a pending invite.
+// Accepting adds them to the carpool and tells the sender.
+func (h *InviteHandler) RespondToInvite(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r, h.userRepo)
+	if !ok {
+		return
+	}
+
+	inviteID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid invite ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.UpdateInviteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Status != models.InviteStatusAccepted && req.Status != models.InviteStatusRejected {
+		http.Error(w, "status must be 1 (accepted) or 2 (rejected)", http.StatusBadRequest)
+		return
+	}
+
+	invite, err := h.inviteRepo.RespondToInvite(r.Context(), inviteID, userID, req.Status)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			http.Error(w, "Invite not found", http.StatusNotFound)
+		case repository.ErrInviteNotPending, repository.ErrNoSeatsAvailable:
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to respond to invite: %v\"}", err)
+			http.Error(w, "Failed to respond to invite", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(invite)
+}
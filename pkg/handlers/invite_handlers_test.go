@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"bytes"
+	"car-backend/pkg/models"
+	"car-backend/pkg/repository"
+	"car-backend/pkg/services"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/clerk/clerk-sdk-go/v2"
+	"github.com/google/uuid"
+	_ "github.com/lib/pq"
+)
+
+// testDB opens TEST_DATABASE_URL in a fresh schema with every migration
+// applied, and drops the schema when the test ends. Tests that need Postgres
+// are skipped when it is not set.
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		t.Fatalf("failed to create schema: %v", err)
+	}
+	t.Cleanup(func() { admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`) })
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatalf("TEST_DATABASE_URL must be a URL: %v", err)
+	}
+	query := u.Query()
+	query.Set("search_path", schema)
+	u.RawQuery = query.Encode()
+
+	db, err := sql.Open("postgres", u.String())
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	files, err := filepath.Glob(filepath.Join("..", "..", "migrations", "*.sql"))
+	if err != nil {
+		t.Fatalf("failed to list migrations: %v", err)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		migration, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", file, err)
+		}
+		if _, err := db.Exec(string(migration)); err != nil {
+			t.Fatalf("failed to apply %s: %v", filepath.Base(file), err)
+		}
+	}
+
+	return db
+}
+
+// createTestUser stores a user and returns their id and Clerk id
+func createTestUser(t *testing.T, db *sql.DB) (uuid.UUID, string) {
+	t.Helper()
+	id := uuid.New()
+	clerkID := "user_" + id.String()
+	_, err := db.Exec(`INSERT INTO users (id, email, name, clerk_id) VALUES ($1, $2, 'Test', $3)`,
+		id, id.String()+"@example.com", clerkID)
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	return id, clerkID
+}
+
+// authedRequest builds a request signed in as the Clerk user, as the Clerk
+// middleware would
+func authedRequest(t *testing.T, method, target, clerkID string, body interface{}) *http.Request {
+	t.Helper()
+	payload, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("failed to encode body: %v", err)
+	}
+	r := httptest.NewRequest(method, target, bytes.NewReader(payload))
+	claims := &clerk.SessionClaims{RegisteredClaims: clerk.RegisteredClaims{Subject: clerkID}}
+	return r.WithContext(clerk.ContextWithSessionClaims(r.Context(), claims))
+}
+
+func TestCreateInvite(t *testing.T) {
+	db := testDB(t)
+
+	userRepo := repository.NewUserRepository(db)
+	carpoolRepo := repository.NewCarPoolRepository(db)
+	carpools := NewCarPoolHandler(carpoolRepo, userRepo, services.NewMatchingService(carpoolRepo))
+	invites := NewInviteHandler(repository.NewInviteRepository(db), userRepo, carpoolRepo, repository.NewBlockRepository(db))
+
+	_, creatorClerkID := createTestUser(t, db)
+	_, outsiderClerkID := createTestUser(t, db)
+	inviteeID, _ := createTestUser(t, db)
+
+	w := httptest.NewRecorder()
+	carpools.CreateCarPool(w, authedRequest(t, http.MethodPost, "/api/carpools", creatorClerkID,
+		models.CreateCarPoolRequest{CarpoolName: "School run", Seats: 4, AvailableSeats: 3}))
+	if w.Code != http.StatusOK {
+		t.Fatalf("CreateCarPool status = %d: %s", w.Code, w.Body.String())
+	}
+	var carpool models.Carpool
+	if err := json.NewDecoder(w.Body).Decode(&carpool); err != nil {
+		t.Fatalf("failed to decode carpool: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		clerkID    string
+		wantStatus int
+	}{
+		{"creator can invite", creatorClerkID, http.StatusCreated},
+		{"outsider cannot invite", outsiderClerkID, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			invites.CreateInvite(w, authedRequest(t, http.MethodPost, "/api/invites", tt.clerkID,
+				models.CreateInviteRequest{CarpoolID: carpool.ID, ToUser: &inviteeID}))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("CreateInvite status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusCreated {
+				return
+			}
+
+			var invite models.Invite
+			if err := json.NewDecoder(w.Body).Decode(&invite); err != nil {
+				t.Fatalf("failed to decode invite: %v", err)
+			}
+			if invite.Status != models.InviteStatusPending || invite.ToUser == nil || *invite.ToUser != inviteeID {
+				t.Errorf("invite = %+v, want a pending invite to %s", invite, inviteeID)
+			}
+		})
+	}
+}
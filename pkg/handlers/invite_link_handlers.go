@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"car-backend/pkg/models"
+	"car-backend/pkg/repository"
+	"car-backend/pkg/services"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultInviteLinkTTL = 7 * 24 * time.Hour
+	maxInviteLinkTTL     = 30 * 24 * time.Hour
+)
+
+type InviteLinkHandler struct {
+	inviteLinkRepo *repository.InviteLinkRepository
+	carpoolRepo    *repository.CarPoolRepository
+	userRepo       *repository.UserRepository
+	signer         *services.InviteTokenSigner
+}
+
+func NewInviteLinkHandler(inviteLinkRepo *repository.InviteLinkRepository, carpoolRepo *repository.CarPoolRepository, userRepo *repository.UserRepository, signer *services.InviteTokenSigner) *InviteLinkHandler {
+	return &InviteLinkHandler{
+		inviteLinkRepo: inviteLinkRepo,
+		carpoolRepo:    carpoolRepo,
+		userRepo:       userRepo,
+		signer:         signer,
+	}
+}
+
+// CreateInviteLink issues a shareable link and code for the carpool
+func (h *InviteLinkHandler) CreateInviteLink(w http.ResponseWriter, r *http.Request) {
+	carpoolID, userID, ok := requireCarpoolAdmin(w, r, h.userRepo, h.carpoolRepo)
+	if !ok {
+		return
+	}
+
+	var req models.CreateInviteLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	ttl := defaultInviteLinkTTL
+	if req.ExpiresInHours > 0 {
+		ttl = time.Duration(req.ExpiresInHours) * time.Hour
+	}
+	if ttl > maxInviteLinkTTL {
+		http.Error(w, "Invite links can last at most 30 days", http.StatusBadRequest)
+		return
+	}
+
+	maxUses := req.MaxUses
+	if req.SingleUse {
+		one := 1
+		maxUses = &one
+	}
+	if maxUses != nil && *maxUses < 1 {
+		http.Error(w, "max_uses must be at least 1", http.StatusBadRequest)
+		return
+	}
+
+	code, err := services.NewInviteCode()
+	if err != nil {
+		http.Error(w, "Failed to generate invite code", http.StatusInternalServerError)
+		return
+	}
+
+	link := &models.InviteLink{
+		CarpoolID: carpoolID,
+		CreatedBy: userID,
+		Code:      code,
+		ExpiresAt: time.Now().Add(ttl).Truncate(time.Second),
+		MaxUses:   maxUses,
+	}
+	if err := h.inviteLinkRepo.CreateInviteLink(r.Context(), link); err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to create invite link: %v\"}", err)
+		http.Error(w, "Failed to create invite link", http.StatusInternalServerError)
+		return
+	}
+	link.Token = h.signer.Sign(link.ID, link.ExpiresAt)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(link)
+}
+
+// ListInviteLinks returns the carpool's outstanding links to its admins
+func (h *InviteLinkHandler) ListInviteLinks(w http.ResponseWriter, r *http.Request) {
+	carpoolID, _, ok := requireCarpoolAdmin(w, r, h.userRepo, h.carpoolRepo)
+	if !ok {
+		return
+	}
+
+	links, err := h.inviteLinkRepo.ListInviteLinks(r.Context(), carpoolID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list invite links: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(links)
+}
+
+// RevokeInviteLink stops an outstanding link from being used
+func (h *InviteLinkHandler) RevokeInviteLink(w http.ResponseWriter, r *http.Request) {
+	carpoolID, _, ok := requireCarpoolAdmin(w, r, h.userRepo, h.carpoolRepo)
+	if !ok {
+		return
+	}
+
+	linkID, err := uuid.Parse(mux.Vars(r)["linkID"])
+	if err != nil {
+		http.Error(w, "Invalid invite link ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.inviteLinkRepo.RevokeInviteLink(r.Context(), carpoolID, linkID); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Invite link not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Failed to revoke invite link: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RedeemInviteLink joins the current user to the carpool behind a link token or code
+func (h *InviteLinkHandler) RedeemInviteLink(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r, h.userRepo)
+	if !ok {
+		return
+	}
+
+	var req models.RedeemInviteLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	var linkID uuid.UUID
+	switch {
+	case req.Token != "":
+		id, err := h.signer.Verify(req.Token, now)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		linkID = id
+	case req.Code != "":
+		link, err := h.inviteLinkRepo.GetInviteLinkByCode(r.Context(), strings.ToUpper(strings.TrimSpace(req.Code)))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to look up invite code: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if link == nil {
+			http.Error(w, "Invite code not found", http.StatusNotFound)
+			return
+		}
+		linkID = link.ID
+	default:
+		http.Error(w, "token or code is required", http.StatusBadRequest)
+		return
+	}
+
+	link, err := h.inviteLinkRepo.RedeemInviteLink(r.Context(), linkID, userID, now)
+	if err != nil {
+		switch err {
+		case repository.ErrInviteLinkInvalid:
+			http.Error(w, err.Error(), http.StatusGone)
+		case repository.ErrAlreadyMember, repository.ErrNoSeatsAvailable:
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to redeem invite link: %v\"}", err)
+			http.Error(w, "Failed to redeem invite link", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]uuid.UUID{"carpool_id": link.CarpoolID})
+}
@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"car-backend/pkg/models"
+	"car-backend/pkg/repository"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+type JoinRequestHandler struct {
+	joinRequestRepo *repository.JoinRequestRepository
+	carpoolRepo     *repository.CarPoolRepository
+	userRepo        *repository.UserRepository
+}
+
+func NewJoinRequestHandler(joinRequestRepo *repository.JoinRequestRepository, carpoolRepo *repository.CarPoolRepository, userRepo *repository.UserRepository) *JoinRequestHandler {
+	return &JoinRequestHandler{
+		joinRequestRepo: joinRequestRepo,
+		carpoolRepo:     carpoolRepo,
+		userRepo:        userRepo,
+	}
+}
+
+// CreateJoinRequest asks to join the carpool. The request waits for an admin to
+// approve it, even when the carpool is full.
+func (h *JoinRequestHandler) CreateJoinRequest(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r, h.userRepo)
+	if !ok {
+		return
+	}
+
+	carpoolID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid carpool ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.CreateJoinRequestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Only members of an organization can ask to join its organization-only carpools
+	visible, err := h.carpoolRepo.IsVisibleTo(r.Context(), carpoolID, userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to check carpool: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if !visible {
+		http.Error(w, "Carpool not found", http.StatusNotFound)
+		return
+	}
+
+	request := &models.JoinRequest{
+		CarpoolID: carpoolID,
+		UserID:    userID,
+		Message:   req.Message,
+	}
+
+	if err := h.joinRequestRepo.CreateJoinRequest(r.Context(), request); err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			http.Error(w, "Carpool not found", http.StatusNotFound)
+		case repository.ErrAlreadyMember, repository.ErrOpenRequestExists:
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to create join request: %v\"}", err)
+			http.Error(w, "Failed to create join request", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(request)
+}
+
+// ListJoinRequests returns the carpool's open requests and waitlist to its admins
+func (h *JoinRequestHandler) ListJoinRequests(w http.ResponseWriter, r *http.Request) {
+	carpoolID, _, ok := requireCarpoolAdmin(w, r, h.userRepo, h.carpoolRepo)
+	if !ok {
+		return
+	}
+
+	statuses := []int{models.JoinRequestStatusPending, models.JoinRequestStatusWaitlisted}
+	switch r.URL.Query().Get("status") {
+	case "":
+	case "pending":
+		statuses = []int{models.JoinRequestStatusPending}
+	case "waitlisted":
+		statuses = []int{models.JoinRequestStatusWaitlisted}
+	default:
+		http.Error(w, "status must be pending or waitlisted", http.StatusBadRequest)
+		return
+	}
+
+	requests, err := h.joinRequestRepo.ListJoinRequests(r.Context(), carpoolID, statuses)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list join requests: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(requests)
+}
+
+// ApproveJoinRequest admits the requester. If the carpool is full the request is waitlisted instead.
+func (h *JoinRequestHandler) ApproveJoinRequest(w http.ResponseWriter, r *http.Request) {
+	carpoolID, adminID, ok := requireCarpoolAdmin(w, r, h.userRepo, h.carpoolRepo)
+	if !ok {
+		return
+	}
+
+	request, ok := h.loadRequest(w, r, carpoolID)
+	if !ok {
+		return
+	}
+
+	approved, err := h.joinRequestRepo.ApproveJoinRequest(r.Context(), request.ID, adminID)
+	if err != nil {
+		switch err {
+		case repository.ErrNoSeatsAvailable:
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(approved)
+		case repository.ErrRequestNotOpen:
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, fmt.Sprintf("Failed to approve join request: %v", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(approved)
+}
+
+// DenyJoinRequest rejects a pending or waitlisted request
+func (h *JoinRequestHandler) DenyJoinRequest(w http.ResponseWriter, r *http.Request) {
+	carpoolID, adminID, ok := requireCarpoolAdmin(w, r, h.userRepo, h.carpoolRepo)
+	if !ok {
+		return
+	}
+
+	request, ok := h.loadRequest(w, r, carpoolID)
+	if !ok {
+		return
+	}
+
+	if err := h.joinRequestRepo.DenyJoinRequest(r.Context(), request.ID, adminID); err != nil {
+		if err == repository.ErrRequestNotOpen {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Failed to deny join request: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CancelJoinRequest lets the requester withdraw their own open request
+func (h *JoinRequestHandler) CancelJoinRequest(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r, h.userRepo)
+	if !ok {
+		return
+	}
+
+	carpoolID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid carpool ID", http.StatusBadRequest)
+		return
+	}
+
+	request, ok := h.loadRequest(w, r, carpoolID)
+	if !ok {
+		return
+	}
+	if request.UserID != userID {
+		http.Error(w, "Only the requester can cancel this request", http.StatusForbidden)
+		return
+	}
+
+	if err := h.joinRequestRepo.CancelJoinRequest(r.Context(), request.ID); err != nil {
+		if err == repository.ErrRequestNotOpen {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Failed to cancel join request: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// loadRequest fetches the join request from the URL and checks it belongs to the carpool
+func (h *JoinRequestHandler) loadRequest(w http.ResponseWriter, r *http.Request, carpoolID uuid.UUID) (*models.JoinRequest, bool) {
+	requestID, err := uuid.Parse(mux.Vars(r)["requestID"])
+	if err != nil {
+		http.Error(w, "Invalid join request ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	request, err := h.joinRequestRepo.GetJoinRequest(r.Context(), requestID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get join request: %v", err), http.StatusInternalServerError)
+		return nil, false
+	}
+	if request == nil || request.CarpoolID != carpoolID {
+		http.Error(w, "Join request not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	return request, true
+}
@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"car-backend/pkg/models"
+	"car-backend/pkg/repository"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+type ModerationHandler struct {
+	reportRepo *repository.ReportRepository
+	ratingRepo *repository.RatingRepository
+	orgRepo    *repository.OrganizationRepository
+	userRepo   *repository.UserRepository
+}
+
+func NewModerationHandler(reportRepo *repository.ReportRepository, ratingRepo *repository.RatingRepository, orgRepo *repository.OrganizationRepository, userRepo *repository.UserRepository) *ModerationHandler {
+	return &ModerationHandler{
+		reportRepo: reportRepo,
+		ratingRepo: ratingRepo,
+		orgRepo:    orgRepo,
+		userRepo:   userRepo,
+	}
+}
+
+// ListReports returns the moderation queue, oldest first. Defaults to open reports.
+func (h *ModerationHandler) ListReports(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.requireModerator(w, r); !ok {
+		return
+	}
+
+	status := strings.ToUpper(r.URL.Query().Get("status"))
+	switch status {
+	case "":
+		status = models.ReportStatusOpen
+	case models.ReportStatusOpen, models.ReportStatusDismissed, models.ReportStatusActioned:
+	default:
+		http.Error(w, "status must be OPEN, DISMISSED or ACTIONED", http.StatusBadRequest)
+		return
+	}
+
+	reports, err := h.reportRepo.ListReports(r.Context(), status, nil, 100)
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to list reports: %v\"}", err)
+		http.Error(w, "Failed to list reports", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reports)
+}
+
+// ResolveReport dismisses an open report or marks it actioned
+func (h *ModerationHandler) ResolveReport(w http.ResponseWriter, r *http.Request) {
+	moderatorID, ok := h.requireModerator(w, r)
+	if !ok {
+		return
+	}
+
+	reportID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid report ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.ResolveMessageReportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	status := strings.ToUpper(req.Status)
+	if status != models.ReportStatusDismissed && status != models.ReportStatusActioned {
+		http.Error(w, "status must be DISMISSED or ACTIONED", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.reportRepo.ResolveReport(r.Context(), reportID, moderatorID, nil, status); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Open report not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to resolve report: %v\"}", err)
+		http.Error(w, "Failed to resolve report", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListRatingDisputes returns ratings awaiting a decision, oldest dispute first.
+// ?status=HIDDEN or VISIBLE lists past decisions instead.
+func (h *ModerationHandler) ListRatingDisputes(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.requireModerator(w, r); !ok {
+		return
+	}
+
+	status := strings.ToUpper(r.URL.Query().Get("status"))
+	switch status {
+	case "":
+		status = models.RatingStatusDisputed
+	case models.RatingStatusDisputed, models.RatingStatusHidden, models.RatingStatusVisible:
+	default:
+		http.Error(w, "status must be DISPUTED, HIDDEN or VISIBLE", http.StatusBadRequest)
+		return
+	}
+
+	ratings, err := h.ratingRepo.ListByStatus(r.Context(), status, nil, 100)
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to list ratings: %v\"}", err)
+		http.Error(w, "Failed to list ratings", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ratings)
+}
+
+// ResolveRatingDispute hides a disputed rating, removing it from the user's
+// score, or keeps it visible
+func (h *ModerationHandler) ResolveRatingDispute(w http.ResponseWriter, r *http.Request) {
+	moderatorID, ok := h.requireModerator(w, r)
+	if !ok {
+		return
+	}
+
+	ratingID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid rating ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.ResolveRatingDisputeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	status := strings.ToUpper(req.Status)
+	if status != models.RatingStatusHidden && status != models.RatingStatusVisible {
+		http.Error(w, "status must be HIDDEN or VISIBLE", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.ratingRepo.ResolveDispute(r.Context(), ratingID, moderatorID, nil, status); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Disputed rating not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to resolve rating dispute: %v\"}", err)
+		http.Error(w, "Failed to resolve rating dispute", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListPendingEmailDomains returns organizations whose email domains are waiting
+// for approval, longest waiting first
+func (h *ModerationHandler) ListPendingEmailDomains(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.requireModerator(w, r); !ok {
+		return
+	}
+
+	orgs, err := h.orgRepo.ListPendingEmailDomains(r.Context(), 100)
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to list pending email domains: %v\"}", err)
+		http.Error(w, "Failed to list pending email domains", http.StatusInternalServerError)
+		return
+	}
+	for i := range orgs {
+		orgs[i].JoinCode = ""
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(orgs)
+}
+
+// ReviewEmailDomains approves an organization's pending email domains, letting
+// users with a verified email there join without approval, or rejects them.
+// Moderators should check the organization controls the domain first.
+func (h *ModerationHandler) ReviewEmailDomains(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.requireModerator(w, r); !ok {
+		return
+	}
+
+	orgID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid organization ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.ReviewEmailDomainsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	status := strings.ToUpper(req.Status)
+	if status != models.EmailDomainApproved && status != models.EmailDomainRejected {
+		http.Error(w, "status must be APPROVED or REJECTED", http.StatusBadRequest)
+		return
+	}
+	domains, ok := parseEmailDomains(w, req.Domains)
+	if !ok {
+		return
+	}
+
+	if err := h.orgRepo.ReviewEmailDomains(r.Context(), orgID, domains, status == models.EmailDomainApproved); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "No matching pending email domains", http.StatusNotFound)
+			return
+		}
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to review email domains: %v\"}", err)
+		http.Error(w, "Failed to review email domains", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *ModerationHandler) requireModerator(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	userID, ok := requireUser(w, r, h.userRepo)
+	if !ok {
+		return uuid.Nil, false
+	}
+
+	moderator, err := h.userRepo.IsModerator(r.Context(), userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to check permissions: %v", err), http.StatusInternalServerError)
+		return uuid.Nil, false
+	}
+	if !moderator {
+		http.Error(w, "Only moderators can review reports", http.StatusForbidden)
+		return uuid.Nil, false
+	}
+
+	return userID, true
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"car-backend/pkg/models"
+	"car-backend/pkg/realtime"
+	"car-backend/pkg/repository"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultNotificationPageSize = 30
+	maxNotificationPageSize     = 100
+)
+
+type NotificationHandler struct {
+	notificationRepo *repository.NotificationRepository
+	userRepo         *repository.UserRepository
+	hub              *realtime.Hub
+}
+
+func NewNotificationHandler(notificationRepo *repository.NotificationRepository, userRepo *repository.UserRepository, hub *realtime.Hub) *NotificationHandler {
+	return &NotificationHandler{
+		notificationRepo: notificationRepo,
+		userRepo:         userRepo,
+		hub:              hub,
+	}
+}
+
+// ListNotifications returns a page of the user's inbox, newest first, with the
+// unread count. Pass next_cursor back as before for older entries and
+// unread=true to show only unread ones.
+func (h *NotificationHandler) ListNotifications(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r, h.userRepo)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+
+	var before *repository.PageCursor
+	if value := query.Get("before"); value != "" {
+		cursor, err := decodeCursor(value)
+		if err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		before = cursor
+	}
+
+	limit := defaultNotificationPageSize
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxNotificationPageSize {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxNotificationPageSize), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	unreadOnly := query.Get("unread") == "true"
+
+	entries, err := h.notificationRepo.List(r.Context(), userID, before, limit, unreadOnly)
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to list notifications: %v\"}", err)
+		http.Error(w, "Failed to list notifications", http.StatusInternalServerError)
+		return
+	}
+
+	count, err := h.notificationRepo.UnreadCount(r.Context(), userID)
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to count unread notifications: %v\"}", err)
+		http.Error(w, "Failed to list notifications", http.StatusInternalServerError)
+		return
+	}
+
+	response := models.NotificationFeedResponse{Notifications: entries, UnreadCount: count}
+	if len(entries) == limit {
+		last := entries[len(entries)-1]
+		response.NextCursor = encodeCursor(repository.PageCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// UnreadCount returns how many of the user's notifications are unread, for badges
+func (h *NotificationHandler) UnreadCount(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r, h.userRepo)
+	if !ok {
+		return
+	}
+
+	count, err := h.notificationRepo.UnreadCount(r.Context(), userID)
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to count unread notifications: %v\"}", err)
+		http.Error(w, "Failed to count unread notifications", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.UnreadCountResponse{UnreadCount: count})
+}
+
+// MarkRead marks one notification as read
+func (h *NotificationHandler) MarkRead(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r, h.userRepo)
+	if !ok {
+		return
+	}
+
+	notificationID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid notification ID", http.StatusBadRequest)
+		return
+	}
+
+	entry, err := h.notificationRepo.MarkRead(r.Context(), notificationID, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Notification not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to mark notification read: %v\"}", err)
+		http.Error(w, "Failed to mark notification read", http.StatusInternalServerError)
+		return
+	}
+
+	h.publishRead(r.Context(), userID, entry)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entry)
+}
+
+// MarkAllRead marks every unread notification of the user as read
+func (h *NotificationHandler) MarkAllRead(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r, h.userRepo)
+	if !ok {
+		return
+	}
+
+	if _, err := h.notificationRepo.MarkAllRead(r.Context(), userID); err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to mark notifications read: %v\"}", err)
+		http.Error(w, "Failed to mark notifications read", http.StatusInternalServerError)
+		return
+	}
+
+	h.publishRead(r.Context(), userID, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.UnreadCountResponse{UnreadCount: 0})
+}
+
+// publishRead tells the user's other open sessions the unread count changed
+func (h *NotificationHandler) publishRead(ctx context.Context, userID uuid.UUID, entry *models.FeedNotification) {
+	count, err := h.notificationRepo.UnreadCount(ctx, userID)
+	if err != nil {
+		log.Printf("{\"severity\":\"WARNING\",\"message\":\"Failed to count unread notifications: %v\"}", err)
+		return
+	}
+	h.hub.Publish(realtime.UserTopic(userID), "notification.read", models.NotificationFeedEvent{Notification: entry, UnreadCount: count})
+}
@@ -0,0 +1,758 @@
+package handlers
+
+import (
+	"car-backend/pkg/models"
+	"car-backend/pkg/repository"
+	"car-backend/pkg/services"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+type OrganizationHandler struct {
+	orgRepo     *repository.OrganizationRepository
+	carpoolRepo *repository.CarPoolRepository
+	ratingRepo  *repository.RatingRepository
+	reportRepo  *repository.ReportRepository
+	userRepo    *repository.UserRepository
+}
+
+func NewOrganizationHandler(orgRepo *repository.OrganizationRepository, carpoolRepo *repository.CarPoolRepository, ratingRepo *repository.RatingRepository, reportRepo *repository.ReportRepository, userRepo *repository.UserRepository) *OrganizationHandler {
+	return &OrganizationHandler{
+		orgRepo:     orgRepo,
+		carpoolRepo: carpoolRepo,
+		ratingRepo:  ratingRepo,
+		reportRepo:  reportRepo,
+		userRepo:    userRepo,
+	}
+}
+
+// CreateOrganization creates a school or workplace with the current user as its
+// admin. Its email domains wait for a moderator before admitting anyone.
+func (h *OrganizationHandler) CreateOrganization(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r, h.userRepo)
+	if !ok {
+		return
+	}
+
+	var req models.CreateOrganizationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	org := &models.Organization{
+		Name:      strings.TrimSpace(req.Name),
+		Kind:      strings.ToUpper(req.Kind),
+		CreatedBy: userID,
+	}
+	if org.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	switch org.Kind {
+	case "":
+		org.Kind = models.OrganizationKindSchool
+	case models.OrganizationKindSchool, models.OrganizationKindWorkplace, models.OrganizationKindOther:
+	default:
+		http.Error(w, "kind must be SCHOOL, WORKPLACE or OTHER", http.StatusBadRequest)
+		return
+	}
+	domains, ok := parseEmailDomains(w, req.EmailDomains)
+	if !ok {
+		return
+	}
+	org.EmailDomains = []string{}
+	org.PendingEmailDomains = domains
+	if req.EnableJoinCode {
+		code, err := services.NewInviteCode()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to generate join code: %v", err), http.StatusInternalServerError)
+			return
+		}
+		org.JoinCode = code
+	}
+
+	if err := h.orgRepo.CreateOrganization(r.Context(), org); err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to create organization: %v\"}", err)
+		http.Error(w, "Failed to create organization", http.StatusInternalServerError)
+		return
+	}
+
+	org.Membership, _ = h.orgRepo.GetMember(r.Context(), org.ID, userID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(org)
+}
+
+// ListMyOrganizations returns the organizations the current user belongs to or
+// has asked to join
+func (h *OrganizationHandler) ListMyOrganizations(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r, h.userRepo)
+	if !ok {
+		return
+	}
+
+	orgs, err := h.orgRepo.ListUserOrganizations(r.Context(), userID)
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to list organizations: %v\"}", err)
+		http.Error(w, "Failed to list organizations", http.StatusInternalServerError)
+		return
+	}
+	for i := range orgs {
+		if !isActiveOrgAdmin(orgs[i].Membership) {
+			orgs[i].JoinCode = ""
+			orgs[i].PendingEmailDomains = nil
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(orgs)
+}
+
+// GetOrganization returns an organization with the current user's membership.
+// Only admins see the join code and pending email domains.
+func (h *OrganizationHandler) GetOrganization(w http.ResponseWriter, r *http.Request) {
+	org, userID, ok := h.requireOrganization(w, r)
+	if !ok {
+		return
+	}
+
+	member, err := h.orgRepo.GetMember(r.Context(), org.ID, userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get membership: %v", err), http.StatusInternalServerError)
+		return
+	}
+	org.Membership = member
+	if !isActiveOrgAdmin(member) {
+		org.JoinCode = ""
+		org.PendingEmailDomains = nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(org)
+}
+
+// UpdateOrganization lets an admin rename the organization, replace its email
+// domains and rotate or disable its join code. Domains that were approved stay
+// approved; new ones wait for a moderator.
+func (h *OrganizationHandler) UpdateOrganization(w http.ResponseWriter, r *http.Request) {
+	org, _, ok := h.requireOrgAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateOrganizationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Name != nil {
+		org.Name = strings.TrimSpace(*req.Name)
+		if org.Name == "" {
+			http.Error(w, "name cannot be empty", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.EmailDomains != nil {
+		domains, ok := parseEmailDomains(w, req.EmailDomains)
+		if !ok {
+			return
+		}
+		org.EmailDomains, org.PendingEmailDomains = splitEmailDomains(domains, org.EmailDomains)
+	}
+	switch req.JoinCode {
+	case "":
+	case "rotate":
+		code, err := services.NewInviteCode()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to generate join code: %v", err), http.StatusInternalServerError)
+			return
+		}
+		org.JoinCode = code
+	case "disable":
+		org.JoinCode = ""
+	default:
+		http.Error(w, "join_code must be rotate or disable", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.orgRepo.UpdateOrganization(r.Context(), org); err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to update organization: %v\"}", err)
+		http.Error(w, "Failed to update organization", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(org)
+}
+
+// JoinOrganization joins the organization in the URL. Users whose verified
+// email is in one of its domains, or who give its join code, become members
+// straight away; anyone else waits for an admin to approve them.
+func (h *OrganizationHandler) JoinOrganization(w http.ResponseWriter, r *http.Request) {
+	org, userID, ok := h.requireOrganization(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.JoinOrganizationRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	member := &models.OrganizationMember{
+		OrganizationID: org.ID,
+		UserID:         userID,
+		Status:         models.OrgMemberPending,
+		VerifiedVia:    models.OrgVerifiedApproval,
+	}
+	if code := strings.ToUpper(strings.TrimSpace(req.JoinCode)); code != "" {
+		if org.JoinCode == "" || code != org.JoinCode {
+			http.Error(w, "Invalid join code", http.StatusForbidden)
+			return
+		}
+		member.Status = models.OrgMemberActive
+		member.VerifiedVia = models.OrgVerifiedCode
+	} else {
+		user, err := h.userRepo.GetByID(r.Context(), userID.String())
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get user: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if user.EmailVerified && emailInDomains(user.Email, org.EmailDomains) {
+			member.Status = models.OrgMemberActive
+			member.VerifiedVia = models.OrgVerifiedDomain
+		}
+	}
+
+	h.addMember(w, r, member)
+}
+
+// JoinOrganizationByCode joins whichever organization the join code belongs to
+func (h *OrganizationHandler) JoinOrganizationByCode(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r, h.userRepo)
+	if !ok {
+		return
+	}
+
+	var req models.JoinOrganizationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	code := strings.ToUpper(strings.TrimSpace(req.JoinCode))
+	if code == "" {
+		http.Error(w, "join_code is required", http.StatusBadRequest)
+		return
+	}
+
+	org, err := h.orgRepo.GetByJoinCode(r.Context(), code)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get organization: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if org == nil {
+		http.Error(w, "Invalid join code", http.StatusNotFound)
+		return
+	}
+
+	h.addMember(w, r, &models.OrganizationMember{
+		OrganizationID: org.ID,
+		UserID:         userID,
+		Status:         models.OrgMemberActive,
+		VerifiedVia:    models.OrgVerifiedCode,
+	})
+}
+
+func (h *OrganizationHandler) addMember(w http.ResponseWriter, r *http.Request, member *models.OrganizationMember) {
+	if err := h.orgRepo.AddMember(r.Context(), member); err != nil {
+		if err == repository.ErrAlreadyOrgMember {
+			http.Error(w, "You already belong to or have asked to join this organization", http.StatusConflict)
+			return
+		}
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to join organization: %v\"}", err)
+		http.Error(w, "Failed to join organization", http.StatusInternalServerError)
+		return
+	}
+
+	status := http.StatusCreated
+	if member.Status == models.OrgMemberPending {
+		status = http.StatusAccepted
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(member)
+}
+
+// ListMembers returns the organization's active members, or with
+// ?status=PENDING the requests waiting for approval
+func (h *OrganizationHandler) ListMembers(w http.ResponseWriter, r *http.Request) {
+	org, _, ok := h.requireOrgAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	status := strings.ToUpper(r.URL.Query().Get("status"))
+	switch status {
+	case "":
+		status = models.OrgMemberActive
+	case models.OrgMemberActive, models.OrgMemberPending:
+	default:
+		http.Error(w, "status must be ACTIVE or PENDING", http.StatusBadRequest)
+		return
+	}
+
+	members, err := h.orgRepo.ListMembers(r.Context(), org.ID, status)
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to list organization members: %v\"}", err)
+		http.Error(w, "Failed to list members", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(members)
+}
+
+// ApproveMember lets an admin accept a pending request to join
+func (h *OrganizationHandler) ApproveMember(w http.ResponseWriter, r *http.Request) {
+	org, adminID, ok := h.requireOrgAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	memberID, err := uuid.Parse(mux.Vars(r)["userID"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.orgRepo.ApproveMember(r.Context(), org.ID, memberID, adminID); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Pending request not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to approve organization member: %v\"}", err)
+		http.Error(w, "Failed to approve member", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RemoveMember takes a member out of the organization, or denies a pending
+// request. Members may leave on their own; admins may remove anyone.
+func (h *OrganizationHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	org, callerID, ok := h.requireOrganization(w, r)
+	if !ok {
+		return
+	}
+
+	memberID, err := uuid.Parse(mux.Vars(r)["userID"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	if memberID != callerID {
+		admin, err := h.orgRepo.IsAdmin(r.Context(), org.ID, callerID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to check permissions: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if !admin {
+			http.Error(w, "Only organization admins can remove other members", http.StatusForbidden)
+			return
+		}
+	}
+
+	if err := h.orgRepo.RemoveMember(r.Context(), org.ID, memberID); err != nil {
+		h.writeMemberChangeError(w, err, "remove")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UpdateMemberRole lets an admin designate or revoke other admins
+func (h *OrganizationHandler) UpdateMemberRole(w http.ResponseWriter, r *http.Request) {
+	org, _, ok := h.requireOrgAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	memberID, err := uuid.Parse(mux.Vars(r)["userID"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.UpdateOrgMemberRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	role := strings.ToUpper(req.Role)
+	if role != models.OrgRoleMember && role != models.OrgRoleAdmin {
+		http.Error(w, "role must be MEMBER or ADMIN", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.orgRepo.SetMemberRole(r.Context(), org.ID, memberID, role); err != nil {
+		h.writeMemberChangeError(w, err, "update")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *OrganizationHandler) writeMemberChangeError(w http.ResponseWriter, err error, action string) {
+	switch err {
+	case sql.ErrNoRows:
+		http.Error(w, "Member not found", http.StatusNotFound)
+	case repository.ErrLastOrgAdmin:
+		http.Error(w, "Promote another admin first; an organization needs at least one admin", http.StatusConflict)
+	default:
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to %s organization member: %v\"}", action, err)
+		http.Error(w, fmt.Sprintf("Failed to %s member", action), http.StatusInternalServerError)
+	}
+}
+
+// SetCarpoolOrganization moves the carpool in the URL into an organization the
+// caller is an active member of, optionally visible only to its members. With no
+// organization_id it detaches the carpool, which the organization's admins may
+// also do.
+func (h *OrganizationHandler) SetCarpoolOrganization(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r, h.userRepo)
+	if !ok {
+		return
+	}
+
+	carpoolID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid carpool ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.SetCarpoolOrganizationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	visibility := strings.ToUpper(req.Visibility)
+	switch {
+	case visibility == "":
+		visibility = models.CarpoolVisibilityPublic
+	case visibility != models.CarpoolVisibilityPublic && visibility != models.CarpoolVisibilityOrganization:
+		http.Error(w, "visibility must be PUBLIC or ORGANIZATION", http.StatusBadRequest)
+		return
+	}
+	if req.OrganizationID == nil && visibility != models.CarpoolVisibilityPublic {
+		http.Error(w, "Carpools outside an organization must be PUBLIC", http.StatusBadRequest)
+		return
+	}
+
+	admin, err := h.carpoolRepo.IsAdmin(r.Context(), carpoolID, userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to check permissions: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if req.OrganizationID == nil {
+		if !admin {
+			admin, err = h.carpoolRepo.IsOrgAdmin(r.Context(), carpoolID, userID)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Failed to check permissions: %v", err), http.StatusInternalServerError)
+				return
+			}
+		}
+		if !admin {
+			http.Error(w, "Only carpool or organization admins can detach a carpool", http.StatusForbidden)
+			return
+		}
+	} else {
+		if !admin {
+			http.Error(w, "Only carpool admins can move a carpool into an organization", http.StatusForbidden)
+			return
+		}
+		member, err := h.orgRepo.GetMember(r.Context(), *req.OrganizationID, userID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to check membership: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if member == nil || member.Status != models.OrgMemberActive {
+			http.Error(w, "You must be a member of the organization", http.StatusForbidden)
+			return
+		}
+	}
+
+	if err := h.carpoolRepo.SetOrganization(r.Context(), carpoolID, req.OrganizationID, visibility); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Carpool not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to set carpool organization: %v\"}", err)
+		http.Error(w, "Failed to set carpool organization", http.StatusInternalServerError)
+		return
+	}
+
+	carpool, err := h.carpoolRepo.GetCarPool(r.Context(), carpoolID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get carpool: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(carpool)
+}
+
+// ListRatingDisputes is the moderation queue for ratings left on rides of the
+// organization's carpools. ?status=HIDDEN or VISIBLE lists past decisions.
+func (h *OrganizationHandler) ListRatingDisputes(w http.ResponseWriter, r *http.Request) {
+	org, _, ok := h.requireOrgAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	status := strings.ToUpper(r.URL.Query().Get("status"))
+	switch status {
+	case "":
+		status = models.RatingStatusDisputed
+	case models.RatingStatusDisputed, models.RatingStatusHidden, models.RatingStatusVisible:
+	default:
+		http.Error(w, "status must be DISPUTED, HIDDEN or VISIBLE", http.StatusBadRequest)
+		return
+	}
+
+	ratings, err := h.ratingRepo.ListByStatus(r.Context(), status, &org.ID, 100)
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to list ratings: %v\"}", err)
+		http.Error(w, "Failed to list ratings", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ratings)
+}
+
+// ResolveRatingDispute lets an admin hide or keep a disputed rating left on a
+// ride of one of the organization's carpools
+func (h *OrganizationHandler) ResolveRatingDispute(w http.ResponseWriter, r *http.Request) {
+	org, adminID, ok := h.requireOrgAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	ratingID, err := uuid.Parse(mux.Vars(r)["ratingID"])
+	if err != nil {
+		http.Error(w, "Invalid rating ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.ResolveRatingDisputeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	status := strings.ToUpper(req.Status)
+	if status != models.RatingStatusHidden && status != models.RatingStatusVisible {
+		http.Error(w, "status must be HIDDEN or VISIBLE", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.ratingRepo.ResolveDispute(r.Context(), ratingID, adminID, &org.ID, status); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Disputed rating not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to resolve rating dispute: %v\"}", err)
+		http.Error(w, "Failed to resolve rating dispute", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListMessageReports is the moderation queue for direct messages reported
+// between two of the organization's active members. ?status=DISMISSED or
+// ACTIONED lists past decisions.
+func (h *OrganizationHandler) ListMessageReports(w http.ResponseWriter, r *http.Request) {
+	org, _, ok := h.requireOrgAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	status := strings.ToUpper(r.URL.Query().Get("status"))
+	switch status {
+	case "":
+		status = models.ReportStatusOpen
+	case models.ReportStatusOpen, models.ReportStatusDismissed, models.ReportStatusActioned:
+	default:
+		http.Error(w, "status must be OPEN, DISMISSED or ACTIONED", http.StatusBadRequest)
+		return
+	}
+
+	reports, err := h.reportRepo.ListReports(r.Context(), status, &org.ID, 100)
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to list reports: %v\"}", err)
+		http.Error(w, "Failed to list reports", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reports)
+}
+
+// ResolveMessageReport lets an admin dismiss or action an open report between
+// two of the organization's active members
+func (h *OrganizationHandler) ResolveMessageReport(w http.ResponseWriter, r *http.Request) {
+	org, adminID, ok := h.requireOrgAdmin(w, r)
+	if !ok {
+		return
+	}
+
+	reportID, err := uuid.Parse(mux.Vars(r)["reportID"])
+	if err != nil {
+		http.Error(w, "Invalid report ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.ResolveMessageReportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	status := strings.ToUpper(req.Status)
+	if status != models.ReportStatusDismissed && status != models.ReportStatusActioned {
+		http.Error(w, "status must be DISMISSED or ACTIONED", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.reportRepo.ResolveReport(r.Context(), reportID, adminID, &org.ID, status); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Open report not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to resolve report: %v\"}", err)
+		http.Error(w, "Failed to resolve report", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// requireOrganization resolves the current user and the {id} organization from the URL
+func (h *OrganizationHandler) requireOrganization(w http.ResponseWriter, r *http.Request) (*models.Organization, uuid.UUID, bool) {
+	userID, ok := requireUser(w, r, h.userRepo)
+	if !ok {
+		return nil, uuid.Nil, false
+	}
+
+	orgID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid organization ID", http.StatusBadRequest)
+		return nil, uuid.Nil, false
+	}
+
+	org, err := h.orgRepo.GetOrganization(r.Context(), orgID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get organization: %v", err), http.StatusInternalServerError)
+		return nil, uuid.Nil, false
+	}
+	if org == nil {
+		http.Error(w, "Organization not found", http.StatusNotFound)
+		return nil, uuid.Nil, false
+	}
+
+	return org, userID, true
+}
+
+// requireOrgAdmin resolves the {id} organization and checks the current user is
+// one of its active admins
+func (h *OrganizationHandler) requireOrgAdmin(w http.ResponseWriter, r *http.Request) (*models.Organization, uuid.UUID, bool) {
+	org, userID, ok := h.requireOrganization(w, r)
+	if !ok {
+		return nil, uuid.Nil, false
+	}
+
+	admin, err := h.orgRepo.IsAdmin(r.Context(), org.ID, userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to check permissions: %v", err), http.StatusInternalServerError)
+		return nil, uuid.Nil, false
+	}
+	if !admin {
+		http.Error(w, "Only organization admins can perform this action", http.StatusForbidden)
+		return nil, uuid.Nil, false
+	}
+
+	return org, userID, true
+}
+
+func isActiveOrgAdmin(member *models.OrganizationMember) bool {
+	return member != nil && member.Role == models.OrgRoleAdmin && member.Status == models.OrgMemberActive
+}
+
+// parseEmailDomains normalizes domains like "@School.edu" to "school.edu"
+func parseEmailDomains(w http.ResponseWriter, values []string) ([]string, bool) {
+	domains := []string{}
+	seen := map[string]bool{}
+	for _, value := range values {
+		domain := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(value), "@"))
+		if domain == "" || !strings.Contains(domain, ".") || strings.ContainsAny(domain, "@ /") {
+			http.Error(w, fmt.Sprintf("Invalid email domain %q", value), http.StatusBadRequest)
+			return nil, false
+		}
+		if !seen[domain] {
+			seen[domain] = true
+			domains = append(domains, domain)
+		}
+	}
+	return domains, true
+}
+
+// splitEmailDomains divides requested domains into those already approved and
+// those that still need a moderator
+func splitEmailDomains(requested, approved []string) ([]string, []string) {
+	isApproved := map[string]bool{}
+	for _, domain := range approved {
+		isApproved[domain] = true
+	}
+
+	kept, pending := []string{}, []string{}
+	for _, domain := range requested {
+		if isApproved[domain] {
+			kept = append(kept, domain)
+		} else {
+			pending = append(pending, domain)
+		}
+	}
+	return kept, pending
+}
+
+// emailInDomains reports whether the email's domain is one of domains or a
+// subdomain of one, so staff@mail.school.edu matches school.edu
+func emailInDomains(email string, domains []string) bool {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	host := strings.ToLower(strings.TrimSpace(email[at+1:]))
+	for _, domain := range domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
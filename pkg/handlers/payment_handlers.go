@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"car-backend/pkg/models"
+	"car-backend/pkg/repository"
+	"car-backend/pkg/services"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+type PaymentHandler struct {
+	paymentRepo *repository.PaymentRepository
+	expenseRepo *repository.ExpenseRepository
+	carpoolRepo *repository.CarPoolRepository
+	userRepo    *repository.UserRepository
+	// provider is nil when no payment provider is configured
+	provider services.PaymentProvider
+}
+
+func NewPaymentHandler(paymentRepo *repository.PaymentRepository, expenseRepo *repository.ExpenseRepository, carpoolRepo *repository.CarPoolRepository, userRepo *repository.UserRepository, provider services.PaymentProvider) *PaymentHandler {
+	return &PaymentHandler{
+		paymentRepo: paymentRepo,
+		expenseRepo: expenseRepo,
+		carpoolRepo: carpoolRepo,
+		userRepo:    userRepo,
+		provider:    provider,
+	}
+}
+
+// CreatePayment starts a payment from the current user to another member
+// through the provider. The balance is settled once the provider reports the
+// payment succeeded.
+func (h *PaymentHandler) CreatePayment(w http.ResponseWriter, r *http.Request) {
+	if h.provider == nil {
+		http.Error(w, "Payments are not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	carpoolID, userID, ok := requireCarpoolMember(w, r, h.userRepo, h.carpoolRepo)
+	if !ok {
+		return
+	}
+
+	var req models.CreatePaymentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	currency, ok := validateSettlement(w, r, h.expenseRepo, h.carpoolRepo, carpoolID, userID, req.ToUserID, req.AmountMinor, req.Currency)
+	if !ok {
+		return
+	}
+
+	payment := &models.Payment{
+		CarpoolID:   carpoolID,
+		FromUserID:  userID,
+		ToUserID:    req.ToUserID,
+		AmountMinor: req.AmountMinor,
+		Currency:    currency,
+		Provider:    h.provider.Name(),
+	}
+	if err := h.paymentRepo.CreatePayment(r.Context(), payment); err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to create payment: %v\"}", err)
+		http.Error(w, "Failed to create payment", http.StatusInternalServerError)
+		return
+	}
+
+	intent, err := h.provider.CreatePaymentIntent(r.Context(), services.PaymentIntentParams{
+		AmountMinor:    payment.AmountMinor,
+		Currency:       payment.Currency,
+		Description:    fmt.Sprintf("Carpool settle-up %s", payment.ID),
+		IdempotencyKey: payment.ID.String(),
+	})
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Payment provider %s failed to create intent for %s: %v\"}", payment.Provider, payment.ID, err)
+		if err := h.paymentRepo.MarkFailed(r.Context(), payment.ID, "provider error"); err != nil {
+			log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to mark payment %s failed: %v\"}", payment.ID, err)
+		}
+		http.Error(w, "Payment provider is unavailable", http.StatusBadGateway)
+		return
+	}
+
+	if err := h.paymentRepo.SetProviderIntent(r.Context(), payment.ID, intent.ID); err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to save intent for payment %s: %v\"}", payment.ID, err)
+		http.Error(w, "Failed to create payment", http.StatusInternalServerError)
+		return
+	}
+	payment.ProviderIntentID = intent.ID
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(models.CreatePaymentResponse{Payment: payment, ClientSecret: intent.ClientSecret})
+}
+
+// GetPayment returns a payment to its payer or payee, for polling its status
+func (h *PaymentHandler) GetPayment(w http.ResponseWriter, r *http.Request) {
+	carpoolID, userID, ok := requireCarpoolMember(w, r, h.userRepo, h.carpoolRepo)
+	if !ok {
+		return
+	}
+
+	paymentID, err := uuid.Parse(mux.Vars(r)["paymentID"])
+	if err != nil {
+		http.Error(w, "Invalid payment ID", http.StatusBadRequest)
+		return
+	}
+
+	payment, err := h.paymentRepo.GetPayment(r.Context(), paymentID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get payment: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if payment == nil || payment.CarpoolID != carpoolID || (payment.FromUserID != userID && payment.ToUserID != userID) {
+		http.Error(w, "Payment not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(payment)
+}
+
+// HandleWebhook applies the provider's payment status events. Events are
+// signature-verified and applied at most once, so redeliveries are harmless.
+func (h *PaymentHandler) HandleWebhook(w http.ResponseWriter, r *http.Request) {
+	if h.provider == nil {
+		http.Error(w, "Payments are not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	event, err := h.provider.ParseWebhook(r.Header, body)
+	if err != nil {
+		log.Printf("{\"severity\":\"WARNING\",\"message\":\"Rejected %s payment webhook: %v\"}", h.provider.Name(), err)
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	applied, err := h.paymentRepo.ApplyWebhookEvent(r.Context(), h.provider.Name(), event.ID, event.IntentID, event.Status, event.FailureReason)
+	if err != nil {
+		if err == repository.ErrUnknownPaymentIntent {
+			log.Printf("{\"severity\":\"WARNING\",\"message\":\"Payment webhook %s for unknown intent %s\"}", event.ID, event.IntentID)
+			http.Error(w, "Unknown payment intent", http.StatusNotFound)
+			return
+		}
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to apply payment webhook %s: %v\"}", event.ID, err)
+		http.Error(w, "Failed to process webhook", http.StatusInternalServerError)
+		return
+	}
+	if applied {
+		log.Printf("{\"severity\":\"INFO\",\"message\":\"Payment intent %s is %s\"}", event.IntentID, event.Status)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
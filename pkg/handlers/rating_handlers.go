@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"car-backend/pkg/models"
+	"car-backend/pkg/repository"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultRatingPageSize = 20
+	maxRatingPageSize     = 100
+)
+
+type RatingHandler struct {
+	ratingRepo      *repository.RatingRepository
+	carpoolRepo     *repository.CarPoolRepository
+	carpoolRideRepo *repository.CarPoolRideRepository
+	userRepo        *repository.UserRepository
+}
+
+func NewRatingHandler(ratingRepo *repository.RatingRepository, carpoolRepo *repository.CarPoolRepository, carpoolRideRepo *repository.CarPoolRideRepository, userRepo *repository.UserRepository) *RatingHandler {
+	return &RatingHandler{
+		ratingRepo:      ratingRepo,
+		carpoolRepo:     carpoolRepo,
+		carpoolRideRepo: carpoolRideRepo,
+		userRepo:        userRepo,
+	}
+}
+
+// RateParticipant records the current user's rating of another participant of a
+// completed ride. The driver and riders with a stop on the ride are participants,
+// and each can rate every other participant once.
+func (h *RatingHandler) RateParticipant(w http.ResponseWriter, r *http.Request) {
+	ride, userID, ok := requireCarpoolRide(w, r, h.userRepo, h.carpoolRepo, h.carpoolRideRepo)
+	if !ok {
+		return
+	}
+
+	if ride.Status != models.RideStatusCompleted {
+		http.Error(w, "Rides can only be rated once completed", http.StatusConflict)
+		return
+	}
+
+	var req models.CreateRatingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Score < 1 || req.Score > 5 {
+		http.Error(w, "score must be between 1 and 5", http.StatusBadRequest)
+		return
+	}
+	req.Review = strings.TrimSpace(req.Review)
+	if utf8.RuneCountInString(req.Review) > models.MaxReviewLength {
+		http.Error(w, fmt.Sprintf("review must be at most %d characters", models.MaxReviewLength), http.StatusBadRequest)
+		return
+	}
+
+	participants := ride.Participants()
+	if _, ok := participants[userID]; !ok {
+		http.Error(w, "Only participants of the ride can rate it", http.StatusForbidden)
+		return
+	}
+	role, ok := participants[req.RateeID]
+	if !ok {
+		http.Error(w, "ratee_id must be another participant of the ride", http.StatusBadRequest)
+		return
+	}
+	if req.RateeID == userID {
+		http.Error(w, "You cannot rate yourself", http.StatusBadRequest)
+		return
+	}
+
+	rating := &models.Rating{
+		CarpoolRideID: ride.ID,
+		RaterID:       userID,
+		RateeID:       req.RateeID,
+		RateeRole:     role,
+		Score:         req.Score,
+		Review:        req.Review,
+	}
+
+	if err := h.ratingRepo.CreateRating(r.Context(), rating); err != nil {
+		if err == repository.ErrAlreadyRated {
+			http.Error(w, "You already rated this participant for this ride", http.StatusConflict)
+			return
+		}
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to create rating: %v\"}", err)
+		http.Error(w, "Failed to create rating", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rating)
+}
+
+// ListRideRatings returns the ratings left on a ride
+func (h *RatingHandler) ListRideRatings(w http.ResponseWriter, r *http.Request) {
+	ride, _, ok := requireCarpoolRide(w, r, h.userRepo, h.carpoolRepo, h.carpoolRideRepo)
+	if !ok {
+		return
+	}
+
+	ratings, err := h.ratingRepo.ListRideRatings(r.Context(), ride.ID)
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to list ride ratings: %v\"}", err)
+		http.Error(w, "Failed to list ratings", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ratings)
+}
+
+// ListUserRatings returns a user's aggregate rating and the reviews they
+// received, newest first. Hidden reviews are left out.
+func (h *RatingHandler) ListUserRatings(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireUser(w, r, h.userRepo); !ok {
+		return
+	}
+
+	userID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+
+	var before *repository.PageCursor
+	if value := query.Get("before"); value != "" {
+		cursor, err := decodeCursor(value)
+		if err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		before = cursor
+	}
+
+	limit := defaultRatingPageSize
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxRatingPageSize {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxRatingPageSize), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	summary, err := h.ratingRepo.GetSummary(r.Context(), userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to get rating summary: %v\"}", err)
+		http.Error(w, "Failed to list ratings", http.StatusInternalServerError)
+		return
+	}
+
+	ratings, err := h.ratingRepo.ListUserRatings(r.Context(), userID, before, limit)
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to list user ratings: %v\"}", err)
+		http.Error(w, "Failed to list ratings", http.StatusInternalServerError)
+		return
+	}
+
+	response := models.RatingListResponse{Summary: *summary, Ratings: ratings}
+	if len(ratings) == limit {
+		last := ratings[len(ratings)-1]
+		response.NextCursor = encodeCursor(repository.PageCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// DisputeRating lets the rated user flag an abusive review for moderator review.
+// It keeps counting towards their score unless a moderator hides it.
+func (h *RatingHandler) DisputeRating(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r, h.userRepo)
+	if !ok {
+		return
+	}
+
+	ratingID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid rating ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.DisputeRatingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		http.Error(w, "A reason is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.ratingRepo.DisputeRating(r.Context(), ratingID, userID, req.Reason); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Rating not found or already disputed", http.StatusNotFound)
+			return
+		}
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to dispute rating: %v\"}", err)
+		http.Error(w, "Failed to dispute rating", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
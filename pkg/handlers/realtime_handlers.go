@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"car-backend/pkg/realtime"
+	"car-backend/pkg/repository"
+	"context"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+type RealtimeHandler struct {
+	hub             *realtime.Hub
+	userRepo        *repository.UserRepository
+	carpoolRepo     *repository.CarPoolRepository
+	carpoolRideRepo *repository.CarPoolRideRepository
+	dmRepo          *repository.DirectMessageRepository
+	upgrader        websocket.Upgrader
+}
+
+func NewRealtimeHandler(hub *realtime.Hub, userRepo *repository.UserRepository, carpoolRepo *repository.CarPoolRepository, carpoolRideRepo *repository.CarPoolRideRepository, dmRepo *repository.DirectMessageRepository, allowedOrigins []string) *RealtimeHandler {
+	return &RealtimeHandler{
+		hub:             hub,
+		userRepo:        userRepo,
+		carpoolRepo:     carpoolRepo,
+		carpoolRideRepo: carpoolRideRepo,
+		dmRepo:          dmRepo,
+		upgrader: websocket.Upgrader{
+			CheckOrigin: func(r *http.Request) bool {
+				origin := r.Header.Get("Origin")
+				if origin == "" {
+					return true
+				}
+				for _, allowed := range allowedOrigins {
+					if origin == allowed {
+						return true
+					}
+				}
+				return false
+			},
+		},
+	}
+}
+
+// Connect upgrades the request to a WebSocket that clients use to subscribe to live updates
+func (h *RealtimeHandler) Connect(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r, h.userRepo)
+	if !ok {
+		return
+	}
+
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("{\"severity\":\"WARNING\",\"message\":\"WebSocket upgrade failed: %v\"}", err)
+		return
+	}
+
+	h.hub.Serve(conn, userID, h.authorize)
+}
+
+// authorize checks the user may see a topic. Ride topics are open to the
+// driver and to members of the ride's carpool; chat topics only to members and
+// conversation topics only to the two participants. A user topic is only open
+// to that user.
+func (h *RealtimeHandler) authorize(userID uuid.UUID, topic string) bool {
+	ctx := context.Background()
+
+	kind, id, found := strings.Cut(topic, ":")
+	if !found {
+		return false
+	}
+	resourceID, err := uuid.Parse(id)
+	if err != nil {
+		return false
+	}
+
+	switch kind {
+	case "ride":
+		ride, err := h.carpoolRideRepo.GetCarpoolRide(ctx, resourceID)
+		if err != nil || ride == nil {
+			return false
+		}
+		if ride.DriverID == userID {
+			return true
+		}
+		member, err := h.carpoolRepo.IsMember(ctx, ride.CarpoolID, userID)
+		return err == nil && member
+	case "chat":
+		member, err := h.carpoolRepo.IsMember(ctx, resourceID, userID)
+		return err == nil && member
+	case "dm":
+		conversation, err := h.dmRepo.GetConversation(ctx, resourceID)
+		return err == nil && conversation != nil && conversation.Includes(userID)
+	case "user":
+		return resourceID == userID
+	}
+
+	return false
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"car-backend/pkg/models"
+	"car-backend/pkg/repository"
+	"car-backend/pkg/services"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultLeaderboardSize = 25
+	maxLeaderboardSize     = 100
+)
+
+type RewardsHandler struct {
+	rewards     *services.RewardsEngine
+	carpoolRepo *repository.CarPoolRepository
+	userRepo    *repository.UserRepository
+}
+
+func NewRewardsHandler(rewards *services.RewardsEngine, carpoolRepo *repository.CarPoolRepository, userRepo *repository.UserRepository) *RewardsHandler {
+	return &RewardsHandler{
+		rewards:     rewards,
+		carpoolRepo: carpoolRepo,
+		userRepo:    userRepo,
+	}
+}
+
+// GetMyRewards returns the current user's points, streaks and badges
+func (h *RewardsHandler) GetMyRewards(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r, h.userRepo)
+	if !ok {
+		return
+	}
+
+	h.writeProfile(w, r, userID)
+}
+
+// GetUserRewards returns another user's points, streaks and badges, which are
+// public like their ratings
+func (h *RewardsHandler) GetUserRewards(w http.ResponseWriter, r *http.Request) {
+	if _, ok := requireUser(w, r, h.userRepo); !ok {
+		return
+	}
+
+	userID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	h.writeProfile(w, r, userID)
+}
+
+func (h *RewardsHandler) writeProfile(w http.ResponseWriter, r *http.Request, userID uuid.UUID) {
+	profile, err := h.rewards.Profile(r.Context(), userID)
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to get rewards for %s: %v\"}", userID, err)
+		http.Error(w, "Failed to get rewards", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profile)
+}
+
+// GetCarpoolLeaderboard ranks the carpool's members by points earned on its rides
+func (h *RewardsHandler) GetCarpoolLeaderboard(w http.ResponseWriter, r *http.Request) {
+	carpoolID, userID, ok := requireCarpoolMember(w, r, h.userRepo, h.carpoolRepo)
+	if !ok {
+		return
+	}
+
+	h.writeLeaderboard(w, r, userID, &carpoolID, nil)
+}
+
+// GetSchoolLeaderboard ranks users by points earned in carpools serving ?school
+// that the user may see
+func (h *RewardsHandler) GetSchoolLeaderboard(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r, h.userRepo)
+	if !ok {
+		return
+	}
+
+	school := strings.TrimSpace(r.URL.Query().Get("school"))
+	if school == "" {
+		http.Error(w, "school is required", http.StatusBadRequest)
+		return
+	}
+
+	h.writeLeaderboard(w, r, userID, nil, &school)
+}
+
+// writeLeaderboard reads ?period (week, month or all) and ?limit. Weeks and
+// months follow the requesting user's timezone.
+func (h *RewardsHandler) writeLeaderboard(w http.ResponseWriter, r *http.Request, userID uuid.UUID, carpoolID *uuid.UUID, school *string) {
+	query := r.URL.Query()
+
+	period := strings.ToLower(query.Get("period"))
+	switch period {
+	case "":
+		period = models.LeaderboardPeriodAll
+	case models.LeaderboardPeriodWeek, models.LeaderboardPeriodMonth, models.LeaderboardPeriodAll:
+	default:
+		http.Error(w, "period must be week, month or all", http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultLeaderboardSize
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxLeaderboardSize {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxLeaderboardSize), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	loc, ok := requireUserLocation(w, r, h.userRepo, userID)
+	if !ok {
+		return
+	}
+
+	leaderboard, err := h.rewards.Leaderboard(r.Context(), carpoolID, school, userID, period, loc, limit)
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to get leaderboard: %v\"}", err)
+		http.Error(w, "Failed to get leaderboard", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(leaderboard)
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"car-backend/pkg/models"
+	"car-backend/pkg/repository"
+	"car-backend/pkg/services"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultRideHistoryPageSize = 25
+	maxRideHistoryPageSize     = 100
+	// maxRideHistoryExport caps how many rides a single export contains
+	maxRideHistoryExport = 5000
+)
+
+type RideHistoryHandler struct {
+	carpoolRideRepo *repository.CarPoolRideRepository
+	userRepo        *repository.UserRepository
+}
+
+func NewRideHistoryHandler(carpoolRideRepo *repository.CarPoolRideRepository, userRepo *repository.UserRepository) *RideHistoryHandler {
+	return &RideHistoryHandler{
+		carpoolRideRepo: carpoolRideRepo,
+		userRepo:        userRepo,
+	}
+}
+
+// ListRideHistory returns a page of the current user's past rides as driver or
+// rider, most recent first. Filters are ?from, ?to, ?carpool_id and ?role.
+func (h *RideHistoryHandler) ListRideHistory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r, h.userRepo)
+	if !ok {
+		return
+	}
+
+	filter, _, ok := h.parseFilter(w, r, userID)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	if value := query.Get("before"); value != "" {
+		cursor, err := decodeCursor(value)
+		if err != nil {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		filter.Before = cursor
+	}
+
+	filter.Limit = defaultRideHistoryPageSize
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxRideHistoryPageSize {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxRideHistoryPageSize), http.StatusBadRequest)
+			return
+		}
+		filter.Limit = n
+	}
+
+	rides, err := h.carpoolRideRepo.ListRideHistory(r.Context(), userID, filter)
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to list ride history: %v\"}", err)
+		http.Error(w, "Failed to list ride history", http.StatusInternalServerError)
+		return
+	}
+
+	response := models.RideHistoryResponse{Rides: rides}
+	if len(rides) == filter.Limit {
+		last := rides[len(rides)-1]
+		response.NextCursor = encodeCursor(repository.PageCursor{CreatedAt: last.OccurredAt(), ID: last.ID})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// ExportRideHistory downloads every ride matching the same filters as
+// ListRideHistory, as ?format=csv (the default) or json, for reimbursement records
+func (h *RideHistoryHandler) ExportRideHistory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r, h.userRepo)
+	if !ok {
+		return
+	}
+
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "json" {
+		http.Error(w, "format must be csv or json", http.StatusBadRequest)
+		return
+	}
+
+	filter, loc, ok := h.parseFilter(w, r, userID)
+	if !ok {
+		return
+	}
+	filter.Limit = maxRideHistoryExport
+
+	rides, err := h.carpoolRideRepo.ListRideHistory(r.Context(), userID, filter)
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to export ride history: %v\"}", err)
+		http.Error(w, "Failed to export ride history", http.StatusInternalServerError)
+		return
+	}
+
+	filename := "ride-history-" + time.Now().In(loc).Format("2006-01-02")
+	if format == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.json"`, filename))
+		json.NewEncoder(w).Encode(rides)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.csv"`, filename))
+	if err := services.WriteRideHistoryCSV(w, userID, rides, loc); err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to write ride history CSV: %v\"}", err)
+	}
+}
+
+// parseFilter reads the history filters from the query. Dates given as
+// YYYY-MM-DD are whole days in the user's timezone, which is also returned.
+func (h *RideHistoryHandler) parseFilter(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (repository.RideHistoryFilter, *time.Location, bool) {
+	var filter repository.RideHistoryFilter
+	query := r.URL.Query()
+
+	loc, ok := requireUserLocation(w, r, h.userRepo, userID)
+	if !ok {
+		return filter, nil, false
+	}
+
+	if value := query.Get("from"); value != "" {
+		from, _, err := parseHistoryTime(value, loc)
+		if err != nil {
+			http.Error(w, "from must be a date (YYYY-MM-DD) or RFC 3339 time", http.StatusBadRequest)
+			return filter, nil, false
+		}
+		filter.From = &from
+	}
+	if value := query.Get("to"); value != "" {
+		to, isDate, err := parseHistoryTime(value, loc)
+		if err != nil {
+			http.Error(w, "to must be a date (YYYY-MM-DD) or RFC 3339 time", http.StatusBadRequest)
+			return filter, nil, false
+		}
+		// A date includes the whole day
+		if isDate {
+			to = to.AddDate(0, 0, 1)
+		}
+		filter.To = &to
+	}
+	if filter.From != nil && filter.To != nil && !filter.To.After(*filter.From) {
+		http.Error(w, "to must be after from", http.StatusBadRequest)
+		return filter, nil, false
+	}
+
+	if value := query.Get("carpool_id"); value != "" {
+		carpoolID, err := uuid.Parse(value)
+		if err != nil {
+			http.Error(w, "Invalid carpool ID", http.StatusBadRequest)
+			return filter, nil, false
+		}
+		filter.CarpoolID = &carpoolID
+	}
+
+	switch role := strings.ToUpper(query.Get("role")); role {
+	case "", models.RideRoleDriver, models.RideRoleRider:
+		filter.Role = role
+	default:
+		http.Error(w, "role must be driver or rider", http.StatusBadRequest)
+		return filter, nil, false
+	}
+
+	return filter, loc, true
+}
+
+// parseHistoryTime reads a date or an RFC 3339 time, reporting whether it was a date
+func parseHistoryTime(value string, loc *time.Location) (time.Time, bool, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, loc); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	return t, false, err
+}
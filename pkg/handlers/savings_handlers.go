@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"car-backend/pkg/models"
+	"car-backend/pkg/repository"
+	"car-backend/pkg/services"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// defaultSavingsPeriod is the report period when ?from is not given
+const defaultSavingsPeriod = 30 * 24 * time.Hour
+
+type SavingsHandler struct {
+	savings     *services.SavingsCalculator
+	carpoolRepo *repository.CarPoolRepository
+	orgRepo     *repository.OrganizationRepository
+	userRepo    *repository.UserRepository
+}
+
+func NewSavingsHandler(savings *services.SavingsCalculator, carpoolRepo *repository.CarPoolRepository, orgRepo *repository.OrganizationRepository, userRepo *repository.UserRepository) *SavingsHandler {
+	return &SavingsHandler{
+		savings:     savings,
+		carpoolRepo: carpoolRepo,
+		orgRepo:     orgRepo,
+		userRepo:    userRepo,
+	}
+}
+
+// GetUserSavings reports the CO2 and fuel cost the current user's rides saved
+func (h *SavingsHandler) GetUserSavings(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r, h.userRepo)
+	if !ok {
+		return
+	}
+
+	h.writeReport(w, r, userID, repository.SavingsScope{UserID: &userID}, func(report *models.SavingsReport) {
+		report.Scope = models.SavingsScopeUser
+		report.ScopeID = &userID
+	})
+}
+
+// GetCarpoolSavings reports the savings of every ride of the carpool, for its members
+func (h *SavingsHandler) GetCarpoolSavings(w http.ResponseWriter, r *http.Request) {
+	carpoolID, userID, ok := requireCarpoolMember(w, r, h.userRepo, h.carpoolRepo)
+	if !ok {
+		return
+	}
+
+	h.writeReport(w, r, userID, repository.SavingsScope{CarpoolID: &carpoolID}, func(report *models.SavingsReport) {
+		report.Scope = models.SavingsScopeCarpool
+		report.ScopeID = &carpoolID
+	})
+}
+
+// GetSchoolSavings reports the savings of every carpool serving ?school that the
+// user may see. Only aggregate figures are returned, so any signed in user may ask.
+func (h *SavingsHandler) GetSchoolSavings(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r, h.userRepo)
+	if !ok {
+		return
+	}
+
+	school := strings.TrimSpace(r.URL.Query().Get("school"))
+	if school == "" {
+		http.Error(w, "school is required", http.StatusBadRequest)
+		return
+	}
+
+	h.writeReport(w, r, userID, repository.SavingsScope{School: &school, ViewerID: &userID}, func(report *models.SavingsReport) {
+		report.Scope = models.SavingsScopeSchool
+		report.School = school
+	})
+}
+
+// GetOrganizationSavings reports the savings of every carpool of the
+// organization, for its active members
+func (h *SavingsHandler) GetOrganizationSavings(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r, h.userRepo)
+	if !ok {
+		return
+	}
+
+	orgID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid organization ID", http.StatusBadRequest)
+		return
+	}
+
+	member, err := h.orgRepo.GetMember(r.Context(), orgID, userID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to check membership: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if member == nil || member.Status != models.OrgMemberActive {
+		http.Error(w, "Organization not found", http.StatusNotFound)
+		return
+	}
+
+	h.writeReport(w, r, userID, repository.SavingsScope{OrganizationID: &orgID}, func(report *models.SavingsReport) {
+		report.Scope = models.SavingsScopeOrganization
+		report.ScopeID = &orgID
+	})
+}
+
+// writeReport reads ?from, ?to and ?bucket, with dates and buckets in the
+// requesting user's timezone, and writes the report for scope
+func (h *SavingsHandler) writeReport(w http.ResponseWriter, r *http.Request, userID uuid.UUID, scope repository.SavingsScope, describe func(*models.SavingsReport)) {
+	query := r.URL.Query()
+
+	bucket := strings.ToLower(query.Get("bucket"))
+	switch bucket {
+	case "":
+		bucket = models.SavingsBucketDay
+	case models.SavingsBucketDay, models.SavingsBucketWeek, models.SavingsBucketMonth:
+	default:
+		http.Error(w, "bucket must be day, week or month", http.StatusBadRequest)
+		return
+	}
+
+	loc, ok := requireUserLocation(w, r, h.userRepo, userID)
+	if !ok {
+		return
+	}
+
+	to := time.Now()
+	if value := query.Get("to"); value != "" {
+		t, isDate, err := parseHistoryTime(value, loc)
+		if err != nil {
+			http.Error(w, "to must be a date (YYYY-MM-DD) or RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		// A date includes the whole day
+		if isDate {
+			t = t.AddDate(0, 0, 1)
+		}
+		to = t
+	}
+	from := to.Add(-defaultSavingsPeriod)
+	if value := query.Get("from"); value != "" {
+		t, _, err := parseHistoryTime(value, loc)
+		if err != nil {
+			http.Error(w, "from must be a date (YYYY-MM-DD) or RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		from = t
+	}
+	if !to.After(from) {
+		http.Error(w, "to must be after from", http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.savings.Report(r.Context(), scope, from, to, bucket, loc)
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to compute savings report: %v\"}", err)
+		http.Error(w, "Failed to compute savings report", http.StatusInternalServerError)
+		return
+	}
+	describe(report)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -3,42 +3,136 @@ package handlers
 import (
 	"car-backend/pkg/models"
 	"car-backend/pkg/repository"
+	"car-backend/pkg/services"
+	"database/sql"
 	"encoding/json"
+	"io"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 	"github.com/clerk/clerk-sdk-go/v2"
 	"github.com/google/uuid"
 )
 
 type UserHandler struct {
-	userRepo    *repository.UserRepository
-	clerkClient clerk.Client
+	userRepo      *repository.UserRepository
+	inviteRepo    *repository.InviteRepository
+	analytics     *services.AnalyticsService
+	clerkClient   clerk.Client
+	webhookSecret string
 }
 
-func NewUserHandler(userRepo *repository.UserRepository) *UserHandler {
+func NewUserHandler(userRepo *repository.UserRepository, inviteRepo *repository.InviteRepository, analytics *services.AnalyticsService, webhookSecret string) *UserHandler {
 	return &UserHandler{
-		userRepo:    userRepo,
+		userRepo:      userRepo,
+		inviteRepo:    inviteRepo,
+		analytics:     analytics,
+		webhookSecret: webhookSecret,
 	}
 }
 
-// HandleWebhook processes Clerk webhooks for user events
+// HandleWebhook processes Clerk webhooks for user events. On user.created the
+// user is stored; on user.updated their primary email and its verification
+// status are refreshed. Either way, invites addressed to their email or phone
+// are claimed once Clerk has verified it.
 func (h *UserHandler) HandleWebhook(w http.ResponseWriter, r *http.Request) {
-	// Implement webhook handling for Clerk events
-	// This is where you'll handle user creation/updates from Clerk
-	// Example: user.created, user.updated, etc.
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := verifyClerkWebhook(h.webhookSecret, r.Header, body, time.Now()); err != nil {
+		log.Printf("{\"severity\":\"WARNING\",\"message\":\"Rejected Clerk webhook: %v\"}", err)
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	var event clerkWebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	email, emailVerified := event.Data.primaryEmail()
+	phone, phoneVerified := event.Data.primaryPhone()
+
+	switch event.Type {
+	case "user.created":
+		name := strings.TrimSpace(event.Data.FirstName + " " + event.Data.LastName)
+		user := &models.User{
+			ID:            uuid.New(),
+			ClerkID:       event.Data.ID,
+			Email:         email,
+			EmailVerified: emailVerified,
+			Phone:         phone,
+			Name:          name,
+			DisplayName:   name,
+		}
+		if err := h.userRepo.CreateUserIfNotExists(ctx, user); err != nil {
+			log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to create user from webhook: %v\"}", err)
+			http.Error(w, "Failed to create user", http.StatusInternalServerError)
+			return
+		}
+	case "user.updated":
+		if err := h.userRepo.UpdateEmail(ctx, event.Data.ID, email, emailVerified); err != nil {
+			log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to update user from webhook: %v\"}", err)
+			http.Error(w, "Failed to update user", http.StatusInternalServerError)
+			return
+		}
+	default:
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// Unverified addresses could belong to someone else, so their invites stay put
+	if !emailVerified {
+		email = ""
+	}
+	if !phoneVerified {
+		phone = ""
+	}
+	if email == "" && phone == "" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	stored, err := h.userRepo.GetByClerkID(ctx, event.Data.ID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to load user %s: %v\"}", event.Data.ID, err)
+		http.Error(w, "Failed to load user", http.StatusInternalServerError)
+		return
+	}
+
+	claimed, err := h.inviteRepo.ClaimInvites(ctx, stored.ID, email, phone)
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to claim invites for %s: %v\"}", stored.ID, err)
+		http.Error(w, "Failed to claim invites", http.StatusInternalServerError)
+		return
+	}
+	if claimed > 0 {
+		log.Printf("{\"severity\":\"INFO\",\"message\":\"Claimed %d invites for user %s\"}", claimed, stored.ID)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
 }
 
 // GetProfile returns the user's profile
 func (h *UserHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	claims, ok := clerk.SessionClaimsFromContext(ctx)
+	userID, ok := requireUser(w, r, h.userRepo)
 	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
 	// Get user from our database
-	user, err := h.userRepo.GetByID(ctx, claims.Subject)
+	user, err := h.userRepo.GetByID(ctx, userID.String())
 	if err != nil {
 		http.Error(w, "Failed to get user profile", http.StatusInternalServerError)
 		return
@@ -51,9 +145,8 @@ func (h *UserHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
 // UpdateProfile updates the user's profile
 func (h *UserHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	claims, ok := clerk.SessionClaimsFromContext(ctx)
+	userID, ok := requireUser(w, r, h.userRepo)
 	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
@@ -63,7 +156,12 @@ func (h *UserHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.userRepo.UpdateProfile(ctx, claims.Subject, &update); err != nil {
+	if update.VehicleMPG != nil && *update.VehicleMPG <= 0 {
+		http.Error(w, "vehicle_mpg must be positive", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.userRepo.UpdateProfile(ctx, userID, &update); err != nil {
 		http.Error(w, "Failed to update profile", http.StatusInternalServerError)
 		return
 	}
@@ -135,3 +233,117 @@ func (h *UserHandler) CreateProfile(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(user)
 }
+
+// GetStats returns the current user's carpooling counters
+func (h *UserHandler) GetStats(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r, h.userRepo)
+	if !ok {
+		return
+	}
+
+	stats, err := h.analytics.Stats(r.Context(), userID)
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to get user stats: %v\"}", err)
+		http.Error(w, "Failed to get stats", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// GetNotificationSettings returns the current user's notification preferences and quiet hours
+func (h *UserHandler) GetNotificationSettings(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r, h.userRepo)
+	if !ok {
+		return
+	}
+
+	settings, err := h.userRepo.GetNotificationSettings(r.Context(), userID)
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to get notification settings: %v\"}", err)
+		http.Error(w, "Failed to get notification settings", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+// UpdateNotificationSettings merges per-event channel preferences into the current
+// user's settings and updates their quiet hours and timezone.
+func (h *UserHandler) UpdateNotificationSettings(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r, h.userRepo)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateNotificationSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	settings, err := h.userRepo.GetNotificationSettings(r.Context(), userID)
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to get notification settings: %v\"}", err)
+		http.Error(w, "Failed to get notification settings", http.StatusInternalServerError)
+		return
+	}
+
+	for eventType, channels := range req.Preferences {
+		if _, known := models.DefaultNotificationChannels[eventType]; !known {
+			http.Error(w, "Unknown notification type "+eventType, http.StatusBadRequest)
+			return
+		}
+		if settings.Preferences[eventType] == nil {
+			settings.Preferences[eventType] = map[string]bool{}
+		}
+		for channel, enabled := range channels {
+			switch channel {
+			case models.ChannelPush, models.ChannelEmail, models.ChannelSMS, models.ChannelInApp:
+				settings.Preferences[eventType][channel] = enabled
+			default:
+				http.Error(w, "Unknown notification channel "+channel, http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	for _, value := range []*string{req.QuietHoursStart, req.QuietHoursEnd} {
+		if value == nil || *value == "" {
+			continue
+		}
+		if _, err := time.Parse("15:04", *value); err != nil {
+			http.Error(w, "Quiet hours must be HH:MM", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.QuietHoursStart != nil {
+		settings.QuietHoursStart = *req.QuietHoursStart
+	}
+	if req.QuietHoursEnd != nil {
+		settings.QuietHoursEnd = *req.QuietHoursEnd
+	}
+	if (settings.QuietHoursStart == "") != (settings.QuietHoursEnd == "") {
+		http.Error(w, "Quiet hours need both a start and an end", http.StatusBadRequest)
+		return
+	}
+
+	if req.Timezone != nil {
+		if _, err := time.LoadLocation(*req.Timezone); err != nil || *req.Timezone == "" {
+			http.Error(w, "Invalid timezone", http.StatusBadRequest)
+			return
+		}
+		settings.Timezone = *req.Timezone
+	}
+
+	if err := h.userRepo.UpdateNotificationSettings(r.Context(), userID, settings); err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to update notification settings: %v\"}", err)
+		http.Error(w, "Failed to update notification settings", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
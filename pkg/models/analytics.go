@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserAnalytics holds a user's lifetime carpooling counters, derived from
+// memberships and completed rides
+type UserAnalytics struct {
+	UserID                         uuid.UUID `json:"user_id" db:"user_id"`
+	NumberOfCarpools               int       `json:"number_of_carpools" db:"number_of_carpools"`
+	NumberOfCompletedRides         int       `json:"number_of_completed_rides" db:"number_of_completed_rides"`
+	NumberOfCompletedRidesAsDriver int       `json:"number_of_completed_rides_as_driver" db:"number_of_completed_rides_as_driver"`
+	DrivingMilesSaved              int       `json:"driving_miles_saved" db:"driving_miles_saved"`
+	UpdatedAt                      time.Time `json:"updated_at" db:"updated_at"`
+}
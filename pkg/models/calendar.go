@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CalendarFeed is an iCalendar subscription URL for a user's rides, or for
+// one carpool's rides when CarpoolID is set
+type CalendarFeed struct {
+	ID        uuid.UUID  `json:"id" db:"id"`
+	UserID    uuid.UUID  `json:"user_id" db:"user_id"`
+	CarpoolID *uuid.UUID `json:"carpool_id,omitempty" db:"carpool_id"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+}
+
+// CalendarFeedResponse carries the subscription URL. It is only shown when the
+// feed is created; creating a new one revokes the previous URL.
+type CalendarFeedResponse struct {
+	URL       string     `json:"url"`
+	CarpoolID *uuid.UUID `json:"carpool_id,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// CalendarRide is a ride with the names shown in calendar entries. Revision
+// counts the changes to the ride that calendar apps need to pick up.
+type CalendarRide struct {
+	CarpoolRide
+	CarpoolName string
+	DriverName  string
+	Revision    int
+}
@@ -8,16 +8,33 @@ import (
 
 // Carpool represents a carpool group
 type Carpool struct {
-	ID                 uuid.UUID `json:"id" db:"id"`
-	CreatorID          string    `json:"creator_id" db:"creator_id"`
-	CarpoolName        string    `json:"carpool_name" db:"carpool_name"`
-	Status             bool      `json:"status" db:"status"`
-	RecurringOption    string    `json:"recurring_option" db:"recurring_option"`
-	AvailableSeats     int       `json:"available_seats" db:"available_seats"`
-	DestinationAddress string    `json:"destination_address" db:"destination_address"`
-	Seats              int       `json:"seats" db:"seats"`
-	CreatedAt          time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt          time.Time `json:"updated_at" db:"updated_at"`
+	ID                 uuid.UUID  `json:"id" db:"id"`
+	CreatorID          string     `json:"creator_id" db:"creator_id"`
+	CarpoolName        string     `json:"carpool_name" db:"carpool_name"`
+	Status             bool       `json:"status" db:"status"`
+	RecurringOption    string     `json:"recurring_option" db:"recurring_option"`
+	AvailableSeats     int        `json:"available_seats" db:"available_seats"`
+	DestinationAddress string     `json:"destination_address" db:"destination_address"`
+	Seats              int        `json:"seats" db:"seats"`
+	OriginAddress      string     `json:"origin_address" db:"origin_address"`
+	OriginLat          *float64   `json:"origin_lat,omitempty" db:"origin_lat"`
+	OriginLng          *float64   `json:"origin_lng,omitempty" db:"origin_lng"`
+	DestinationLat     *float64   `json:"destination_lat,omitempty" db:"destination_lat"`
+	DestinationLng     *float64   `json:"destination_lng,omitempty" db:"destination_lng"`
+	DepartureTime      string     `json:"departure_time" db:"departure_time"`
+	ScheduleDays       string     `json:"schedule_days" db:"schedule_days"`
+	MusicPreference    string     `json:"music_preference" db:"music_preference"`
+	SmokingAllowed     bool       `json:"smoking_allowed" db:"smoking_allowed"`
+	PetsAllowed        bool       `json:"pets_allowed" db:"pets_allowed"`
+	SchoolName         string     `json:"school_name" db:"school_name"`
+	OrganizationID     *uuid.UUID `json:"organization_id,omitempty" db:"organization_id"`
+	Visibility         string     `json:"visibility" db:"visibility"`
+	CreatedAt          time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at" db:"updated_at"`
+
+	// MemberRating aggregates the ratings of the carpool's members. It is filled
+	// in for search and recommendation results.
+	MemberRating *RatingSummary `json:"member_rating,omitempty"`
 }
 
 // CarpoolMember represents a member of a carpool
@@ -25,55 +42,104 @@ type CarpoolMember struct {
 	ID        uuid.UUID `json:"id" db:"id"`
 	CarpoolID uuid.UUID `json:"carpool_id" db:"carpool_id"`
 	UserID    uuid.UUID `json:"user_id" db:"user_id"`
+	Role      string    `json:"role" db:"role"`
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
 }
 
 // CarpoolRide represents a specific ride instance
 type CarpoolRide struct {
-	ID          uuid.UUID `json:"id" db:"id"`
-	CarpoolID   uuid.UUID `json:"carpool_id" db:"carpool_id"`
-	DriverID    uuid.UUID `json:"driver_id" db:"driver_id"`
-	Status      int       `json:"status" db:"status"`
-	LocationLat float64   `json:"location_lat" db:"location_lat"`
-	LocationLng float64   `json:"location_lng" db:"location_lng"`
-	MilesSaved  float64   `json:"miles_saved" db:"miles_saved"`
-	CreatedAt   time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
-	Stops       []Stop    `json:"stops,omitempty"`
+	ID          uuid.UUID  `json:"id" db:"id"`
+	CarpoolID   uuid.UUID  `json:"carpool_id" db:"carpool_id"`
+	DriverID    uuid.UUID  `json:"driver_id" db:"driver_id"`
+	Status      int        `json:"status" db:"status"`
+	LocationLat float64    `json:"location_lat" db:"location_lat"`
+	LocationLng float64    `json:"location_lng" db:"location_lng"`
+	MilesSaved  float64    `json:"miles_saved" db:"miles_saved"`
+	ScheduledAt *time.Time `json:"scheduled_at,omitempty" db:"scheduled_at"`
+	StartedAt   *time.Time `json:"started_at,omitempty" db:"started_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty" db:"completed_at"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
+	Stops       []Stop     `json:"stops,omitempty"`
+	ETAs        []StopETA  `json:"etas,omitempty"`
+}
+
+// Participants maps the driver and each rider with a stop on the ride to their role
+func (r *CarpoolRide) Participants() map[uuid.UUID]string {
+	participants := map[uuid.UUID]string{r.DriverID: RideRoleDriver}
+	for _, stop := range r.Stops {
+		if _, ok := participants[stop.UserID]; !ok && stop.UserID != uuid.Nil {
+			participants[stop.UserID] = RideRoleRider
+		}
+	}
+	return participants
+}
+
+// OccurredAt is when the ride happened: its completion, else its scheduled time,
+// else when it was created
+func (r *CarpoolRide) OccurredAt() time.Time {
+	switch {
+	case r.CompletedAt != nil:
+		return *r.CompletedAt
+	case r.ScheduledAt != nil:
+		return *r.ScheduledAt
+	}
+	return r.CreatedAt
 }
 
 // Stop represents a stop in a carpool ride
 type Stop struct {
-	ID            uuid.UUID `json:"id" db:"id"`
-	CarpoolRideID uuid.UUID `json:"carpool_ride_id" db:"carpool_ride_id"`
-	Address       string    `json:"address" db:"address"`
-	StopOrder     int       `json:"stop_order" db:"stop_order"`
-	StopType      string    `json:"stop_type" db:"stop_type"`
-	UserID        uuid.UUID `json:"user_id" db:"user_id"`
-	CreatedAt     time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at" db:"updated_at"`
+	ID              uuid.UUID  `json:"id" db:"id"`
+	CarpoolRideID   uuid.UUID  `json:"carpool_ride_id" db:"carpool_ride_id"`
+	Address         string     `json:"address" db:"address"`
+	StopOrder       int        `json:"stop_order" db:"stop_order"`
+	StopType        string     `json:"stop_type" db:"stop_type"`
+	UserID          uuid.UUID  `json:"user_id" db:"user_id"`
+	Lat             *float64   `json:"lat,omitempty" db:"lat"`
+	Lng             *float64   `json:"lng,omitempty" db:"lng"`
+	GeofenceRadiusM *float64   `json:"geofence_radius_m,omitempty" db:"geofence_radius_m"`
+	ScheduledAt     *time.Time `json:"scheduled_at,omitempty" db:"scheduled_at"`
+	ArrivedAt       *time.Time `json:"arrived_at,omitempty" db:"arrived_at"`
+	DepartedAt      *time.Time `json:"departed_at,omitempty" db:"departed_at"`
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at" db:"updated_at"`
 }
 
 // Invite represents a carpool invitation
 type Invite struct {
-	ID        uuid.UUID `json:"id" db:"id"`
-	FromUser  uuid.UUID `json:"from_user" db:"from_user"`
-	ToUser    uuid.UUID `json:"to_user" db:"to_user"`
-	CarpoolID uuid.UUID `json:"carpool_id" db:"carpool_id"`
-	Message   string    `json:"message" db:"message"`
-	Status    int       `json:"status" db:"status"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	ID             uuid.UUID  `json:"id" db:"id"`
+	FromUser       uuid.UUID  `json:"from_user" db:"from_user"`
+	ToUser         *uuid.UUID `json:"to_user,omitempty" db:"to_user"`
+	ToEmail        string     `json:"to_email,omitempty" db:"to_email"`
+	ToPhone        string     `json:"to_phone,omitempty" db:"to_phone"`
+	CarpoolID      uuid.UUID  `json:"carpool_id" db:"carpool_id"`
+	Message        string     `json:"message" db:"message"`
+	Status         int        `json:"status" db:"status"`
+	ExpiresAt      time.Time  `json:"expires_at" db:"expires_at"`
+	ReminderSentAt *time.Time `json:"reminder_sent_at,omitempty" db:"reminder_sent_at"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at" db:"updated_at"`
 }
 
 // CreateCarPoolRequest represents the request structure for creating a new carpool
 type CreateCarPoolRequest struct {
-	CarpoolName        string `json:"carpool_name"`
-	RecurringOption    string `json:"recurring_option"`
-	AvailableSeats     int    `json:"available_seats"`
-	DestinationAddress string `json:"destination_address"`
-	Seats              int    `json:"seats"`
+	CarpoolName        string   `json:"carpool_name"`
+	RecurringOption    string   `json:"recurring_option"`
+	AvailableSeats     int      `json:"available_seats"`
+	DestinationAddress string   `json:"destination_address"`
+	Seats              int      `json:"seats"`
+	OriginAddress      string   `json:"origin_address"`
+	OriginLat          *float64 `json:"origin_lat,omitempty"`
+	OriginLng          *float64 `json:"origin_lng,omitempty"`
+	DestinationLat     *float64 `json:"destination_lat,omitempty"`
+	DestinationLng     *float64 `json:"destination_lng,omitempty"`
+	DepartureTime      string   `json:"departure_time"`
+	ScheduleDays       string   `json:"schedule_days"`
+	MusicPreference    string   `json:"music_preference"`
+	SmokingAllowed     bool     `json:"smoking_allowed"`
+	PetsAllowed        bool     `json:"pets_allowed"`
+	SchoolName         string   `json:"school_name"`
 }
 
 // UpdateCarPoolRequest represents the request structure for updating a carpool
@@ -88,16 +154,21 @@ type UpdateCarPoolRequest struct {
 
 // CreateRideRequest represents the request structure for creating a new ride
 type CreateRideRequest struct {
-	CarpoolID uuid.UUID     `json:"carpool_id"`
-	Stops     []StopRequest `json:"stops"`
+	CarpoolID   uuid.UUID     `json:"carpool_id"`
+	ScheduledAt *time.Time    `json:"scheduled_at,omitempty"`
+	Stops       []StopRequest `json:"stops"`
 }
 
 // StopRequest represents the request structure for a stop
 type StopRequest struct {
-	Address   string    `json:"address"`
-	StopOrder int       `json:"stop_order"`
-	StopType  string    `json:"stop_type"`
-	UserID    uuid.UUID `json:"user_id"`
+	Address         string     `json:"address"`
+	StopOrder       int        `json:"stop_order"`
+	StopType        string     `json:"stop_type"`
+	UserID          uuid.UUID  `json:"user_id"`
+	Lat             *float64   `json:"lat,omitempty"`
+	Lng             *float64   `json:"lng,omitempty"`
+	GeofenceRadiusM *float64   `json:"geofence_radius_m,omitempty"`
+	ScheduledAt     *time.Time `json:"scheduled_at,omitempty"`
 }
 
 type SearchFilters struct {
@@ -108,6 +179,8 @@ type SearchFilters struct {
 	MusicPreference *string    `json:"music_preference,omitempty"`
 	SmokingAllowed  *bool      `json:"smoking_allowed,omitempty"`
 	PetsAllowed     *bool      `json:"pets_allowed,omitempty"`
+	MinRating       *float64   `json:"min_rating,omitempty"`
+	OrganizationID  *uuid.UUID `json:"organization_id,omitempty"`
 }
 
 // CreateCarPoolMemberRequest represents the request structure for adding a member to a carpool
@@ -116,11 +189,14 @@ type CreateCarPoolMemberRequest struct {
 	UserID    uuid.UUID `json:"user_id"`
 }
 
-// CreateInviteRequest represents the request structure for creating a carpool invitation
+// CreateInviteRequest represents the request structure for creating a carpool invitation.
+// Exactly one of ToUser, ToEmail or ToPhone identifies the recipient.
 type CreateInviteRequest struct {
-	ToUser    uuid.UUID `json:"to_user"`
-	CarpoolID uuid.UUID `json:"carpool_id"`
-	Message   string    `json:"message"`
+	ToUser    *uuid.UUID `json:"to_user,omitempty"`
+	ToEmail   string     `json:"to_email,omitempty"`
+	ToPhone   string     `json:"to_phone,omitempty"`
+	CarpoolID uuid.UUID  `json:"carpool_id"`
+	Message   string     `json:"message"`
 }
 
 // UpdateInviteRequest represents the request structure for updating an invitation status
@@ -130,8 +206,30 @@ type UpdateInviteRequest struct {
 
 // Add these constants for invite status
 const (
-	InviteStatusPending  = 0
-	InviteStatusAccepted = 1
-	InviteStatusRejected = 2
+	InviteStatusPending   = 0
+	InviteStatusAccepted  = 1
+	InviteStatusRejected  = 2
+	InviteStatusWithdrawn = 3
+	InviteStatusExpired   = 4
+)
+
+// Ride status values for carpool_rides.status
+const (
+	RideStatusScheduled  = 0
+	RideStatusInProgress = 1
+	RideStatusCompleted  = 2
+	RideStatusCancelled  = 3
 )
 
+// Roles a user can have on a ride
+const (
+	RideRoleDriver = "DRIVER"
+	RideRoleRider  = "RIDER"
+)
+
+// Stop types for carpool_stops.stop_type
+const (
+	StopTypeStart        = "START"
+	StopTypeIntermediate = "INTERMEDIATE"
+	StopTypeDestination  = "DESTINATION"
+)
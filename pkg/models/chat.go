@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Chat limits
+const (
+	ChatMessageMaxLength = 4000
+	// ChatEditWindow is how long after sending a message its sender can still edit it
+	ChatEditWindow = 15 * time.Minute
+)
+
+// ChatMessage is a message in a carpool's group chat. Deleted messages keep
+// their place in the history with the body cleared.
+type ChatMessage struct {
+	ID            uuid.UUID  `json:"id" db:"id"`
+	CarpoolID     uuid.UUID  `json:"carpool_id" db:"carpool_id"`
+	CarpoolRideID *uuid.UUID `json:"carpool_ride_id,omitempty" db:"carpool_ride_id"`
+	SenderID      uuid.UUID  `json:"sender_id" db:"sender_id"`
+	Body          string     `json:"body" db:"body"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+	EditedAt      *time.Time `json:"edited_at,omitempty" db:"edited_at"`
+	DeletedAt     *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+}
+
+// SendChatMessageRequest represents the request structure for posting a chat message
+type SendChatMessageRequest struct {
+	Body          string     `json:"body"`
+	CarpoolRideID *uuid.UUID `json:"carpool_ride_id,omitempty"`
+}
+
+// EditChatMessageRequest represents the request structure for editing a chat message
+type EditChatMessageRequest struct {
+	Body string `json:"body"`
+}
+
+// ChatHistoryResponse is a page of chat history, newest first.
+// NextCursor fetches the older page and is empty on the last page.
+type ChatHistoryResponse struct {
+	Messages   []ChatMessage `json:"messages"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+// ChatReadReceipt records the newest message a member has read
+type ChatReadReceipt struct {
+	CarpoolID         uuid.UUID `json:"carpool_id" db:"carpool_id"`
+	UserID            uuid.UUID `json:"user_id" db:"user_id"`
+	LastReadMessageID uuid.UUID `json:"last_read_message_id" db:"last_read_message_id"`
+	LastReadAt        time.Time `json:"last_read_at" db:"last_read_at"`
+}
+
+// MarkChatReadRequest represents the request structure for updating a read receipt
+type MarkChatReadRequest struct {
+	MessageID uuid.UUID `json:"message_id"`
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MaxClosureDates caps how many dates a single import may add
+const MaxClosureDates = 1000
+
+// ClosureCalendar is a named set of dates school is closed. Dates are local
+// to the calendar's timezone.
+type ClosureCalendar struct {
+	ID        uuid.UUID     `json:"id" db:"id"`
+	Name      string        `json:"name" db:"name"`
+	Timezone  string        `json:"timezone" db:"timezone"`
+	CreatedBy uuid.UUID     `json:"created_by" db:"created_by"`
+	CreatedAt time.Time     `json:"created_at" db:"created_at"`
+	Dates     []ClosureDate `json:"dates,omitempty"`
+}
+
+// ClosureDate is one day a calendar marks as closed. Date is "YYYY-MM-DD".
+type ClosureDate struct {
+	Date   string `json:"date" db:"closed_on"`
+	Reason string `json:"reason,omitempty" db:"reason"`
+}
+
+// ClosureImportResponse reports the outcome of importing a closure calendar
+type ClosureImportResponse struct {
+	Calendar       ClosureCalendar `json:"calendar"`
+	DatesImported  int             `json:"dates_imported"`
+	RidesCancelled int             `json:"rides_cancelled"`
+}
+
+// AttachClosureCalendarResponse reports the rides cancelled by attaching a calendar
+type AttachClosureCalendarResponse struct {
+	CalendarID     uuid.UUID `json:"calendar_id"`
+	RidesCancelled int       `json:"rides_cancelled"`
+}
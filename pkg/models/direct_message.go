@@ -0,0 +1,103 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Conversation is a one-to-one thread between two users
+type Conversation struct {
+	ID            uuid.UUID  `json:"id" db:"id"`
+	UserA         uuid.UUID  `json:"user_a" db:"user_a"`
+	UserB         uuid.UUID  `json:"user_b" db:"user_b"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+	LastMessageAt *time.Time `json:"last_message_at,omitempty" db:"last_message_at"`
+}
+
+// Includes reports whether the user is one of the conversation's participants
+func (c *Conversation) Includes(userID uuid.UUID) bool {
+	return c.UserA == userID || c.UserB == userID
+}
+
+// Other returns the participant who is not userID
+func (c *Conversation) Other(userID uuid.UUID) uuid.UUID {
+	if c.UserA == userID {
+		return c.UserB
+	}
+	return c.UserA
+}
+
+// ConversationListItem is a conversation as shown in the user's inbox
+type ConversationListItem struct {
+	Conversation
+	OtherUserID      uuid.UUID `json:"other_user_id"`
+	OtherDisplayName string    `json:"other_display_name"`
+	UnreadCount      int       `json:"unread_count"`
+}
+
+// DirectMessage is a message in a one-to-one conversation
+type DirectMessage struct {
+	ID             uuid.UUID  `json:"id" db:"id"`
+	ConversationID uuid.UUID  `json:"conversation_id" db:"conversation_id"`
+	SenderID       uuid.UUID  `json:"sender_id" db:"sender_id"`
+	Body           string     `json:"body" db:"body"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+	ReadAt         *time.Time `json:"read_at,omitempty" db:"read_at"`
+}
+
+// StartConversationRequest represents the request structure for opening a conversation
+type StartConversationRequest struct {
+	UserID uuid.UUID `json:"user_id"`
+}
+
+// SendDirectMessageRequest represents the request structure for sending a direct message
+type SendDirectMessageRequest struct {
+	Body string `json:"body"`
+}
+
+// DirectMessageHistoryResponse is a page of a conversation, newest first
+type DirectMessageHistoryResponse struct {
+	Messages   []DirectMessage `json:"messages"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// UserBlock records that one user blocked another
+type UserBlock struct {
+	BlockerID uuid.UUID `json:"blocker_id" db:"blocker_id"`
+	BlockedID uuid.UUID `json:"blocked_id" db:"blocked_id"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// MessageReport is a direct message flagged for moderator review
+type MessageReport struct {
+	ID              uuid.UUID  `json:"id" db:"id"`
+	DirectMessageID uuid.UUID  `json:"direct_message_id" db:"direct_message_id"`
+	ReporterID      uuid.UUID  `json:"reporter_id" db:"reporter_id"`
+	ReportedUserID  uuid.UUID  `json:"reported_user_id" db:"reported_user_id"`
+	Reason          string     `json:"reason" db:"reason"`
+	Status          string     `json:"status" db:"status"`
+	ReviewedBy      *uuid.UUID `json:"reviewed_by,omitempty" db:"reviewed_by"`
+	ReviewedAt      *time.Time `json:"reviewed_at,omitempty" db:"reviewed_at"`
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+
+	// MessageBody is the reported message text, filled in for the moderation queue
+	MessageBody string `json:"message_body,omitempty"`
+}
+
+// CreateMessageReportRequest represents the request structure for reporting a message
+type CreateMessageReportRequest struct {
+	Reason string `json:"reason"`
+}
+
+// ResolveMessageReportRequest represents the request structure for a moderator decision
+type ResolveMessageReportRequest struct {
+	Status string `json:"status"`
+}
+
+// Message report statuses
+const (
+	ReportStatusOpen      = "OPEN"
+	ReportStatusDismissed = "DISMISSED"
+	ReportStatusActioned  = "ACTIONED"
+)
@@ -0,0 +1,130 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Expense categories
+const (
+	ExpenseCategoryFuel    = "FUEL"
+	ExpenseCategoryToll    = "TOLL"
+	ExpenseCategoryParking = "PARKING"
+	ExpenseCategoryOther   = "OTHER"
+)
+
+// Rules for splitting an expense among a ride's riders
+const (
+	// SplitRuleEqual gives every rider the same share
+	SplitRuleEqual = "EQUAL"
+	// SplitRulePerMile weights each rider by the distance they rode
+	SplitRulePerMile = "PER_MILE"
+	// SplitRulePerSeat weights each rider by the seats they take
+	SplitRulePerSeat = "PER_SEAT"
+)
+
+const MaxExpenseDescriptionLength = 500
+
+// Expense is a cost the driver paid for a ride. Amounts are integer minor units
+// (cents) of Currency.
+type Expense struct {
+	ID            uuid.UUID      `json:"id" db:"id"`
+	CarpoolID     uuid.UUID      `json:"carpool_id" db:"carpool_id"`
+	CarpoolRideID uuid.UUID      `json:"carpool_ride_id" db:"carpool_ride_id"`
+	PayerID       uuid.UUID      `json:"payer_id" db:"payer_id"`
+	Category      string         `json:"category" db:"category"`
+	AmountMinor   int64          `json:"amount_minor" db:"amount_minor"`
+	Currency      string         `json:"currency" db:"currency"`
+	SplitRule     string         `json:"split_rule" db:"split_rule"`
+	Description   string         `json:"description" db:"description"`
+	CreatedAt     time.Time      `json:"created_at" db:"created_at"`
+	Shares        []ExpenseShare `json:"shares"`
+}
+
+// ExpenseShare is what one rider owes the payer for an expense
+type ExpenseShare struct {
+	UserID      uuid.UUID `json:"user_id" db:"user_id"`
+	AmountMinor int64     `json:"amount_minor" db:"amount_minor"`
+}
+
+type CreateExpenseRequest struct {
+	Category    string `json:"category"`
+	AmountMinor int64  `json:"amount_minor"`
+	// Currency and SplitRule default to the carpool's settings
+	Currency    string `json:"currency,omitempty"`
+	SplitRule   string `json:"split_rule,omitempty"`
+	Description string `json:"description"`
+}
+
+type ExpenseListResponse struct {
+	Expenses   []Expense `json:"expenses"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+// ExpenseSettings are a carpool's defaults for new expenses
+type ExpenseSettings struct {
+	SplitRule string `json:"split_rule"`
+	Currency  string `json:"currency"`
+}
+
+type UpdateExpenseSettingsRequest struct {
+	SplitRule *string `json:"split_rule,omitempty"`
+	Currency  *string `json:"currency,omitempty"`
+}
+
+type UpdateMemberSeatsRequest struct {
+	Seats int `json:"seats"`
+}
+
+// Settlement statuses. A settlement the payer records stays pending until the
+// payee confirms or rejects it; only confirmed settlements count in balances.
+const (
+	SettlementStatusPending   = "PENDING"
+	SettlementStatusConfirmed = "CONFIRMED"
+	SettlementStatusRejected  = "REJECTED"
+)
+
+// Settlement is a payment one member made another to settle up
+type Settlement struct {
+	ID          uuid.UUID  `json:"id" db:"id"`
+	CarpoolID   uuid.UUID  `json:"carpool_id" db:"carpool_id"`
+	FromUserID  uuid.UUID  `json:"from_user_id" db:"from_user_id"`
+	ToUserID    uuid.UUID  `json:"to_user_id" db:"to_user_id"`
+	AmountMinor int64      `json:"amount_minor" db:"amount_minor"`
+	Currency    string     `json:"currency" db:"currency"`
+	Status      string     `json:"status" db:"status"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	DecidedAt   *time.Time `json:"decided_at,omitempty" db:"decided_at"`
+}
+
+type CreateSettlementRequest struct {
+	ToUserID    uuid.UUID `json:"to_user_id"`
+	AmountMinor int64     `json:"amount_minor"`
+	Currency    string    `json:"currency,omitempty"`
+}
+
+// MemberBalance is a member's running position in one currency. A positive
+// NetMinor is owed to the member, a negative one is owed by them.
+type MemberBalance struct {
+	UserID        uuid.UUID `json:"user_id"`
+	Currency      string    `json:"currency"`
+	PaidMinor     int64     `json:"paid_minor"`
+	OwedMinor     int64     `json:"owed_minor"`
+	SentMinor     int64     `json:"sent_minor"`
+	ReceivedMinor int64     `json:"received_minor"`
+	NetMinor      int64     `json:"net_minor"`
+}
+
+// Transfer is a payment that, with the others suggested, settles every balance
+type Transfer struct {
+	FromUserID  uuid.UUID `json:"from_user_id"`
+	ToUserID    uuid.UUID `json:"to_user_id"`
+	AmountMinor int64     `json:"amount_minor"`
+	Currency    string    `json:"currency"`
+}
+
+type BalancesResponse struct {
+	Balances  []MemberBalance `json:"balances"`
+	Transfers []Transfer      `json:"transfers"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Incident types recorded against a driver or rider
+const (
+	IncidentTypeLate         = "LATE"
+	IncidentTypeDriverNoShow = "DRIVER_NO_SHOW"
+	IncidentTypeRiderNoShow  = "RIDER_NO_SHOW"
+)
+
+// RideIncident represents a late arrival or no-show on a ride
+type RideIncident struct {
+	ID            uuid.UUID  `json:"id" db:"id"`
+	CarpoolRideID uuid.UUID  `json:"carpool_ride_id" db:"carpool_ride_id"`
+	CarpoolStopID *uuid.UUID `json:"carpool_stop_id,omitempty" db:"carpool_stop_id"`
+	UserID        uuid.UUID  `json:"user_id" db:"user_id"`
+	IncidentType  string     `json:"incident_type" db:"incident_type"`
+	Details       string     `json:"details" db:"details"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+}
+
+// ReliabilityScore summarises a user's incident history
+type ReliabilityScore struct {
+	UserID        uuid.UUID `json:"user_id"`
+	LateCount     int       `json:"late_count"`
+	NoShowCount   int       `json:"no_show_count"`
+	IncidentCount int       `json:"incident_count"`
+}
+
+// RideAlert is sent to carpool members when the monitor flags a ride
+type RideAlert struct {
+	CarpoolID     uuid.UUID  `json:"carpool_id"`
+	CarpoolRideID uuid.UUID  `json:"carpool_ride_id"`
+	CarpoolStopID *uuid.UUID `json:"carpool_stop_id,omitempty"`
+	IncidentType  string     `json:"incident_type"`
+	Message       string     `json:"message"`
+}
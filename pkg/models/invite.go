@@ -0,0 +1,43 @@
+package models
+
+import "github.com/google/uuid"
+
+// CarpoolSummary is the subset of a carpool shown alongside related records
+type CarpoolSummary struct {
+	ID                 uuid.UUID `json:"id"`
+	CarpoolName        string    `json:"carpool_name"`
+	DestinationAddress string    `json:"destination_address"`
+	AvailableSeats     int       `json:"available_seats"`
+}
+
+// InviteListItem is an invite in the current user's inbox or outbox
+type InviteListItem struct {
+	Invite
+	Direction         string         `json:"direction"`
+	SenderDisplayName string         `json:"sender_display_name"`
+	Carpool           CarpoolSummary `json:"carpool"`
+}
+
+// InviteListFilter narrows the invites returned for a user.
+// Box is "received", "sent" or empty for both.
+type InviteListFilter struct {
+	Box       string
+	Status    *int
+	CarpoolID *uuid.UUID
+	Limit     int
+	Offset    int
+}
+
+// InviteListResponse is a page of invites
+type InviteListResponse struct {
+	Invites []InviteListItem `json:"invites"`
+	Total   int              `json:"total"`
+	Limit   int              `json:"limit"`
+	Offset  int              `json:"offset"`
+}
+
+// Invite list directions
+const (
+	InviteBoxReceived = "received"
+	InviteBoxSent     = "sent"
+)
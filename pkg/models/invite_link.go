@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// InviteLink is a shareable, expiring link or code that admits its holder to a carpool
+type InviteLink struct {
+	ID        uuid.UUID  `json:"id" db:"id"`
+	CarpoolID uuid.UUID  `json:"carpool_id" db:"carpool_id"`
+	CreatedBy uuid.UUID  `json:"created_by" db:"created_by"`
+	Code      string     `json:"code" db:"code"`
+	ExpiresAt time.Time  `json:"expires_at" db:"expires_at"`
+	MaxUses   *int       `json:"max_uses,omitempty" db:"max_uses"`
+	UseCount  int        `json:"use_count" db:"use_count"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	// Token is the signed link token; it is only returned when the link is created
+	Token string `json:"token,omitempty"`
+}
+
+// CreateInviteLinkRequest represents the request structure for creating an invite link.
+// SingleUse is shorthand for MaxUses of 1.
+type CreateInviteLinkRequest struct {
+	ExpiresInHours int  `json:"expires_in_hours"`
+	MaxUses        *int `json:"max_uses,omitempty"`
+	SingleUse      bool `json:"single_use"`
+}
+
+// RedeemInviteLinkRequest redeems either a signed link token or a short code
+type RedeemInviteLinkRequest struct {
+	Token string `json:"token,omitempty"`
+	Code  string `json:"code,omitempty"`
+}
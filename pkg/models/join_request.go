@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// JoinRequest is a user's request to join a carpool they found
+type JoinRequest struct {
+	ID        uuid.UUID  `json:"id" db:"id"`
+	CarpoolID uuid.UUID  `json:"carpool_id" db:"carpool_id"`
+	UserID    uuid.UUID  `json:"user_id" db:"user_id"`
+	Message   string     `json:"message" db:"message"`
+	Status    int        `json:"status" db:"status"`
+	DecidedBy *uuid.UUID `json:"decided_by,omitempty" db:"decided_by"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// CreateJoinRequestRequest represents the request structure for asking to join a carpool
+type CreateJoinRequestRequest struct {
+	Message string `json:"message"`
+}
+
+// UpdateMemberRoleRequest represents the request structure for changing a member's role
+type UpdateMemberRoleRequest struct {
+	Role string `json:"role"`
+}
+
+// Join request status values. Requests an admin approves while the carpool is
+// full are waitlisted, and promoted to approved in order of creation as seats
+// free up.
+const (
+	JoinRequestStatusPending    = 0
+	JoinRequestStatusApproved   = 1
+	JoinRequestStatusDenied     = 2
+	JoinRequestStatusWaitlisted = 3
+	JoinRequestStatusCancelled  = 4
+)
+
+// Carpool member roles
+const (
+	MemberRoleMember = "MEMBER"
+	MemberRoleAdmin  = "ADMIN"
+)
@@ -0,0 +1,16 @@
+package models
+
+// MatchScoreComponent is one weighted factor of a carpool recommendation score
+type MatchScoreComponent struct {
+	Factor      string  `json:"factor"`
+	Score       float64 `json:"score"`
+	Weight      float64 `json:"weight"`
+	Explanation string  `json:"explanation"`
+}
+
+// CarpoolRecommendation is a carpool suggested to a user along with why it was suggested
+type CarpoolRecommendation struct {
+	Carpool    Carpool               `json:"carpool"`
+	Score      float64               `json:"score"`
+	Components []MatchScoreComponent `json:"components"`
+}
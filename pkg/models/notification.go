@@ -0,0 +1,122 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Notification event types
+const (
+	NotificationInviteReceived  = "INVITE_RECEIVED"
+	NotificationInviteAccepted  = "INVITE_ACCEPTED"
+	NotificationInviteExpiring  = "INVITE_EXPIRING"
+	NotificationRideStarted     = "RIDE_STARTED"
+	NotificationRideArriving    = "RIDE_ARRIVING"
+	NotificationChildDroppedOff = "CHILD_DROPPED_OFF"
+	NotificationScheduleChanged = "SCHEDULE_CHANGED"
+	NotificationRideAlert       = "RIDE_ALERT"
+	NotificationRideReminder    = "RIDE_REMINDER"
+	NotificationJoinedCarpool   = "JOINED_CARPOOL"
+)
+
+// Notification delivery channels
+const (
+	ChannelPush  = "push"
+	ChannelEmail = "email"
+	ChannelSMS   = "sms"
+	ChannelInApp = "in_app"
+)
+
+// DefaultNotificationChannels lists the channels each event is delivered on
+// unless the user's preferences say otherwise.
+var DefaultNotificationChannels = map[string][]string{
+	NotificationInviteReceived:  {ChannelPush, ChannelEmail, ChannelInApp},
+	NotificationInviteAccepted:  {ChannelPush, ChannelInApp},
+	NotificationInviteExpiring:  {ChannelPush, ChannelEmail, ChannelInApp},
+	NotificationRideStarted:     {ChannelPush, ChannelInApp},
+	NotificationRideArriving:    {ChannelPush, ChannelInApp},
+	NotificationChildDroppedOff: {ChannelPush, ChannelInApp},
+	NotificationScheduleChanged: {ChannelPush, ChannelEmail, ChannelInApp},
+	NotificationRideAlert:       {ChannelPush, ChannelSMS, ChannelInApp},
+	NotificationRideReminder:    {ChannelPush, ChannelInApp},
+	NotificationJoinedCarpool:   {ChannelPush, ChannelEmail, ChannelInApp},
+}
+
+// UrgentNotifications are delivered on every enabled channel even during quiet hours
+var UrgentNotifications = map[string]bool{
+	NotificationChildDroppedOff: true,
+	NotificationRideAlert:       true,
+}
+
+// Notification is a message about something that happened, delivered to a user
+type Notification struct {
+	Type  string            `json:"type"`
+	Title string            `json:"title"`
+	Body  string            `json:"body"`
+	Data  map[string]string `json:"data,omitempty"`
+}
+
+// NotificationRecipient is who a notification is delivered to. Invites to people
+// without an account have no UserID, only an email or phone.
+type NotificationRecipient struct {
+	UserID uuid.UUID `json:"user_id,omitempty"`
+	Name   string    `json:"name,omitempty"`
+	Email  string    `json:"email,omitempty"`
+	Phone  string    `json:"phone,omitempty"`
+}
+
+// NotificationSettings are a user's notification preferences and quiet hours.
+// Preferences maps event type to channel to enabled and overrides DefaultNotificationChannels.
+// Quiet hours are "HH:MM" in Timezone and may wrap past midnight.
+type NotificationSettings struct {
+	Preferences     map[string]map[string]bool `json:"preferences"`
+	QuietHoursStart string                     `json:"quiet_hours_start,omitempty"`
+	QuietHoursEnd   string                     `json:"quiet_hours_end,omitempty"`
+	Timezone        string                     `json:"timezone"`
+}
+
+// UpdateNotificationSettingsRequest represents the request structure for changing notification settings.
+// Preferences are merged into the existing ones; empty quiet hours clear them.
+type UpdateNotificationSettingsRequest struct {
+	Preferences     map[string]map[string]bool `json:"preferences,omitempty"`
+	QuietHoursStart *string                    `json:"quiet_hours_start,omitempty"`
+	QuietHoursEnd   *string                    `json:"quiet_hours_end,omitempty"`
+	Timezone        *string                    `json:"timezone,omitempty"`
+}
+
+// FeedNotification is an entry in a user's in-app notification inbox.
+// Link is the app path of the carpool, ride or invite it is about.
+type FeedNotification struct {
+	ID            uuid.UUID         `json:"id" db:"id"`
+	UserID        uuid.UUID         `json:"user_id" db:"user_id"`
+	Type          string            `json:"type" db:"type"`
+	Title         string            `json:"title" db:"title"`
+	Body          string            `json:"body" db:"body"`
+	Data          map[string]string `json:"data,omitempty" db:"data"`
+	CarpoolID     *uuid.UUID        `json:"carpool_id,omitempty" db:"carpool_id"`
+	CarpoolRideID *uuid.UUID        `json:"carpool_ride_id,omitempty" db:"carpool_ride_id"`
+	InviteID      *uuid.UUID        `json:"invite_id,omitempty" db:"invite_id"`
+	Link          string            `json:"link" db:"link"`
+	ReadAt        *time.Time        `json:"read_at,omitempty" db:"read_at"`
+	CreatedAt     time.Time         `json:"created_at" db:"created_at"`
+}
+
+// NotificationFeedResponse is a page of the inbox, newest first
+type NotificationFeedResponse struct {
+	Notifications []FeedNotification `json:"notifications"`
+	NextCursor    string             `json:"next_cursor,omitempty"`
+	UnreadCount   int                `json:"unread_count"`
+}
+
+// UnreadCountResponse carries the number of unread inbox entries
+type UnreadCountResponse struct {
+	UnreadCount int `json:"unread_count"`
+}
+
+// NotificationFeedEvent is published on the user's realtime topic whenever
+// their inbox changes
+type NotificationFeedEvent struct {
+	Notification *FeedNotification `json:"notification,omitempty"`
+	UnreadCount  int               `json:"unread_count"`
+}
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Organization kinds
+const (
+	OrganizationKindSchool    = "SCHOOL"
+	OrganizationKindWorkplace = "WORKPLACE"
+	OrganizationKindOther     = "OTHER"
+)
+
+// Organization member roles and statuses
+const (
+	OrgRoleAdmin  = "ADMIN"
+	OrgRoleMember = "MEMBER"
+
+	OrgMemberPending = "PENDING"
+	OrgMemberActive  = "ACTIVE"
+)
+
+// How an organization membership was verified
+const (
+	OrgVerifiedCreator  = "CREATOR"
+	OrgVerifiedDomain   = "DOMAIN"
+	OrgVerifiedCode     = "CODE"
+	OrgVerifiedApproval = "APPROVAL"
+)
+
+// Carpool visibility
+const (
+	// CarpoolVisibilityPublic carpools are visible to everyone
+	CarpoolVisibilityPublic = "PUBLIC"
+	// CarpoolVisibilityOrganization carpools are visible only to active members
+	// of their organization, and to their own members
+	CarpoolVisibilityOrganization = "ORGANIZATION"
+)
+
+// Email domain review decisions
+const (
+	EmailDomainApproved = "APPROVED"
+	EmailDomainRejected = "REJECTED"
+)
+
+// Organization is a school or workplace that carpools belong to. Users join by
+// email domain only once a platform moderator approved the domain; until then
+// it is pending. The join code and pending domains are only shown to the
+// organization's admins.
+type Organization struct {
+	ID                  uuid.UUID `json:"id" db:"id"`
+	Name                string    `json:"name" db:"name"`
+	Kind                string    `json:"kind" db:"kind"`
+	EmailDomains        []string  `json:"email_domains" db:"email_domains"`
+	PendingEmailDomains []string  `json:"pending_email_domains,omitempty" db:"pending_email_domains"`
+	JoinCode            string    `json:"join_code,omitempty" db:"join_code"`
+	CreatedBy           uuid.UUID `json:"created_by" db:"created_by"`
+	CreatedAt           time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt           time.Time `json:"updated_at" db:"updated_at"`
+
+	// Membership is the requesting user's membership, if any
+	Membership *OrganizationMember `json:"membership,omitempty"`
+}
+
+type OrganizationMember struct {
+	OrganizationID uuid.UUID  `json:"organization_id" db:"organization_id"`
+	UserID         uuid.UUID  `json:"user_id" db:"user_id"`
+	Name           string     `json:"name,omitempty"`
+	Role           string     `json:"role" db:"role"`
+	Status         string     `json:"status" db:"status"`
+	VerifiedVia    string     `json:"verified_via" db:"verified_via"`
+	ApprovedBy     *uuid.UUID `json:"approved_by,omitempty" db:"approved_by"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+type CreateOrganizationRequest struct {
+	Name         string   `json:"name"`
+	Kind         string   `json:"kind"`
+	EmailDomains []string `json:"email_domains"`
+	// EnableJoinCode generates a join code for the organization
+	EnableJoinCode bool `json:"enable_join_code"`
+}
+
+// ReviewEmailDomainsRequest is a moderator's decision on some of an
+// organization's pending email domains, or all of them when Domains is empty
+type ReviewEmailDomainsRequest struct {
+	Domains []string `json:"domains,omitempty"`
+	Status  string   `json:"status"`
+}
+
+type UpdateOrganizationRequest struct {
+	Name         *string  `json:"name,omitempty"`
+	EmailDomains []string `json:"email_domains,omitempty"`
+	// JoinCode is "rotate" to issue a new code or "disable" to turn code joins off
+	JoinCode string `json:"join_code,omitempty"`
+}
+
+// JoinOrganizationRequest joins by code when JoinCode is set. Without a code the
+// user joins by verified email domain when it matches, or asks an admin for
+// approval.
+type JoinOrganizationRequest struct {
+	JoinCode string `json:"join_code,omitempty"`
+}
+
+type UpdateOrgMemberRoleRequest struct {
+	Role string `json:"role"`
+}
+
+// SetCarpoolOrganizationRequest moves a carpool into an organization, or out of
+// one when OrganizationID is nil
+type SetCarpoolOrganizationRequest struct {
+	OrganizationID *uuid.UUID `json:"organization_id"`
+	Visibility     string     `json:"visibility"`
+}
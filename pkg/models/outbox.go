@@ -0,0 +1,82 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Domain event types written to the outbox
+const (
+	EventCarpoolCreated   = "carpool.created"
+	EventMemberJoined     = "carpool.member_joined"
+	EventMemberLeft       = "carpool.member_left"
+	EventWaitlistPromoted = "carpool.waitlist_promoted"
+	EventInviteCreated    = "invite.created"
+	EventInviteAccepted   = "invite.accepted"
+	EventInviteRejected   = "invite.rejected"
+	EventInviteReminder   = "invite.reminder"
+	EventRideStarted      = "ride.started"
+	EventRideCompleted    = "ride.completed"
+	EventRideCancelled    = "ride.cancelled"
+	EventRideReminder     = "ride.reminder"
+)
+
+// OutboxEvent is a domain event awaiting or past delivery to subscribers
+type OutboxEvent struct {
+	ID             uuid.UUID       `json:"id" db:"id"`
+	EventType      string          `json:"event_type" db:"event_type"`
+	AggregateID    uuid.UUID       `json:"aggregate_id" db:"aggregate_id"`
+	Payload        json.RawMessage `json:"payload" db:"payload"`
+	Attempts       int             `json:"attempts" db:"attempts"`
+	LastError      *string         `json:"last_error,omitempty" db:"last_error"`
+	AvailableAt    time.Time       `json:"available_at" db:"available_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty" db:"delivered_at"`
+	DeadLetteredAt *time.Time      `json:"dead_lettered_at,omitempty" db:"dead_lettered_at"`
+	CreatedAt      time.Time       `json:"created_at" db:"created_at"`
+}
+
+// CarpoolCreatedEvent is the payload of carpool.created
+type CarpoolCreatedEvent struct {
+	CarpoolID uuid.UUID `json:"carpool_id"`
+	CreatorID string    `json:"creator_id"`
+}
+
+// MembershipEvent is the payload of carpool.member_joined, carpool.member_left
+// and carpool.waitlist_promoted
+type MembershipEvent struct {
+	CarpoolID uuid.UUID `json:"carpool_id"`
+	UserID    uuid.UUID `json:"user_id"`
+}
+
+// InviteEvent is the payload of invite.created, invite.accepted, invite.rejected
+// and invite.reminder
+type InviteEvent struct {
+	Invite Invite `json:"invite"`
+}
+
+// RideEvent is the payload of ride.started, ride.completed and ride.cancelled.
+// Cancelled rides carry when they were scheduled and why they were cancelled.
+type RideEvent struct {
+	RideID      uuid.UUID  `json:"ride_id"`
+	CarpoolID   uuid.UUID  `json:"carpool_id"`
+	DriverID    uuid.UUID  `json:"driver_id"`
+	ScheduledAt *time.Time `json:"scheduled_at,omitempty"`
+	Reason      string     `json:"reason,omitempty"`
+}
+
+// Ride reminder kinds: the driver is reminded the evening before, riders shortly before
+const (
+	RideReminderDriver = "DRIVER"
+	RideReminderRiders = "RIDERS"
+)
+
+// RideReminderEvent is the payload of ride.reminder
+type RideReminderEvent struct {
+	RideID      uuid.UUID `json:"ride_id"`
+	CarpoolID   uuid.UUID `json:"carpool_id"`
+	DriverID    uuid.UUID `json:"driver_id"`
+	Kind        string    `json:"kind"`
+	ScheduledAt time.Time `json:"scheduled_at"`
+}
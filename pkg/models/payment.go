@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Payment statuses. Only PENDING payments change status.
+const (
+	PaymentStatusPending   = "PENDING"
+	PaymentStatusSucceeded = "SUCCEEDED"
+	PaymentStatusFailed    = "FAILED"
+	PaymentStatusCanceled  = "CANCELED"
+)
+
+// Payment is a transfer between members made through a payment provider. Once
+// it succeeds it is recorded in the ledger as SettlementID.
+type Payment struct {
+	ID               uuid.UUID  `json:"id" db:"id"`
+	CarpoolID        uuid.UUID  `json:"carpool_id" db:"carpool_id"`
+	FromUserID       uuid.UUID  `json:"from_user_id" db:"from_user_id"`
+	ToUserID         uuid.UUID  `json:"to_user_id" db:"to_user_id"`
+	AmountMinor      int64      `json:"amount_minor" db:"amount_minor"`
+	Currency         string     `json:"currency" db:"currency"`
+	Provider         string     `json:"provider" db:"provider"`
+	ProviderIntentID string     `json:"provider_intent_id,omitempty" db:"provider_intent_id"`
+	Status           string     `json:"status" db:"status"`
+	FailureReason    string     `json:"failure_reason,omitempty" db:"failure_reason"`
+	SettlementID     *uuid.UUID `json:"settlement_id,omitempty" db:"settlement_id"`
+	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+type CreatePaymentRequest struct {
+	ToUserID    uuid.UUID `json:"to_user_id"`
+	AmountMinor int64     `json:"amount_minor"`
+	Currency    string    `json:"currency,omitempty"`
+}
+
+// CreatePaymentResponse carries the client secret the app hands to the
+// provider's SDK to confirm the payment
+type CreatePaymentResponse struct {
+	Payment      *Payment `json:"payment"`
+	ClientSecret string   `json:"client_secret"`
+}
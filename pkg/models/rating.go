@@ -0,0 +1,66 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MaxReviewLength caps the optional text of a rating
+const MaxReviewLength = 2000
+
+// Rating statuses. Disputed ratings still count until a moderator hides them.
+const (
+	RatingStatusVisible  = "VISIBLE"
+	RatingStatusDisputed = "DISPUTED"
+	RatingStatusHidden   = "HIDDEN"
+)
+
+// Rating is one participant's score and review of another after a completed ride
+type Rating struct {
+	ID            uuid.UUID  `json:"id" db:"id"`
+	CarpoolRideID uuid.UUID  `json:"carpool_ride_id" db:"carpool_ride_id"`
+	RaterID       uuid.UUID  `json:"rater_id" db:"rater_id"`
+	RateeID       uuid.UUID  `json:"ratee_id" db:"ratee_id"`
+	RateeRole     string     `json:"ratee_role" db:"ratee_role"`
+	Score         int        `json:"score" db:"score"`
+	Review        string     `json:"review,omitempty" db:"review"`
+	Status        string     `json:"status" db:"status"`
+	DisputeReason string     `json:"dispute_reason,omitempty" db:"dispute_reason"`
+	DisputedAt    *time.Time `json:"disputed_at,omitempty" db:"disputed_at"`
+	ReviewedBy    *uuid.UUID `json:"reviewed_by,omitempty" db:"reviewed_by"`
+	ReviewedAt    *time.Time `json:"reviewed_at,omitempty" db:"reviewed_at"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+}
+
+// RatingSummary is the aggregate of a user's, or a carpool's members', ratings
+type RatingSummary struct {
+	Average *float64 `json:"average,omitempty"`
+	Count   int      `json:"count"`
+}
+
+// CreateRatingRequest represents the request structure for rating another ride participant
+type CreateRatingRequest struct {
+	RateeID uuid.UUID `json:"ratee_id"`
+	Score   int       `json:"score"`
+	Review  string    `json:"review"`
+}
+
+// DisputeRatingRequest represents the request structure for disputing a rating received
+type DisputeRatingRequest struct {
+	Reason string `json:"reason"`
+}
+
+// ResolveRatingDisputeRequest represents a moderator's decision to keep or hide a
+// disputed rating
+type ResolveRatingDisputeRequest struct {
+	Status string `json:"status"`
+}
+
+// RatingListResponse is a page of a user's ratings, newest first.
+// NextCursor fetches the older page and is empty on the last page.
+type RatingListResponse struct {
+	Summary    RatingSummary `json:"summary"`
+	Ratings    []Rating      `json:"ratings"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Reasons points are awarded for
+const (
+	RewardReasonRideCompleted = "RIDE_COMPLETED"
+	RewardReasonDrivingTurn   = "DRIVING_TURN"
+	RewardReasonOnTime        = "ON_TIME"
+	RewardReasonPerfectWeek   = "PERFECT_WEEK"
+)
+
+// Leaderboard periods
+const (
+	LeaderboardPeriodWeek  = "week"
+	LeaderboardPeriodMonth = "month"
+	LeaderboardPeriodAll   = "all"
+)
+
+// Badge describes an achievement. Only the code is stored; names and
+// descriptions come from the rewards engine's rules.
+type Badge struct {
+	Code        string `json:"code"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type UserBadge struct {
+	Badge
+	AwardedAt time.Time `json:"awarded_at"`
+}
+
+// RewardProfile is a user's points, on-time streaks and badges
+type RewardProfile struct {
+	UserID        uuid.UUID   `json:"user_id"`
+	Points        int         `json:"points"`
+	CurrentStreak int         `json:"current_streak"`
+	BestStreak    int         `json:"best_streak"`
+	Badges        []UserBadge `json:"badges"`
+}
+
+type LeaderboardEntry struct {
+	Rank   int       `json:"rank"`
+	UserID uuid.UUID `json:"user_id"`
+	Name   string    `json:"name"`
+	Points int       `json:"points"`
+}
+
+type LeaderboardResponse struct {
+	Period  string             `json:"period"`
+	Entries []LeaderboardEntry `json:"entries"`
+}
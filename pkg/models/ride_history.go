@@ -0,0 +1,34 @@
+package models
+
+import "github.com/google/uuid"
+
+// Attendance of a participant on a completed ride, from the incidents recorded
+const (
+	AttendancePresent = "PRESENT"
+	AttendanceLate    = "LATE"
+	AttendanceNoShow  = "NO_SHOW"
+)
+
+// RideAttendance is whether a participant turned up for a ride
+type RideAttendance struct {
+	UserID uuid.UUID `json:"user_id"`
+	Role   string    `json:"role"`
+	Status string    `json:"status"`
+}
+
+// RideHistoryEntry is a past ride the user drove or rode in. Role is the user's
+// role on it. Attendance is empty for cancelled rides.
+type RideHistoryEntry struct {
+	CarpoolRide
+	CarpoolName string           `json:"carpool_name"`
+	DriverName  string           `json:"driver_name"`
+	Role        string           `json:"role"`
+	Attendance  []RideAttendance `json:"attendance"`
+}
+
+// RideHistoryResponse is a page of ride history, most recent first.
+// NextCursor fetches the older page and is empty on the last page.
+type RideHistoryResponse struct {
+	Rides      []RideHistoryEntry `json:"rides"`
+	NextCursor string             `json:"next_cursor,omitempty"`
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Savings report bucket sizes
+const (
+	SavingsBucketDay   = "day"
+	SavingsBucketWeek  = "week"
+	SavingsBucketMonth = "month"
+)
+
+// Savings report scopes
+const (
+	SavingsScopeUser         = "user"
+	SavingsScopeCarpool      = "carpool"
+	SavingsScopeSchool       = "school"
+	SavingsScopeOrganization = "organization"
+)
+
+// SavingsFactors are the emission factor and fuel price a report was computed
+// with. The fuel price is in integer minor units of Currency, as expenses are.
+type SavingsFactors struct {
+	KgCO2PerGallon          float64 `json:"kg_co2_per_gallon"`
+	FuelPriceMinorPerGallon int64   `json:"fuel_price_minor_per_gallon"`
+	Currency                string  `json:"currency"`
+	DefaultMPG              float64 `json:"default_mpg"`
+}
+
+// SavingsFigures are the totals for a period. Fuel is estimated from each ride's
+// miles saved and the driver's vehicle fuel economy, or the default when unset.
+// The cost saved is in integer minor units.
+type SavingsFigures struct {
+	Rides              int     `json:"rides"`
+	MilesSaved         float64 `json:"miles_saved"`
+	FuelGallonsSaved   float64 `json:"fuel_gallons_saved"`
+	CO2KgAvoided       float64 `json:"co2_kg_avoided"`
+	FuelCostSavedMinor int64   `json:"fuel_cost_saved_minor"`
+}
+
+// SavingsBucket is one day, week or month of a report, starting at Start in the
+// requesting user's timezone
+type SavingsBucket struct {
+	Start time.Time `json:"start"`
+	SavingsFigures
+}
+
+type SavingsReport struct {
+	Scope   string          `json:"scope"`
+	ScopeID *uuid.UUID      `json:"scope_id,omitempty"`
+	School  string          `json:"school,omitempty"`
+	From    time.Time       `json:"from"`
+	To      time.Time       `json:"to"`
+	Bucket  string          `json:"bucket"`
+	Factors SavingsFactors  `json:"factors"`
+	Totals  SavingsFigures  `json:"totals"`
+	Buckets []SavingsBucket `json:"buckets"`
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Geofence event types for ride stops
+const (
+	StopEventArriving = "arriving"
+	StopEventArrived  = "arrived"
+	StopEventDeparted = "departed"
+)
+
+// StopEvent is a geofence transition detected from a driver location ping
+type StopEvent struct {
+	ID            uuid.UUID `json:"id" db:"id"`
+	CarpoolID     uuid.UUID `json:"carpool_id"`
+	CarpoolRideID uuid.UUID `json:"carpool_ride_id" db:"carpool_ride_id"`
+	CarpoolStopID uuid.UUID `json:"carpool_stop_id" db:"carpool_stop_id"`
+	StopType      string    `json:"stop_type,omitempty"`
+	EventType     string    `json:"event_type" db:"event_type"`
+	Lat           float64   `json:"lat" db:"lat"`
+	Lng           float64   `json:"lng" db:"lng"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+}
+
+// LocationUpdate is a driver location ping for an active ride
+type LocationUpdate struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+// StopETA is the estimated arrival time at a stop the ride has not yet reached.
+// DistanceM is the straight-line distance still to travel to get there.
+type StopETA struct {
+	StopID      uuid.UUID  `json:"stop_id"`
+	StopOrder   int        `json:"stop_order"`
+	Address     string     `json:"address"`
+	DistanceM   float64    `json:"distance_m"`
+	ETA         time.Time  `json:"eta"`
+	ScheduledAt *time.Time `json:"scheduled_at,omitempty"`
+}
+
+// PrecedenceConstraint requires one rider to be picked up before another
+type PrecedenceConstraint struct {
+	BeforeUserID uuid.UUID `json:"before_user_id"`
+	AfterUserID  uuid.UUID `json:"after_user_id"`
+}
+
+// OptimizeRouteRequest asks for the best order of a ride's pickups.
+// Stops must include one START and one DESTINATION, and every stop needs coordinates.
+type OptimizeRouteRequest struct {
+	Stops []StopRequest `json:"stops"`
+	// PickupFirst lists riders who must be picked up before everyone else
+	PickupFirst []uuid.UUID            `json:"pickup_first,omitempty"`
+	Precedence  []PrecedenceConstraint `json:"precedence,omitempty"`
+}
+
+// OptimizedRoute is the proposed stop order along with the savings over the submitted order
+type OptimizedRoute struct {
+	Stops                []StopRequest `json:"stops"`
+	Solver               string        `json:"solver"`
+	TotalDistanceM       float64       `json:"total_distance_m"`
+	EstimatedDurationSec int64         `json:"estimated_duration_sec"`
+	OriginalDistanceM    float64       `json:"original_distance_m"`
+	OriginalDurationSec  int64         `json:"original_duration_sec"`
+	DistanceSavedM       float64       `json:"distance_saved_m"`
+	TimeSavedSec         int64         `json:"time_saved_sec"`
+}
@@ -7,15 +7,32 @@ import (
 )
 
 type User struct {
-	ID          uuid.UUID `json:"id" db:"id"`
-	ClerkID     string    `json:"clerk_id" db:"clerk_id"`
-	Email       string    `json:"email" db:"email"`
-	Name        string    `json:"name" db:"name"`
-	DisplayName string    `json:"display_name" db:"display_name"`
-	City        string    `json:"city" db:"city"`
-	State       string    `json:"state" db:"state"`
-	CreatedAt   time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+	ID            uuid.UUID `json:"id" db:"id"`
+	ClerkID       string    `json:"clerk_id" db:"clerk_id"`
+	Email         string    `json:"email" db:"email"`
+	EmailVerified bool      `json:"email_verified" db:"email_verified"`
+	Phone         string    `json:"phone,omitempty" db:"phone"`
+	Name          string    `json:"name" db:"name"`
+	DisplayName   string    `json:"display_name" db:"display_name"`
+	City          string    `json:"city" db:"city"`
+	State         string    `json:"state" db:"state"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at" db:"updated_at"`
+
+	HomeLat                *float64 `json:"home_lat,omitempty" db:"home_lat"`
+	HomeLng                *float64 `json:"home_lng,omitempty" db:"home_lng"`
+	DestinationLat         *float64 `json:"destination_lat,omitempty" db:"destination_lat"`
+	DestinationLng         *float64 `json:"destination_lng,omitempty" db:"destination_lng"`
+	PreferredDepartureTime string   `json:"preferred_departure_time" db:"preferred_departure_time"`
+	PreferredDays          string   `json:"preferred_days" db:"preferred_days"`
+	MusicPreference        string   `json:"music_preference" db:"music_preference"`
+	SmokingOK              bool     `json:"smoking_ok" db:"smoking_ok"`
+	PetsOK                 bool     `json:"pets_ok" db:"pets_ok"`
+	SchoolName             string   `json:"school_name" db:"school_name"`
+	VehicleMPG             *float64 `json:"vehicle_mpg,omitempty" db:"vehicle_mpg"`
+
+	// Rating aggregates the ratings other ride participants gave the user
+	Rating RatingSummary `json:"rating"`
 }
 
 type CreateUserRequest struct {
@@ -27,7 +44,18 @@ type CreateUserRequest struct {
 }
 
 type UpdateUserProfile struct {
-	DisplayName *string `json:"display_name,omitempty"`
-	City        *string `json:"city,omitempty"`
-	State       *string `json:"state,omitempty"`
+	DisplayName            *string  `json:"display_name,omitempty"`
+	City                   *string  `json:"city,omitempty"`
+	State                  *string  `json:"state,omitempty"`
+	HomeLat                *float64 `json:"home_lat,omitempty"`
+	HomeLng                *float64 `json:"home_lng,omitempty"`
+	DestinationLat         *float64 `json:"destination_lat,omitempty"`
+	DestinationLng         *float64 `json:"destination_lng,omitempty"`
+	PreferredDepartureTime *string  `json:"preferred_departure_time,omitempty"`
+	PreferredDays          *string  `json:"preferred_days,omitempty"`
+	MusicPreference        *string  `json:"music_preference,omitempty"`
+	SmokingOK              *bool    `json:"smoking_ok,omitempty"`
+	PetsOK                 *bool    `json:"pets_ok,omitempty"`
+	SchoolName             *string  `json:"school_name,omitempty"`
+	VehicleMPG             *float64 `json:"vehicle_mpg,omitempty"`
 }
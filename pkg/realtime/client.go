@@ -0,0 +1,171 @@
+package realtime
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	writeWait  = 10 * time.Second
+	pongWait   = 60 * time.Second
+	pingPeriod = (pongWait * 9) / 10
+	sendBuffer = 64
+)
+
+// Authorizer decides whether a user may subscribe to a topic
+type Authorizer func(userID uuid.UUID, topic string) bool
+
+// request is a control frame sent by the client over the socket
+type request struct {
+	Action string `json:"action"`
+	Topic  string `json:"topic"`
+}
+
+// Client is a single WebSocket connection subscribed to zero or more topics
+type Client struct {
+	hub       *Hub
+	conn      *websocket.Conn
+	userID    uuid.UUID
+	authorize Authorizer
+	send      chan []byte
+
+	mu     sync.Mutex
+	topics map[string]bool
+	closed bool
+}
+
+// Serve registers the connection with the hub and pumps messages until it closes.
+// Clients subscribe by sending {"action":"subscribe","topic":"..."}.
+func (h *Hub) Serve(conn *websocket.Conn, userID uuid.UUID, authorize Authorizer) {
+	client := &Client{
+		hub:       h,
+		conn:      conn,
+		userID:    userID,
+		authorize: authorize,
+		send:      make(chan []byte, sendBuffer),
+		topics:    make(map[string]bool),
+	}
+
+	go client.writePump()
+	client.readPump()
+}
+
+// Subscribe adds the client to a topic without an authorization check.
+// It is used for topics the server subscribes on the client's behalf.
+func (c *Client) Subscribe(topic string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed || c.topics[topic] {
+		return
+	}
+	c.topics[topic] = true
+	c.hub.subscribe(c, topic)
+}
+
+func (c *Client) unsubscribe(topic string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.topics[topic] {
+		return
+	}
+	delete(c.topics, topic)
+	c.hub.unsubscribe(c, topic)
+}
+
+// Close removes the client from all topics and closes the connection
+func (c *Client) Close() {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.closed = true
+	topics := c.topics
+	c.topics = nil
+	c.mu.Unlock()
+
+	for topic := range topics {
+		c.hub.unsubscribe(c, topic)
+	}
+	close(c.send)
+	c.conn.Close()
+}
+
+func (c *Client) readPump() {
+	defer c.Close()
+
+	c.conn.SetReadLimit(4096)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		var req request
+		if err := c.conn.ReadJSON(&req); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Printf("{\"severity\":\"WARNING\",\"message\":\"Realtime connection closed: %v\"}", err)
+			}
+			return
+		}
+
+		switch req.Action {
+		case "subscribe":
+			if c.authorize == nil || !c.authorize(c.userID, req.Topic) {
+				c.reply(req.Topic, "error", "forbidden")
+				continue
+			}
+			c.Subscribe(req.Topic)
+			c.reply(req.Topic, "subscribed", nil)
+		case "unsubscribe":
+			c.unsubscribe(req.Topic)
+			c.reply(req.Topic, "unsubscribed", nil)
+		default:
+			c.reply(req.Topic, "error", "unknown action")
+		}
+	}
+}
+
+func (c *Client) reply(topic, msgType string, data interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	payload, err := encode(Message{Topic: topic, Type: msgType, Data: data})
+	if err != nil {
+		return
+	}
+	select {
+	case c.send <- payload:
+	default:
+	}
+}
+
+func (c *Client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case payload, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, payload); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package realtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// Message is the envelope pushed to subscribers of a topic
+type Message struct {
+	Topic string      `json:"topic"`
+	Type  string      `json:"type"`
+	Data  interface{} `json:"data"`
+}
+
+// RideTopic is the topic carrying live updates for a single ride
+func RideTopic(rideID uuid.UUID) string {
+	return fmt.Sprintf("ride:%s", rideID)
+}
+
+// ChatTopic is the topic carrying a carpool's group chat
+func ChatTopic(carpoolID uuid.UUID) string {
+	return fmt.Sprintf("chat:%s", carpoolID)
+}
+
+// ConversationTopic is the topic carrying a direct message conversation
+func ConversationTopic(conversationID uuid.UUID) string {
+	return fmt.Sprintf("dm:%s", conversationID)
+}
+
+// UserTopic is the topic carrying a user's own notification inbox
+func UserTopic(userID uuid.UUID) string {
+	return fmt.Sprintf("user:%s", userID)
+}
+
+// Hub fans published messages out to the clients subscribed to each topic
+type Hub struct {
+	mu     sync.RWMutex
+	topics map[string]map[*Client]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{topics: make(map[string]map[*Client]struct{})}
+}
+
+// Publish sends a message to every client subscribed to the topic.
+// Slow clients that cannot keep up are dropped rather than blocking the publisher.
+func (h *Hub) Publish(topic, msgType string, data interface{}) {
+	payload, err := encode(Message{Topic: topic, Type: msgType, Data: data})
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to encode realtime message for %s: %v\"}", topic, err)
+		return
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for client := range h.topics[topic] {
+		select {
+		case client.send <- payload:
+		default:
+			go client.Close()
+		}
+	}
+}
+
+func (h *Hub) subscribe(client *Client, topic string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.topics[topic] == nil {
+		h.topics[topic] = make(map[*Client]struct{})
+	}
+	h.topics[topic][client] = struct{}{}
+}
+
+func (h *Hub) unsubscribe(client *Client, topic string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.topics[topic], client)
+	if len(h.topics[topic]) == 0 {
+		delete(h.topics, topic)
+	}
+}
+
+// SubscriberCount returns how many clients are subscribed to the topic
+func (h *Hub) SubscriberCount(topic string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.topics[topic])
+}
+
+func encode(msg Message) ([]byte, error) {
+	return json.Marshal(msg)
+}
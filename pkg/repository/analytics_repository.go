@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"car-backend/pkg/models"
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type AnalyticsRepository struct {
+	db *sql.DB
+}
+
+func NewAnalyticsRepository(db *sql.DB) *AnalyticsRepository {
+	return &AnalyticsRepository{db: db}
+}
+
+// Get returns the user's counters, or nil when they have not been computed yet
+func (r *AnalyticsRepository) Get(ctx context.Context, userID uuid.UUID) (*models.UserAnalytics, error) {
+	analytics := &models.UserAnalytics{}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT user_id, number_of_carpools, number_of_completed_rides,
+		       number_of_completed_rides_as_driver, driving_miles_saved, updated_at
+		FROM user_analytics
+		WHERE user_id = $1`,
+		userID,
+	).Scan(
+		&analytics.UserID,
+		&analytics.NumberOfCarpools,
+		&analytics.NumberOfCompletedRides,
+		&analytics.NumberOfCompletedRidesAsDriver,
+		&analytics.DrivingMilesSaved,
+		&analytics.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get user analytics: %w", err)
+	}
+	return analytics, nil
+}
+
+// Refresh recomputes the counters of the given users from memberships and
+// completed rides. It returns how many users' counters changed.
+func (r *AnalyticsRepository) Refresh(ctx context.Context, userIDs []uuid.UUID) (int, error) {
+	if len(userIDs) == 0 {
+		return 0, nil
+	}
+	ids := make([]string, len(userIDs))
+	for i, id := range userIDs {
+		ids[i] = id.String()
+	}
+	return r.refresh(ctx, pq.Array(ids))
+}
+
+// RefreshAll recomputes every user's counters, correcting any drift. It returns
+// how many users' counters changed.
+func (r *AnalyticsRepository) RefreshAll(ctx context.Context) (int, error) {
+	return r.refresh(ctx, nil)
+}
+
+// refresh upserts recomputed counters for the users in ids, or all users when
+// ids is nil. Rows whose counters are already right are left alone.
+func (r *AnalyticsRepository) refresh(ctx context.Context, ids interface{}) (int, error) {
+	result, err := r.db.ExecContext(ctx, `
+		WITH participation AS (
+			SELECT r.driver_id AS user_id, r.id AS ride_id, TRUE AS as_driver, COALESCE(r.miles_saved, 0) AS miles_saved
+			FROM carpool_rides r
+			WHERE r.status = $2 AND ($1::uuid[] IS NULL OR r.driver_id = ANY($1::uuid[]))
+			UNION
+			SELECT s.user_id, r.id, FALSE, COALESCE(r.miles_saved, 0)
+			FROM carpool_rides r
+			JOIN carpool_stops s ON s.carpool_ride_id = r.id
+			WHERE r.status = $2 AND s.user_id <> r.driver_id
+			  AND ($1::uuid[] IS NULL OR s.user_id = ANY($1::uuid[]))
+		),
+		rides AS (
+			SELECT user_id,
+			       COUNT(*) AS completed,
+			       COUNT(*) FILTER (WHERE as_driver) AS as_driver,
+			       ROUND(SUM(miles_saved))::int AS miles_saved
+			FROM participation
+			GROUP BY user_id
+		),
+		memberships AS (
+			SELECT user_id, COUNT(*) AS carpools
+			FROM carpool_members
+			WHERE $1::uuid[] IS NULL OR user_id = ANY($1::uuid[])
+			GROUP BY user_id
+		)
+		INSERT INTO user_analytics (
+			user_id, number_of_carpools, number_of_completed_rides,
+			number_of_completed_rides_as_driver, driving_miles_saved
+		)
+		SELECT u.id, COALESCE(m.carpools, 0), COALESCE(rd.completed, 0),
+		       COALESCE(rd.as_driver, 0), COALESCE(rd.miles_saved, 0)
+		FROM users u
+		LEFT JOIN memberships m ON m.user_id = u.id
+		LEFT JOIN rides rd ON rd.user_id = u.id
+		WHERE $1::uuid[] IS NULL OR u.id = ANY($1::uuid[])
+		ON CONFLICT (user_id) DO UPDATE
+		SET number_of_carpools = EXCLUDED.number_of_carpools,
+		    number_of_completed_rides = EXCLUDED.number_of_completed_rides,
+		    number_of_completed_rides_as_driver = EXCLUDED.number_of_completed_rides_as_driver,
+		    driving_miles_saved = EXCLUDED.driving_miles_saved,
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE (user_analytics.number_of_carpools, user_analytics.number_of_completed_rides,
+		       user_analytics.number_of_completed_rides_as_driver, user_analytics.driving_miles_saved)
+		    IS DISTINCT FROM
+		      (EXCLUDED.number_of_carpools, EXCLUDED.number_of_completed_rides,
+		       EXCLUDED.number_of_completed_rides_as_driver, EXCLUDED.driving_miles_saved)`,
+		ids, models.RideStatusCompleted,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to refresh user analytics: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get affected rows: %v", err)
+	}
+	return int(rowsAffected), nil
+}
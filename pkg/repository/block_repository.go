@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"car-backend/pkg/models"
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+type BlockRepository struct {
+	db *sql.DB
+}
+
+func NewBlockRepository(db *sql.DB) *BlockRepository {
+	return &BlockRepository{db: db}
+}
+
+// Block stops the two users messaging or inviting each other. Pending invites
+// between them are withdrawn so they cannot be acted on.
+func (r *BlockRepository) Block(ctx context.Context, blockerID, blockedID uuid.UUID) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO user_blocks (blocker_id, blocked_id)
+		VALUES ($1, $2)
+		ON CONFLICT (blocker_id, blocked_id) DO NOTHING`,
+		blockerID, blockedID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to block user: %v", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE invites
+		SET status = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE COALESCE(status, 0) = $4
+		  AND ((from_user = $1 AND to_user = $2) OR (from_user = $2 AND to_user = $1))`,
+		blockerID, blockedID, models.InviteStatusWithdrawn, models.InviteStatusPending,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to withdraw invites: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	return nil
+}
+
+func (r *BlockRepository) Unblock(ctx context.Context, blockerID, blockedID uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx,
+		`DELETE FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2`,
+		blockerID, blockedID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to unblock user: %w", err)
+	}
+
+	return nil
+}
+
+// ListBlocks returns the users the blocker has blocked, most recent first
+func (r *BlockRepository) ListBlocks(ctx context.Context, blockerID uuid.UUID) ([]models.UserBlock, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT blocker_id, blocked_id, created_at
+		FROM user_blocks
+		WHERE blocker_id = $1
+		ORDER BY created_at DESC`,
+		blockerID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list blocks: %w", err)
+	}
+	defer rows.Close()
+
+	blocks := []models.UserBlock{}
+	for rows.Next() {
+		var block models.UserBlock
+		if err := rows.Scan(&block.BlockerID, &block.BlockedID, &block.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan block: %w", err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	return blocks, rows.Err()
+}
+
+// IsBlocked reports whether either user has blocked the other
+func (r *BlockRepository) IsBlocked(ctx context.Context, userID, otherID uuid.UUID) (bool, error) {
+	var blocked bool
+	err := r.db.QueryRowContext(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM user_blocks
+			WHERE (blocker_id = $1 AND blocked_id = $2) OR (blocker_id = $2 AND blocked_id = $1)
+		)`,
+		userID, otherID,
+	).Scan(&blocked)
+	if err != nil {
+		return false, fmt.Errorf("failed to check block: %w", err)
+	}
+
+	return blocked, nil
+}
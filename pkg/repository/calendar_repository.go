@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"car-backend/pkg/models"
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+type CalendarRepository struct {
+	db *sql.DB
+}
+
+func NewCalendarRepository(db *sql.DB) *CalendarRepository {
+	return &CalendarRepository{db: db}
+}
+
+// CreateFeed stores a new feed for the user, or for the user and carpool, and
+// revokes the one it replaces so an old URL stops working.
+func (r *CalendarRepository) CreateFeed(ctx context.Context, userID uuid.UUID, carpoolID *uuid.UUID, tokenHash string) (*models.CalendarFeed, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := revokeFeed(ctx, tx, userID, carpoolID); err != nil {
+		return nil, err
+	}
+
+	feed := &models.CalendarFeed{UserID: userID, CarpoolID: carpoolID}
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO calendar_feeds (user_id, carpool_id, token_hash)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at`,
+		userID, carpoolID, tokenHash,
+	).Scan(&feed.ID, &feed.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create calendar feed: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	return feed, nil
+}
+
+// RevokeFeed disables the user's live feed, or their feed for the carpool
+func (r *CalendarRepository) RevokeFeed(ctx context.Context, userID uuid.UUID, carpoolID *uuid.UUID) (int64, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	revoked, err := revokeFeed(ctx, tx, userID, carpoolID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	return revoked, nil
+}
+
+func revokeFeed(ctx context.Context, tx *sql.Tx, userID uuid.UUID, carpoolID *uuid.UUID) (int64, error) {
+	result, err := tx.ExecContext(ctx, `
+		UPDATE calendar_feeds
+		SET revoked_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND carpool_id IS NOT DISTINCT FROM $2 AND revoked_at IS NULL`,
+		userID, carpoolID,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke calendar feed: %v", err)
+	}
+	return result.RowsAffected()
+}
+
+// GetFeedByTokenHash returns the live feed with the token hash, or nil
+func (r *CalendarRepository) GetFeedByTokenHash(ctx context.Context, tokenHash string) (*models.CalendarFeed, error) {
+	feed := &models.CalendarFeed{}
+
+	err := r.db.QueryRowContext(ctx, `
+		SELECT id, user_id, carpool_id, created_at, revoked_at
+		FROM calendar_feeds
+		WHERE token_hash = $1 AND revoked_at IS NULL`,
+		tokenHash,
+	).Scan(&feed.ID, &feed.UserID, &feed.CarpoolID, &feed.CreatedAt, &feed.RevokedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get calendar feed: %w", err)
+	}
+
+	return feed, nil
+}
@@ -6,7 +6,9 @@ import (
     "database/sql"
     "fmt"
 	"log"
+	"time"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 type CarPoolRideRepository struct {
@@ -28,13 +30,13 @@ func (r *CarPoolRideRepository) CreateCarpoolRide(ctx context.Context, ride *mod
 
 	query := `
 			INSERT INTO carpool_rides (
-				carpool_id, driver_id, status, location_lat, location_lng, miles_saved
-			) VALUES ($1, $2, $3, $4, $5, $6)
+				carpool_id, driver_id, status, location_lat, location_lng, miles_saved, scheduled_at
+			) VALUES ($1, $2, $3, $4, $5, $6, $7)
 			RETURNING id, created_at, updated_at
 	`
 
 	err = tx.QueryRowContext(ctx, query,
-			ride.CarpoolID, ride.DriverID, ride.Status, ride.LocationLat, ride.LocationLng, ride.MilesSaved,
+			ride.CarpoolID, ride.DriverID, ride.Status, ride.LocationLat, ride.LocationLng, ride.MilesSaved, ride.ScheduledAt,
 	).Scan(&ride.ID, &ride.CreatedAt, &ride.UpdatedAt)
 
 	if err != nil {
@@ -42,6 +44,32 @@ func (r *CarPoolRideRepository) CreateCarpoolRide(ctx context.Context, ride *mod
 			return fmt.Errorf("failed to create carpool ride: %w", err)
 	}
 
+	stopQuery := `
+			INSERT INTO carpool_stops (
+				carpool_ride_id, address, stop_order, stop_type, user_id,
+				lat, lng, geofence_radius_m, scheduled_at
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			RETURNING id, created_at, updated_at
+	`
+
+	for i := range ride.Stops {
+			stop := &ride.Stops[i]
+			stop.CarpoolRideID = ride.ID
+
+			var userID *uuid.UUID
+			if stop.UserID != uuid.Nil {
+					userID = &stop.UserID
+			}
+
+			err = tx.QueryRowContext(ctx, stopQuery,
+					stop.CarpoolRideID, stop.Address, stop.StopOrder, stop.StopType, userID,
+					stop.Lat, stop.Lng, stop.GeofenceRadiusM, stop.ScheduledAt,
+			).Scan(&stop.ID, &stop.CreatedAt, &stop.UpdatedAt)
+			if err != nil {
+					return fmt.Errorf("failed to create carpool stop: %w", err)
+			}
+	}
+
 	log.Printf("Carpool ride created successfully: %v", ride.ID)
 
 	if err := tx.Commit(); err != nil {
@@ -55,7 +83,8 @@ func (r *CarPoolRideRepository) GetCarpoolRide(ctx context.Context, rideID uuid.
 	ride := &models.CarpoolRide{}
 
 	query := `
-			SELECT id, carpool_id, driver_id, status, location_lat, location_lng, miles_saved, created_at, updated_at
+			SELECT id, carpool_id, driver_id, status, location_lat, location_lng, miles_saved,
+			       scheduled_at, started_at, completed_at, created_at, updated_at
 			FROM carpool_rides
 			WHERE id = $1
 	`
@@ -68,6 +97,9 @@ func (r *CarPoolRideRepository) GetCarpoolRide(ctx context.Context, rideID uuid.
 			&ride.LocationLat,
 			&ride.LocationLng,
 			&ride.MilesSaved,
+			&ride.ScheduledAt,
+			&ride.StartedAt,
+			&ride.CompletedAt,
 			&ride.CreatedAt,
 			&ride.UpdatedAt,
 	)
@@ -78,5 +110,667 @@ func (r *CarPoolRideRepository) GetCarpoolRide(ctx context.Context, rideID uuid.
 			return nil, fmt.Errorf("failed to get carpool ride: %w", err)
 	}
 
+	stops, err := r.GetStops(ctx, ride.ID)
+	if err != nil {
+			return nil, err
+	}
+	ride.Stops = stops
+
 	return ride, nil
+}
+
+// GetStops returns the stops of a ride in stop order
+func (r *CarPoolRideRepository) GetStops(ctx context.Context, rideID uuid.UUID) ([]models.Stop, error) {
+	query := `SELECT ` + stopColumns + `
+		FROM carpool_stops
+		WHERE carpool_ride_id = $1
+		ORDER BY stop_order`
+
+	rows, err := r.db.QueryContext(ctx, query, rideID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get carpool stops: %w", err)
+	}
+	defer rows.Close()
+
+	var stops []models.Stop
+	for rows.Next() {
+		var stop models.Stop
+		if err := scanStop(rows, &stop); err != nil {
+			return nil, fmt.Errorf("failed to scan carpool stop: %w", err)
+		}
+		stops = append(stops, stop)
+	}
+
+	return stops, rows.Err()
+}
+
+// listStopsForRides loads the stops of many rides in one query, keyed by ride
+// and in stop order
+func (r *CarPoolRideRepository) listStopsForRides(ctx context.Context, rideIDs []string) (map[uuid.UUID][]models.Stop, error) {
+	query := `SELECT ` + stopColumns + `
+		FROM carpool_stops
+		WHERE carpool_ride_id = ANY($1::uuid[])
+		ORDER BY carpool_ride_id, stop_order`
+
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(rideIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get carpool stops: %w", err)
+	}
+	defer rows.Close()
+
+	stops := make(map[uuid.UUID][]models.Stop)
+	for rows.Next() {
+		var stop models.Stop
+		if err := scanStop(rows, &stop); err != nil {
+			return nil, fmt.Errorf("failed to scan carpool stop: %w", err)
+		}
+		stops[stop.CarpoolRideID] = append(stops[stop.CarpoolRideID], stop)
+	}
+
+	return stops, rows.Err()
+}
+
+const stopColumns = `id, carpool_ride_id, address, stop_order, stop_type, user_id,
+		lat, lng, geofence_radius_m, scheduled_at, arrived_at, departed_at,
+		created_at, updated_at`
+
+func scanStop(row rowScanner, stop *models.Stop) error {
+	var userID uuid.NullUUID
+	err := row.Scan(
+		&stop.ID,
+		&stop.CarpoolRideID,
+		&stop.Address,
+		&stop.StopOrder,
+		&stop.StopType,
+		&userID,
+		&stop.Lat,
+		&stop.Lng,
+		&stop.GeofenceRadiusM,
+		&stop.ScheduledAt,
+		&stop.ArrivedAt,
+		&stop.DepartedAt,
+		&stop.CreatedAt,
+		&stop.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	stop.UserID = userID.UUID
+	return nil
+}
+
+// StartRide moves a scheduled ride to in progress
+func (r *CarPoolRideRepository) StartRide(ctx context.Context, rideID uuid.UUID) error {
+	return r.transition(ctx, rideID, models.RideStatusScheduled, models.RideStatusInProgress, "started_at", models.EventRideStarted)
+}
+
+// CompleteRide moves an in-progress ride to completed
+func (r *CarPoolRideRepository) CompleteRide(ctx context.Context, rideID uuid.UUID) error {
+	return r.transition(ctx, rideID, models.RideStatusInProgress, models.RideStatusCompleted, "completed_at", models.EventRideCompleted)
+}
+
+// transition updates the ride status only if it is currently in the expected state,
+// and records eventType in the outbox. It returns sql.ErrNoRows when the ride does
+// not exist or is in another state.
+func (r *CarPoolRideRepository) transition(ctx context.Context, rideID uuid.UUID, from, to int, timestampColumn, eventType string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf(`
+		UPDATE carpool_rides
+		SET status = $1, %s = CURRENT_TIMESTAMP, revision = revision + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2 AND status = $3
+		RETURNING carpool_id, driver_id`, timestampColumn)
+
+	event := models.RideEvent{RideID: rideID}
+	if err := tx.QueryRowContext(ctx, query, to, rideID, from).Scan(&event.CarpoolID, &event.DriverID); err != nil {
+		if err == sql.ErrNoRows {
+			return err
+		}
+		return fmt.Errorf("failed to update ride status: %w", err)
+	}
+
+	if err := enqueueEvent(ctx, tx, eventType, rideID, event); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	return nil
+}
+
+// MarkStopArrived records the arrival time of a stop on an in-progress ride
+func (r *CarPoolRideRepository) MarkStopArrived(ctx context.Context, rideID, stopID uuid.UUID) error {
+	query := `
+		UPDATE carpool_stops s
+		SET arrived_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		FROM carpool_rides r
+		WHERE s.id = $1 AND s.carpool_ride_id = $2 AND r.id = s.carpool_ride_id
+		  AND r.status = $3 AND s.arrived_at IS NULL`
+
+	result, err := r.db.ExecContext(ctx, query, stopID, rideID, models.RideStatusInProgress)
+	if err != nil {
+		return fmt.Errorf("failed to mark stop arrived: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %v", err)
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// MarkStopDeparted records when the vehicle left a stop it had arrived at
+func (r *CarPoolRideRepository) MarkStopDeparted(ctx context.Context, rideID, stopID uuid.UUID) error {
+	query := `
+		UPDATE carpool_stops
+		SET departed_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND carpool_ride_id = $2 AND departed_at IS NULL`
+
+	_, err := r.db.ExecContext(ctx, query, stopID, rideID)
+	if err != nil {
+		return fmt.Errorf("failed to mark stop departed: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateLocation stores the latest driver location for a scheduled or in-progress ride
+func (r *CarPoolRideRepository) UpdateLocation(ctx context.Context, rideID uuid.UUID, lat, lng float64) error {
+	query := `
+		UPDATE carpool_rides
+		SET location_lat = $1, location_lng = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $3 AND status IN ($4, $5)`
+
+	result, err := r.db.ExecContext(ctx, query, lat, lng, rideID, models.RideStatusScheduled, models.RideStatusInProgress)
+	if err != nil {
+		return fmt.Errorf("failed to update ride location: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %v", err)
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// RecordStopEvent stores a geofence event unless it was already seen for the stop.
+// It reports whether a new event was created.
+func (r *CarPoolRideRepository) RecordStopEvent(ctx context.Context, event *models.StopEvent) (bool, error) {
+	query := `
+		INSERT INTO ride_stop_events (carpool_ride_id, carpool_stop_id, event_type, lat, lng)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (carpool_stop_id, event_type) DO NOTHING
+		RETURNING id, created_at`
+
+	err := r.db.QueryRowContext(ctx, query,
+		event.CarpoolRideID, event.CarpoolStopID, event.EventType, event.Lat, event.Lng,
+	).Scan(&event.ID, &event.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to record stop event: %w", err)
+	}
+
+	return true, nil
+}
+
+// ListStopEvents returns the geofence event types already recorded for each stop of a ride
+func (r *CarPoolRideRepository) ListStopEvents(ctx context.Context, rideID uuid.UUID) (map[uuid.UUID]map[string]bool, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT carpool_stop_id, event_type FROM ride_stop_events WHERE carpool_ride_id = $1`, rideID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stop events: %w", err)
+	}
+	defer rows.Close()
+
+	seen := make(map[uuid.UUID]map[string]bool)
+	for rows.Next() {
+		var stopID uuid.UUID
+		var eventType string
+		if err := rows.Scan(&stopID, &eventType); err != nil {
+			return nil, fmt.Errorf("failed to scan stop event: %w", err)
+		}
+		if seen[stopID] == nil {
+			seen[stopID] = make(map[string]bool)
+		}
+		seen[stopID][eventType] = true
+	}
+
+	return seen, rows.Err()
+}
+
+// ListUnstartedRides returns up to limit scheduled rides whose start time is
+// between since and the cutoff and that have no driver no-show recorded yet,
+// oldest first
+func (r *CarPoolRideRepository) ListUnstartedRides(ctx context.Context, since, cutoff time.Time, limit int) ([]models.CarpoolRide, error) {
+	query := `
+		SELECT id, carpool_id, driver_id, status, scheduled_at
+		FROM carpool_rides cr
+		WHERE status = $1 AND scheduled_at >= $2 AND scheduled_at < $3
+		  AND NOT EXISTS (
+		      SELECT 1 FROM ride_incidents i
+		      WHERE i.carpool_ride_id = cr.id AND i.incident_type = $4
+		  )
+		ORDER BY scheduled_at
+		LIMIT $5`
+
+	rows, err := r.db.QueryContext(ctx, query, models.RideStatusScheduled, since, cutoff, models.IncidentTypeDriverNoShow, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list unstarted rides: %w", err)
+	}
+	defer rows.Close()
+
+	var rides []models.CarpoolRide
+	for rows.Next() {
+		var ride models.CarpoolRide
+		if err := rows.Scan(&ride.ID, &ride.CarpoolID, &ride.DriverID, &ride.Status, &ride.ScheduledAt); err != nil {
+			return nil, fmt.Errorf("failed to scan carpool ride: %w", err)
+		}
+		rides = append(rides, ride)
+	}
+
+	return rides, rows.Err()
+}
+
+// ReminderCandidate is a scheduled ride that has not been claimed for some kind
+// of reminder yet
+type ReminderCandidate struct {
+	RideID         uuid.UUID
+	ScheduledAt    time.Time
+	DriverTimezone string
+}
+
+// ListReminderCandidates returns scheduled rides starting after from and up to
+// to that have not been claimed for the kind of reminder, soonest first
+func (r *CarPoolRideRepository) ListReminderCandidates(ctx context.Context, kind string, from, to time.Time) ([]ReminderCandidate, error) {
+	query := `
+		SELECT cr.id, cr.scheduled_at, COALESCE(u.timezone, 'UTC')
+		FROM carpool_rides cr
+		LEFT JOIN users u ON u.id = cr.driver_id
+		WHERE cr.status = $2 AND cr.scheduled_at > $3 AND cr.scheduled_at <= $4
+		  AND NOT EXISTS (
+		      SELECT 1 FROM ride_reminders rr
+		      WHERE rr.carpool_ride_id = cr.id AND rr.kind = $1
+		  )
+		ORDER BY cr.scheduled_at`
+
+	rows, err := r.db.QueryContext(ctx, query, kind, models.RideStatusScheduled, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reminder candidates: %w", err)
+	}
+	defer rows.Close()
+
+	var candidates []ReminderCandidate
+	for rows.Next() {
+		var c ReminderCandidate
+		if err := rows.Scan(&c.RideID, &c.ScheduledAt, &c.DriverTimezone); err != nil {
+			return nil, fmt.Errorf("failed to scan reminder candidate: %w", err)
+		}
+		candidates = append(candidates, c)
+	}
+
+	return candidates, rows.Err()
+}
+
+// ClaimRideReminders claims the kind of reminder for those of the rides that
+// are still scheduled, and queues a ride.reminder event for each in the same
+// transaction. A ride is claimed once per kind: concurrent instances block on
+// the ride_reminders primary key and skip what another one claimed.
+func (r *CarPoolRideRepository) ClaimRideReminders(ctx context.Context, kind string, rideIDs []uuid.UUID) ([]models.RideReminderEvent, error) {
+	if len(rideIDs) == 0 {
+		return nil, nil
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		WITH claimed AS (
+			INSERT INTO ride_reminders (carpool_ride_id, kind)
+			SELECT id, $1 FROM carpool_rides
+			WHERE id = ANY($3::uuid[]) AND status = $2
+			ON CONFLICT DO NOTHING
+			RETURNING carpool_ride_id
+		)
+		SELECT r.id, r.carpool_id, r.driver_id, r.scheduled_at
+		FROM carpool_rides r
+		JOIN claimed c ON c.carpool_ride_id = r.id`
+
+	ids := make([]string, len(rideIDs))
+	for i, id := range rideIDs {
+		ids[i] = id.String()
+	}
+
+	rows, err := tx.QueryContext(ctx, query, kind, models.RideStatusScheduled, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim ride reminders: %w", err)
+	}
+
+	var reminders []models.RideReminderEvent
+	for rows.Next() {
+		reminder := models.RideReminderEvent{Kind: kind}
+		if err := rows.Scan(&reminder.RideID, &reminder.CarpoolID, &reminder.DriverID, &reminder.ScheduledAt); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan ride reminder: %w", err)
+		}
+		reminders = append(reminders, reminder)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, reminder := range reminders {
+		if err := enqueueEvent(ctx, tx, models.EventRideReminder, reminder.RideID, reminder); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	return reminders, nil
+}
+
+// ListCalendarRides returns the rides scheduled between from and to in the user's
+// carpools or driven by the user, optionally narrowed to one carpool, with stops.
+func (r *CarPoolRideRepository) ListCalendarRides(ctx context.Context, userID uuid.UUID, carpoolID *uuid.UUID, from, to time.Time) ([]models.CalendarRide, error) {
+	query := `
+		SELECT r.id, r.carpool_id, r.driver_id, r.status, r.scheduled_at, r.started_at,
+		       r.completed_at, r.created_at, r.updated_at, r.revision,
+		       c.carpool_name, COALESCE(NULLIF(u.display_name, ''), u.name, '')
+		FROM carpool_rides r
+		JOIN carpools c ON c.id = r.carpool_id
+		LEFT JOIN users u ON u.id = r.driver_id
+		WHERE (r.driver_id = $1 OR r.carpool_id IN (SELECT carpool_id FROM carpool_members WHERE user_id = $1))
+		  AND ($2::uuid IS NULL OR r.carpool_id = $2)
+		  AND r.scheduled_at >= $3 AND r.scheduled_at < $4
+		ORDER BY r.scheduled_at`
+
+	rows, err := r.db.QueryContext(ctx, query, userID, carpoolID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list calendar rides: %w", err)
+	}
+
+	var rides []models.CalendarRide
+	for rows.Next() {
+		var ride models.CalendarRide
+		if err := rows.Scan(
+			&ride.ID,
+			&ride.CarpoolID,
+			&ride.DriverID,
+			&ride.Status,
+			&ride.ScheduledAt,
+			&ride.StartedAt,
+			&ride.CompletedAt,
+			&ride.CreatedAt,
+			&ride.UpdatedAt,
+			&ride.Revision,
+			&ride.CarpoolName,
+			&ride.DriverName,
+		); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan calendar ride: %w", err)
+		}
+		rides = append(rides, ride)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(rides) == 0 {
+		return rides, nil
+	}
+
+	ids := make([]string, len(rides))
+	for i := range rides {
+		ids[i] = rides[i].ID.String()
+	}
+	stops, err := r.listStopsForRides(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range rides {
+		rides[i].Stops = stops[rides[i].ID]
+	}
+
+	return rides, nil
+}
+
+// RideHistoryFilter narrows a user's ride history. From and To bound when the
+// ride happened; Role is RideRoleDriver or RideRoleRider, or empty for both.
+type RideHistoryFilter struct {
+	From      *time.Time
+	To        *time.Time
+	CarpoolID *uuid.UUID
+	Role      string
+	Before    *PageCursor
+	Limit     int
+}
+
+// rideOccurredAt matches CarpoolRide.OccurredAt, used to order and filter history
+const rideOccurredAt = `COALESCE(r.completed_at, r.scheduled_at, r.created_at)`
+
+// ListRideHistory returns the completed and cancelled rides the user drove or had
+// a stop on, most recent first, with stops and the attendance of each participant.
+// The cursor's CreatedAt is the ride's OccurredAt.
+func (r *CarPoolRideRepository) ListRideHistory(ctx context.Context, userID uuid.UUID, filter RideHistoryFilter) ([]models.RideHistoryEntry, error) {
+	var beforeTime, beforeID interface{}
+	if filter.Before != nil {
+		beforeTime, beforeID = filter.Before.CreatedAt, filter.Before.ID
+	}
+
+	query := `
+		SELECT r.id, r.carpool_id, r.driver_id, r.status, COALESCE(r.miles_saved, 0),
+		       r.scheduled_at, r.started_at, r.completed_at, r.created_at, r.updated_at,
+		       c.carpool_name, COALESCE(NULLIF(u.display_name, ''), u.name, ''),
+		       CASE WHEN r.driver_id = $1 THEN $2 ELSE $3 END
+		FROM carpool_rides r
+		JOIN carpools c ON c.id = r.carpool_id
+		LEFT JOIN users u ON u.id = r.driver_id
+		WHERE r.status IN ($4, $5)
+		  AND (r.driver_id = $1 OR EXISTS (
+		      SELECT 1 FROM carpool_stops s WHERE s.carpool_ride_id = r.id AND s.user_id = $1
+		  ))
+		  AND ($6::text = '' OR ($6 = $2) = (r.driver_id = $1))
+		  AND ($7::uuid IS NULL OR r.carpool_id = $7)
+		  AND ($8::timestamptz IS NULL OR ` + rideOccurredAt + ` >= $8)
+		  AND ($9::timestamptz IS NULL OR ` + rideOccurredAt + ` < $9)
+		  AND ($10::timestamptz IS NULL OR (` + rideOccurredAt + `, r.id) < ($10, $11))
+		ORDER BY ` + rideOccurredAt + ` DESC, r.id DESC
+		LIMIT $12`
+
+	rows, err := r.db.QueryContext(ctx, query,
+		userID, models.RideRoleDriver, models.RideRoleRider,
+		models.RideStatusCompleted, models.RideStatusCancelled,
+		filter.Role, filter.CarpoolID, filter.From, filter.To,
+		beforeTime, beforeID, filter.Limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ride history: %w", err)
+	}
+
+	entries := []models.RideHistoryEntry{}
+	for rows.Next() {
+		var entry models.RideHistoryEntry
+		if err := rows.Scan(
+			&entry.ID,
+			&entry.CarpoolID,
+			&entry.DriverID,
+			&entry.Status,
+			&entry.MilesSaved,
+			&entry.ScheduledAt,
+			&entry.StartedAt,
+			&entry.CompletedAt,
+			&entry.CreatedAt,
+			&entry.UpdatedAt,
+			&entry.CarpoolName,
+			&entry.DriverName,
+			&entry.Role,
+		); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan ride history: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(entries) == 0 {
+		return entries, nil
+	}
+
+	// Stops and incidents are loaded for the whole page at once, so an export
+	// of thousands of rides costs three queries rather than two per ride
+	ids := make([]string, len(entries))
+	for i := range entries {
+		ids[i] = entries[i].ID.String()
+	}
+	stops, err := r.listStopsForRides(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	incidents, err := r.listIncidentsForRides(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range entries {
+		entries[i].Stops = stops[entries[i].ID]
+		entries[i].Attendance = []models.RideAttendance{}
+		if entries[i].Status == models.RideStatusCompleted {
+			entries[i].Attendance = rideAttendance(&entries[i].CarpoolRide, incidents[entries[i].ID])
+		}
+	}
+
+	return entries, nil
+}
+
+// listIncidentsForRides returns, per ride, how each participant with an
+// incident attended: late, or a no-show when any other incident was recorded
+func (r *CarPoolRideRepository) listIncidentsForRides(ctx context.Context, rideIDs []string) (map[uuid.UUID]map[uuid.UUID]string, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT carpool_ride_id, user_id, incident_type FROM ride_incidents WHERE carpool_ride_id = ANY($1::uuid[])`,
+		pq.Array(rideIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ride incidents: %w", err)
+	}
+	defer rows.Close()
+
+	incidents := make(map[uuid.UUID]map[uuid.UUID]string)
+	for rows.Next() {
+		var rideID, userID uuid.UUID
+		var incidentType string
+		if err := rows.Scan(&rideID, &userID, &incidentType); err != nil {
+			return nil, fmt.Errorf("failed to scan ride incident: %w", err)
+		}
+		if incidents[rideID] == nil {
+			incidents[rideID] = make(map[uuid.UUID]string)
+		}
+		if incidentType == models.IncidentTypeLate {
+			if _, seen := incidents[rideID][userID]; !seen {
+				incidents[rideID][userID] = models.AttendanceLate
+			}
+		} else {
+			incidents[rideID][userID] = models.AttendanceNoShow
+		}
+	}
+
+	return incidents, rows.Err()
+}
+
+// rideAttendance reports each participant of a completed ride as present, late
+// or a no-show from the attendance recorded against them by incidents
+func rideAttendance(ride *models.CarpoolRide, incidents map[uuid.UUID]string) []models.RideAttendance {
+	participants := ride.Participants()
+	attendance := make([]models.RideAttendance, 0, len(participants))
+	attendance = append(attendance, models.RideAttendance{UserID: ride.DriverID, Role: models.RideRoleDriver})
+	for _, stop := range ride.Stops {
+		if role, ok := participants[stop.UserID]; ok && role == models.RideRoleRider {
+			attendance = append(attendance, models.RideAttendance{UserID: stop.UserID, Role: role})
+			delete(participants, stop.UserID)
+		}
+	}
+	for i := range attendance {
+		attendance[i].Status = models.AttendancePresent
+		if status, ok := incidents[attendance[i].UserID]; ok {
+			attendance[i].Status = status
+		}
+	}
+
+	return attendance
+}
+
+// OverdueStop is a stop on an in-progress ride that has not been reached in time
+type OverdueStop struct {
+	Stop      models.Stop
+	CarpoolID uuid.UUID
+	DriverID  uuid.UUID
+}
+
+// ListOverdueStops returns up to limit unreached stops of in-progress rides
+// scheduled between since and the cutoff that have not been flagged late yet,
+// oldest first
+func (r *CarPoolRideRepository) ListOverdueStops(ctx context.Context, since, cutoff time.Time, limit int) ([]OverdueStop, error) {
+	query := `
+		SELECT s.id, s.carpool_ride_id, s.address, s.stop_order, s.stop_type, s.scheduled_at,
+		       r.carpool_id, r.driver_id
+		FROM carpool_stops s
+		JOIN carpool_rides r ON r.id = s.carpool_ride_id
+		WHERE r.status = $1 AND s.arrived_at IS NULL
+		  AND s.scheduled_at >= $2 AND s.scheduled_at < $3
+		  AND NOT EXISTS (
+		      SELECT 1 FROM ride_incidents i
+		      WHERE i.carpool_stop_id = s.id AND i.incident_type = $4
+		  )
+		ORDER BY s.scheduled_at
+		LIMIT $5`
+
+	rows, err := r.db.QueryContext(ctx, query, models.RideStatusInProgress, since, cutoff, models.IncidentTypeLate, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list overdue stops: %w", err)
+	}
+	defer rows.Close()
+
+	var overdue []OverdueStop
+	for rows.Next() {
+		var o OverdueStop
+		if err := rows.Scan(
+			&o.Stop.ID,
+			&o.Stop.CarpoolRideID,
+			&o.Stop.Address,
+			&o.Stop.StopOrder,
+			&o.Stop.StopType,
+			&o.Stop.ScheduledAt,
+			&o.CarpoolID,
+			&o.DriverID,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan overdue stop: %w", err)
+		}
+		overdue = append(overdue, o)
+	}
+
+	return overdue, rows.Err()
 }
\ No newline at end of file
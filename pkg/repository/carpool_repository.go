@@ -6,7 +6,9 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"car-backend/pkg/geo"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 type CarPoolRepository struct {
@@ -29,20 +31,49 @@ func (r *CarPoolRepository) CreateCarPool(ctx context.Context, carpool *models.C
     query := `
             INSERT INTO carpools (
                 creator_id, carpool_name, status, recurring_option,
-                available_seats, destination_address, seats
-            ) VALUES ($1, $2, $3, $4, $5, $6, $7)
+                available_seats, destination_address, seats,
+                origin_address, origin_lat, origin_lng, destination_lat, destination_lng,
+                departure_time, schedule_days, music_preference, smoking_allowed, pets_allowed,
+                school_name
+            ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)
             RETURNING id, created_at, updated_at`
 
     err = tx.QueryRowContext(
         ctx, query,
         carpool.CreatorID, carpool.CarpoolName, carpool.Status,
         carpool.RecurringOption, carpool.AvailableSeats, carpool.DestinationAddress, carpool.Seats,
+        carpool.OriginAddress, carpool.OriginLat, carpool.OriginLng, carpool.DestinationLat, carpool.DestinationLng,
+        carpool.DepartureTime, carpool.ScheduleDays, carpool.MusicPreference, carpool.SmokingAllowed, carpool.PetsAllowed,
+        carpool.SchoolName,
     ).Scan(&carpool.ID, &carpool.CreatedAt, &carpool.UpdatedAt)
 
     if err != nil {
         return fmt.Errorf("failed to insert carpool: %v", err)
     }
 
+    // The creator administers the carpool as its first member
+    creatorID, err := uuid.Parse(carpool.CreatorID)
+    if err != nil {
+        return fmt.Errorf("invalid creator id: %v", err)
+    }
+    _, err = tx.ExecContext(ctx, `
+            INSERT INTO carpool_members (carpool_id, user_id, role)
+            VALUES ($1, $2, $3)`,
+        carpool.ID, creatorID, models.MemberRoleAdmin,
+    )
+    if err != nil {
+        return fmt.Errorf("failed to add carpool creator: %v", err)
+    }
+
+    event := models.CarpoolCreatedEvent{CarpoolID: carpool.ID, CreatorID: carpool.CreatorID}
+    if err = enqueueEvent(ctx, tx, models.EventCarpoolCreated, carpool.ID, event); err != nil {
+        return err
+    }
+    joined := models.MembershipEvent{CarpoolID: carpool.ID, UserID: creatorID}
+    if err = enqueueEvent(ctx, tx, models.EventMemberJoined, carpool.ID, joined); err != nil {
+        return err
+    }
+
     if err = tx.Commit(); err != nil {
         return fmt.Errorf("failed to commit transaction: %v", err)
     }
@@ -50,6 +81,42 @@ func (r *CarPoolRepository) CreateCarPool(ctx context.Context, carpool *models.C
     return nil
 }
 
+// carpoolColumns is the column list read by scanCarpool
+const carpoolColumns = `
+        id, creator_id, carpool_name, status, recurring_option,
+        available_seats, destination_address, seats,
+        origin_address, origin_lat, origin_lng, destination_lat, destination_lng,
+        departure_time, schedule_days, music_preference, smoking_allowed, pets_allowed,
+        school_name, organization_id, visibility, created_at, updated_at`
+
+func scanCarpool(row rowScanner, carpool *models.Carpool) error {
+    return row.Scan(
+        &carpool.ID,
+        &carpool.CreatorID,
+        &carpool.CarpoolName,
+        &carpool.Status,
+        &carpool.RecurringOption,
+        &carpool.AvailableSeats,
+        &carpool.DestinationAddress,
+        &carpool.Seats,
+        &carpool.OriginAddress,
+        &carpool.OriginLat,
+        &carpool.OriginLng,
+        &carpool.DestinationLat,
+        &carpool.DestinationLng,
+        &carpool.DepartureTime,
+        &carpool.ScheduleDays,
+        &carpool.MusicPreference,
+        &carpool.SmokingAllowed,
+        &carpool.PetsAllowed,
+        &carpool.SchoolName,
+        &carpool.OrganizationID,
+        &carpool.Visibility,
+        &carpool.CreatedAt,
+        &carpool.UpdatedAt,
+    )
+}
+
 func (r *CarPoolRepository) GetCarPool(ctx context.Context, carpoolID uuid.UUID) (*models.Carpool, error) {
     // Create a new Carpool struct to store the retrieved data
     carpool := &models.Carpool{}
@@ -62,24 +129,9 @@ func (r *CarPoolRepository) GetCarPool(ctx context.Context, carpoolID uuid.UUID)
     defer tx.Rollback()
 
     // Get carpool details
-    carpoolQuery := `
-        SELECT id, creator_id, carpool_name, status, recurring_option,
-               available_seats, destination_address, seats, created_at, updated_at
-        FROM carpools
-        WHERE id = $1`
+    carpoolQuery := `SELECT ` + carpoolColumns + ` FROM carpools WHERE id = $1`
 
-    err = tx.QueryRowContext(ctx, carpoolQuery, carpoolID).Scan(
-        &carpool.ID,
-        &carpool.CreatorID,
-        &carpool.CarpoolName,
-        &carpool.Status,
-        &carpool.RecurringOption,
-        &carpool.AvailableSeats,
-        &carpool.DestinationAddress,
-        &carpool.Seats,
-        &carpool.CreatedAt,
-        &carpool.UpdatedAt,
-    )
+    err = scanCarpool(tx.QueryRowContext(ctx, carpoolQuery, carpoolID), carpool)
 
     if err != nil {
         if err == sql.ErrNoRows {
@@ -127,7 +179,427 @@ func (r *CarPoolRepository) DeleteCarPool(ctx context.Context, carpoolID uuid.UU
     return nil
 }
 
+// ListMemberIDs returns the user ids of every member of a carpool
+func (r *CarPoolRepository) ListMemberIDs(ctx context.Context, carpoolID uuid.UUID) ([]uuid.UUID, error) {
+    rows, err := r.db.QueryContext(ctx,
+        `SELECT user_id FROM carpool_members WHERE carpool_id = $1`, carpoolID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to list carpool members: %v", err)
+    }
+    defer rows.Close()
+
+    var ids []uuid.UUID
+    for rows.Next() {
+        var id uuid.UUID
+        if err := rows.Scan(&id); err != nil {
+            return nil, fmt.Errorf("failed to scan carpool member: %v", err)
+        }
+        ids = append(ids, id)
+    }
+
+    return ids, rows.Err()
+}
+
+// IsMember reports whether the user belongs to the carpool
+func (r *CarPoolRepository) IsMember(ctx context.Context, carpoolID, userID uuid.UUID) (bool, error) {
+    var exists bool
+    err := r.db.QueryRowContext(ctx,
+        `SELECT EXISTS(SELECT 1 FROM carpool_members WHERE carpool_id = $1 AND user_id = $2)`,
+        carpoolID, userID,
+    ).Scan(&exists)
+    if err != nil {
+        return false, fmt.Errorf("failed to check carpool membership: %v", err)
+    }
+
+    return exists, nil
+}
+
+// IsAdmin reports whether the user is the carpool's creator or a designated admin
+func (r *CarPoolRepository) IsAdmin(ctx context.Context, carpoolID, userID uuid.UUID) (bool, error) {
+    var admin bool
+    err := r.db.QueryRowContext(ctx, `
+        SELECT EXISTS(SELECT 1 FROM carpools WHERE id = $1 AND creator_id = $2)
+            OR EXISTS(SELECT 1 FROM carpool_members WHERE carpool_id = $1 AND user_id = $3 AND role = $4)`,
+        carpoolID, userID.String(), userID, models.MemberRoleAdmin,
+    ).Scan(&admin)
+    if err != nil {
+        return false, fmt.Errorf("failed to check carpool admin: %v", err)
+    }
+
+    return admin, nil
+}
+
+// IsOrgAdmin reports whether the user is an active admin of the organization
+// the carpool belongs to
+func (r *CarPoolRepository) IsOrgAdmin(ctx context.Context, carpoolID, userID uuid.UUID) (bool, error) {
+    var admin bool
+    err := r.db.QueryRowContext(ctx, `
+        SELECT EXISTS(
+            SELECT 1 FROM carpools c
+            JOIN organization_members om ON om.organization_id = c.organization_id
+            WHERE c.id = $1 AND om.user_id = $2 AND om.role = $3 AND om.status = $4)`,
+        carpoolID, userID, models.OrgRoleAdmin, models.OrgMemberActive,
+    ).Scan(&admin)
+    if err != nil {
+        return false, fmt.Errorf("failed to check organization admin: %v", err)
+    }
+
+    return admin, nil
+}
+
+// SetMemberRole changes a member's role within the carpool
+func (r *CarPoolRepository) SetMemberRole(ctx context.Context, carpoolID, userID uuid.UUID, role string) error {
+    result, err := r.db.ExecContext(ctx, `
+        UPDATE carpool_members
+        SET role = $1, updated_at = CURRENT_TIMESTAMP
+        WHERE carpool_id = $2 AND user_id = $3`,
+        role, carpoolID, userID,
+    )
+    if err != nil {
+        return fmt.Errorf("failed to update member role: %v", err)
+    }
+
+    rowsAffected, err := result.RowsAffected()
+    if err != nil {
+        return fmt.Errorf("failed to get affected rows: %v", err)
+    }
+    if rowsAffected == 0 {
+        return sql.ErrNoRows
+    }
+
+    return nil
+}
+
+// RemoveMember takes the user out of the carpool, frees their seat and
+// promotes waitlisted join requests into any seats that are now free.
+func (r *CarPoolRepository) RemoveMember(ctx context.Context, carpoolID, userID uuid.UUID) ([]models.JoinRequest, error) {
+    tx, err := r.db.BeginTx(ctx, nil)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin transaction: %v", err)
+    }
+    defer tx.Rollback()
+
+    result, err := tx.ExecContext(ctx,
+        `DELETE FROM carpool_members WHERE carpool_id = $1 AND user_id = $2`, carpoolID, userID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to remove carpool member: %v", err)
+    }
+
+    rowsAffected, err := result.RowsAffected()
+    if err != nil {
+        return nil, fmt.Errorf("failed to get affected rows: %v", err)
+    }
+    if rowsAffected == 0 {
+        return nil, sql.ErrNoRows
+    }
+
+    event := models.MembershipEvent{CarpoolID: carpoolID, UserID: userID}
+    if err = enqueueEvent(ctx, tx, models.EventMemberLeft, carpoolID, event); err != nil {
+        return nil, err
+    }
+
+    _, err = tx.ExecContext(ctx, `
+        UPDATE carpools
+        SET available_seats = LEAST(available_seats + 1, COALESCE(seats, available_seats + 1)),
+            updated_at = CURRENT_TIMESTAMP
+        WHERE id = $1`,
+        carpoolID,
+    )
+    if err != nil {
+        return nil, fmt.Errorf("failed to free seat: %v", err)
+    }
+
+    promoted, err := promoteWaitlist(ctx, tx, carpoolID)
+    if err != nil {
+        return nil, err
+    }
+
+    if err = tx.Commit(); err != nil {
+        return nil, fmt.Errorf("failed to commit transaction: %v", err)
+    }
+
+    return promoted, nil
+}
+
+// ListUserCarpools returns the carpools the user is a member of, optionally just one of them
+func (r *CarPoolRepository) ListUserCarpools(ctx context.Context, userID uuid.UUID, carpoolID *uuid.UUID) ([]models.Carpool, error) {
+    query := `SELECT ` + carpoolColumns + `
+        FROM carpools
+        WHERE id IN (SELECT carpool_id FROM carpool_members WHERE user_id = $1)
+          AND ($2::uuid IS NULL OR id = $2)
+        ORDER BY carpool_name`
+
+    rows, err := r.db.QueryContext(ctx, query, userID, carpoolID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to list user carpools: %w", err)
+    }
+    defer rows.Close()
+
+    var carpools []models.Carpool
+    for rows.Next() {
+        var carpool models.Carpool
+        if err := scanCarpool(rows, &carpool); err != nil {
+            return nil, fmt.Errorf("failed to scan carpool: %w", err)
+        }
+        carpools = append(carpools, carpool)
+    }
+
+    return carpools, rows.Err()
+}
+
+// carpoolVisibleTo is the condition that carpool c is visible to the user in
+// the given query parameter: it is public, the user belongs to it, or the user is
+// an active member of its organization
+func carpoolVisibleTo(param string) string {
+    return `(c.visibility = '` + models.CarpoolVisibilityPublic + `'
+          OR EXISTS (SELECT 1 FROM carpool_members vm WHERE vm.carpool_id = c.id AND vm.user_id = ` + param + `)
+          OR EXISTS (
+              SELECT 1 FROM organization_members om
+              WHERE om.organization_id = c.organization_id AND om.user_id = ` + param + `
+                AND om.status = '` + models.OrgMemberActive + `'))`
+}
+
+// IsVisibleTo reports whether the carpool exists and the user may see it
+func (r *CarPoolRepository) IsVisibleTo(ctx context.Context, carpoolID, userID uuid.UUID) (bool, error) {
+    var visible bool
+    err := r.db.QueryRowContext(ctx,
+        `SELECT EXISTS (SELECT 1 FROM carpools c WHERE c.id = $1 AND `+carpoolVisibleTo("$2")+`)`,
+        carpoolID, userID,
+    ).Scan(&visible)
+    if err != nil {
+        return false, fmt.Errorf("failed to check carpool visibility: %v", err)
+    }
+    return visible, nil
+}
+
+// SetOrganization moves the carpool into the organization with the given
+// visibility, or out of any organization when organizationID is nil
+func (r *CarPoolRepository) SetOrganization(ctx context.Context, carpoolID uuid.UUID, organizationID *uuid.UUID, visibility string) error {
+    result, err := r.db.ExecContext(ctx, `
+        UPDATE carpools
+        SET organization_id = $2, visibility = $3, updated_at = CURRENT_TIMESTAMP
+        WHERE id = $1`,
+        carpoolID, organizationID, visibility,
+    )
+    if err != nil {
+        return fmt.Errorf("failed to set carpool organization: %v", err)
+    }
+
+    rowsAffected, err := result.RowsAffected()
+    if err != nil {
+        return fmt.Errorf("failed to get affected rows: %v", err)
+    }
+    if rowsAffected == 0 {
+        return sql.ErrNoRows
+    }
+    return nil
+}
+
+// MatchArea narrows match candidates to carpools that start or end near the
+// user or go to their school. Unset parts are not matched on, and an empty area
+// matches every carpool.
+type MatchArea struct {
+    Origin      *geo.Bounds
+    Destination *geo.Bounds
+    SchoolName  string
+}
+
+// ListMatchCandidates returns up to limit carpools in the area with open seats
+// that the user is not already in and can see, newest first, only those of the
+// organization when one is given
+func (r *CarPoolRepository) ListMatchCandidates(ctx context.Context, userID uuid.UUID, organizationID *uuid.UUID, area MatchArea, limit int) ([]models.Carpool, error) {
+    var origin, destination [4]interface{}
+    if b := area.Origin; b != nil {
+        origin = [4]interface{}{b.MinLat, b.MaxLat, b.MinLng, b.MaxLng}
+    }
+    if b := area.Destination; b != nil {
+        destination = [4]interface{}{b.MinLat, b.MaxLat, b.MinLng, b.MaxLng}
+    }
+    var school interface{}
+    if area.SchoolName != "" {
+        school = area.SchoolName
+    }
+
+    query := `SELECT ` + carpoolColumns + `
+        FROM carpools c
+        WHERE c.available_seats > 0
+          AND NOT EXISTS (
+              SELECT 1 FROM carpool_members m WHERE m.carpool_id = c.id AND m.user_id = $1
+          )
+          AND ($2::uuid IS NULL OR c.organization_id = $2)
+          AND ` + carpoolVisibleTo("$1") + `
+          AND (
+              ($4::float IS NULL AND $8::float IS NULL AND $12::text IS NULL)
+              OR (c.origin_lat BETWEEN $4::float AND $5::float AND c.origin_lng BETWEEN $6::float AND $7::float)
+              OR (c.destination_lat BETWEEN $8::float AND $9::float AND c.destination_lng BETWEEN $10::float AND $11::float)
+              OR LOWER(c.school_name) = LOWER($12::text)
+          )
+        ORDER BY c.created_at DESC
+        LIMIT $3`
+
+    rows, err := r.db.QueryContext(ctx, query, userID, organizationID, limit,
+        origin[0], origin[1], origin[2], origin[3],
+        destination[0], destination[1], destination[2], destination[3],
+        school,
+    )
+    if err != nil {
+        return nil, fmt.Errorf("failed to list match candidates: %v", err)
+    }
+    defer rows.Close()
+
+    var carpools []models.Carpool
+    for rows.Next() {
+        var carpool models.Carpool
+        if err := scanCarpool(rows, &carpool); err != nil {
+            return nil, fmt.Errorf("failed to scan carpool: %v", err)
+        }
+        carpools = append(carpools, carpool)
+    }
+
+    return carpools, rows.Err()
+}
+
+// MutualMemberCounts returns, per carpool, how many of its members already share another carpool with the user
+func (r *CarPoolRepository) MutualMemberCounts(ctx context.Context, userID uuid.UUID) (map[uuid.UUID]int, error) {
+    query := `
+        SELECT cm.carpool_id, COUNT(DISTINCT cm.user_id)
+        FROM carpool_members cm
+        JOIN carpool_members other ON other.user_id = cm.user_id AND other.carpool_id <> cm.carpool_id
+        JOIN carpool_members mine ON mine.carpool_id = other.carpool_id AND mine.user_id = $1
+        WHERE cm.user_id <> $1
+        GROUP BY cm.carpool_id`
+
+    rows, err := r.db.QueryContext(ctx, query, userID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to count mutual members: %v", err)
+    }
+    defer rows.Close()
+
+    counts := make(map[uuid.UUID]int)
+    for rows.Next() {
+        var carpoolID uuid.UUID
+        var count int
+        if err := rows.Scan(&carpoolID, &count); err != nil {
+            return nil, fmt.Errorf("failed to scan mutual members: %v", err)
+        }
+        counts[carpoolID] = count
+    }
+
+    return counts, rows.Err()
+}
+
+// memberRatingExpr is the count-weighted average rating of a carpool's members
+const memberRatingExpr = `(
+        SELECT SUM(u.rating_average * u.rating_count) / NULLIF(SUM(u.rating_count), 0)
+        FROM carpool_members rm
+        JOIN users u ON u.id = rm.user_id
+        WHERE rm.carpool_id = c.id)`
+
+// SearchCarPools returns carpools matching the filters that the viewer can see,
+// newest first. MaxDistance is in kilometres from origin, which is required when
+// it is set.
+func (r *CarPoolRepository) SearchCarPools(ctx context.Context, viewerID uuid.UUID, filters models.SearchFilters, origin *geo.Point, limit int) ([]models.Carpool, error) {
+    var originLat, originLng interface{}
+    if origin != nil {
+        originLat, originLng = origin.Lat, origin.Lng
+    }
+
+    query := `SELECT ` + carpoolColumns + `
+        FROM carpools c
+        WHERE ($1::int IS NULL OR c.available_seats >= $1)
+          AND ($2::text IS NULL OR LOWER(c.music_preference) = LOWER($2))
+          AND ($3::bool IS NULL OR c.smoking_allowed = $3)
+          AND ($4::bool IS NULL OR c.pets_allowed = $4)
+          AND (($5::timestamptz IS NULL AND $6::timestamptz IS NULL) OR EXISTS (
+              SELECT 1 FROM carpool_rides ride
+              WHERE ride.carpool_id = c.id AND ride.status = $7
+                AND ($5 IS NULL OR ride.scheduled_at >= $5)
+                AND ($6 IS NULL OR ride.scheduled_at <= $6)
+          ))
+          AND ($8::float IS NULL OR ` + memberRatingExpr + ` >= $8)
+          AND ($9::float IS NULL OR (
+              c.origin_lat IS NOT NULL AND c.origin_lng IS NOT NULL
+              AND 6371 * 2 * ASIN(SQRT(
+                  POWER(SIN(RADIANS(c.origin_lat - $10::float) / 2), 2) +
+                  COS(RADIANS($10::float)) * COS(RADIANS(c.origin_lat)) *
+                  POWER(SIN(RADIANS(c.origin_lng - $11::float) / 2), 2)
+              )) <= $9
+          ))
+          AND ($13::uuid IS NULL OR c.organization_id = $13)
+          AND ` + carpoolVisibleTo("$14") + `
+        ORDER BY c.created_at DESC
+        LIMIT $12`
+
+    rows, err := r.db.QueryContext(ctx, query,
+        filters.MinSeats, filters.MusicPreference, filters.SmokingAllowed, filters.PetsAllowed,
+        filters.StartDate, filters.EndDate, models.RideStatusScheduled,
+        filters.MinRating, filters.MaxDistance, originLat, originLng,
+        limit, filters.OrganizationID, viewerID,
+    )
+    if err != nil {
+        return nil, fmt.Errorf("failed to search carpools: %v", err)
+    }
+    defer rows.Close()
+
+    carpools := []models.Carpool{}
+    for rows.Next() {
+        var carpool models.Carpool
+        if err := scanCarpool(rows, &carpool); err != nil {
+            return nil, fmt.Errorf("failed to scan carpool: %v", err)
+        }
+        carpools = append(carpools, carpool)
+    }
+
+    return carpools, rows.Err()
+}
+
+// AttachMemberRatings fills in MemberRating on each carpool with the aggregate
+// rating of its members
+func (r *CarPoolRepository) AttachMemberRatings(ctx context.Context, carpools []models.Carpool) error {
+    if len(carpools) == 0 {
+        return nil
+    }
+
+    ids := make([]string, len(carpools))
+    for i, carpool := range carpools {
+        ids[i] = carpool.ID.String()
+    }
+
+    query := `
+        SELECT m.carpool_id,
+               SUM(u.rating_average * u.rating_count) / NULLIF(SUM(u.rating_count), 0),
+               COALESCE(SUM(u.rating_count), 0)
+        FROM carpool_members m
+        JOIN users u ON u.id = m.user_id
+        WHERE m.carpool_id = ANY($1::uuid[])
+        GROUP BY m.carpool_id`
+
+    rows, err := r.db.QueryContext(ctx, query, pq.Array(ids))
+    if err != nil {
+        return fmt.Errorf("failed to get member ratings: %v", err)
+    }
+    defer rows.Close()
+
+    ratings := make(map[uuid.UUID]models.RatingSummary)
+    for rows.Next() {
+        var carpoolID uuid.UUID
+        var summary models.RatingSummary
+        if err := rows.Scan(&carpoolID, &summary.Average, &summary.Count); err != nil {
+            return fmt.Errorf("failed to scan member rating: %v", err)
+        }
+        ratings[carpoolID] = summary
+    }
+    if err := rows.Err(); err != nil {
+        return err
+    }
+
+    for i := range carpools {
+        summary := ratings[carpools[i].ID]
+        carpools[i].MemberRating = &summary
+    }
+
+    return nil
+}
 
 // Add methods like:
-// UpdateCarPool
-// SearchCarPools
\ No newline at end of file
+// UpdateCarPool
\ No newline at end of file
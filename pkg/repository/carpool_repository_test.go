@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"car-backend/pkg/models"
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestCreateCarPoolCreatorIsAdmin(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	creator, other := uuid.New(), uuid.New()
+	for _, id := range []uuid.UUID{creator, other} {
+		_, err := db.Exec(`INSERT INTO users (id, email, name, clerk_id) VALUES ($1, $2, 'Test', $3)`,
+			id, id.String()+"@example.com", "user_"+id.String())
+		if err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+	}
+
+	repo := NewCarPoolRepository(db)
+	carpool := &models.Carpool{CreatorID: creator.String(), CarpoolName: "School run"}
+	if err := repo.CreateCarPool(ctx, carpool); err != nil {
+		t.Fatalf("CreateCarPool() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		userID uuid.UUID
+		want   bool
+	}{
+		{"creator is an admin", creator, true},
+		{"other users are not", other, false},
+	}
+	for _, tt := range tests {
+		admin, err := repo.IsAdmin(ctx, carpool.ID, tt.userID)
+		if err != nil {
+			t.Fatalf("%s: IsAdmin() error = %v", tt.name, err)
+		}
+		if admin != tt.want {
+			t.Errorf("%s: IsAdmin() = %v, want %v", tt.name, admin, tt.want)
+		}
+	}
+
+	var role string
+	err := db.QueryRow(`SELECT role FROM carpool_members WHERE carpool_id = $1 AND user_id = $2`,
+		carpool.ID, creator).Scan(&role)
+	if err != nil {
+		t.Fatalf("creator is not a member: %v", err)
+	}
+	if role != models.MemberRoleAdmin {
+		t.Errorf("creator role = %s, want %s", role, models.MemberRoleAdmin)
+	}
+}
@@ -0,0 +1,213 @@
+package repository
+
+import (
+	"car-backend/pkg/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrChatMessageNotEditable = errors.New("message can no longer be edited")
+
+// PageCursor marks a position in a newest-first listing such as chat history.
+// Pages continue with the rows strictly older than the cursor.
+type PageCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+type ChatRepository struct {
+	db *sql.DB
+}
+
+func NewChatRepository(db *sql.DB) *ChatRepository {
+	return &ChatRepository{db: db}
+}
+
+// CreateMessage stores a new chat message
+func (r *ChatRepository) CreateMessage(ctx context.Context, message *models.ChatMessage) error {
+	query := `
+		INSERT INTO chat_messages (carpool_id, carpool_ride_id, sender_id, body)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`
+
+	err := r.db.QueryRowContext(ctx, query,
+		message.CarpoolID, message.CarpoolRideID, message.SenderID, message.Body,
+	).Scan(&message.ID, &message.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create chat message: %v", err)
+	}
+
+	return nil
+}
+
+func (r *ChatRepository) GetMessage(ctx context.Context, messageID uuid.UUID) (*models.ChatMessage, error) {
+	message := &models.ChatMessage{}
+
+	query := `SELECT ` + chatMessageColumns + ` FROM chat_messages WHERE id = $1`
+	if err := scanChatMessage(r.db.QueryRowContext(ctx, query, messageID), message); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get chat message: %w", err)
+	}
+
+	return message, nil
+}
+
+// ListMessages returns up to limit messages of a carpool's chat older than the
+// cursor, newest first. A ride ID narrows the history to messages about that ride.
+func (r *ChatRepository) ListMessages(ctx context.Context, carpoolID uuid.UUID, rideID *uuid.UUID, before *PageCursor, limit int) ([]models.ChatMessage, error) {
+	query := `SELECT ` + chatMessageColumns + `
+		FROM chat_messages
+		WHERE carpool_id = $1
+		  AND ($2::uuid IS NULL OR carpool_ride_id = $2)
+		  AND ($3::timestamptz IS NULL OR (created_at, id) < ($3, $4))
+		ORDER BY created_at DESC, id DESC
+		LIMIT $5`
+
+	var cursorTime *time.Time
+	cursorID := uuid.Nil
+	if before != nil {
+		cursorTime, cursorID = &before.CreatedAt, before.ID
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, carpoolID, rideID, cursorTime, cursorID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list chat messages: %w", err)
+	}
+	defer rows.Close()
+
+	messages := []models.ChatMessage{}
+	for rows.Next() {
+		var message models.ChatMessage
+		if err := scanChatMessage(rows, &message); err != nil {
+			return nil, fmt.Errorf("failed to scan chat message: %w", err)
+		}
+		messages = append(messages, message)
+	}
+
+	return messages, rows.Err()
+}
+
+// EditMessage replaces the body of a message. Only the sender can edit, and only
+// within window of sending; otherwise ErrChatMessageNotEditable is returned.
+func (r *ChatRepository) EditMessage(ctx context.Context, messageID, senderID uuid.UUID, body string, window time.Duration) (*models.ChatMessage, error) {
+	message := &models.ChatMessage{}
+
+	query := `
+		UPDATE chat_messages
+		SET body = $3, edited_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND sender_id = $2 AND deleted_at IS NULL
+		  AND created_at > CURRENT_TIMESTAMP - make_interval(secs => $4)
+		RETURNING ` + chatMessageColumns
+
+	err := scanChatMessage(r.db.QueryRowContext(ctx, query, messageID, senderID, body, window.Seconds()), message)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrChatMessageNotEditable
+		}
+		return nil, fmt.Errorf("failed to edit chat message: %w", err)
+	}
+
+	return message, nil
+}
+
+// DeleteMessage soft-deletes a message, clearing its body but keeping its place in the history
+func (r *ChatRepository) DeleteMessage(ctx context.Context, messageID uuid.UUID) (*models.ChatMessage, error) {
+	message := &models.ChatMessage{}
+
+	query := `
+		UPDATE chat_messages
+		SET body = '', deleted_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING ` + chatMessageColumns
+
+	err := scanChatMessage(r.db.QueryRowContext(ctx, query, messageID), message)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to delete chat message: %w", err)
+	}
+
+	return message, nil
+}
+
+// MarkRead moves the member's read receipt forward to the given message.
+// Receipts never move backwards, so marking an older message is a no-op.
+func (r *ChatRepository) MarkRead(ctx context.Context, carpoolID, userID, messageID uuid.UUID) (*models.ChatReadReceipt, error) {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO chat_read_receipts (carpool_id, user_id, last_read_message_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (carpool_id, user_id) DO UPDATE
+		SET last_read_message_id = EXCLUDED.last_read_message_id, last_read_at = CURRENT_TIMESTAMP
+		WHERE (SELECT (created_at, id) FROM chat_messages WHERE id = chat_read_receipts.last_read_message_id)
+		    < (SELECT (created_at, id) FROM chat_messages WHERE id = EXCLUDED.last_read_message_id)`,
+		carpoolID, userID, messageID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mark chat read: %w", err)
+	}
+
+	receipt := &models.ChatReadReceipt{}
+	err = r.db.QueryRowContext(ctx, `
+		SELECT carpool_id, user_id, last_read_message_id, last_read_at
+		FROM chat_read_receipts
+		WHERE carpool_id = $1 AND user_id = $2`,
+		carpoolID, userID,
+	).Scan(&receipt.CarpoolID, &receipt.UserID, &receipt.LastReadMessageID, &receipt.LastReadAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get read receipt: %w", err)
+	}
+
+	return receipt, nil
+}
+
+// ListReadReceipts returns the read receipts of the carpool's current members
+func (r *ChatRepository) ListReadReceipts(ctx context.Context, carpoolID uuid.UUID) ([]models.ChatReadReceipt, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT rr.carpool_id, rr.user_id, rr.last_read_message_id, rr.last_read_at
+		FROM chat_read_receipts rr
+		JOIN carpool_members cm ON cm.carpool_id = rr.carpool_id AND cm.user_id = rr.user_id
+		WHERE rr.carpool_id = $1
+		ORDER BY rr.last_read_at DESC`,
+		carpoolID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list read receipts: %w", err)
+	}
+	defer rows.Close()
+
+	receipts := []models.ChatReadReceipt{}
+	for rows.Next() {
+		var receipt models.ChatReadReceipt
+		if err := rows.Scan(&receipt.CarpoolID, &receipt.UserID, &receipt.LastReadMessageID, &receipt.LastReadAt); err != nil {
+			return nil, fmt.Errorf("failed to scan read receipt: %w", err)
+		}
+		receipts = append(receipts, receipt)
+	}
+
+	return receipts, rows.Err()
+}
+
+// chatMessageColumns is the column list read by scanChatMessage
+const chatMessageColumns = `
+	id, carpool_id, carpool_ride_id, sender_id, body, created_at, edited_at, deleted_at`
+
+func scanChatMessage(row rowScanner, message *models.ChatMessage) error {
+	return row.Scan(
+		&message.ID,
+		&message.CarpoolID,
+		&message.CarpoolRideID,
+		&message.SenderID,
+		&message.Body,
+		&message.CreatedAt,
+		&message.EditedAt,
+		&message.DeletedAt,
+	)
+}
@@ -0,0 +1,296 @@
+package repository
+
+import (
+	"car-backend/pkg/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type ClosureRepository struct {
+	db *sql.DB
+}
+
+func NewClosureRepository(db *sql.DB) *ClosureRepository {
+	return &ClosureRepository{db: db}
+}
+
+// CreateCalendar stores an imported closure calendar with its dates, attaches it
+// to the carpool and cancels the carpool's upcoming rides on those dates, all in
+// one transaction. It returns how many rides were cancelled.
+func (r *ClosureRepository) CreateCalendar(ctx context.Context, calendar *models.ClosureCalendar, carpoolID uuid.UUID) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO closure_calendars (name, timezone, created_by)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at`,
+		calendar.Name, calendar.Timezone, calendar.CreatedBy,
+	).Scan(&calendar.ID, &calendar.CreatedAt)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create closure calendar: %v", err)
+	}
+
+	dates := make([]string, len(calendar.Dates))
+	reasons := make([]string, len(calendar.Dates))
+	for i, date := range calendar.Dates {
+		dates[i], reasons[i] = date.Date, date.Reason
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO closure_dates (calendar_id, closed_on, reason)
+		SELECT $1, d.closed_on, d.reason
+		FROM unnest($2::date[], $3::text[]) AS d(closed_on, reason)
+		ON CONFLICT DO NOTHING`,
+		calendar.ID, pq.Array(dates), pq.Array(reasons),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to store closure dates: %v", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO carpool_closure_calendars (carpool_id, calendar_id, attached_by)
+		VALUES ($1, $2, $3)`,
+		carpoolID, calendar.ID, calendar.CreatedBy,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to attach closure calendar: %v", err)
+	}
+
+	cancelled, err := cancelClosedRides(ctx, tx, carpoolID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	return cancelled, nil
+}
+
+// AttachCalendar attaches an existing, possibly shared, calendar to the carpool
+// and cancels the carpool's upcoming rides on its dates
+func (r *ClosureRepository) AttachCalendar(ctx context.Context, carpoolID, calendarID, userID uuid.UUID) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO carpool_closure_calendars (carpool_id, calendar_id, attached_by)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING`,
+		carpoolID, calendarID, userID,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to attach closure calendar: %v", err)
+	}
+
+	cancelled, err := cancelClosedRides(ctx, tx, carpoolID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	return cancelled, nil
+}
+
+// DetachCalendar stops applying a calendar to the carpool. Rides it already
+// cancelled stay cancelled. It returns sql.ErrNoRows when it was not attached.
+func (r *ClosureRepository) DetachCalendar(ctx context.Context, carpoolID, calendarID uuid.UUID) error {
+	result, err := r.db.ExecContext(ctx,
+		`DELETE FROM carpool_closure_calendars WHERE carpool_id = $1 AND calendar_id = $2`,
+		carpoolID, calendarID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to detach closure calendar: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %v", err)
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// GetCalendar returns a calendar with its dates, or nil
+func (r *ClosureRepository) GetCalendar(ctx context.Context, calendarID uuid.UUID) (*models.ClosureCalendar, error) {
+	calendar := &models.ClosureCalendar{}
+
+	err := scanClosureCalendar(r.db.QueryRowContext(ctx,
+		`SELECT `+closureCalendarColumns+` FROM closure_calendars WHERE id = $1`, calendarID), calendar)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get closure calendar: %w", err)
+	}
+
+	if calendar.Dates, err = r.listDates(ctx, calendar.ID); err != nil {
+		return nil, err
+	}
+
+	return calendar, nil
+}
+
+// ListCarpoolCalendars returns the calendars attached to a carpool with their dates
+func (r *ClosureRepository) ListCarpoolCalendars(ctx context.Context, carpoolID uuid.UUID) ([]models.ClosureCalendar, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+closureCalendarColumns+`
+		FROM closure_calendars
+		WHERE id IN (SELECT calendar_id FROM carpool_closure_calendars WHERE carpool_id = $1)
+		ORDER BY name`,
+		carpoolID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list closure calendars: %w", err)
+	}
+
+	calendars := []models.ClosureCalendar{}
+	for rows.Next() {
+		var calendar models.ClosureCalendar
+		if err := scanClosureCalendar(rows, &calendar); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan closure calendar: %w", err)
+		}
+		calendars = append(calendars, calendar)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range calendars {
+		if calendars[i].Dates, err = r.listDates(ctx, calendars[i].ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return calendars, nil
+}
+
+// ClosureOn returns the closure covering the given time for the carpool, or nil
+// when school is open that day
+func (r *ClosureRepository) ClosureOn(ctx context.Context, carpoolID uuid.UUID, at time.Time) (*models.ClosureDate, error) {
+	closure := &models.ClosureDate{}
+
+	err := r.db.QueryRowContext(ctx, `
+		SELECT to_char(d.closed_on, 'YYYY-MM-DD'), d.reason
+		FROM carpool_closure_calendars cc
+		JOIN closure_calendars c ON c.id = cc.calendar_id
+		JOIN closure_dates d ON d.calendar_id = c.id
+		WHERE cc.carpool_id = $1 AND d.closed_on = ($2::timestamptz AT TIME ZONE c.timezone)::date
+		LIMIT 1`,
+		carpoolID, at,
+	).Scan(&closure.Date, &closure.Reason)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to check closures: %w", err)
+	}
+
+	return closure, nil
+}
+
+func (r *ClosureRepository) listDates(ctx context.Context, calendarID uuid.UUID) ([]models.ClosureDate, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT to_char(closed_on, 'YYYY-MM-DD'), reason
+		FROM closure_dates
+		WHERE calendar_id = $1
+		ORDER BY closed_on`,
+		calendarID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list closure dates: %w", err)
+	}
+	defer rows.Close()
+
+	var dates []models.ClosureDate
+	for rows.Next() {
+		var date models.ClosureDate
+		if err := rows.Scan(&date.Date, &date.Reason); err != nil {
+			return nil, fmt.Errorf("failed to scan closure date: %w", err)
+		}
+		dates = append(dates, date)
+	}
+
+	return dates, rows.Err()
+}
+
+// cancelClosedRides cancels the carpool's scheduled, not yet started rides that
+// fall on a closure date of an attached calendar, and queues a ride.cancelled
+// event for each so members are told.
+func cancelClosedRides(ctx context.Context, tx *sql.Tx, carpoolID uuid.UUID) (int, error) {
+	rows, err := tx.QueryContext(ctx, `
+		UPDATE carpool_rides r
+		SET status = $2, revision = r.revision + 1, updated_at = CURRENT_TIMESTAMP
+		FROM (
+			SELECT DISTINCT ON (ride.id) ride.id, d.reason
+			FROM carpool_rides ride
+			JOIN carpool_closure_calendars cc ON cc.carpool_id = ride.carpool_id
+			JOIN closure_calendars c ON c.id = cc.calendar_id
+			JOIN closure_dates d ON d.calendar_id = c.id
+			    AND d.closed_on = (ride.scheduled_at AT TIME ZONE c.timezone)::date
+			WHERE ride.carpool_id = $1 AND ride.status = $3
+			  AND ride.scheduled_at > CURRENT_TIMESTAMP
+		) closed
+		WHERE r.id = closed.id
+		RETURNING r.id, r.carpool_id, r.driver_id, r.scheduled_at, closed.reason`,
+		carpoolID, models.RideStatusCancelled, models.RideStatusScheduled,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to cancel rides on closure dates: %v", err)
+	}
+
+	var events []models.RideEvent
+	for rows.Next() {
+		var event models.RideEvent
+		if err := rows.Scan(&event.RideID, &event.CarpoolID, &event.DriverID, &event.ScheduledAt, &event.Reason); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan cancelled ride: %v", err)
+		}
+		events = append(events, event)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, event := range events {
+		if err := enqueueEvent(ctx, tx, models.EventRideCancelled, event.RideID, event); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(events), nil
+}
+
+// closureCalendarColumns is the column list read by scanClosureCalendar
+const closureCalendarColumns = `id, name, timezone, created_by, created_at`
+
+func scanClosureCalendar(row rowScanner, calendar *models.ClosureCalendar) error {
+	return row.Scan(
+		&calendar.ID,
+		&calendar.Name,
+		&calendar.Timezone,
+		&calendar.CreatedBy,
+		&calendar.CreatedAt,
+	)
+}
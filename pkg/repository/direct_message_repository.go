@@ -0,0 +1,248 @@
+package repository
+
+import (
+	"car-backend/pkg/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type DirectMessageRepository struct {
+	db *sql.DB
+}
+
+func NewDirectMessageRepository(db *sql.DB) *DirectMessageRepository {
+	return &DirectMessageRepository{db: db}
+}
+
+// HasSharedContext reports whether two users share a carpool, as members or as
+// creator and member, or have a pending invite between them.
+func (r *DirectMessageRepository) HasSharedContext(ctx context.Context, userID, otherID uuid.UUID) (bool, error) {
+	var shared bool
+	err := r.db.QueryRowContext(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM carpool_members m1
+			JOIN carpool_members m2 ON m2.carpool_id = m1.carpool_id
+			WHERE m1.user_id = $1 AND m2.user_id = $2
+		) OR EXISTS(
+			SELECT 1 FROM carpools c
+			JOIN carpool_members m ON m.carpool_id = c.id
+			WHERE (c.creator_id = $3 AND m.user_id = $2) OR (c.creator_id = $4 AND m.user_id = $1)
+		) OR EXISTS(
+			SELECT 1 FROM invites
+			WHERE COALESCE(status, 0) = $5
+			  AND ((from_user = $1 AND to_user = $2) OR (from_user = $2 AND to_user = $1))
+		)`,
+		userID, otherID, userID.String(), otherID.String(), models.InviteStatusPending,
+	).Scan(&shared)
+	if err != nil {
+		return false, fmt.Errorf("failed to check shared context: %w", err)
+	}
+
+	return shared, nil
+}
+
+// GetOrCreateConversation returns the conversation between the two users, creating it if needed
+func (r *DirectMessageRepository) GetOrCreateConversation(ctx context.Context, userID, otherID uuid.UUID) (*models.Conversation, error) {
+	userA, userB := userID, otherID
+	if userB.String() < userA.String() {
+		userA, userB = userB, userA
+	}
+
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO conversations (user_a, user_b)
+		VALUES ($1, $2)
+		ON CONFLICT (user_a, user_b) DO NOTHING`,
+		userA, userB,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create conversation: %w", err)
+	}
+
+	conversation := &models.Conversation{}
+	query := `SELECT ` + conversationColumns + ` FROM conversations WHERE user_a = $1 AND user_b = $2`
+	if err := scanConversation(r.db.QueryRowContext(ctx, query, userA, userB), conversation); err != nil {
+		return nil, fmt.Errorf("failed to get conversation: %w", err)
+	}
+
+	return conversation, nil
+}
+
+func (r *DirectMessageRepository) GetConversation(ctx context.Context, conversationID uuid.UUID) (*models.Conversation, error) {
+	conversation := &models.Conversation{}
+
+	query := `SELECT ` + conversationColumns + ` FROM conversations WHERE id = $1`
+	if err := scanConversation(r.db.QueryRowContext(ctx, query, conversationID), conversation); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get conversation: %w", err)
+	}
+
+	return conversation, nil
+}
+
+// ListConversations returns the user's conversations, most recently active first,
+// with the other participant's name and how many of their messages are unread.
+func (r *DirectMessageRepository) ListConversations(ctx context.Context, userID uuid.UUID) ([]models.ConversationListItem, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT c.id, c.user_a, c.user_b, c.created_at, c.last_message_at,
+		       u.id, COALESCE(NULLIF(u.display_name, ''), u.name),
+		       (SELECT COUNT(*) FROM direct_messages dm
+		        WHERE dm.conversation_id = c.id AND dm.sender_id <> $1 AND dm.read_at IS NULL)
+		FROM conversations c
+		JOIN users u ON u.id = CASE WHEN c.user_a = $1 THEN c.user_b ELSE c.user_a END
+		WHERE c.user_a = $1 OR c.user_b = $1
+		ORDER BY COALESCE(c.last_message_at, c.created_at) DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list conversations: %w", err)
+	}
+	defer rows.Close()
+
+	items := []models.ConversationListItem{}
+	for rows.Next() {
+		var item models.ConversationListItem
+		if err := rows.Scan(
+			&item.ID,
+			&item.UserA,
+			&item.UserB,
+			&item.CreatedAt,
+			&item.LastMessageAt,
+			&item.OtherUserID,
+			&item.OtherDisplayName,
+			&item.UnreadCount,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan conversation: %w", err)
+		}
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+// CreateMessage stores a direct message and bumps the conversation's activity time
+func (r *DirectMessageRepository) CreateMessage(ctx context.Context, message *models.DirectMessage) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO direct_messages (conversation_id, sender_id, body)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at`,
+		message.ConversationID, message.SenderID, message.Body,
+	).Scan(&message.ID, &message.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create direct message: %v", err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE conversations SET last_message_at = $2 WHERE id = $1`,
+		message.ConversationID, message.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update conversation: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	return nil
+}
+
+func (r *DirectMessageRepository) GetMessage(ctx context.Context, messageID uuid.UUID) (*models.DirectMessage, error) {
+	message := &models.DirectMessage{}
+
+	query := `SELECT ` + directMessageColumns + ` FROM direct_messages WHERE id = $1`
+	if err := scanDirectMessage(r.db.QueryRowContext(ctx, query, messageID), message); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get direct message: %w", err)
+	}
+
+	return message, nil
+}
+
+// ListMessages returns up to limit messages of a conversation older than the cursor, newest first
+func (r *DirectMessageRepository) ListMessages(ctx context.Context, conversationID uuid.UUID, before *PageCursor, limit int) ([]models.DirectMessage, error) {
+	query := `SELECT ` + directMessageColumns + `
+		FROM direct_messages
+		WHERE conversation_id = $1
+		  AND ($2::timestamptz IS NULL OR (created_at, id) < ($2, $3))
+		ORDER BY created_at DESC, id DESC
+		LIMIT $4`
+
+	var cursorTime *time.Time
+	cursorID := uuid.Nil
+	if before != nil {
+		cursorTime, cursorID = &before.CreatedAt, before.ID
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, conversationID, cursorTime, cursorID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list direct messages: %w", err)
+	}
+	defer rows.Close()
+
+	messages := []models.DirectMessage{}
+	for rows.Next() {
+		var message models.DirectMessage
+		if err := scanDirectMessage(rows, &message); err != nil {
+			return nil, fmt.Errorf("failed to scan direct message: %w", err)
+		}
+		messages = append(messages, message)
+	}
+
+	return messages, rows.Err()
+}
+
+// MarkConversationRead marks every message the other participant sent as read
+func (r *DirectMessageRepository) MarkConversationRead(ctx context.Context, conversationID, readerID uuid.UUID) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE direct_messages
+		SET read_at = CURRENT_TIMESTAMP
+		WHERE conversation_id = $1 AND sender_id <> $2 AND read_at IS NULL`,
+		conversationID, readerID,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark conversation read: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+// conversationColumns is the column list read by scanConversation
+const conversationColumns = `id, user_a, user_b, created_at, last_message_at`
+
+func scanConversation(row rowScanner, conversation *models.Conversation) error {
+	return row.Scan(
+		&conversation.ID,
+		&conversation.UserA,
+		&conversation.UserB,
+		&conversation.CreatedAt,
+		&conversation.LastMessageAt,
+	)
+}
+
+// directMessageColumns is the column list read by scanDirectMessage
+const directMessageColumns = `id, conversation_id, sender_id, body, created_at, read_at`
+
+func scanDirectMessage(row rowScanner, message *models.DirectMessage) error {
+	return row.Scan(
+		&message.ID,
+		&message.ConversationID,
+		&message.SenderID,
+		&message.Body,
+		&message.CreatedAt,
+		&message.ReadAt,
+	)
+}
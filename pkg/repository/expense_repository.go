@@ -0,0 +1,443 @@
+package repository
+
+import (
+	"car-backend/pkg/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// ErrSettlementNotPending is returned when a settlement was already confirmed,
+// rejected or withdrawn
+var ErrSettlementNotPending = errors.New("settlement is no longer pending")
+
+type ExpenseRepository struct {
+	db *sql.DB
+}
+
+func NewExpenseRepository(db *sql.DB) *ExpenseRepository {
+	return &ExpenseRepository{db: db}
+}
+
+// GetSettings returns the carpool's expense defaults, or nil when the carpool does not exist
+func (r *ExpenseRepository) GetSettings(ctx context.Context, carpoolID uuid.UUID) (*models.ExpenseSettings, error) {
+	settings := &models.ExpenseSettings{}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT expense_split_rule, expense_currency FROM carpools WHERE id = $1`,
+		carpoolID,
+	).Scan(&settings.SplitRule, &settings.Currency)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get expense settings: %w", err)
+	}
+	return settings, nil
+}
+
+// UpdateSettings changes the carpool's expense defaults. Existing expenses keep
+// the rule and currency they were logged with.
+func (r *ExpenseRepository) UpdateSettings(ctx context.Context, carpoolID uuid.UUID, update *models.UpdateExpenseSettingsRequest) (*models.ExpenseSettings, error) {
+	settings := &models.ExpenseSettings{}
+	err := r.db.QueryRowContext(ctx, `
+		UPDATE carpools
+		SET expense_split_rule = COALESCE($2, expense_split_rule),
+		    expense_currency = COALESCE($3, expense_currency),
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING expense_split_rule, expense_currency`,
+		carpoolID, update.SplitRule, update.Currency,
+	).Scan(&settings.SplitRule, &settings.Currency)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update expense settings: %w", err)
+	}
+	return settings, nil
+}
+
+// SetMemberSeats records how many seats a member usually takes. It returns
+// sql.ErrNoRows when the user is not a member.
+func (r *ExpenseRepository) SetMemberSeats(ctx context.Context, carpoolID, userID uuid.UUID, seats int) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE carpool_members
+		SET seats = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE carpool_id = $1 AND user_id = $2`,
+		carpoolID, userID, seats,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set member seats: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %v", err)
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// MemberSeats returns the seats each current member of the carpool takes
+func (r *ExpenseRepository) MemberSeats(ctx context.Context, carpoolID uuid.UUID) (map[uuid.UUID]int, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT user_id, seats FROM carpool_members WHERE carpool_id = $1`,
+		carpoolID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get member seats: %w", err)
+	}
+	defer rows.Close()
+
+	seats := map[uuid.UUID]int{}
+	for rows.Next() {
+		var userID uuid.UUID
+		var n int
+		if err := rows.Scan(&userID, &n); err != nil {
+			return nil, fmt.Errorf("failed to scan member seats: %w", err)
+		}
+		seats[userID] = n
+	}
+	return seats, rows.Err()
+}
+
+// CreateExpense stores an expense together with its shares
+func (r *ExpenseRepository) CreateExpense(ctx context.Context, expense *models.Expense) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO ride_expenses (carpool_id, carpool_ride_id, payer_id, category, amount_minor, currency, split_rule, description)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at`,
+		expense.CarpoolID, expense.CarpoolRideID, expense.PayerID, expense.Category,
+		expense.AmountMinor, expense.Currency, expense.SplitRule, expense.Description,
+	).Scan(&expense.ID, &expense.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create expense: %v", err)
+	}
+
+	for _, share := range expense.Shares {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO ride_expense_shares (expense_id, user_id, amount_minor)
+			VALUES ($1, $2, $3)`,
+			expense.ID, share.UserID, share.AmountMinor,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to create expense share: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	return nil
+}
+
+// DeleteExpense removes an expense its payer logged in error. It returns
+// sql.ErrNoRows when the expense does not exist in the carpool or the user did not pay it.
+func (r *ExpenseRepository) DeleteExpense(ctx context.Context, carpoolID, expenseID, payerID uuid.UUID) error {
+	result, err := r.db.ExecContext(ctx, `
+		DELETE FROM ride_expenses
+		WHERE id = $1 AND carpool_id = $2 AND payer_id = $3`,
+		expenseID, carpoolID, payerID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete expense: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %v", err)
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ListExpenses returns the carpool's expenses with their shares, newest first,
+// optionally only those of one ride
+func (r *ExpenseRepository) ListExpenses(ctx context.Context, carpoolID uuid.UUID, rideID *uuid.UUID, before *PageCursor, limit int) ([]models.Expense, error) {
+	var beforeTime, beforeID interface{}
+	if before != nil {
+		beforeTime, beforeID = before.CreatedAt, before.ID
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+expenseColumns+`
+		FROM ride_expenses
+		WHERE carpool_id = $1
+		  AND ($2::uuid IS NULL OR carpool_ride_id = $2)
+		  AND ($3::timestamptz IS NULL OR (created_at, id) < ($3, $4))
+		ORDER BY created_at DESC, id DESC
+		LIMIT $5`,
+		carpoolID, rideID, beforeTime, beforeID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list expenses: %w", err)
+	}
+
+	expenses, err := collectExpenses(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.attachShares(ctx, expenses); err != nil {
+		return nil, err
+	}
+	return expenses, nil
+}
+
+func (r *ExpenseRepository) attachShares(ctx context.Context, expenses []models.Expense) error {
+	if len(expenses) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(expenses))
+	index := make(map[uuid.UUID]int, len(expenses))
+	for i, expense := range expenses {
+		ids[i] = expense.ID.String()
+		index[expense.ID] = i
+		expenses[i].Shares = []models.ExpenseShare{}
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT expense_id, user_id, amount_minor
+		FROM ride_expense_shares
+		WHERE expense_id = ANY($1::uuid[])
+		ORDER BY amount_minor DESC, user_id`,
+		pq.Array(ids),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to get expense shares: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var expenseID uuid.UUID
+		var share models.ExpenseShare
+		if err := rows.Scan(&expenseID, &share.UserID, &share.AmountMinor); err != nil {
+			return fmt.Errorf("failed to scan expense share: %w", err)
+		}
+		i := index[expenseID]
+		expenses[i].Shares = append(expenses[i].Shares, share)
+	}
+	return rows.Err()
+}
+
+// CreateSettlement records a payment between two members
+func (r *ExpenseRepository) CreateSettlement(ctx context.Context, settlement *models.Settlement) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := insertSettlement(ctx, tx, settlement); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	return nil
+}
+
+func insertSettlement(ctx context.Context, tx *sql.Tx, settlement *models.Settlement) error {
+	err := tx.QueryRowContext(ctx, `
+		INSERT INTO expense_settlements (carpool_id, from_user_id, to_user_id, amount_minor, currency, status, decided_at)
+		VALUES ($1, $2, $3, $4, $5, $6, CASE WHEN $7 THEN CURRENT_TIMESTAMP END)
+		RETURNING id, created_at, decided_at`,
+		settlement.CarpoolID, settlement.FromUserID, settlement.ToUserID, settlement.AmountMinor, settlement.Currency,
+		settlement.Status, settlement.Status != models.SettlementStatusPending,
+	).Scan(&settlement.ID, &settlement.CreatedAt, &settlement.DecidedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create settlement: %v", err)
+	}
+	return nil
+}
+
+func (r *ExpenseRepository) GetSettlement(ctx context.Context, settlementID uuid.UUID) (*models.Settlement, error) {
+	settlement := &models.Settlement{}
+	query := `SELECT ` + settlementColumns + ` FROM expense_settlements WHERE id = $1`
+	if err := scanSettlement(r.db.QueryRowContext(ctx, query, settlementID), settlement); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get settlement: %w", err)
+	}
+	return settlement, nil
+}
+
+// ListSettlements returns the carpool's settlements, newest first, optionally
+// only those with one status
+func (r *ExpenseRepository) ListSettlements(ctx context.Context, carpoolID uuid.UUID, status string) ([]models.Settlement, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+settlementColumns+`
+		FROM expense_settlements
+		WHERE carpool_id = $1 AND ($2 = '' OR status = $2)
+		ORDER BY created_at DESC, id DESC`,
+		carpoolID, status,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list settlements: %w", err)
+	}
+	defer rows.Close()
+
+	settlements := []models.Settlement{}
+	for rows.Next() {
+		var settlement models.Settlement
+		if err := scanSettlement(rows, &settlement); err != nil {
+			return nil, fmt.Errorf("failed to scan settlement: %w", err)
+		}
+		settlements = append(settlements, settlement)
+	}
+	return settlements, rows.Err()
+}
+
+// DecideSettlement confirms or rejects a pending settlement on behalf of the
+// member it says was paid. It returns ErrSettlementNotPending when the
+// settlement was already decided or withdrawn.
+func (r *ExpenseRepository) DecideSettlement(ctx context.Context, settlement *models.Settlement, status string) error {
+	err := r.db.QueryRowContext(ctx, `
+		UPDATE expense_settlements
+		SET status = $3, decided_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND to_user_id = $2 AND status = $4
+		RETURNING status, decided_at`,
+		settlement.ID, settlement.ToUserID, status, models.SettlementStatusPending,
+	).Scan(&settlement.Status, &settlement.DecidedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrSettlementNotPending
+		}
+		return fmt.Errorf("failed to update settlement: %w", err)
+	}
+	return nil
+}
+
+// DeleteSettlement lets the payer withdraw a settlement the payee has not yet
+// confirmed. It returns ErrSettlementNotPending once it has been decided.
+func (r *ExpenseRepository) DeleteSettlement(ctx context.Context, settlementID, payerID uuid.UUID) error {
+	result, err := r.db.ExecContext(ctx, `
+		DELETE FROM expense_settlements
+		WHERE id = $1 AND from_user_id = $2 AND status = $3`,
+		settlementID, payerID, models.SettlementStatusPending,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete settlement: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %v", err)
+	}
+	if rowsAffected == 0 {
+		return ErrSettlementNotPending
+	}
+	return nil
+}
+
+const settlementColumns = `id, carpool_id, from_user_id, to_user_id, amount_minor, currency, status, created_at, decided_at`
+
+func scanSettlement(row rowScanner, settlement *models.Settlement) error {
+	return row.Scan(
+		&settlement.ID,
+		&settlement.CarpoolID,
+		&settlement.FromUserID,
+		&settlement.ToUserID,
+		&settlement.AmountMinor,
+		&settlement.Currency,
+		&settlement.Status,
+		&settlement.CreatedAt,
+		&settlement.DecidedAt,
+	)
+}
+
+// Balances returns every member's running position in each currency the carpool
+// has used, from expenses paid, shares owed and settlements the payee confirmed.
+// Members who have left keep their balance until it is settled.
+func (r *ExpenseRepository) Balances(ctx context.Context, carpoolID uuid.UUID) ([]models.MemberBalance, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		WITH entries AS (
+			SELECT payer_id AS user_id, currency, amount_minor AS paid, 0 AS owed, 0 AS sent, 0 AS received
+			FROM ride_expenses
+			WHERE carpool_id = $1
+			UNION ALL
+			SELECT s.user_id, e.currency, 0, s.amount_minor, 0, 0
+			FROM ride_expense_shares s
+			JOIN ride_expenses e ON e.id = s.expense_id
+			WHERE e.carpool_id = $1
+			UNION ALL
+			SELECT from_user_id, currency, 0, 0, amount_minor, 0
+			FROM expense_settlements
+			WHERE carpool_id = $1 AND status = $2
+			UNION ALL
+			SELECT to_user_id, currency, 0, 0, 0, amount_minor
+			FROM expense_settlements
+			WHERE carpool_id = $1 AND status = $2
+		)
+		SELECT user_id, currency, SUM(paid), SUM(owed), SUM(sent), SUM(received)
+		FROM entries
+		GROUP BY user_id, currency
+		ORDER BY currency, user_id`,
+		carpoolID, models.SettlementStatusConfirmed,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get balances: %w", err)
+	}
+	defer rows.Close()
+
+	var balances []models.MemberBalance
+	for rows.Next() {
+		var b models.MemberBalance
+		if err := rows.Scan(&b.UserID, &b.Currency, &b.PaidMinor, &b.OwedMinor, &b.SentMinor, &b.ReceivedMinor); err != nil {
+			return nil, fmt.Errorf("failed to scan balance: %w", err)
+		}
+		b.NetMinor = b.PaidMinor - b.OwedMinor + b.SentMinor - b.ReceivedMinor
+		balances = append(balances, b)
+	}
+	return balances, rows.Err()
+}
+
+func collectExpenses(rows *sql.Rows) ([]models.Expense, error) {
+	defer rows.Close()
+
+	expenses := []models.Expense{}
+	for rows.Next() {
+		var expense models.Expense
+		if err := scanExpense(rows, &expense); err != nil {
+			return nil, fmt.Errorf("failed to scan expense: %w", err)
+		}
+		expenses = append(expenses, expense)
+	}
+
+	return expenses, rows.Err()
+}
+
+// expenseColumns is the column list read by scanExpense
+const expenseColumns = `id, carpool_id, carpool_ride_id, payer_id, category, amount_minor,
+        currency, split_rule, description, created_at`
+
+func scanExpense(row rowScanner, expense *models.Expense) error {
+	return row.Scan(
+		&expense.ID,
+		&expense.CarpoolID,
+		&expense.CarpoolRideID,
+		&expense.PayerID,
+		&expense.Category,
+		&expense.AmountMinor,
+		&expense.Currency,
+		&expense.SplitRule,
+		&expense.Description,
+		&expense.CreatedAt,
+	)
+}
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"car-backend/pkg/models"
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+type IncidentRepository struct {
+	db *sql.DB
+}
+
+func NewIncidentRepository(db *sql.DB) *IncidentRepository {
+	return &IncidentRepository{db: db}
+}
+
+// RecordIncident stores an incident unless the same one was already recorded.
+// It reports whether a new row was created so callers only alert once.
+func (r *IncidentRepository) RecordIncident(ctx context.Context, incident *models.RideIncident) (bool, error) {
+	query := `
+		INSERT INTO ride_incidents (
+			carpool_ride_id, carpool_stop_id, user_id, incident_type, details
+		) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT DO NOTHING
+		RETURNING id, created_at`
+
+	err := r.db.QueryRowContext(ctx, query,
+		incident.CarpoolRideID, incident.CarpoolStopID, incident.UserID, incident.IncidentType, incident.Details,
+	).Scan(&incident.ID, &incident.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to record incident: %w", err)
+	}
+
+	return true, nil
+}
+
+// GetReliability counts a user's recorded incidents by kind
+func (r *IncidentRepository) GetReliability(ctx context.Context, userID uuid.UUID) (*models.ReliabilityScore, error) {
+	score := &models.ReliabilityScore{UserID: userID}
+
+	query := `
+		SELECT
+			COUNT(*) FILTER (WHERE incident_type = $2),
+			COUNT(*) FILTER (WHERE incident_type IN ($3, $4)),
+			COUNT(*)
+		FROM ride_incidents
+		WHERE user_id = $1`
+
+	err := r.db.QueryRowContext(ctx, query, userID,
+		models.IncidentTypeLate, models.IncidentTypeDriverNoShow, models.IncidentTypeRiderNoShow,
+	).Scan(&score.LateCount, &score.NoShowCount, &score.IncidentCount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reliability: %w", err)
+	}
+
+	return score, nil
+}
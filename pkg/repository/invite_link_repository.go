@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"car-backend/pkg/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrInviteLinkInvalid = errors.New("invite link is expired, revoked or used up")
+
+type InviteLinkRepository struct {
+	db *sql.DB
+}
+
+func NewInviteLinkRepository(db *sql.DB) *InviteLinkRepository {
+	return &InviteLinkRepository{db: db}
+}
+
+func (r *InviteLinkRepository) CreateInviteLink(ctx context.Context, link *models.InviteLink) error {
+	query := `
+		INSERT INTO invite_links (carpool_id, created_by, code, expires_at, max_uses)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, use_count, created_at`
+
+	err := r.db.QueryRowContext(ctx, query,
+		link.CarpoolID, link.CreatedBy, link.Code, link.ExpiresAt, link.MaxUses,
+	).Scan(&link.ID, &link.UseCount, &link.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create invite link: %w", err)
+	}
+
+	return nil
+}
+
+func (r *InviteLinkRepository) GetInviteLink(ctx context.Context, linkID uuid.UUID) (*models.InviteLink, error) {
+	return r.getBy(ctx, "id", linkID)
+}
+
+func (r *InviteLinkRepository) GetInviteLinkByCode(ctx context.Context, code string) (*models.InviteLink, error) {
+	return r.getBy(ctx, "code", code)
+}
+
+func (r *InviteLinkRepository) getBy(ctx context.Context, column string, value interface{}) (*models.InviteLink, error) {
+	link := &models.InviteLink{}
+
+	query := `SELECT ` + inviteLinkColumns + ` FROM invite_links WHERE ` + column + ` = $1`
+	if err := scanInviteLink(r.db.QueryRowContext(ctx, query, value), link); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get invite link: %w", err)
+	}
+
+	return link, nil
+}
+
+// ListInviteLinks returns a carpool's links that are still usable
+func (r *InviteLinkRepository) ListInviteLinks(ctx context.Context, carpoolID uuid.UUID) ([]models.InviteLink, error) {
+	query := `SELECT ` + inviteLinkColumns + `
+		FROM invite_links
+		WHERE carpool_id = $1 AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		  AND (max_uses IS NULL OR use_count < max_uses)
+		ORDER BY created_at DESC`
+
+	rows, err := r.db.QueryContext(ctx, query, carpoolID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list invite links: %w", err)
+	}
+	defer rows.Close()
+
+	var links []models.InviteLink
+	for rows.Next() {
+		var link models.InviteLink
+		if err := scanInviteLink(rows, &link); err != nil {
+			return nil, fmt.Errorf("failed to scan invite link: %w", err)
+		}
+		links = append(links, link)
+	}
+
+	return links, rows.Err()
+}
+
+// RevokeInviteLink stops a link from being redeemed
+func (r *InviteLinkRepository) RevokeInviteLink(ctx context.Context, carpoolID, linkID uuid.UUID) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE invite_links
+		SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND carpool_id = $2 AND revoked_at IS NULL`,
+		linkID, carpoolID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke invite link: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %v", err)
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// RedeemInviteLink admits the user to the link's carpool and counts the use.
+// Redeeming a link for a carpool the user already belongs to does not use it up.
+func (r *InviteLinkRepository) RedeemInviteLink(ctx context.Context, linkID, userID uuid.UUID, now time.Time) (*models.InviteLink, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	link := &models.InviteLink{}
+	query := `SELECT ` + inviteLinkColumns + ` FROM invite_links WHERE id = $1 FOR UPDATE`
+	if err := scanInviteLink(tx.QueryRowContext(ctx, query, linkID), link); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrInviteLinkInvalid
+		}
+		return nil, fmt.Errorf("failed to get invite link: %w", err)
+	}
+
+	if link.RevokedAt != nil || !now.Before(link.ExpiresAt) ||
+		(link.MaxUses != nil && link.UseCount >= *link.MaxUses) {
+		return nil, ErrInviteLinkInvalid
+	}
+
+	var member bool
+	err = tx.QueryRowContext(ctx,
+		`SELECT EXISTS(SELECT 1 FROM carpool_members WHERE carpool_id = $1 AND user_id = $2)`,
+		link.CarpoolID, userID,
+	).Scan(&member)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check carpool membership: %v", err)
+	}
+	if member {
+		return link, ErrAlreadyMember
+	}
+
+	admitted, err := admitMember(ctx, tx, link.CarpoolID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !admitted {
+		return nil, ErrNoSeatsAvailable
+	}
+
+	err = tx.QueryRowContext(ctx,
+		`UPDATE invite_links SET use_count = use_count + 1 WHERE id = $1 RETURNING use_count`, link.ID,
+	).Scan(&link.UseCount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record invite link use: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	return link, nil
+}
+
+const inviteLinkColumns = `id, carpool_id, created_by, code, expires_at, max_uses, use_count, revoked_at, created_at`
+
+func scanInviteLink(row rowScanner, link *models.InviteLink) error {
+	return row.Scan(
+		&link.ID,
+		&link.CarpoolID,
+		&link.CreatedBy,
+		&link.Code,
+		&link.ExpiresAt,
+		&link.MaxUses,
+		&link.UseCount,
+		&link.RevokedAt,
+		&link.CreatedAt,
+	)
+}
@@ -4,11 +4,20 @@ import (
     "car-backend/pkg/models"
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 	"github.com/google/uuid"
 	
 )
 
+var (
+    ErrDuplicateInvite    = errors.New("recipient already has a pending invite to this carpool")
+    ErrInviteLimitReached = errors.New("daily invite limit reached")
+    ErrInviteNotPending   = errors.New("invite is no longer pending")
+)
+
 type InviteRepository struct {
     db *sql.DB
 }
@@ -17,29 +26,60 @@ func NewInviteRepository(db *sql.DB) *InviteRepository {
     return &InviteRepository{db: db}
 }
 
-func (r *InviteRepository) CreateInvite(ctx context.Context, invite *models.Invite) error {
+// CreateInvite stores a pending invite. It fails with ErrInviteLimitReached when the
+// sender already sent dailyLimit invites in the last 24 hours (0 disables the cap) and
+// with ErrDuplicateInvite when the recipient already has a pending invite to the carpool.
+func (r *InviteRepository) CreateInvite(ctx context.Context, invite *models.Invite, dailyLimit int) error {
     tx, err := r.db.BeginTx(ctx, nil)
     if err != nil {
             return fmt.Errorf("failed to begin transaction: %v", err)
     }
     defer tx.Rollback()
 
+    if dailyLimit > 0 {
+            // Lock the sender so concurrent requests cannot both slip under the cap
+            if _, err := tx.ExecContext(ctx, `SELECT id FROM users WHERE id = $1 FOR UPDATE`, invite.FromUser); err != nil {
+                    return fmt.Errorf("failed to lock sender: %v", err)
+            }
+
+            var sent int
+            err = tx.QueryRowContext(ctx, `
+                    SELECT COUNT(*) FROM invites
+                    WHERE from_user = $1 AND created_at > CURRENT_TIMESTAMP - INTERVAL '1 day'`,
+                    invite.FromUser,
+            ).Scan(&sent)
+            if err != nil {
+                    return fmt.Errorf("failed to count sent invites: %v", err)
+            }
+            if sent >= dailyLimit {
+                    return ErrInviteLimitReached
+            }
+    }
+
     query := `
             INSERT INTO invites (
-                    from_user, to_user, carpool_id, message, status
-            ) VALUES ($1, $2, $3, $4, $5)
+                    from_user, to_user, to_email, to_phone, carpool_id, message, status, expires_at
+            ) VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), $5, $6, $7, $8)
+            ON CONFLICT DO NOTHING
             RETURNING id, created_at, updated_at
     `
 
     err = tx.QueryRowContext(
             ctx, query,
-            invite.FromUser, invite.ToUser, invite.CarpoolID, invite.Message, invite.Status,
+            invite.FromUser, invite.ToUser, invite.ToEmail, invite.ToPhone, invite.CarpoolID, invite.Message, invite.Status, invite.ExpiresAt,
     ).Scan(&invite.ID, &invite.CreatedAt, &invite.UpdatedAt)
 
     if err != nil {
+            if err == sql.ErrNoRows {
+                    return ErrDuplicateInvite
+            }
             return fmt.Errorf("failed to create invite: %v", err)
     }
 
+    if err := enqueueEvent(ctx, tx, models.EventInviteCreated, invite.ID, models.InviteEvent{Invite: *invite}); err != nil {
+            return err
+    }
+
     if err := tx.Commit(); err != nil {
             return fmt.Errorf("failed to commit transaction: %v", err)
     }
@@ -50,29 +90,306 @@ func (r *InviteRepository) CreateInvite(ctx context.Context, invite *models.Invi
 func (r *InviteRepository) GetInvite(ctx context.Context, inviteID uuid.UUID) (*models.Invite, error) {
     invite := &models.Invite{}
 
-    query := `
-            SELECT id, from_user, to_user, carpool_id, message, status, created_at, updated_at
-            FROM invites
+    query := `SELECT ` + inviteColumns + ` FROM invites WHERE id = $1`
+
+    err := scanInvite(r.db.QueryRowContext(ctx, query, inviteID), invite)
+    if err != nil {
+            if err == sql.ErrNoRows {
+                    return nil, nil
+            }
+            return nil, fmt.Errorf("failed to get invite: %w", err)
+    }
+
+    return invite, nil
+}
+
+// ListInvites returns a page of invites the user sent or received, newest first,
+// joined with the carpool summary and the sender's display name.
+func (r *InviteRepository) ListInvites(ctx context.Context, userID uuid.UUID, filter models.InviteListFilter) ([]models.InviteListItem, int, error) {
+    where := []string{}
+    args := []interface{}{userID}
+
+    switch filter.Box {
+    case models.InviteBoxReceived:
+            where = append(where, "i.to_user = $1")
+    case models.InviteBoxSent:
+            where = append(where, "i.from_user = $1")
+    default:
+            where = append(where, "(i.to_user = $1 OR i.from_user = $1)")
+    }
+    if filter.Status != nil {
+            args = append(args, *filter.Status)
+            where = append(where, fmt.Sprintf("COALESCE(i.status, 0) = $%d", len(args)))
+    }
+    if filter.CarpoolID != nil {
+            args = append(args, *filter.CarpoolID)
+            where = append(where, fmt.Sprintf("i.carpool_id = $%d", len(args)))
+    }
+    conditions := strings.Join(where, " AND ")
+
+    var total int
+    err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM invites i WHERE `+conditions, args...).Scan(&total)
+    if err != nil {
+            return nil, 0, fmt.Errorf("failed to count invites: %w", err)
+    }
+
+    args = append(args, filter.Limit, filter.Offset)
+    query := fmt.Sprintf(`
+            SELECT i.id, i.from_user, i.to_user, COALESCE(i.to_email, ''), COALESCE(i.to_phone, ''),
+                   i.carpool_id, COALESCE(i.message, ''), COALESCE(i.status, 0), i.expires_at, i.reminder_sent_at,
+                   i.created_at, i.updated_at,
+                   COALESCE(NULLIF(u.display_name, ''), u.name),
+                   c.carpool_name, COALESCE(c.destination_address, ''), COALESCE(c.available_seats, 0)
+            FROM invites i
+            JOIN users u ON u.id = i.from_user
+            JOIN carpools c ON c.id = i.carpool_id
+            WHERE %s
+            ORDER BY i.created_at DESC, i.id
+            LIMIT $%d OFFSET $%d`, conditions, len(args)-1, len(args))
+
+    rows, err := r.db.QueryContext(ctx, query, args...)
+    if err != nil {
+            return nil, 0, fmt.Errorf("failed to list invites: %w", err)
+    }
+    defer rows.Close()
+
+    items := []models.InviteListItem{}
+    for rows.Next() {
+            var item models.InviteListItem
+            if err := rows.Scan(
+                    &item.ID,
+                    &item.FromUser,
+                    &item.ToUser,
+                    &item.ToEmail,
+                    &item.ToPhone,
+                    &item.CarpoolID,
+                    &item.Message,
+                    &item.Status,
+                    &item.ExpiresAt,
+                    &item.ReminderSentAt,
+                    &item.CreatedAt,
+                    &item.UpdatedAt,
+                    &item.SenderDisplayName,
+                    &item.Carpool.CarpoolName,
+                    &item.Carpool.DestinationAddress,
+                    &item.Carpool.AvailableSeats,
+            ); err != nil {
+                    return nil, 0, fmt.Errorf("failed to scan invite: %w", err)
+            }
+            item.Carpool.ID = item.CarpoolID
+            item.Direction = models.InviteBoxReceived
+            if item.FromUser == userID {
+                    item.Direction = models.InviteBoxSent
+            }
+            items = append(items, item)
+    }
+
+    return items, total, rows.Err()
+}
+
+// WithdrawInvite lets the sender retract an invite that has not been answered yet
+func (r *InviteRepository) WithdrawInvite(ctx context.Context, inviteID, senderID uuid.UUID) error {
+    result, err := r.db.ExecContext(ctx, `
+            UPDATE invites
+            SET status = $1, updated_at = CURRENT_TIMESTAMP
+            WHERE id = $2 AND from_user = $3 AND COALESCE(status, 0) = $4`,
+            models.InviteStatusWithdrawn, inviteID, senderID, models.InviteStatusPending,
+    )
+    if err != nil {
+            return fmt.Errorf("failed to withdraw invite: %w", err)
+    }
+
+    rowsAffected, err := result.RowsAffected()
+    if err != nil {
+            return fmt.Errorf("failed to get affected rows: %v", err)
+    }
+    if rowsAffected == 0 {
+            return sql.ErrNoRows
+    }
+
+    return nil
+}
+
+// RespondToInvite records the recipient's answer to a pending, unexpired invite.
+// Accepting adds the recipient to the carpool and fails with ErrNoSeatsAvailable
+// when it is full. It returns sql.ErrNoRows when the invite is not addressed to the user.
+func (r *InviteRepository) RespondToInvite(ctx context.Context, inviteID, userID uuid.UUID, status int) (*models.Invite, error) {
+    tx, err := r.db.BeginTx(ctx, nil)
+    if err != nil {
+            return nil, fmt.Errorf("failed to begin transaction: %v", err)
+    }
+    defer tx.Rollback()
+
+    invite := &models.Invite{}
+    query := `SELECT ` + inviteColumns + ` FROM invites WHERE id = $1 AND to_user = $2 FOR UPDATE`
+    if err := scanInvite(tx.QueryRowContext(ctx, query, inviteID, userID), invite); err != nil {
+            if err == sql.ErrNoRows {
+                    return nil, err
+            }
+            return nil, fmt.Errorf("failed to get invite: %w", err)
+    }
+    if invite.Status != models.InviteStatusPending || !invite.ExpiresAt.After(time.Now()) {
+            return nil, ErrInviteNotPending
+    }
+
+    if status == models.InviteStatusAccepted {
+            admitted, err := admitMember(ctx, tx, invite.CarpoolID, userID)
+            if err != nil {
+                    return nil, err
+            }
+            if !admitted {
+                    return nil, ErrNoSeatsAvailable
+            }
+    }
+
+    err = tx.QueryRowContext(ctx, `
+            UPDATE invites
+            SET status = $2, updated_at = CURRENT_TIMESTAMP
             WHERE id = $1
-    `
+            RETURNING updated_at`,
+            invite.ID, status,
+    ).Scan(&invite.UpdatedAt)
+    if err != nil {
+            return nil, fmt.Errorf("failed to update invite: %w", err)
+    }
+    invite.Status = status
+
+    eventType := models.EventInviteRejected
+    if status == models.InviteStatusAccepted {
+            eventType = models.EventInviteAccepted
+    }
+    if err := enqueueEvent(ctx, tx, eventType, invite.ID, models.InviteEvent{Invite: *invite}); err != nil {
+            return nil, err
+    }
+
+    if err := tx.Commit(); err != nil {
+            return nil, fmt.Errorf("failed to commit transaction: %v", err)
+    }
+
+    return invite, nil
+}
+
+// ClaimInvites attaches invites addressed to an email or phone number to the
+// user who verified it, and returns how many were claimed. Pass "" for an
+// address that is not verified.
+// Only one pending invite per carpool is claimed so the user never ends up with
+// duplicate pending invites; the rest are left to expire.
+func (r *InviteRepository) ClaimInvites(ctx context.Context, userID uuid.UUID, email, phone string) (int64, error) {
+    result, err := r.db.ExecContext(ctx, `
+            WITH matched AS (
+                    SELECT id, carpool_id, COALESCE(status, 0) AS status, created_at
+                    FROM invites
+                    WHERE to_user IS NULL
+                      AND ((to_email IS NOT NULL AND LOWER(to_email) = LOWER(NULLIF($2, '')))
+                        OR (to_phone IS NOT NULL AND to_phone = NULLIF($3, '')))
+            ), claimable AS (
+                    SELECT id FROM matched WHERE status <> $4
+                    UNION ALL
+                    (SELECT DISTINCT ON (carpool_id) id FROM matched m
+                     WHERE m.status = $4
+                       AND NOT EXISTS (
+                             SELECT 1 FROM invites p
+                             WHERE p.carpool_id = m.carpool_id AND p.to_user = $1 AND COALESCE(p.status, 0) = $4
+                       )
+                     ORDER BY carpool_id, created_at DESC)
+            )
+            UPDATE invites
+            SET to_user = $1, updated_at = CURRENT_TIMESTAMP
+            WHERE id IN (SELECT id FROM claimable)`,
+            userID, email, phone, models.InviteStatusPending,
+    )
+    if err != nil {
+            return 0, fmt.Errorf("failed to claim invites: %w", err)
+    }
+
+    return result.RowsAffected()
+}
+
+// ExpireInvites moves pending invites past their expiry to the expired status
+// and returns how many were expired.
+func (r *InviteRepository) ExpireInvites(ctx context.Context, now time.Time) (int64, error) {
+    result, err := r.db.ExecContext(ctx, `
+            UPDATE invites
+            SET status = $1, updated_at = CURRENT_TIMESTAMP
+            WHERE COALESCE(status, 0) = $2 AND expires_at <= $3`,
+            models.InviteStatusExpired, models.InviteStatusPending, now,
+    )
+    if err != nil {
+            return 0, fmt.Errorf("failed to expire invites: %w", err)
+    }
+
+    return result.RowsAffected()
+}
+
+// ClaimInviteReminders marks pending invites expiring before cutoff as reminded,
+// queues an invite.reminder event for each in the same transaction and returns
+// them. Each invite is claimed at most once, even with several sweepers running,
+// and its reminder is delivered by the outbox even if the sweeper stops.
+func (r *InviteRepository) ClaimInviteReminders(ctx context.Context, now, cutoff time.Time) ([]models.Invite, error) {
+    tx, err := r.db.BeginTx(ctx, nil)
+    if err != nil {
+            return nil, fmt.Errorf("failed to begin transaction: %v", err)
+    }
+    defer tx.Rollback()
+
+    query := `
+            UPDATE invites
+            SET reminder_sent_at = CURRENT_TIMESTAMP
+            WHERE COALESCE(status, 0) = $1 AND reminder_sent_at IS NULL
+              AND expires_at > $2 AND expires_at <= $3
+            RETURNING ` + inviteColumns
+
+    rows, err := tx.QueryContext(ctx, query, models.InviteStatusPending, now, cutoff)
+    if err != nil {
+            return nil, fmt.Errorf("failed to claim invite reminders: %w", err)
+    }
+
+    var invites []models.Invite
+    for rows.Next() {
+            var invite models.Invite
+            if err := scanInvite(rows, &invite); err != nil {
+                    rows.Close()
+                    return nil, fmt.Errorf("failed to scan invite: %w", err)
+            }
+            invites = append(invites, invite)
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+            return nil, err
+    }
+
+    for _, invite := range invites {
+            if err := enqueueEvent(ctx, tx, models.EventInviteReminder, invite.ID, models.InviteEvent{Invite: invite}); err != nil {
+                    return nil, err
+            }
+    }
 
-    err := r.db.QueryRowContext(ctx, query, inviteID).Scan(
+    if err := tx.Commit(); err != nil {
+            return nil, fmt.Errorf("failed to commit transaction: %v", err)
+    }
+
+    return invites, nil
+}
+
+// inviteColumns is the column list read by scanInvite
+const inviteColumns = `
+            id, from_user, to_user, COALESCE(to_email, ''), COALESCE(to_phone, ''),
+            carpool_id, COALESCE(message, ''), COALESCE(status, 0), expires_at, reminder_sent_at,
+            created_at, updated_at`
+
+func scanInvite(row rowScanner, invite *models.Invite) error {
+    return row.Scan(
             &invite.ID,
             &invite.FromUser,
             &invite.ToUser,
+            &invite.ToEmail,
+            &invite.ToPhone,
             &invite.CarpoolID,
             &invite.Message,
             &invite.Status,
+            &invite.ExpiresAt,
+            &invite.ReminderSentAt,
             &invite.CreatedAt,
             &invite.UpdatedAt,
     )
-    if err != nil {
-            if err == sql.ErrNoRows {
-                    return nil, nil
-            }
-            return nil, fmt.Errorf("failed to get invite: %w", err)
-    }
-
-    return invite, nil
 }
-
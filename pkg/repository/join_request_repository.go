@@ -0,0 +1,314 @@
+package repository
+
+import (
+	"car-backend/pkg/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrAlreadyMember     = errors.New("user is already a member of this carpool")
+	ErrOpenRequestExists = errors.New("user already has an open request for this carpool")
+	ErrRequestNotOpen    = errors.New("join request is no longer open")
+	ErrNoSeatsAvailable  = errors.New("carpool has no available seats")
+)
+
+type JoinRequestRepository struct {
+	db *sql.DB
+}
+
+func NewJoinRequestRepository(db *sql.DB) *JoinRequestRepository {
+	return &JoinRequestRepository{db: db}
+}
+
+// CreateJoinRequest files a request to join a carpool for its admins to decide on
+func (r *JoinRequestRepository) CreateJoinRequest(ctx context.Context, request *models.JoinRequest) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var member bool
+	err = tx.QueryRowContext(ctx,
+		`SELECT EXISTS(SELECT 1 FROM carpool_members WHERE carpool_id = c.id AND user_id = $2) FROM carpools c WHERE c.id = $1`,
+		request.CarpoolID, request.UserID,
+	).Scan(&member)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return err
+		}
+		return fmt.Errorf("failed to check carpool membership: %v", err)
+	}
+	if member {
+		return ErrAlreadyMember
+	}
+
+	request.Status = models.JoinRequestStatusPending
+
+	query := `
+		INSERT INTO join_requests (carpool_id, user_id, message, status)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT DO NOTHING
+		RETURNING id, created_at, updated_at`
+
+	err = tx.QueryRowContext(ctx, query,
+		request.CarpoolID, request.UserID, request.Message, request.Status,
+	).Scan(&request.ID, &request.CreatedAt, &request.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrOpenRequestExists
+		}
+		return fmt.Errorf("failed to create join request: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	return nil
+}
+
+func (r *JoinRequestRepository) GetJoinRequest(ctx context.Context, requestID uuid.UUID) (*models.JoinRequest, error) {
+	request := &models.JoinRequest{}
+
+	query := `SELECT ` + joinRequestColumns + ` FROM join_requests WHERE id = $1`
+	if err := scanJoinRequest(r.db.QueryRowContext(ctx, query, requestID), request); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get join request: %w", err)
+	}
+
+	return request, nil
+}
+
+// ListJoinRequests returns a carpool's requests with the given statuses, oldest first
+func (r *JoinRequestRepository) ListJoinRequests(ctx context.Context, carpoolID uuid.UUID, statuses []int) ([]models.JoinRequest, error) {
+	query := `SELECT ` + joinRequestColumns + `
+		FROM join_requests
+		WHERE carpool_id = $1 AND status = ANY($2)
+		ORDER BY created_at`
+
+	rows, err := r.db.QueryContext(ctx, query, carpoolID, pq.Array(statuses))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list join requests: %w", err)
+	}
+	defer rows.Close()
+
+	var requests []models.JoinRequest
+	for rows.Next() {
+		var request models.JoinRequest
+		if err := scanJoinRequest(rows, &request); err != nil {
+			return nil, fmt.Errorf("failed to scan join request: %w", err)
+		}
+		requests = append(requests, request)
+	}
+
+	return requests, rows.Err()
+}
+
+// ApproveJoinRequest adds the requester as a member and reserves a seat.
+// If the carpool filled up in the meantime the request is waitlisted and
+// ErrNoSeatsAvailable is returned.
+func (r *JoinRequestRepository) ApproveJoinRequest(ctx context.Context, requestID, approverID uuid.UUID) (*models.JoinRequest, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	request := &models.JoinRequest{}
+	query := `SELECT ` + joinRequestColumns + ` FROM join_requests WHERE id = $1 FOR UPDATE`
+	if err := scanJoinRequest(tx.QueryRowContext(ctx, query, requestID), request); err != nil {
+		return nil, err
+	}
+	if request.Status != models.JoinRequestStatusPending && request.Status != models.JoinRequestStatusWaitlisted {
+		return nil, ErrRequestNotOpen
+	}
+
+	admitted, err := admitMember(ctx, tx, request.CarpoolID, request.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	request.Status = models.JoinRequestStatusApproved
+	if !admitted {
+		request.Status = models.JoinRequestStatusWaitlisted
+	}
+	if err := setJoinRequestStatus(ctx, tx, request, &approverID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	if !admitted {
+		return request, ErrNoSeatsAvailable
+	}
+	return request, nil
+}
+
+// DenyJoinRequest rejects an open request
+func (r *JoinRequestRepository) DenyJoinRequest(ctx context.Context, requestID, deciderID uuid.UUID) error {
+	return r.closeRequest(ctx, requestID, models.JoinRequestStatusDenied, &deciderID)
+}
+
+// CancelJoinRequest withdraws an open request on behalf of the requester
+func (r *JoinRequestRepository) CancelJoinRequest(ctx context.Context, requestID uuid.UUID) error {
+	return r.closeRequest(ctx, requestID, models.JoinRequestStatusCancelled, nil)
+}
+
+func (r *JoinRequestRepository) closeRequest(ctx context.Context, requestID uuid.UUID, status int, decidedBy *uuid.UUID) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE join_requests
+		SET status = $1, decided_by = COALESCE($2, decided_by), updated_at = CURRENT_TIMESTAMP
+		WHERE id = $3 AND status IN ($4, $5)`,
+		status, decidedBy, requestID, models.JoinRequestStatusPending, models.JoinRequestStatusWaitlisted,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update join request: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %v", err)
+	}
+	if rowsAffected == 0 {
+		return ErrRequestNotOpen
+	}
+
+	return nil
+}
+
+// admitMember inserts the membership row and takes a seat if one is free.
+// The carpool row is locked so concurrent approvals cannot oversell seats.
+func admitMember(ctx context.Context, tx *sql.Tx, carpoolID, userID uuid.UUID) (bool, error) {
+	var availableSeats int
+	err := tx.QueryRowContext(ctx,
+		`SELECT COALESCE(available_seats, 0) FROM carpools WHERE id = $1 FOR UPDATE`, carpoolID,
+	).Scan(&availableSeats)
+	if err != nil {
+		return false, fmt.Errorf("failed to lock carpool: %v", err)
+	}
+	if availableSeats <= 0 {
+		return false, nil
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO carpool_members (carpool_id, user_id)
+		VALUES ($1, $2)
+		ON CONFLICT (carpool_id, user_id) DO NOTHING`,
+		carpoolID, userID,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to add carpool member: %v", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		// Already a member, so no new seat is taken
+		return true, nil
+	}
+
+	event := models.MembershipEvent{CarpoolID: carpoolID, UserID: userID}
+	if err := enqueueEvent(ctx, tx, models.EventMemberJoined, carpoolID, event); err != nil {
+		return false, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE carpools
+		SET available_seats = available_seats - 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`,
+		carpoolID,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to reserve seat: %v", err)
+	}
+
+	return true, nil
+}
+
+// promoteWaitlist admits waitlisted requesters, oldest first, while seats are
+// free. Only requests an admin approved are on the waitlist, and each promotion
+// queues an event so the requester hears about it.
+func promoteWaitlist(ctx context.Context, tx *sql.Tx, carpoolID uuid.UUID) ([]models.JoinRequest, error) {
+	var promoted []models.JoinRequest
+
+	for {
+		request := models.JoinRequest{}
+		query := `SELECT ` + joinRequestColumns + `
+			FROM join_requests
+			WHERE carpool_id = $1 AND status = $2 AND decided_by IS NOT NULL
+			ORDER BY created_at
+			LIMIT 1
+			FOR UPDATE`
+		err := scanJoinRequest(tx.QueryRowContext(ctx, query, carpoolID, models.JoinRequestStatusWaitlisted), &request)
+		if err == sql.ErrNoRows {
+			return promoted, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read waitlist: %v", err)
+		}
+
+		admitted, err := admitMember(ctx, tx, carpoolID, request.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if !admitted {
+			return promoted, nil
+		}
+
+		request.Status = models.JoinRequestStatusApproved
+		if err := setJoinRequestStatus(ctx, tx, &request, nil); err != nil {
+			return nil, err
+		}
+
+		event := models.MembershipEvent{CarpoolID: carpoolID, UserID: request.UserID}
+		if err := enqueueEvent(ctx, tx, models.EventWaitlistPromoted, request.ID, event); err != nil {
+			return nil, err
+		}
+		promoted = append(promoted, request)
+	}
+}
+
+func setJoinRequestStatus(ctx context.Context, tx *sql.Tx, request *models.JoinRequest, decidedBy *uuid.UUID) error {
+	err := tx.QueryRowContext(ctx, `
+		UPDATE join_requests
+		SET status = $1, decided_by = COALESCE($2, decided_by), updated_at = CURRENT_TIMESTAMP
+		WHERE id = $3
+		RETURNING decided_by, updated_at`,
+		request.Status, decidedBy, request.ID,
+	).Scan(&request.DecidedBy, &request.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to update join request: %v", err)
+	}
+	return nil
+}
+
+const joinRequestColumns = `id, carpool_id, user_id, COALESCE(message, ''), status, decided_by, created_at, updated_at`
+
+func scanJoinRequest(row rowScanner, request *models.JoinRequest) error {
+	var decidedBy uuid.NullUUID
+	err := row.Scan(
+		&request.ID,
+		&request.CarpoolID,
+		&request.UserID,
+		&request.Message,
+		&request.Status,
+		&decidedBy,
+		&request.CreatedAt,
+		&request.UpdatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	if decidedBy.Valid {
+		request.DecidedBy = &decidedBy.UUID
+	}
+	return nil
+}
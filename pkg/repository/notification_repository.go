@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"car-backend/pkg/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type NotificationRepository struct {
+	db *sql.DB
+}
+
+func NewNotificationRepository(db *sql.DB) *NotificationRepository {
+	return &NotificationRepository{db: db}
+}
+
+// Create stores an inbox entry for the notification's user
+func (r *NotificationRepository) Create(ctx context.Context, entry *models.FeedNotification) error {
+	data, err := json.Marshal(entry.Data)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification data: %v", err)
+	}
+
+	query := `
+		INSERT INTO notifications (user_id, type, title, body, data, carpool_id, carpool_ride_id, invite_id, link)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, created_at`
+
+	err = r.db.QueryRowContext(ctx, query,
+		entry.UserID, entry.Type, entry.Title, entry.Body, data,
+		entry.CarpoolID, entry.CarpoolRideID, entry.InviteID, entry.Link,
+	).Scan(&entry.ID, &entry.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create notification: %v", err)
+	}
+
+	return nil
+}
+
+// List returns up to limit of the user's notifications older than the cursor,
+// newest first, optionally only the unread ones.
+func (r *NotificationRepository) List(ctx context.Context, userID uuid.UUID, before *PageCursor, limit int, unreadOnly bool) ([]models.FeedNotification, error) {
+	query := `SELECT ` + notificationColumns + `
+		FROM notifications
+		WHERE user_id = $1
+		  AND (NOT $2 OR read_at IS NULL)
+		  AND ($3::timestamptz IS NULL OR (created_at, id) < ($3, $4))
+		ORDER BY created_at DESC, id DESC
+		LIMIT $5`
+
+	var cursorTime *time.Time
+	cursorID := uuid.Nil
+	if before != nil {
+		cursorTime, cursorID = &before.CreatedAt, before.ID
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, userID, unreadOnly, cursorTime, cursorID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notifications: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []models.FeedNotification{}
+	for rows.Next() {
+		var entry models.FeedNotification
+		if err := scanFeedNotification(rows, &entry); err != nil {
+			return nil, fmt.Errorf("failed to scan notification: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// UnreadCount returns how many of the user's notifications are unread
+func (r *NotificationRepository) UnreadCount(ctx context.Context, userID uuid.UUID) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL`,
+		userID,
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count unread notifications: %w", err)
+	}
+
+	return count, nil
+}
+
+// MarkRead marks one of the user's notifications as read. It returns
+// sql.ErrNoRows when the notification does not belong to the user.
+func (r *NotificationRepository) MarkRead(ctx context.Context, notificationID, userID uuid.UUID) (*models.FeedNotification, error) {
+	entry := &models.FeedNotification{}
+
+	query := `
+		UPDATE notifications
+		SET read_at = COALESCE(read_at, CURRENT_TIMESTAMP)
+		WHERE id = $1 AND user_id = $2
+		RETURNING ` + notificationColumns
+
+	err := scanFeedNotification(r.db.QueryRowContext(ctx, query, notificationID, userID), entry)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to mark notification read: %w", err)
+	}
+
+	return entry, nil
+}
+
+// MarkAllRead marks every unread notification of the user as read
+func (r *NotificationRepository) MarkAllRead(ctx context.Context, userID uuid.UUID) (int64, error) {
+	result, err := r.db.ExecContext(ctx,
+		`UPDATE notifications SET read_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND read_at IS NULL`,
+		userID,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark notifications read: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+// notificationColumns is the column list read by scanFeedNotification
+const notificationColumns = `
+	id, user_id, type, title, body, data, carpool_id, carpool_ride_id, invite_id, link, read_at, created_at`
+
+func scanFeedNotification(row rowScanner, entry *models.FeedNotification) error {
+	var data []byte
+	err := row.Scan(
+		&entry.ID,
+		&entry.UserID,
+		&entry.Type,
+		&entry.Title,
+		&entry.Body,
+		&data,
+		&entry.CarpoolID,
+		&entry.CarpoolRideID,
+		&entry.InviteID,
+		&entry.Link,
+		&entry.ReadAt,
+		&entry.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	if len(data) > 0 {
+		return json.Unmarshal(data, &entry.Data)
+	}
+	return nil
+}
@@ -0,0 +1,409 @@
+package repository
+
+import (
+	"car-backend/pkg/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrAlreadyOrgMember = errors.New("already a member of this organization")
+	ErrLastOrgAdmin     = errors.New("an organization needs at least one admin")
+)
+
+type OrganizationRepository struct {
+	db *sql.DB
+}
+
+func NewOrganizationRepository(db *sql.DB) *OrganizationRepository {
+	return &OrganizationRepository{db: db}
+}
+
+// CreateOrganization stores the organization with its creator as its first admin
+func (r *OrganizationRepository) CreateOrganization(ctx context.Context, org *models.Organization) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO organizations (name, kind, email_domains, pending_email_domains, join_code, created_by)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6)
+		RETURNING id, created_at, updated_at`,
+		org.Name, org.Kind, pq.Array(org.EmailDomains), pq.Array(org.PendingEmailDomains), org.JoinCode, org.CreatedBy,
+	).Scan(&org.ID, &org.CreatedAt, &org.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create organization: %v", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO organization_members (organization_id, user_id, role, status, verified_via)
+		VALUES ($1, $2, $3, $4, $5)`,
+		org.ID, org.CreatedBy, models.OrgRoleAdmin, models.OrgMemberActive, models.OrgVerifiedCreator,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to add organization creator: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	return nil
+}
+
+// GetOrganization returns an organization, or nil
+func (r *OrganizationRepository) GetOrganization(ctx context.Context, orgID uuid.UUID) (*models.Organization, error) {
+	return r.getOrganization(ctx, `id = $1`, orgID)
+}
+
+// GetByJoinCode returns the organization with the join code, or nil
+func (r *OrganizationRepository) GetByJoinCode(ctx context.Context, code string) (*models.Organization, error) {
+	return r.getOrganization(ctx, `join_code = $1`, code)
+}
+
+func (r *OrganizationRepository) getOrganization(ctx context.Context, where string, arg interface{}) (*models.Organization, error) {
+	org := &models.Organization{}
+	err := scanOrganization(r.db.QueryRowContext(ctx,
+		`SELECT `+organizationColumns+` FROM organizations o WHERE o.`+where, arg), org)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get organization: %w", err)
+	}
+	return org, nil
+}
+
+// UpdateOrganization saves the organization's name, email domains and join code
+func (r *OrganizationRepository) UpdateOrganization(ctx context.Context, org *models.Organization) error {
+	err := r.db.QueryRowContext(ctx, `
+		UPDATE organizations
+		SET name = $2, email_domains = $3, pending_email_domains = $4, join_code = NULLIF($5, ''),
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING updated_at`,
+		org.ID, org.Name, pq.Array(org.EmailDomains), pq.Array(org.PendingEmailDomains), org.JoinCode,
+	).Scan(&org.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to update organization: %w", err)
+	}
+	return nil
+}
+
+// ListPendingEmailDomains returns organizations with email domains waiting for
+// a moderator, longest waiting first
+func (r *OrganizationRepository) ListPendingEmailDomains(ctx context.Context, limit int) ([]models.Organization, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+organizationColumns+`
+		FROM organizations o
+		WHERE cardinality(o.pending_email_domains) > 0
+		ORDER BY o.updated_at, o.id
+		LIMIT $1`,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pending email domains: %w", err)
+	}
+	defer rows.Close()
+
+	orgs := []models.Organization{}
+	for rows.Next() {
+		var org models.Organization
+		if err := scanOrganization(rows, &org); err != nil {
+			return nil, fmt.Errorf("failed to scan organization: %w", err)
+		}
+		orgs = append(orgs, org)
+	}
+	return orgs, rows.Err()
+}
+
+// ReviewEmailDomains approves or rejects the organization's pending domains in
+// domains, or all of them when domains is empty. Approved domains start
+// admitting members; rejected ones are dropped. Returns sql.ErrNoRows when none
+// of the domains was pending.
+func (r *OrganizationRepository) ReviewEmailDomains(ctx context.Context, orgID uuid.UUID, domains []string, approve bool) error {
+	result, err := r.db.ExecContext(ctx, `
+		WITH reviewed AS (
+			SELECT ARRAY(
+				SELECT d FROM unnest(pending_email_domains) d
+				WHERE COALESCE(cardinality($2::text[]), 0) = 0 OR d = ANY($2::text[])
+			) AS domains
+			FROM organizations
+			WHERE id = $1
+		)
+		UPDATE organizations o
+		SET email_domains = CASE WHEN $3 THEN ARRAY(
+		        SELECT DISTINCT d FROM unnest(o.email_domains || reviewed.domains) d ORDER BY d
+		    ) ELSE o.email_domains END,
+		    pending_email_domains = ARRAY(
+		        SELECT d FROM unnest(o.pending_email_domains) d WHERE d <> ALL(reviewed.domains)
+		    ),
+		    updated_at = CURRENT_TIMESTAMP
+		FROM reviewed
+		WHERE o.id = $1 AND cardinality(reviewed.domains) > 0`,
+		orgID, pq.Array(domains), approve,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to review email domains: %w", err)
+	}
+	changed, err := rowsChanged(result)
+	if err != nil {
+		return err
+	}
+	if !changed {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ListUserOrganizations returns the organizations the user belongs to or has
+// asked to join, with their membership, by name
+func (r *OrganizationRepository) ListUserOrganizations(ctx context.Context, userID uuid.UUID) ([]models.Organization, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+organizationColumns+`, `+orgMemberColumns+`
+		FROM organizations o
+		JOIN organization_members m ON m.organization_id = o.id
+		WHERE m.user_id = $1
+		ORDER BY o.name, o.id`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list organizations: %w", err)
+	}
+	defer rows.Close()
+
+	orgs := []models.Organization{}
+	for rows.Next() {
+		var org models.Organization
+		member := &models.OrganizationMember{}
+		if err := rows.Scan(append(organizationFields(&org), orgMemberFields(member)...)...); err != nil {
+			return nil, fmt.Errorf("failed to scan organization: %w", err)
+		}
+		org.Membership = member
+		orgs = append(orgs, org)
+	}
+	return orgs, rows.Err()
+}
+
+// GetMember returns the user's membership of the organization, or nil
+func (r *OrganizationRepository) GetMember(ctx context.Context, orgID, userID uuid.UUID) (*models.OrganizationMember, error) {
+	member := &models.OrganizationMember{}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT `+orgMemberColumns+`
+		FROM organization_members m
+		WHERE m.organization_id = $1 AND m.user_id = $2`,
+		orgID, userID,
+	).Scan(orgMemberFields(member)...)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get organization member: %w", err)
+	}
+	return member, nil
+}
+
+// IsAdmin reports whether the user is an active admin of the organization
+func (r *OrganizationRepository) IsAdmin(ctx context.Context, orgID, userID uuid.UUID) (bool, error) {
+	var admin bool
+	err := r.db.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM organization_members
+			WHERE organization_id = $1 AND user_id = $2 AND role = $3 AND status = $4
+		)`,
+		orgID, userID, models.OrgRoleAdmin, models.OrgMemberActive,
+	).Scan(&admin)
+	if err != nil {
+		return false, fmt.Errorf("failed to check organization admin: %w", err)
+	}
+	return admin, nil
+}
+
+// AddMember adds the user to the organization, or activates their pending
+// request when member is active. It returns ErrAlreadyOrgMember when there is
+// nothing to change.
+func (r *OrganizationRepository) AddMember(ctx context.Context, member *models.OrganizationMember) error {
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO organization_members (organization_id, user_id, role, status, verified_via)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (organization_id, user_id) DO UPDATE
+		SET status = EXCLUDED.status, verified_via = EXCLUDED.verified_via, updated_at = CURRENT_TIMESTAMP
+		WHERE organization_members.status = $6 AND EXCLUDED.status = $7
+		RETURNING role, created_at, updated_at`,
+		member.OrganizationID, member.UserID, models.OrgRoleMember, member.Status, member.VerifiedVia,
+		models.OrgMemberPending, models.OrgMemberActive,
+	).Scan(&member.Role, &member.CreatedAt, &member.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrAlreadyOrgMember
+		}
+		return fmt.Errorf("failed to add organization member: %w", err)
+	}
+	return nil
+}
+
+// ListMembers returns the organization's members with the given status, oldest first
+func (r *OrganizationRepository) ListMembers(ctx context.Context, orgID uuid.UUID, status string) ([]models.OrganizationMember, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+orgMemberColumns+`, COALESCE(NULLIF(u.display_name, ''), u.name, '')
+		FROM organization_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.organization_id = $1 AND m.status = $2
+		ORDER BY m.created_at, m.user_id`,
+		orgID, status,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list organization members: %w", err)
+	}
+	defer rows.Close()
+
+	members := []models.OrganizationMember{}
+	for rows.Next() {
+		var member models.OrganizationMember
+		if err := rows.Scan(append(orgMemberFields(&member), &member.Name)...); err != nil {
+			return nil, fmt.Errorf("failed to scan organization member: %w", err)
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+// ApproveMember activates a pending membership. It returns sql.ErrNoRows when
+// the user has no pending request.
+func (r *OrganizationRepository) ApproveMember(ctx context.Context, orgID, userID, adminID uuid.UUID) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE organization_members
+		SET status = $3, verified_via = $4, approved_by = $5, updated_at = CURRENT_TIMESTAMP
+		WHERE organization_id = $1 AND user_id = $2 AND status = $6`,
+		orgID, userID, models.OrgMemberActive, models.OrgVerifiedApproval, adminID, models.OrgMemberPending,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to approve organization member: %w", err)
+	}
+	changed, err := rowsChanged(result)
+	if err != nil {
+		return err
+	}
+	if !changed {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetMemberRole changes an active member's role. It returns sql.ErrNoRows when
+// the user is not an active member and ErrLastOrgAdmin when it would leave the
+// organization without an admin.
+func (r *OrganizationRepository) SetMemberRole(ctx context.Context, orgID, userID uuid.UUID, role string) error {
+	return r.changeMember(ctx, orgID, userID, role == models.OrgRoleAdmin, `
+		UPDATE organization_members
+		SET role = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE organization_id = $1 AND user_id = $2 AND status = $4`,
+		orgID, userID, role, models.OrgMemberActive,
+	)
+}
+
+// RemoveMember removes a membership or pending request. It returns
+// sql.ErrNoRows when there is none and ErrLastOrgAdmin when it would leave the
+// organization without an admin.
+func (r *OrganizationRepository) RemoveMember(ctx context.Context, orgID, userID uuid.UUID) error {
+	return r.changeMember(ctx, orgID, userID, false, `
+		DELETE FROM organization_members
+		WHERE organization_id = $1 AND user_id = $2`,
+		orgID, userID,
+	)
+}
+
+// changeMember runs query against a membership unless the member is the last
+// active admin and staysAdmin is false
+func (r *OrganizationRepository) changeMember(ctx context.Context, orgID, userID uuid.UUID, staysAdmin bool, query string, args ...interface{}) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the admins so two admins cannot remove each other at once
+	var admins int
+	var isAdmin bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT COUNT(*), COALESCE(BOOL_OR(user_id = $2), FALSE)
+		FROM (
+			SELECT user_id FROM organization_members
+			WHERE organization_id = $1 AND role = $3 AND status = $4
+			FOR UPDATE
+		) admins`,
+		orgID, userID, models.OrgRoleAdmin, models.OrgMemberActive,
+	).Scan(&admins, &isAdmin)
+	if err != nil {
+		return fmt.Errorf("failed to count organization admins: %v", err)
+	}
+	if isAdmin && !staysAdmin && admins == 1 {
+		return ErrLastOrgAdmin
+	}
+
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to update organization member: %v", err)
+	}
+	changed, err := rowsChanged(result)
+	if err != nil {
+		return err
+	}
+	if !changed {
+		return sql.ErrNoRows
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	return nil
+}
+
+// organizationColumns is the column list read by organizationFields
+const organizationColumns = `
+		o.id, o.name, o.kind, o.email_domains, o.pending_email_domains, COALESCE(o.join_code, ''),
+		o.created_by, o.created_at, o.updated_at`
+
+func organizationFields(org *models.Organization) []interface{} {
+	return []interface{}{
+		&org.ID,
+		&org.Name,
+		&org.Kind,
+		pq.Array(&org.EmailDomains),
+		pq.Array(&org.PendingEmailDomains),
+		&org.JoinCode,
+		&org.CreatedBy,
+		&org.CreatedAt,
+		&org.UpdatedAt,
+	}
+}
+
+func scanOrganization(row rowScanner, org *models.Organization) error {
+	return row.Scan(organizationFields(org)...)
+}
+
+// orgMemberColumns is the column list read by orgMemberFields
+const orgMemberColumns = `
+		m.organization_id, m.user_id, m.role, m.status, m.verified_via,
+		m.approved_by, m.created_at, m.updated_at`
+
+func orgMemberFields(member *models.OrganizationMember) []interface{} {
+	return []interface{}{
+		&member.OrganizationID,
+		&member.UserID,
+		&member.Role,
+		&member.Status,
+		&member.VerifiedVia,
+		&member.ApprovedBy,
+		&member.CreatedAt,
+		&member.UpdatedAt,
+	}
+}
@@ -0,0 +1,186 @@
+package repository
+
+import (
+	"car-backend/pkg/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// enqueueEvent writes a domain event to the outbox inside the caller's transaction,
+// so the event is recorded if and only if the change that caused it commits.
+func enqueueEvent(ctx context.Context, tx *sql.Tx, eventType string, aggregateID uuid.UUID, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %v", eventType, err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO outbox_events (event_type, aggregate_id, payload) VALUES ($1, $2, $3)`,
+		eventType, aggregateID, data,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to enqueue %s event: %v", eventType, err)
+	}
+
+	return nil
+}
+
+type OutboxRepository struct {
+	db *sql.DB
+}
+
+func NewOutboxRepository(db *sql.DB) *OutboxRepository {
+	return &OutboxRepository{db: db}
+}
+
+// ClaimEvents takes up to limit undelivered events that are due, oldest first,
+// and hides them from other dispatchers for the lease. An event whose dispatcher
+// dies before settling it becomes due again when the lease runs out.
+func (r *OutboxRepository) ClaimEvents(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEvent, error) {
+	query := `
+		UPDATE outbox_events
+		SET attempts = attempts + 1,
+		    available_at = CURRENT_TIMESTAMP + make_interval(secs => $2)
+		WHERE id IN (
+			SELECT id FROM outbox_events
+			WHERE delivered_at IS NULL AND dead_lettered_at IS NULL
+			  AND available_at <= CURRENT_TIMESTAMP
+			ORDER BY created_at, id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + outboxEventColumns
+
+	rows, err := r.db.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim outbox events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []models.OutboxEvent{}
+	for rows.Next() {
+		var event models.OutboxEvent
+		if err := scanOutboxEvent(rows, &event); err != nil {
+			return nil, fmt.Errorf("failed to scan outbox event: %w", err)
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// RETURNING does not keep the subquery's order
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].CreatedAt.Before(events[j].CreatedAt)
+	})
+
+	return events, nil
+}
+
+// MarkDelivered records that every subscriber handled the event
+func (r *OutboxRepository) MarkDelivered(ctx context.Context, eventID uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE outbox_events
+		SET delivered_at = CURRENT_TIMESTAMP, last_error = NULL
+		WHERE id = $1`,
+		eventID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to mark outbox event delivered: %w", err)
+	}
+	return nil
+}
+
+// MarkFailed records a failed delivery and schedules the next attempt
+func (r *OutboxRepository) MarkFailed(ctx context.Context, eventID uuid.UUID, reason string, retryAt time.Time) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE outbox_events
+		SET last_error = $2, available_at = $3
+		WHERE id = $1`,
+		eventID, reason, retryAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to mark outbox event failed: %w", err)
+	}
+	return nil
+}
+
+// DeadLetter gives up on an event. It stays in the table with its last error
+// for inspection and is never picked up again.
+func (r *OutboxRepository) DeadLetter(ctx context.Context, eventID uuid.UUID, reason string) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE outbox_events
+		SET last_error = $2, dead_lettered_at = CURRENT_TIMESTAMP
+		WHERE id = $1`,
+		eventID, reason,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to dead-letter outbox event: %w", err)
+	}
+	return nil
+}
+
+// ListDeliveries returns the subscribers and subscriber steps that already
+// handled the event
+func (r *OutboxRepository) ListDeliveries(ctx context.Context, eventID uuid.UUID) (map[string]bool, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT subscriber FROM outbox_deliveries WHERE event_id = $1`, eventID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list outbox deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	done := make(map[string]bool)
+	for rows.Next() {
+		var subscriber string
+		if err := rows.Scan(&subscriber); err != nil {
+			return nil, fmt.Errorf("failed to scan outbox delivery: %w", err)
+		}
+		done[subscriber] = true
+	}
+	return done, rows.Err()
+}
+
+// RecordDelivery records that a subscriber, or one step of its work, handled the event
+func (r *OutboxRepository) RecordDelivery(ctx context.Context, eventID uuid.UUID, subscriber string) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO outbox_deliveries (event_id, subscriber)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`,
+		eventID, subscriber,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record outbox delivery: %w", err)
+	}
+	return nil
+}
+
+// outboxEventColumns is the column list read by scanOutboxEvent
+const outboxEventColumns = `
+	id, event_type, aggregate_id, payload, attempts, last_error,
+	available_at, delivered_at, dead_lettered_at, created_at`
+
+func scanOutboxEvent(row rowScanner, event *models.OutboxEvent) error {
+	var payload []byte
+	err := row.Scan(
+		&event.ID,
+		&event.EventType,
+		&event.AggregateID,
+		&payload,
+		&event.Attempts,
+		&event.LastError,
+		&event.AvailableAt,
+		&event.DeliveredAt,
+		&event.DeadLetteredAt,
+		&event.CreatedAt,
+	)
+	event.Payload = payload
+	return err
+}
@@ -0,0 +1,183 @@
+package repository
+
+import (
+	"car-backend/pkg/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// ErrUnknownPaymentIntent is returned for webhook events about an intent we have
+// no payment for, including one whose intent id has not been saved yet
+var ErrUnknownPaymentIntent = errors.New("unknown payment intent")
+
+type PaymentRepository struct {
+	db *sql.DB
+}
+
+func NewPaymentRepository(db *sql.DB) *PaymentRepository {
+	return &PaymentRepository{db: db}
+}
+
+// CreatePayment stores a pending payment before the provider is asked for an intent
+func (r *PaymentRepository) CreatePayment(ctx context.Context, payment *models.Payment) error {
+	err := r.db.QueryRowContext(ctx, `
+		INSERT INTO payments (carpool_id, from_user_id, to_user_id, amount_minor, currency, provider)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, status, created_at, updated_at`,
+		payment.CarpoolID, payment.FromUserID, payment.ToUserID, payment.AmountMinor, payment.Currency, payment.Provider,
+	).Scan(&payment.ID, &payment.Status, &payment.CreatedAt, &payment.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create payment: %v", err)
+	}
+	return nil
+}
+
+// SetProviderIntent records the provider's id for the payment's intent
+func (r *PaymentRepository) SetProviderIntent(ctx context.Context, paymentID uuid.UUID, intentID string) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE payments
+		SET provider_intent_id = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`,
+		paymentID, intentID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set payment intent: %w", err)
+	}
+	return nil
+}
+
+// MarkFailed fails a payment that is still pending
+func (r *PaymentRepository) MarkFailed(ctx context.Context, paymentID uuid.UUID, reason string) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE payments
+		SET status = $2, failure_reason = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status = $4`,
+		paymentID, models.PaymentStatusFailed, reason, models.PaymentStatusPending,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to mark payment failed: %w", err)
+	}
+	return nil
+}
+
+// GetPayment returns a payment, or nil
+func (r *PaymentRepository) GetPayment(ctx context.Context, paymentID uuid.UUID) (*models.Payment, error) {
+	payment := &models.Payment{}
+	err := scanPayment(r.db.QueryRowContext(ctx,
+		`SELECT `+paymentColumns+` FROM payments WHERE id = $1`, paymentID), payment)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get payment: %w", err)
+	}
+	return payment, nil
+}
+
+// ApplyWebhookEvent moves the payment with the provider's intent id to status
+// and, when it succeeded, records the settlement in the ledger. Each provider
+// event is applied at most once: it returns false for an event already seen.
+// Events for payments no longer pending are recorded and otherwise ignored.
+// Events for unknown intents are not recorded, so the provider's retry is applied.
+func (r *PaymentRepository) ApplyWebhookEvent(ctx context.Context, provider, eventID, intentID, status, failureReason string) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO payment_webhook_events (provider, event_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`,
+		provider, eventID,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to record webhook event: %v", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get affected rows: %v", err)
+	}
+	if rowsAffected == 0 {
+		return false, nil
+	}
+
+	payment := &models.Payment{}
+	err = scanPayment(tx.QueryRowContext(ctx, `
+		SELECT `+paymentColumns+`
+		FROM payments
+		WHERE provider = $1 AND provider_intent_id = $2
+		FOR UPDATE`,
+		provider, intentID,
+	), payment)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, ErrUnknownPaymentIntent
+		}
+		return false, fmt.Errorf("failed to get payment: %v", err)
+	}
+
+	if payment.Status == models.PaymentStatusPending && status != models.PaymentStatusPending {
+		var settlementID *uuid.UUID
+		if status == models.PaymentStatusSucceeded {
+			settlement := &models.Settlement{
+				CarpoolID:   payment.CarpoolID,
+				FromUserID:  payment.FromUserID,
+				ToUserID:    payment.ToUserID,
+				AmountMinor: payment.AmountMinor,
+				Currency:    payment.Currency,
+				// The provider has already confirmed the money moved
+				Status: models.SettlementStatusConfirmed,
+			}
+			if err := insertSettlement(ctx, tx, settlement); err != nil {
+				return false, err
+			}
+			settlementID = &settlement.ID
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE payments
+			SET status = $2, failure_reason = NULLIF($3, ''), settlement_id = $4, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $1`,
+			payment.ID, status, failureReason, settlementID,
+		)
+		if err != nil {
+			return false, fmt.Errorf("failed to update payment: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	return true, nil
+}
+
+// paymentColumns is the column list read by scanPayment
+const paymentColumns = `
+		id, carpool_id, from_user_id, to_user_id, amount_minor, currency, provider,
+		COALESCE(provider_intent_id, ''), status, COALESCE(failure_reason, ''),
+		settlement_id, created_at, updated_at`
+
+func scanPayment(row rowScanner, payment *models.Payment) error {
+	return row.Scan(
+		&payment.ID,
+		&payment.CarpoolID,
+		&payment.FromUserID,
+		&payment.ToUserID,
+		&payment.AmountMinor,
+		&payment.Currency,
+		&payment.Provider,
+		&payment.ProviderIntentID,
+		&payment.Status,
+		&payment.FailureReason,
+		&payment.SettlementID,
+		&payment.CreatedAt,
+		&payment.UpdatedAt,
+	)
+}
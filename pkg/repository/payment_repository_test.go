@@ -0,0 +1,158 @@
+package repository
+
+import (
+	"car-backend/pkg/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	_ "github.com/lib/pq"
+)
+
+// testDB opens TEST_DATABASE_URL in a fresh schema with every migration
+// applied, and drops the schema when the test ends. Tests that need Postgres
+// are skipped when it is not set.
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		t.Fatalf("failed to create schema: %v", err)
+	}
+	t.Cleanup(func() { admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`) })
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatalf("TEST_DATABASE_URL must be a URL: %v", err)
+	}
+	query := u.Query()
+	query.Set("search_path", schema)
+	u.RawQuery = query.Encode()
+
+	db, err := sql.Open("postgres", u.String())
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	files, err := filepath.Glob(filepath.Join("..", "..", "migrations", "*.sql"))
+	if err != nil {
+		t.Fatalf("failed to list migrations: %v", err)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		migration, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", file, err)
+		}
+		if _, err := db.Exec(string(migration)); err != nil {
+			t.Fatalf("failed to apply %s: %v", filepath.Base(file), err)
+		}
+	}
+
+	return db
+}
+
+func TestApplyWebhookEventReplay(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	payer, payee := uuid.New(), uuid.New()
+	for _, id := range []uuid.UUID{payer, payee} {
+		_, err := db.Exec(`INSERT INTO users (id, email, name, clerk_id) VALUES ($1, $2, 'Test', $3)`,
+			id, id.String()+"@example.com", "user_"+id.String())
+		if err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+	}
+	var carpoolID uuid.UUID
+	if err := db.QueryRow(`INSERT INTO carpools (carpool_name) VALUES ('Test') RETURNING id`).Scan(&carpoolID); err != nil {
+		t.Fatalf("failed to create carpool: %v", err)
+	}
+	var paymentID uuid.UUID
+	err := db.QueryRow(`
+		INSERT INTO payments (carpool_id, from_user_id, to_user_id, amount_minor, currency, provider, provider_intent_id)
+		VALUES ($1, $2, $3, 1250, 'USD', 'fake', 'pi_1')
+		RETURNING id`,
+		carpoolID, payer, payee,
+	).Scan(&paymentID)
+	if err != nil {
+		t.Fatalf("failed to create payment: %v", err)
+	}
+
+	repo := NewPaymentRepository(db)
+
+	// Steps run in order against the same payment
+	steps := []struct {
+		name            string
+		eventID         string
+		intentID        string
+		status          string
+		wantApplied     bool
+		wantErr         error
+		wantStatus      string
+		wantSettlements int
+	}{
+		{"first delivery settles the payment", "evt_1", "pi_1", models.PaymentStatusSucceeded, true, nil, models.PaymentStatusSucceeded, 1},
+		{"redelivery is ignored", "evt_1", "pi_1", models.PaymentStatusSucceeded, false, nil, models.PaymentStatusSucceeded, 1},
+		{"new event for a settled payment changes nothing", "evt_2", "pi_1", models.PaymentStatusSucceeded, true, nil, models.PaymentStatusSucceeded, 1},
+		{"late failure does not undo a success", "evt_3", "pi_1", models.PaymentStatusFailed, true, nil, models.PaymentStatusSucceeded, 1},
+		{"unknown intent is rejected", "evt_4", "pi_unknown", models.PaymentStatusSucceeded, false, ErrUnknownPaymentIntent, models.PaymentStatusSucceeded, 1},
+	}
+
+	for _, step := range steps {
+		applied, err := repo.ApplyWebhookEvent(ctx, "fake", step.eventID, step.intentID, step.status, "")
+		if err != step.wantErr {
+			t.Fatalf("%s: err = %v, want %v", step.name, err, step.wantErr)
+		}
+		if applied != step.wantApplied {
+			t.Errorf("%s: applied = %v, want %v", step.name, applied, step.wantApplied)
+		}
+
+		payment, err := repo.GetPayment(ctx, paymentID)
+		if err != nil {
+			t.Fatalf("%s: failed to get payment: %v", step.name, err)
+		}
+		if payment.Status != step.wantStatus {
+			t.Errorf("%s: payment status = %s, want %s", step.name, payment.Status, step.wantStatus)
+		}
+
+		var settlements int
+		err = db.QueryRow(`SELECT COUNT(*) FROM expense_settlements WHERE carpool_id = $1 AND status = $2`,
+			carpoolID, models.SettlementStatusConfirmed).Scan(&settlements)
+		if err != nil {
+			t.Fatalf("%s: failed to count settlements: %v", step.name, err)
+		}
+		if settlements != step.wantSettlements {
+			t.Errorf("%s: %d confirmed settlements, want %d", step.name, settlements, step.wantSettlements)
+		}
+	}
+
+	// The provider retries events for intents we did not know yet, so those
+	// must not be marked as seen
+	var seen bool
+	if err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM payment_webhook_events WHERE event_id = 'evt_4')`).Scan(&seen); err != nil {
+		t.Fatalf("failed to check webhook events: %v", err)
+	}
+	if seen {
+		t.Error("event for an unknown intent was recorded as seen")
+	}
+}
@@ -0,0 +1,275 @@
+package repository
+
+import (
+	"car-backend/pkg/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+var ErrAlreadyRated = errors.New("participant already rated for this ride")
+
+type RatingRepository struct {
+	db *sql.DB
+}
+
+func NewRatingRepository(db *sql.DB) *RatingRepository {
+	return &RatingRepository{db: db}
+}
+
+// CreateRating stores a rating and refreshes the ratee's aggregate score.
+// A rater can rate each other participant of a ride once.
+func (r *RatingRepository) CreateRating(ctx context.Context, rating *models.Rating) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO ride_ratings (carpool_ride_id, rater_id, ratee_id, ratee_role, score, review)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT ON CONSTRAINT ride_ratings_once DO NOTHING
+		RETURNING id, status, created_at`,
+		rating.CarpoolRideID, rating.RaterID, rating.RateeID, rating.RateeRole, rating.Score, rating.Review,
+	).Scan(&rating.ID, &rating.Status, &rating.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrAlreadyRated
+		}
+		return fmt.Errorf("failed to create rating: %v", err)
+	}
+
+	if err := refreshUserRating(ctx, tx, rating.RateeID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	return nil
+}
+
+// GetRating returns a rating, or nil
+func (r *RatingRepository) GetRating(ctx context.Context, ratingID uuid.UUID) (*models.Rating, error) {
+	rating := &models.Rating{}
+
+	err := scanRating(r.db.QueryRowContext(ctx,
+		`SELECT `+ratingColumns+` FROM ride_ratings WHERE id = $1`, ratingID), rating)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get rating: %w", err)
+	}
+
+	return rating, nil
+}
+
+// ListRideRatings returns the ratings left on a ride that are not hidden, oldest first
+func (r *RatingRepository) ListRideRatings(ctx context.Context, rideID uuid.UUID) ([]models.Rating, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+ratingColumns+`
+		FROM ride_ratings
+		WHERE carpool_ride_id = $1 AND status <> $2
+		ORDER BY created_at, id`,
+		rideID, models.RatingStatusHidden,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ride ratings: %w", err)
+	}
+
+	return collectRatings(rows)
+}
+
+// ListUserRatings returns the ratings a user received that are not hidden, newest first
+func (r *RatingRepository) ListUserRatings(ctx context.Context, userID uuid.UUID, before *PageCursor, limit int) ([]models.Rating, error) {
+	var beforeTime, beforeID interface{}
+	if before != nil {
+		beforeTime, beforeID = before.CreatedAt, before.ID
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+ratingColumns+`
+		FROM ride_ratings
+		WHERE ratee_id = $1 AND status <> $2
+		  AND ($3::timestamptz IS NULL OR (created_at, id) < ($3, $4))
+		ORDER BY created_at DESC, id DESC
+		LIMIT $5`,
+		userID, models.RatingStatusHidden, beforeTime, beforeID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user ratings: %w", err)
+	}
+
+	return collectRatings(rows)
+}
+
+// ListByStatus returns ratings with the given status for the moderation queue,
+// oldest dispute first. A non-nil organizationID limits it to rides of that
+// organization's carpools.
+func (r *RatingRepository) ListByStatus(ctx context.Context, status string, organizationID *uuid.UUID, limit int) ([]models.Rating, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+ratingColumns+`
+		FROM ride_ratings
+		WHERE status = $1 AND `+ratingInOrganization("$3")+`
+		ORDER BY disputed_at NULLS LAST, created_at
+		LIMIT $2`,
+		status, limit, organizationID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ratings: %w", err)
+	}
+
+	return collectRatings(rows)
+}
+
+// GetSummary returns a user's aggregate rating
+func (r *RatingRepository) GetSummary(ctx context.Context, userID uuid.UUID) (*models.RatingSummary, error) {
+	summary := &models.RatingSummary{}
+	err := r.db.QueryRowContext(ctx,
+		`SELECT rating_average, rating_count FROM users WHERE id = $1`, userID,
+	).Scan(&summary.Average, &summary.Count)
+	if err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// DisputeRating flags a visible rating the ratee believes is abusive for moderator
+// review. It returns sql.ErrNoRows when the rating is not the user's or is not visible.
+func (r *RatingRepository) DisputeRating(ctx context.Context, ratingID, rateeID uuid.UUID, reason string) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE ride_ratings
+		SET status = $4, dispute_reason = $3, disputed_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND ratee_id = $2 AND status = $5`,
+		ratingID, rateeID, reason, models.RatingStatusDisputed, models.RatingStatusVisible,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to dispute rating: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %v", err)
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// ResolveDispute records a moderator's decision on a disputed rating, either
+// keeping it visible or hiding it, and refreshes the ratee's aggregate score.
+// A non-nil organizationID limits it to rides of that organization's carpools.
+// It returns sql.ErrNoRows when the rating is not under dispute.
+func (r *RatingRepository) ResolveDispute(ctx context.Context, ratingID, moderatorID uuid.UUID, organizationID *uuid.UUID, status string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	var rateeID uuid.UUID
+	err = tx.QueryRowContext(ctx, `
+		UPDATE ride_ratings
+		SET status = $3, reviewed_by = $2, reviewed_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status = $4 AND `+ratingInOrganization("$5")+`
+		RETURNING ratee_id`,
+		ratingID, moderatorID, status, models.RatingStatusDisputed, organizationID,
+	).Scan(&rateeID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return err
+		}
+		return fmt.Errorf("failed to resolve rating dispute: %w", err)
+	}
+
+	if err := refreshUserRating(ctx, tx, rateeID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+
+	return nil
+}
+
+// refreshUserRating recomputes a user's aggregate score from their ratings that
+// are not hidden. The user row is locked first so a concurrent rating of the
+// same user commits before the aggregate is read, and neither write is lost.
+func refreshUserRating(ctx context.Context, tx *sql.Tx, userID uuid.UUID) error {
+	if _, err := tx.ExecContext(ctx, `SELECT 1 FROM users WHERE id = $1 FOR UPDATE`, userID); err != nil {
+		return fmt.Errorf("failed to lock user: %v", err)
+	}
+
+	_, err := tx.ExecContext(ctx, `
+		UPDATE users u
+		SET rating_average = agg.average, rating_count = agg.count
+		FROM (
+			SELECT AVG(score)::float AS average, COUNT(*) AS count
+			FROM ride_ratings
+			WHERE ratee_id = $1 AND status <> $2
+		) agg
+		WHERE u.id = $1`,
+		userID, models.RatingStatusHidden,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to refresh user rating: %v", err)
+	}
+	return nil
+}
+
+// ratingInOrganization is a condition on ride_ratings that holds when the
+// organization id in param is NULL or owns the rated ride's carpool
+func ratingInOrganization(param string) string {
+	return `(` + param + `::uuid IS NULL OR carpool_ride_id IN (
+			SELECT cr.id FROM carpool_rides cr
+			JOIN carpools c ON c.id = cr.carpool_id
+			WHERE c.organization_id = ` + param + `::uuid
+		))`
+}
+
+func collectRatings(rows *sql.Rows) ([]models.Rating, error) {
+	defer rows.Close()
+
+	ratings := []models.Rating{}
+	for rows.Next() {
+		var rating models.Rating
+		if err := scanRating(rows, &rating); err != nil {
+			return nil, fmt.Errorf("failed to scan rating: %w", err)
+		}
+		ratings = append(ratings, rating)
+	}
+
+	return ratings, rows.Err()
+}
+
+// ratingColumns is the column list read by scanRating
+const ratingColumns = `
+		id, carpool_ride_id, rater_id, ratee_id, ratee_role, score, review, status,
+		COALESCE(dispute_reason, ''), disputed_at, reviewed_by, reviewed_at, created_at`
+
+func scanRating(row rowScanner, rating *models.Rating) error {
+	return row.Scan(
+		&rating.ID,
+		&rating.CarpoolRideID,
+		&rating.RaterID,
+		&rating.RateeID,
+		&rating.RateeRole,
+		&rating.Score,
+		&rating.Review,
+		&rating.Status,
+		&rating.DisputeReason,
+		&rating.DisputedAt,
+		&rating.ReviewedBy,
+		&rating.ReviewedAt,
+		&rating.CreatedAt,
+	)
+}
@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"car-backend/pkg/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+var ErrAlreadyReported = errors.New("message already reported")
+
+type ReportRepository struct {
+	db *sql.DB
+}
+
+func NewReportRepository(db *sql.DB) *ReportRepository {
+	return &ReportRepository{db: db}
+}
+
+// CreateReport adds a reported message to the moderation queue.
+// Each user can report a given message once.
+func (r *ReportRepository) CreateReport(ctx context.Context, report *models.MessageReport) error {
+	query := `
+		INSERT INTO message_reports (direct_message_id, reporter_id, reported_user_id, reason)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (direct_message_id, reporter_id) DO NOTHING
+		RETURNING id, status, created_at`
+
+	err := r.db.QueryRowContext(ctx, query,
+		report.DirectMessageID, report.ReporterID, report.ReportedUserID, report.Reason,
+	).Scan(&report.ID, &report.Status, &report.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrAlreadyReported
+		}
+		return fmt.Errorf("failed to create report: %v", err)
+	}
+
+	return nil
+}
+
+// ListReports returns reports with the given status with the reported message
+// text, oldest first. With an organization id only reports between two of its
+// active members are listed.
+func (r *ReportRepository) ListReports(ctx context.Context, status string, organizationID *uuid.UUID, limit int) ([]models.MessageReport, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT mr.id, mr.direct_message_id, mr.reporter_id, mr.reported_user_id, mr.reason, mr.status,
+		       mr.reviewed_by, mr.reviewed_at, mr.created_at, dm.body
+		FROM message_reports mr
+		JOIN direct_messages dm ON dm.id = mr.direct_message_id
+		WHERE mr.status = $1 AND `+reportInOrganization("$3")+`
+		ORDER BY mr.created_at
+		LIMIT $2`,
+		status, limit, organizationID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reports: %w", err)
+	}
+	defer rows.Close()
+
+	reports := []models.MessageReport{}
+	for rows.Next() {
+		var report models.MessageReport
+		if err := rows.Scan(
+			&report.ID,
+			&report.DirectMessageID,
+			&report.ReporterID,
+			&report.ReportedUserID,
+			&report.Reason,
+			&report.Status,
+			&report.ReviewedBy,
+			&report.ReviewedAt,
+			&report.CreatedAt,
+			&report.MessageBody,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan report: %w", err)
+		}
+		reports = append(reports, report)
+	}
+
+	return reports, rows.Err()
+}
+
+// ResolveReport records a moderator's decision on an open report. With an
+// organization id, only reports between two of its active members qualify.
+// It returns sql.ErrNoRows when the report does not exist or was already resolved.
+func (r *ReportRepository) ResolveReport(ctx context.Context, reportID, moderatorID uuid.UUID, organizationID *uuid.UUID, status string) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE message_reports mr
+		SET status = $3, reviewed_by = $2, reviewed_at = CURRENT_TIMESTAMP
+		WHERE mr.id = $1 AND mr.status = $4 AND `+reportInOrganization("$5"),
+		reportID, moderatorID, status, models.ReportStatusOpen, organizationID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to resolve report: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %v", err)
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// reportInOrganization is a condition on message_reports mr that holds when the
+// organization id in param is NULL, or when both the reporter and the reported
+// user are active members of it
+func reportInOrganization(param string) string {
+	return `(` + param + `::uuid IS NULL OR (
+			SELECT COUNT(*) FROM organization_members om
+			WHERE om.organization_id = ` + param + `::uuid AND om.status = '` + models.OrgMemberActive + `'
+			  AND om.user_id IN (mr.reporter_id, mr.reported_user_id)
+		) = 2)`
+}
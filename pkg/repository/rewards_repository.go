@@ -0,0 +1,285 @@
+package repository
+
+import (
+	"car-backend/pkg/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RewardRide is a completed ride as the rewards engine sees it. A ride is on
+// time for a participant who had no late or no-show incident on it.
+type RewardRide struct {
+	RideID     uuid.UUID
+	CarpoolID  uuid.UUID
+	Role       string
+	OccurredAt time.Time
+	OnTime     bool
+}
+
+// RewardStats summarizes a user's completed rides for the badge rules. Streaks
+// count consecutive on-time rides; PerfectWeeks counts the weeks already awarded.
+type RewardStats struct {
+	RidesCompleted int
+	RidesDriven    int
+	CurrentStreak  int
+	BestStreak     int
+	PerfectWeeks   int
+}
+
+// PerfectWeek is a finished week, Monday to Sunday in the user's timezone, in
+// which they completed enough rides and were on time for all of them. Start is
+// the local date the week began; End is the instant it ended.
+type PerfectWeek struct {
+	UserID uuid.UUID
+	Start  time.Time
+	End    time.Time
+}
+
+type RewardsRepository struct {
+	db *sql.DB
+}
+
+func NewRewardsRepository(db *sql.DB) *RewardsRepository {
+	return &RewardsRepository{db: db}
+}
+
+// rewardParticipations lists each completed ride once per participant, the
+// driver and every rider with a stop, with whether they were on time
+const rewardParticipations = `
+		SELECT p.user_id, p.ride_id, p.occurred_at,
+		       NOT EXISTS (
+		           SELECT 1 FROM ride_incidents i
+		           WHERE i.carpool_ride_id = p.ride_id AND i.user_id = p.user_id) AS on_time
+		FROM (
+			SELECT r.driver_id AS user_id, r.id AS ride_id, ` + rideOccurredAt + ` AS occurred_at
+			FROM carpool_rides r
+			WHERE r.status = $1
+			UNION
+			SELECT s.user_id, r.id, ` + rideOccurredAt + `
+			FROM carpool_rides r
+			JOIN carpool_stops s ON s.carpool_ride_id = r.id
+			WHERE r.status = $1 AND s.user_id IS NOT NULL
+		) p`
+
+// GetRewardRide returns one completed ride as the participant saw it, or nil
+// when the ride is not completed or the user did not drive or ride it
+func (r *RewardsRepository) GetRewardRide(ctx context.Context, userID, rideID uuid.UUID) (*RewardRide, error) {
+	ride := &RewardRide{}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT r.id, r.carpool_id,
+		       CASE WHEN r.driver_id = $1 THEN $2 ELSE $3 END,
+		       `+rideOccurredAt+`,
+		       NOT EXISTS (
+		           SELECT 1 FROM ride_incidents i
+		           WHERE i.carpool_ride_id = r.id AND i.user_id = $1)
+		FROM carpool_rides r
+		WHERE r.id = $5 AND r.status = $4
+		  AND (r.driver_id = $1 OR EXISTS (
+		      SELECT 1 FROM carpool_stops s WHERE s.carpool_ride_id = r.id AND s.user_id = $1))`,
+		userID, models.RideRoleDriver, models.RideRoleRider, models.RideStatusCompleted, rideID,
+	).Scan(&ride.RideID, &ride.CarpoolID, &ride.Role, &ride.OccurredAt, &ride.OnTime)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get reward ride: %w", err)
+	}
+	return ride, nil
+}
+
+// GetRewardStats computes the user's ride counts and on-time streaks in one
+// pass over their completed rides. Each late ride starts a new run; the current
+// streak is the on-time rides of the latest run and the best is the longest.
+func (r *RewardsRepository) GetRewardStats(ctx context.Context, userID uuid.UUID) (*RewardStats, error) {
+	stats := &RewardStats{}
+	err := r.db.QueryRowContext(ctx, `
+		WITH rides AS (
+			SELECT ride_id, occurred_at, on_time FROM (`+rewardParticipations+`) participations
+			WHERE user_id = $2
+		), runs AS (
+			SELECT ride_id, on_time,
+			       SUM(CASE WHEN on_time THEN 0 ELSE 1 END) OVER (ORDER BY occurred_at, ride_id) AS run
+			FROM rides
+		)
+		SELECT COUNT(*),
+		       (SELECT COUNT(*) FROM carpool_rides WHERE driver_id = $2 AND status = $1),
+		       COUNT(*) FILTER (WHERE on_time AND run = (SELECT MAX(run) FROM runs)),
+		       COALESCE((SELECT MAX(n) FROM (SELECT COUNT(*) AS n FROM runs WHERE on_time GROUP BY run) streaks), 0),
+		       (SELECT COUNT(*) FROM reward_points WHERE user_id = $2 AND reason = $3)
+		FROM runs`,
+		models.RideStatusCompleted, userID, models.RewardReasonPerfectWeek,
+	).Scan(&stats.RidesCompleted, &stats.RidesDriven, &stats.CurrentStreak, &stats.BestStreak, &stats.PerfectWeeks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reward stats: %w", err)
+	}
+	return stats, nil
+}
+
+// ListPerfectWeeks returns every user's perfect weeks that began at or after
+// since and were over by now, in a single query. A week needs at least
+// minRides rides.
+func (r *RewardsRepository) ListPerfectWeeks(ctx context.Context, since, now time.Time, minRides int) ([]PerfectWeek, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		WITH weeks AS (
+			SELECT p.user_id, u.timezone,
+			       date_trunc('week', p.occurred_at AT TIME ZONE u.timezone) AS week_start,
+			       COUNT(*) AS rides,
+			       bool_and(p.on_time) AS on_time
+			FROM (`+rewardParticipations+`) p
+			JOIN users u ON u.id = p.user_id
+			WHERE p.occurred_at >= $2
+			GROUP BY p.user_id, u.timezone, week_start
+		)
+		SELECT user_id, week_start, (week_start + INTERVAL '7 days') AT TIME ZONE timezone
+		FROM weeks
+		WHERE rides >= $4 AND on_time
+		  AND week_start AT TIME ZONE timezone >= $2
+		  AND (week_start + INTERVAL '7 days') AT TIME ZONE timezone <= $3
+		ORDER BY week_start, user_id`,
+		models.RideStatusCompleted, since, now, minRides,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list perfect weeks: %w", err)
+	}
+	defer rows.Close()
+
+	var weeks []PerfectWeek
+	for rows.Next() {
+		var week PerfectWeek
+		if err := rows.Scan(&week.UserID, &week.Start, &week.End); err != nil {
+			return nil, fmt.Errorf("failed to scan perfect week: %w", err)
+		}
+		weeks = append(weeks, week)
+	}
+	return weeks, rows.Err()
+}
+
+// AwardPoints credits points earned at earnedAt to the user unless the same
+// source already has. It reports whether the points were new.
+func (r *RewardsRepository) AwardPoints(ctx context.Context, userID uuid.UUID, carpoolID *uuid.UUID, source, reason string, points int, earnedAt time.Time) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `
+		INSERT INTO reward_points (user_id, carpool_id, source, reason, points, earned_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT ON CONSTRAINT reward_points_once DO NOTHING`,
+		userID, carpoolID, source, reason, points, earnedAt,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to award points: %w", err)
+	}
+	return rowsChanged(result)
+}
+
+// AwardBadge gives the user a badge they do not have yet. It reports whether the badge was new.
+func (r *RewardsRepository) AwardBadge(ctx context.Context, userID uuid.UUID, code string) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `
+		INSERT INTO user_badges (user_id, badge_code)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`,
+		userID, code,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to award badge: %w", err)
+	}
+	return rowsChanged(result)
+}
+
+// SetStreaks stores the user's recomputed on-time streaks
+func (r *RewardsRepository) SetStreaks(ctx context.Context, userID uuid.UUID, current, best int) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO user_streaks (user_id, current_streak, best_streak)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE
+		SET current_streak = EXCLUDED.current_streak,
+		    best_streak = EXCLUDED.best_streak,
+		    updated_at = CURRENT_TIMESTAMP`,
+		userID, current, best,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set streaks: %w", err)
+	}
+	return nil
+}
+
+// GetProfile returns the user's points, streaks and badges, oldest badge first.
+// Badges carry only their code.
+func (r *RewardsRepository) GetProfile(ctx context.Context, userID uuid.UUID) (*models.RewardProfile, error) {
+	profile := &models.RewardProfile{UserID: userID, Badges: []models.UserBadge{}}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COALESCE((SELECT SUM(points) FROM reward_points WHERE user_id = $1), 0),
+		       COALESCE((SELECT current_streak FROM user_streaks WHERE user_id = $1), 0),
+		       COALESCE((SELECT best_streak FROM user_streaks WHERE user_id = $1), 0)`,
+		userID,
+	).Scan(&profile.Points, &profile.CurrentStreak, &profile.BestStreak)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reward profile: %w", err)
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT badge_code, awarded_at
+		FROM user_badges
+		WHERE user_id = $1
+		ORDER BY awarded_at, badge_code`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list badges: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var badge models.UserBadge
+		if err := rows.Scan(&badge.Code, &badge.AwardedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan badge: %w", err)
+		}
+		profile.Badges = append(profile.Badges, badge)
+	}
+	return profile, rows.Err()
+}
+
+// Leaderboard ranks users by points earned since the given time, or ever when
+// since is nil. Points are limited to those earned in the carpool, or in
+// carpools serving the school, when either is set, and to carpools the viewer
+// may see. Tied users share a rank.
+func (r *RewardsRepository) Leaderboard(ctx context.Context, carpoolID *uuid.UUID, school *string, viewerID uuid.UUID, since *time.Time, limit int) ([]models.LeaderboardEntry, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT RANK() OVER (ORDER BY SUM(p.points) DESC),
+		       p.user_id, COALESCE(NULLIF(u.display_name, ''), u.name, ''), SUM(p.points)
+		FROM reward_points p
+		JOIN users u ON u.id = p.user_id
+		LEFT JOIN carpools c ON c.id = p.carpool_id
+		WHERE ($1::uuid IS NULL OR p.carpool_id = $1)
+		  AND ($2::text IS NULL OR LOWER(c.school_name) = LOWER($2))
+		  AND ($3::timestamptz IS NULL OR p.earned_at >= $3)
+		  AND (p.carpool_id IS NULL OR `+carpoolVisibleTo("$5")+`)
+		GROUP BY p.user_id, u.display_name, u.name
+		ORDER BY SUM(p.points) DESC, p.user_id
+		LIMIT $4`,
+		carpoolID, school, since, limit, viewerID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get leaderboard: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []models.LeaderboardEntry{}
+	for rows.Next() {
+		var entry models.LeaderboardEntry
+		if err := rows.Scan(&entry.Rank, &entry.UserID, &entry.Name, &entry.Points); err != nil {
+			return nil, fmt.Errorf("failed to scan leaderboard entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func rowsChanged(result sql.Result) (bool, error) {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get affected rows: %v", err)
+	}
+	return rowsAffected > 0, nil
+}
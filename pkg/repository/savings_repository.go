@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"car-backend/pkg/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SavingsScope selects the rides a savings report covers. Exactly one of UserID,
+// CarpoolID, School and OrganizationID is set.
+type SavingsScope struct {
+	// UserID covers rides the user drove or had a stop on
+	UserID *uuid.UUID
+	// CarpoolID covers every ride of the carpool
+	CarpoolID *uuid.UUID
+	// School covers every ride of carpools serving the school
+	School *string
+	// OrganizationID covers every ride of the organization's carpools
+	OrganizationID *uuid.UUID
+	// ViewerID, when set, leaves out carpools the viewer may not see
+	ViewerID *uuid.UUID
+}
+
+// RideSavings totals the completed rides of one bucket
+type RideSavings struct {
+	Start   time.Time
+	Rides   int
+	Miles   float64
+	Gallons float64
+}
+
+type SavingsRepository struct {
+	db *sql.DB
+}
+
+func NewSavingsRepository(db *sql.DB) *SavingsRepository {
+	return &SavingsRepository{db: db}
+}
+
+// ListRideSavings totals the completed rides in scope that occurred in [from, to),
+// grouped into day, week or month buckets in loc. Fuel is each ride's miles saved
+// over the driver's vehicle fuel economy, or defaultMPG when the driver has none.
+// Buckets without rides are omitted.
+func (r *SavingsRepository) ListRideSavings(ctx context.Context, scope SavingsScope, from, to time.Time, bucket string, loc *time.Location, defaultMPG float64) ([]RideSavings, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT date_trunc($1, `+rideOccurredAt+` AT TIME ZONE $2) AS bucket,
+		       COUNT(*),
+		       COALESCE(SUM(r.miles_saved), 0),
+		       COALESCE(SUM(r.miles_saved / COALESCE(d.vehicle_mpg, $3)), 0)
+		FROM carpool_rides r
+		JOIN carpools c ON c.id = r.carpool_id
+		LEFT JOIN users d ON d.id = r.driver_id
+		WHERE r.status = $4
+		  AND `+rideOccurredAt+` >= $5 AND `+rideOccurredAt+` < $6
+		  AND ($7::uuid IS NULL OR r.driver_id = $7 OR EXISTS (
+		      SELECT 1 FROM carpool_stops s WHERE s.carpool_ride_id = r.id AND s.user_id = $7))
+		  AND ($8::uuid IS NULL OR r.carpool_id = $8)
+		  AND ($9::text IS NULL OR LOWER(c.school_name) = LOWER($9))
+		  AND ($10::uuid IS NULL OR c.organization_id = $10)
+		  AND ($11::uuid IS NULL OR `+carpoolVisibleTo("$11")+`)
+		GROUP BY bucket
+		ORDER BY bucket`,
+		bucket, loc.String(), defaultMPG, models.RideStatusCompleted,
+		from, to, scope.UserID, scope.CarpoolID, scope.School, scope.OrganizationID, scope.ViewerID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ride savings: %w", err)
+	}
+	defer rows.Close()
+
+	var savings []RideSavings
+	for rows.Next() {
+		var s RideSavings
+		var start time.Time
+		if err := rows.Scan(&start, &s.Rides, &s.Miles, &s.Gallons); err != nil {
+			return nil, fmt.Errorf("failed to scan ride savings: %w", err)
+		}
+		// date_trunc yields a local wall time without zone
+		s.Start = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, loc)
+		savings = append(savings, s)
+	}
+	return savings, rows.Err()
+}
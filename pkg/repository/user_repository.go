@@ -4,7 +4,10 @@ import (
 	"car-backend/pkg/models"
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+
+	"github.com/google/uuid"
 )
 
 type UserRepository struct {
@@ -25,44 +28,196 @@ func (r *UserRepository) CreateUser(ctx context.Context, user *models.User) erro
 	return err
 }
 
-func (r *UserRepository) UpdateProfile(ctx context.Context, userID string, update *models.UpdateUserProfile) error {
+func (r *UserRepository) UpdateProfile(ctx context.Context, userID uuid.UUID, update *models.UpdateUserProfile) error {
 	query := `
         UPDATE users 
         SET 
             display_name = COALESCE($1, display_name),
             city = COALESCE($2, city),
             state = COALESCE($3, state),
+            home_lat = COALESCE($4, home_lat),
+            home_lng = COALESCE($5, home_lng),
+            destination_lat = COALESCE($6, destination_lat),
+            destination_lng = COALESCE($7, destination_lng),
+            preferred_departure_time = COALESCE($8, preferred_departure_time),
+            preferred_days = COALESCE($9, preferred_days),
+            music_preference = COALESCE($10, music_preference),
+            smoking_ok = COALESCE($11, smoking_ok),
+            pets_ok = COALESCE($12, pets_ok),
+            school_name = COALESCE($13, school_name),
+            vehicle_mpg = COALESCE($14, vehicle_mpg),
             updated_at = CURRENT_TIMESTAMP
-        WHERE id = $4
+        WHERE id = $15
     `
 	_, err := r.db.ExecContext(ctx, query,
 		update.DisplayName,
 		update.City,
 		update.State,
+		update.HomeLat,
+		update.HomeLng,
+		update.DestinationLat,
+		update.DestinationLng,
+		update.PreferredDepartureTime,
+		update.PreferredDays,
+		update.MusicPreference,
+		update.SmokingOK,
+		update.PetsOK,
+		update.SchoolName,
+		update.VehicleMPG,
 		userID,
 	)
 	return err
 }
 
-func (r *UserRepository) GetByID(ctx context.Context, id string) (*models.User, error) {
-	var user models.User
-	query := `SELECT * FROM users WHERE id = $1`
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
+// userColumns is the column list read by scanUser
+const userColumns = `
+        id, clerk_id, email, email_verified, COALESCE(phone, ''), name,
+        COALESCE(display_name, ''), COALESCE(city, ''), COALESCE(state, ''),
+        created_at, updated_at,
+        home_lat, home_lng, destination_lat, destination_lng,
+        preferred_departure_time, preferred_days, music_preference,
+        smoking_ok, pets_ok, school_name, vehicle_mpg,
+        rating_average, rating_count`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanUser(row rowScanner, user *models.User) error {
+	return row.Scan(
 		&user.ID,
+		&user.ClerkID,
 		&user.Email,
+		&user.EmailVerified,
+		&user.Phone,
 		&user.Name,
 		&user.DisplayName,
 		&user.City,
 		&user.State,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.HomeLat,
+		&user.HomeLng,
+		&user.DestinationLat,
+		&user.DestinationLng,
+		&user.PreferredDepartureTime,
+		&user.PreferredDays,
+		&user.MusicPreference,
+		&user.SmokingOK,
+		&user.PetsOK,
+		&user.SchoolName,
+		&user.VehicleMPG,
+		&user.Rating.Average,
+		&user.Rating.Count,
 	)
-	if err != nil {
+}
+
+func (r *UserRepository) GetByID(ctx context.Context, id string) (*models.User, error) {
+	var user models.User
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1`
+	if err := scanUser(r.db.QueryRowContext(ctx, query, id), &user); err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
 
+// GetByClerkID looks up the user linked to a Clerk account
+func (r *UserRepository) GetByClerkID(ctx context.Context, clerkID string) (*models.User, error) {
+	var user models.User
+	query := `SELECT ` + userColumns + ` FROM users WHERE clerk_id = $1`
+	if err := scanUser(r.db.QueryRowContext(ctx, query, clerkID), &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetByEmail looks up a user by email address, ignoring case
+func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	var user models.User
+	query := `SELECT ` + userColumns + ` FROM users WHERE LOWER(email) = LOWER($1)`
+	if err := scanUser(r.db.QueryRowContext(ctx, query, email), &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// UpdateEmail records the primary email of the user linked to a Clerk account
+// and whether Clerk has verified it
+func (r *UserRepository) UpdateEmail(ctx context.Context, clerkID, email string, verified bool) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE users
+		SET email = $2, email_verified = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE clerk_id = $1`,
+		clerkID, email, verified,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update email: %w", err)
+	}
+	return nil
+}
+
+// IsModerator reports whether the user can review the message report queue
+func (r *UserRepository) IsModerator(ctx context.Context, userID uuid.UUID) (bool, error) {
+	var moderator bool
+	err := r.db.QueryRowContext(ctx,
+		`SELECT COALESCE(is_moderator, FALSE) FROM users WHERE id = $1`, userID,
+	).Scan(&moderator)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to check moderator: %w", err)
+	}
+	return moderator, nil
+}
+
+// GetNotificationSettings returns the user's notification preferences and quiet hours
+func (r *UserRepository) GetNotificationSettings(ctx context.Context, userID uuid.UUID) (*models.NotificationSettings, error) {
+	var preferences []byte
+	settings := &models.NotificationSettings{}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT notification_preferences, COALESCE(quiet_hours_start, ''), COALESCE(quiet_hours_end, ''), timezone
+		FROM users WHERE id = $1`,
+		userID,
+	).Scan(&preferences, &settings.QuietHoursStart, &settings.QuietHoursEnd, &settings.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(preferences, &settings.Preferences); err != nil {
+		return nil, fmt.Errorf("failed to decode notification preferences: %w", err)
+	}
+	if settings.Preferences == nil {
+		settings.Preferences = map[string]map[string]bool{}
+	}
+
+	return settings, nil
+}
+
+// UpdateNotificationSettings replaces the user's notification preferences and quiet hours
+func (r *UserRepository) UpdateNotificationSettings(ctx context.Context, userID uuid.UUID, settings *models.NotificationSettings) error {
+	preferences, err := json.Marshal(settings.Preferences)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification preferences: %w", err)
+	}
+
+	_, err = r.db.ExecContext(ctx, `
+		UPDATE users
+		SET notification_preferences = $2,
+		    quiet_hours_start = NULLIF($3, ''),
+		    quiet_hours_end = NULLIF($4, ''),
+		    timezone = $5,
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`,
+		userID, preferences, settings.QuietHoursStart, settings.QuietHoursEnd, settings.Timezone,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update notification settings: %w", err)
+	}
+
+	return nil
+}
+
 func (r *UserRepository) CreateUserIfNotExists(ctx context.Context, user *models.User) error {
 	// Check if user exists
 	var exists bool
@@ -83,13 +238,16 @@ func (r *UserRepository) CreateUserIfNotExists(ctx context.Context, user *models
 	// User doesn't exist, create new user
 	query := `
         INSERT INTO users (
-            id, email, name, display_name, city, state
-        ) VALUES ($1, $2, $3, $4, $5, $6)
+            id, clerk_id, email, email_verified, phone, name, display_name, city, state
+        ) VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8, $9)
         RETURNING created_at, updated_at`
 
 	err = r.db.QueryRowContext(ctx, query,
 		user.ID,
+		user.ClerkID,
 		user.Email,
+		user.EmailVerified,
+		user.Phone,
 		user.Name,
 		user.DisplayName,
 		user.City,
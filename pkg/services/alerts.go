@@ -0,0 +1,34 @@
+package services
+
+import (
+	"car-backend/pkg/models"
+	"context"
+	"log"
+
+	"github.com/google/uuid"
+)
+
+// AlertSink delivers ride alerts to carpool members
+type AlertSink interface {
+	SendRideAlert(ctx context.Context, userIDs []uuid.UUID, alert models.RideAlert) error
+}
+
+// LogAlertSink writes ride alerts to the structured log
+type LogAlertSink struct{}
+
+func (LogAlertSink) SendRideAlert(ctx context.Context, userIDs []uuid.UUID, alert models.RideAlert) error {
+	log.Printf("{\"severity\":\"WARNING\",\"message\":\"Ride alert %s for ride %s sent to %d members: %s\"}",
+		alert.IncidentType, alert.CarpoolRideID, len(userIDs), alert.Message)
+	return nil
+}
+
+// StopEventSink delivers geofence arrival and departure events to carpool members
+type StopEventSink interface {
+	SendStopEvent(ctx context.Context, userIDs []uuid.UUID, event models.StopEvent) error
+}
+
+func (LogAlertSink) SendStopEvent(ctx context.Context, userIDs []uuid.UUID, event models.StopEvent) error {
+	log.Printf("{\"severity\":\"INFO\",\"message\":\"Stop event %s for stop %s sent to %d members\"}",
+		event.EventType, event.CarpoolStopID, len(userIDs))
+	return nil
+}
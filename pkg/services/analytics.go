@@ -0,0 +1,117 @@
+package services
+
+import (
+	"car-backend/pkg/models"
+	"car-backend/pkg/repository"
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AnalyticsService keeps the user_analytics counters current. Ride completions
+// and membership changes from the outbox refresh the users involved, and a
+// periodic reconciliation recomputes everyone to correct any drift.
+//
+// Counters are always recomputed from the source tables rather than incremented,
+// so redelivered events cannot double count.
+type AnalyticsService struct {
+	analyticsRepo *repository.AnalyticsRepository
+	rideRepo      *repository.CarPoolRideRepository
+
+	// Interval is how often every user's counters are reconciled
+	Interval time.Duration
+}
+
+func NewAnalyticsService(analyticsRepo *repository.AnalyticsRepository, rideRepo *repository.CarPoolRideRepository) *AnalyticsService {
+	return &AnalyticsService{
+		analyticsRepo: analyticsRepo,
+		rideRepo:      rideRepo,
+		Interval:      6 * time.Hour,
+	}
+}
+
+// SubscribeOutbox registers the events that change a user's counters
+func (s *AnalyticsService) SubscribeOutbox(d *OutboxDispatcher) {
+	d.Subscribe(models.EventRideCompleted, "analytics", s.onRideCompleted)
+	d.Subscribe(models.EventMemberJoined, "analytics", s.onMembershipChanged)
+	d.Subscribe(models.EventMemberLeft, "analytics", s.onMembershipChanged)
+}
+
+// Run reconciles every Interval until the context is cancelled
+func (s *AnalyticsService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Reconcile(ctx); err != nil {
+			log.Printf("{\"severity\":\"ERROR\",\"message\":\"User analytics reconciliation failed: %v\"}", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Reconcile recomputes every user's counters from the source tables
+func (s *AnalyticsService) Reconcile(ctx context.Context) error {
+	changed, err := s.analyticsRepo.RefreshAll(ctx)
+	if err != nil {
+		return err
+	}
+	if changed > 0 {
+		log.Printf("{\"severity\":\"INFO\",\"message\":\"Reconciled user analytics for %d users\"}", changed)
+	}
+	return nil
+}
+
+// Stats returns the user's counters, computing them first if they never have been
+func (s *AnalyticsService) Stats(ctx context.Context, userID uuid.UUID) (*models.UserAnalytics, error) {
+	stats, err := s.analyticsRepo.Get(ctx, userID)
+	if err != nil || stats != nil {
+		return stats, err
+	}
+
+	if _, err := s.analyticsRepo.Refresh(ctx, []uuid.UUID{userID}); err != nil {
+		return nil, err
+	}
+	return s.analyticsRepo.Get(ctx, userID)
+}
+
+func (s *AnalyticsService) onRideCompleted(ctx context.Context, event models.OutboxEvent) error {
+	var payload models.RideEvent
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		return err
+	}
+
+	ride, err := s.rideRepo.GetCarpoolRide(ctx, payload.RideID)
+	if err != nil {
+		return err
+	}
+	if ride == nil {
+		// Deleted since; reconciliation takes care of its participants
+		return nil
+	}
+
+	var userIDs []uuid.UUID
+	for userID := range ride.Participants() {
+		userIDs = append(userIDs, userID)
+	}
+	_, err = s.analyticsRepo.Refresh(ctx, userIDs)
+	return err
+}
+
+func (s *AnalyticsService) onMembershipChanged(ctx context.Context, event models.OutboxEvent) error {
+	var payload models.MembershipEvent
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		return err
+	}
+
+	_, err := s.analyticsRepo.Refresh(ctx, []uuid.UUID{payload.UserID})
+	return err
+}
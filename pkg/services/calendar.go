@@ -0,0 +1,234 @@
+package services
+
+import (
+	"car-backend/pkg/models"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// defaultRideDuration is the calendar length of a ride whose stops give no end time
+const defaultRideDuration = 30 * time.Minute
+
+var rideStatusLabels = map[int]string{
+	models.RideStatusScheduled:  "Scheduled",
+	models.RideStatusInProgress: "In progress",
+	models.RideStatusCompleted:  "Completed",
+	models.RideStatusCancelled:  "Cancelled",
+}
+
+// NewCalendarToken returns a random feed token and the hash stored in its place
+func NewCalendarToken() (token, hash string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(buf)
+	return token, HashCalendarToken(token), nil
+}
+
+// HashCalendarToken returns the stored form of a feed token
+func HashCalendarToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// BuildCalendar renders rides as an iCalendar feed in the given timezone.
+//
+// Each ride is its own event, so closure days and days without a ride never
+// show up as phantom occurrences. Cancelled rides stay in the feed marked as
+// cancelled. UIDs derive from ride IDs and SEQUENCE from the ride's revision,
+// so calendar apps update and remove entries in place as rides change.
+func BuildCalendar(name string, loc *time.Location, rides []models.CalendarRide, now time.Time) []byte {
+	cal := &icalWriter{}
+	cal.line("BEGIN:VCALENDAR")
+	cal.line("VERSION:2.0")
+	cal.line("PRODID:-//Car Backend//Carpool Rides//EN")
+	cal.line("CALSCALE:GREGORIAN")
+	cal.line("METHOD:PUBLISH")
+	cal.prop("X-WR-CALNAME", name)
+	cal.line("X-WR-TIMEZONE:" + loc.String())
+
+	var scheduled []models.CalendarRide
+	from, to := now, now
+	for _, ride := range rides {
+		if ride.ScheduledAt == nil {
+			continue
+		}
+		if ride.ScheduledAt.Before(from) {
+			from = *ride.ScheduledAt
+		}
+		if end := rideEnd(ride); end.After(to) {
+			to = end
+		}
+		scheduled = append(scheduled, ride)
+	}
+
+	// Times are written with TZID, which clients resolve against this definition
+	if loc != time.UTC {
+		cal.timezone(loc, from.AddDate(0, 0, -1), to.AddDate(0, 0, 1))
+	}
+
+	stamp := "DTSTAMP:" + now.UTC().Format("20060102T150405Z")
+	for _, ride := range scheduled {
+		cal.rideEvent(ride, stamp, loc)
+	}
+
+	cal.line("END:VCALENDAR")
+	return []byte(cal.String())
+}
+
+// rideEnd is when the ride is due at its last stop, or a default length after it starts
+func rideEnd(ride models.CalendarRide) time.Time {
+	start := *ride.ScheduledAt
+	if n := len(ride.Stops); n > 0 && ride.Stops[n-1].ScheduledAt != nil && ride.Stops[n-1].ScheduledAt.After(start) {
+		return *ride.Stops[n-1].ScheduledAt
+	}
+	return start.Add(defaultRideDuration)
+}
+
+// icalWriter accumulates content lines, folded at 75 octets as RFC 5545 requires
+type icalWriter struct {
+	strings.Builder
+}
+
+func (w *icalWriter) line(content string) {
+	// Continuation lines start with a space, which counts towards their 75 octets
+	limit := 75
+	for len(content) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(content[cut]) {
+			cut--
+		}
+		w.WriteString(content[:cut] + "\r\n ")
+		content = content[cut:]
+		limit = 74
+	}
+	w.WriteString(content + "\r\n")
+}
+
+// prop writes a text property, escaping it
+func (w *icalWriter) prop(name, value string) {
+	w.line(name + ":" + icalEscape(value))
+}
+
+// timezone writes a VTIMEZONE for loc covering from to to: the offset in
+// effect at from, then every offset change up to to.
+func (w *icalWriter) timezone(loc *time.Location, from, to time.Time) {
+	w.line("BEGIN:VTIMEZONE")
+	w.line("TZID:" + loc.String())
+
+	at := from.Unix()
+	name, offset := time.Unix(at, 0).In(loc).Zone()
+	w.observance(time.Unix(at, 0).In(loc).IsDST(), at, name, offset, offset)
+
+	// Offsets change at most a few times a year, so stepping a day at a time
+	// and then narrowing down to the second finds every change
+	for at < to.Unix() {
+		next := at + 24*60*60
+		if _, nextOffset := time.Unix(next, 0).In(loc).Zone(); nextOffset == offset {
+			at = next
+			continue
+		}
+		lo, hi := at, next
+		for hi-lo > 1 {
+			mid := lo + (hi-lo)/2
+			if _, midOffset := time.Unix(mid, 0).In(loc).Zone(); midOffset == offset {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		changed := time.Unix(hi, 0).In(loc)
+		newName, newOffset := changed.Zone()
+		w.observance(changed.IsDST(), hi, newName, offset, newOffset)
+		at, offset = hi, newOffset
+	}
+
+	w.line("END:VTIMEZONE")
+}
+
+// observance writes a STANDARD or DAYLIGHT block starting at the Unix time at.
+// Its DTSTART is the local wall clock time under the offset it replaces.
+func (w *icalWriter) observance(daylight bool, at int64, name string, offsetFrom, offsetTo int) {
+	kind := "STANDARD"
+	if daylight {
+		kind = "DAYLIGHT"
+	}
+	w.line("BEGIN:" + kind)
+	w.line("DTSTART:" + time.Unix(at+int64(offsetFrom), 0).UTC().Format("20060102T150405"))
+	w.line("TZOFFSETFROM:" + icalOffset(offsetFrom))
+	w.line("TZOFFSETTO:" + icalOffset(offsetTo))
+	w.prop("TZNAME", name)
+	w.line("END:" + kind)
+}
+
+func (w *icalWriter) rideEvent(ride models.CalendarRide, stamp string, loc *time.Location) {
+	w.line("BEGIN:VEVENT")
+	w.line(fmt.Sprintf("UID:ride-%s@car-backend", ride.ID))
+	w.line(stamp)
+	w.line(icalTime("DTSTART", *ride.ScheduledAt, loc))
+	w.line(icalTime("DTEND", rideEnd(ride), loc))
+	w.prop("SUMMARY", ride.CarpoolName)
+	if n := len(ride.Stops); n > 0 {
+		w.prop("LOCATION", ride.Stops[n-1].Address)
+	}
+	w.prop("DESCRIPTION", rideDescription(ride, loc))
+	w.line(fmt.Sprintf("SEQUENCE:%d", ride.Revision))
+	w.line("LAST-MODIFIED:" + ride.UpdatedAt.UTC().Format("20060102T150405Z"))
+	if ride.Status == models.RideStatusCancelled {
+		w.line("STATUS:CANCELLED")
+	} else {
+		w.line("STATUS:CONFIRMED")
+	}
+	w.line("END:VEVENT")
+}
+
+func rideDescription(ride models.CalendarRide, loc *time.Location) string {
+	var b strings.Builder
+	driver := ride.DriverName
+	if driver == "" {
+		driver = "Not assigned"
+	}
+	fmt.Fprintf(&b, "Driver: %s\nStatus: %s", driver, rideStatusLabels[ride.Status])
+	if len(ride.Stops) > 0 {
+		b.WriteString("\nStops:")
+		for i, stop := range ride.Stops {
+			fmt.Fprintf(&b, "\n%d. %s", i+1, stop.Address)
+			if stop.ScheduledAt != nil {
+				fmt.Fprintf(&b, " (%s)", stop.ScheduledAt.In(loc).Format("15:04"))
+			}
+		}
+	}
+	return b.String()
+}
+
+// icalTime formats a date-time property in the feed's timezone, or as UTC
+func icalTime(name string, t time.Time, loc *time.Location) string {
+	if loc == time.UTC {
+		return name + ":" + t.UTC().Format("20060102T150405Z")
+	}
+	return name + ";TZID=" + loc.String() + ":" + t.In(loc).Format("20060102T150405")
+}
+
+// icalOffset formats a UTC offset in seconds as +HHMM, or +HHMMSS when it has seconds
+func icalOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign, seconds = "-", -seconds
+	}
+	offset := fmt.Sprintf("%s%02d%02d", sign, seconds/3600, seconds/60%60)
+	if seconds%60 != 0 {
+		offset += fmt.Sprintf("%02d", seconds%60)
+	}
+	return offset
+}
+
+func icalEscape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(value)
+}
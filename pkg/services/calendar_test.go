@@ -0,0 +1,148 @@
+package services
+
+import (
+	"car-backend/pkg/models"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+func TestIcalOffset(t *testing.T) {
+	tests := []struct {
+		seconds int
+		want    string
+	}{
+		{0, "+0000"},
+		{-5 * 3600, "-0500"},
+		{5*3600 + 30*60, "+0530"},
+		{-(9*3600 + 30*60), "-0930"},
+		{-(17*60 + 30), "-001730"},
+	}
+
+	for _, tt := range tests {
+		if got := icalOffset(tt.seconds); got != tt.want {
+			t.Errorf("icalOffset(%d) = %s, want %s", tt.seconds, got, tt.want)
+		}
+	}
+}
+
+func TestIcalWriterFolding(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"short line", "SUMMARY:Morning run"},
+		{"exactly 75 octets", "DESCRIPTION:" + strings.Repeat("a", 63)},
+		{"long ascii", "DESCRIPTION:" + strings.Repeat("abcdefghij", 20)},
+		{"multibyte runes are not split", "DESCRIPTION:" + strings.Repeat("é", 100)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &icalWriter{}
+			w.line(tt.content)
+			out := w.String()
+
+			if !strings.HasSuffix(out, "\r\n") {
+				t.Fatalf("line does not end with CRLF: %q", out)
+			}
+			for _, line := range strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n") {
+				if len(line) > 75 {
+					t.Errorf("line of %d octets: %q", len(line), line)
+				}
+				if !utf8.ValidString(line) {
+					t.Errorf("line splits a rune: %q", line)
+				}
+			}
+			if unfolded := strings.ReplaceAll(strings.TrimSuffix(out, "\r\n"), "\r\n ", ""); unfolded != tt.content {
+				t.Errorf("unfolded = %q, want %q", unfolded, tt.content)
+			}
+		})
+	}
+}
+
+func TestBuildCalendar(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	ride := func(at time.Time, status, revision int) models.CalendarRide {
+		return models.CalendarRide{
+			CarpoolRide: models.CarpoolRide{ID: uuid.New(), Status: status, ScheduledAt: &at},
+			CarpoolName: "School run",
+			Revision:    revision,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		loc     *time.Location
+		rides   []models.CalendarRide
+		want    []string
+		notWant []string
+	}{
+		{
+			name:  "UTC feed has no VTIMEZONE",
+			loc:   time.UTC,
+			rides: []models.CalendarRide{ride(time.Date(2026, 10, 20, 12, 0, 0, 0, time.UTC), models.RideStatusScheduled, 0)},
+			want:  []string{"DTSTART:20261020T120000Z", "DTEND:20261020T123000Z", "SEQUENCE:0", "STATUS:CONFIRMED"},
+			notWant: []string{
+				"BEGIN:VTIMEZONE", "RRULE", "TZID=",
+			},
+		},
+		{
+			name: "VTIMEZONE covers the change to standard time",
+			loc:  newYork,
+			rides: []models.CalendarRide{
+				ride(time.Date(2026, 10, 20, 8, 0, 0, 0, newYork), models.RideStatusScheduled, 2),
+				ride(time.Date(2026, 11, 3, 8, 0, 0, 0, newYork), models.RideStatusCancelled, 1),
+			},
+			want: []string{
+				"BEGIN:VTIMEZONE\r\nTZID:America/New_York\r\n",
+				"BEGIN:DAYLIGHT\r\nDTSTART:20261018T080000\r\nTZOFFSETFROM:-0400\r\nTZOFFSETTO:-0400\r\nTZNAME:EDT\r\nEND:DAYLIGHT",
+				"BEGIN:STANDARD\r\nDTSTART:20261101T020000\r\nTZOFFSETFROM:-0400\r\nTZOFFSETTO:-0500\r\nTZNAME:EST\r\nEND:STANDARD",
+				"DTSTART;TZID=America/New_York:20261020T080000",
+				"DTSTART;TZID=America/New_York:20261103T080000",
+				"SEQUENCE:2",
+				"SEQUENCE:1",
+				"STATUS:CANCELLED",
+			},
+			notWant: []string{"RRULE", "EXDATE", "RECURRENCE-ID"},
+		},
+		{
+			name:    "rides without a time are left out",
+			loc:     time.UTC,
+			rides:   []models.CalendarRide{{CarpoolRide: models.CarpoolRide{ID: uuid.New()}, CarpoolName: "Unscheduled"}},
+			notWant: []string{"BEGIN:VEVENT"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := string(BuildCalendar("Rides", tt.loc, tt.rides, now))
+
+			if !strings.HasPrefix(out, "BEGIN:VCALENDAR\r\n") || !strings.HasSuffix(out, "END:VCALENDAR\r\n") {
+				t.Fatalf("not a calendar:\n%s", out)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("missing %q in:\n%s", want, out)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(out, notWant) {
+					t.Errorf("unexpected %q in:\n%s", notWant, out)
+				}
+			}
+			for _, r := range tt.rides {
+				if r.ScheduledAt != nil && !strings.Contains(out, "UID:ride-"+r.ID.String()+"@car-backend") {
+					t.Errorf("missing event for ride %s", r.ID)
+				}
+			}
+		})
+	}
+}
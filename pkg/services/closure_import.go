@@ -0,0 +1,209 @@
+package services
+
+import (
+	"bytes"
+	"car-backend/pkg/models"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxClosureSpan caps how many days a single closure entry may cover
+const maxClosureSpan = 366
+
+var ErrTooManyClosureDates = fmt.Errorf("an import can add at most %d dates", models.MaxClosureDates)
+
+// ParseClosureICS reads closure dates from the events of an iCalendar file. Each
+// event closes every day from its start to its end, and its summary is the
+// reason. The calendar's X-WR-TIMEZONE is returned when it names one.
+// Recurrence rules are not expanded; only the listed events are imported.
+func ParseClosureICS(data []byte) ([]models.ClosureDate, string, error) {
+	unfolded := strings.NewReplacer("\r\n ", "", "\r\n\t", "", "\n ", "", "\n\t", "").Replace(string(data))
+
+	closures := newClosureSet()
+	var timezone string
+	var inEvent bool
+	var start, end, summary string
+
+	for _, line := range strings.Split(unfolded, "\n") {
+		line = strings.TrimRight(line, "\r")
+		name, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		name, _, _ = strings.Cut(strings.ToUpper(name), ";")
+
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			inEvent, start, end, summary = true, "", "", ""
+		case name == "END" && value == "VEVENT":
+			inEvent = false
+			if err := closures.addEvent(start, end, icalUnescape(summary)); err != nil {
+				return nil, "", err
+			}
+		case name == "X-WR-TIMEZONE" && !inEvent:
+			timezone = strings.TrimSpace(value)
+		case inEvent && name == "DTSTART":
+			start = value
+		case inEvent && name == "DTEND":
+			end = value
+		case inEvent && name == "SUMMARY":
+			summary = value
+		}
+	}
+
+	if len(closures.dates) == 0 {
+		return nil, "", errors.New("no events with dates found")
+	}
+	return closures.sorted(), timezone, nil
+}
+
+// ParseClosureCSV reads closure dates from CSV rows of date, optional end date and
+// optional reason, with dates as YYYY-MM-DD. A header row is skipped.
+func ParseClosureCSV(data []byte) ([]models.ClosureDate, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	closures := newClosureSet()
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) == 0 || strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+
+		start, err := time.Parse("2006-01-02", strings.TrimSpace(record[0]))
+		if err != nil {
+			if line == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("line %d: invalid date %q", line, record[0])
+		}
+
+		end := start
+		if len(record) > 1 && strings.TrimSpace(record[1]) != "" {
+			if end, err = time.Parse("2006-01-02", strings.TrimSpace(record[1])); err != nil {
+				return nil, fmt.Errorf("line %d: invalid end date %q", line, record[1])
+			}
+		}
+
+		var reason string
+		if len(record) > 2 {
+			reason = strings.TrimSpace(record[2])
+		}
+
+		if err := closures.addRange(start, end.AddDate(0, 0, 1), reason); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+
+	if len(closures.dates) == 0 {
+		return nil, errors.New("no dates found")
+	}
+	return closures.sorted(), nil
+}
+
+// closureSet collects closure days, keeping the first reason given for a day
+type closureSet struct {
+	dates map[string]string
+}
+
+func newClosureSet() *closureSet {
+	return &closureSet{dates: make(map[string]string)}
+}
+
+// addEvent adds the days of an iCalendar event. All-day events end on the day
+// before DTEND; timed events close every day they touch.
+func (s *closureSet) addEvent(start, end, reason string) error {
+	if start == "" {
+		return nil
+	}
+	from, allDay, err := parseICSDate(start)
+	if err != nil {
+		return err
+	}
+
+	until := from.AddDate(0, 0, 1)
+	if end != "" {
+		to, endAllDay, err := parseICSDate(end)
+		if err != nil {
+			return err
+		}
+		switch {
+		case endAllDay || allDay:
+			until = to
+		case to.Hour() == 0 && to.Minute() == 0 && to.Second() == 0:
+			until = dayOf(to)
+		default:
+			until = dayOf(to).AddDate(0, 0, 1)
+		}
+		if !until.After(from) {
+			until = from.AddDate(0, 0, 1)
+		}
+	}
+
+	return s.addRange(dayOf(from), until, reason)
+}
+
+// addRange adds every day from start up to but not including until
+func (s *closureSet) addRange(start, until time.Time, reason string) error {
+	if until.Before(start) {
+		return errors.New("end date is before start date")
+	}
+	if until.Sub(start) > maxClosureSpan*24*time.Hour {
+		return fmt.Errorf("a closure can span at most %d days", maxClosureSpan)
+	}
+
+	for day := start; day.Before(until); day = day.AddDate(0, 0, 1) {
+		key := day.Format("2006-01-02")
+		if _, ok := s.dates[key]; !ok {
+			s.dates[key] = reason
+		}
+		if len(s.dates) > models.MaxClosureDates {
+			return ErrTooManyClosureDates
+		}
+	}
+	return nil
+}
+
+func (s *closureSet) sorted() []models.ClosureDate {
+	dates := make([]models.ClosureDate, 0, len(s.dates))
+	for date, reason := range s.dates {
+		dates = append(dates, models.ClosureDate{Date: date, Reason: reason})
+	}
+	sort.Slice(dates, func(i, j int) bool { return dates[i].Date < dates[j].Date })
+	return dates
+}
+
+// parseICSDate reads a DATE or DATE-TIME value, reporting whether it was a DATE.
+// Times are taken as written; only their calendar day matters here.
+func parseICSDate(value string) (time.Time, bool, error) {
+	value = strings.TrimSuffix(strings.TrimSpace(value), "Z")
+	if len(value) == 8 {
+		t, err := time.Parse("20060102", value)
+		return t, true, err
+	}
+	t, err := time.Parse("20060102T150405", value)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid date %q", value)
+	}
+	return t, false, nil
+}
+
+func dayOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func icalUnescape(value string) string {
+	return strings.NewReplacer(`\n`, " ", `\N`, " ", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(value)
+}
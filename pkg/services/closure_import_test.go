@@ -0,0 +1,180 @@
+package services
+
+import (
+	"car-backend/pkg/models"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// ics wraps event lines in a calendar with CRLF line endings
+func ics(lines ...string) []byte {
+	all := append([]string{"BEGIN:VCALENDAR", "VERSION:2.0"}, lines...)
+	all = append(all, "END:VCALENDAR")
+	return []byte(strings.Join(all, "\r\n") + "\r\n")
+}
+
+func event(lines ...string) []string {
+	return append(append([]string{"BEGIN:VEVENT"}, lines...), "END:VEVENT")
+}
+
+func closed(dates ...string) []models.ClosureDate {
+	var closures []models.ClosureDate
+	for i := 0; i < len(dates); i += 2 {
+		closures = append(closures, models.ClosureDate{Date: dates[i], Reason: dates[i+1]})
+	}
+	return closures
+}
+
+func TestParseClosureICS(t *testing.T) {
+	tests := []struct {
+		name         string
+		data         []byte
+		want         []models.ClosureDate
+		wantTimezone string
+		wantErr      bool
+	}{
+		{
+			name: "all-day event ends the day before DTEND",
+			data: ics(event("DTSTART;VALUE=DATE:20261224", "DTEND;VALUE=DATE:20261225", "SUMMARY:Christmas Eve")...),
+			want: closed("2026-12-24", "Christmas Eve"),
+		},
+		{
+			name: "multi-day all-day event",
+			data: ics(event("DTSTART;VALUE=DATE:20261221", "DTEND;VALUE=DATE:20261224", "SUMMARY:Break")...),
+			want: closed("2026-12-21", "Break", "2026-12-22", "Break", "2026-12-23", "Break"),
+		},
+		{
+			name: "all-day event without DTEND is one day",
+			data: ics(event("DTSTART;VALUE=DATE:20261111", "SUMMARY:Veterans Day")...),
+			want: closed("2026-11-11", "Veterans Day"),
+		},
+		{
+			name: "timed event closes the day it falls on",
+			data: ics(event("DTSTART:20261110T090000", "DTEND:20261110T150000", "SUMMARY:Teacher training")...),
+			want: closed("2026-11-10", "Teacher training"),
+		},
+		{
+			name: "timed event ending at midnight does not close the next day",
+			data: ics(event("DTSTART:20261110T180000Z", "DTEND:20261112T000000Z", "SUMMARY:Storm")...),
+			want: closed("2026-11-10", "Storm", "2026-11-11", "Storm"),
+		},
+		{
+			name: "end before start is one day",
+			data: ics(event("DTSTART;VALUE=DATE:20261105", "DTEND;VALUE=DATE:20261101", "SUMMARY:Typo")...),
+			want: closed("2026-11-05", "Typo"),
+		},
+		{
+			name: "folded and escaped summary",
+			data: ics(event("DTSTART;VALUE=DATE:20261126", "SUMMARY:Thanksgiving\\, no sch", " ool\\; office open")...),
+			want: closed("2026-11-26", "Thanksgiving, no school; office open"),
+		},
+		{
+			name: "overlapping events keep the first reason and sort by date",
+			data: ics(append(
+				event("DTSTART;VALUE=DATE:20261228", "DTEND;VALUE=DATE:20261230", "SUMMARY:Winter break"),
+				event("DTSTART;VALUE=DATE:20261225", "DTEND;VALUE=DATE:20261229", "SUMMARY:Holiday")...,
+			)...),
+			want: closed("2026-12-25", "Holiday", "2026-12-26", "Holiday", "2026-12-27", "Holiday", "2026-12-28", "Winter break", "2026-12-29", "Winter break"),
+		},
+		{
+			name: "calendar timezone is returned, event properties are not",
+			data: ics(append(
+				[]string{"X-WR-TIMEZONE:America/Chicago"},
+				event("DTSTART;VALUE=DATE:20260907", "X-WR-TIMEZONE:Europe/Paris", "SUMMARY:Labor Day")...,
+			)...),
+			want:         closed("2026-09-07", "Labor Day"),
+			wantTimezone: "America/Chicago",
+		},
+		{
+			name: "LF line endings",
+			data: []byte("BEGIN:VCALENDAR\nBEGIN:VEVENT\nDTSTART;VALUE=DATE:20260119\nSUMMARY:MLK Day\nEND:VEVENT\nEND:VCALENDAR\n"),
+			want: closed("2026-01-19", "MLK Day"),
+		},
+		{
+			name:    "no events",
+			data:    ics("X-WR-CALNAME:Empty"),
+			wantErr: true,
+		},
+		{
+			name:    "invalid date",
+			data:    ics(event("DTSTART:tomorrow", "SUMMARY:Bad")...),
+			wantErr: true,
+		},
+		{
+			name:    "span longer than a year",
+			data:    ics(event("DTSTART;VALUE=DATE:20260101", "DTEND;VALUE=DATE:20280101", "SUMMARY:Forever")...),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, timezone, err := ParseClosureICS(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseClosureICS() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseClosureICS() = %v, want %v", got, tt.want)
+			}
+			if timezone != tt.wantTimezone {
+				t.Errorf("timezone = %q, want %q", timezone, tt.wantTimezone)
+			}
+		})
+	}
+}
+
+func TestParseClosureCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    []models.ClosureDate
+		wantErr bool
+	}{
+		{
+			name: "header row is skipped",
+			data: "date,end,reason\n2026-11-11,,Veterans Day\n",
+			want: closed("2026-11-11", "Veterans Day"),
+		},
+		{
+			name: "end date is inclusive",
+			data: "2026-12-21, 2026-12-23, Winter break\n",
+			want: closed("2026-12-21", "Winter break", "2026-12-22", "Winter break", "2026-12-23", "Winter break"),
+		},
+		{
+			name: "reason is optional",
+			data: "2026-01-19\n",
+			want: closed("2026-01-19", ""),
+		},
+		{
+			name:    "invalid date after the first line",
+			data:    "2026-01-19\n01/20/2026\n",
+			wantErr: true,
+		},
+		{
+			name:    "end before start",
+			data:    "2026-01-20,2026-01-18\n",
+			wantErr: true,
+		},
+		{
+			name:    "only a header",
+			data:    "date,end,reason\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseClosureCSV([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseClosureCSV() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseClosureCSV() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
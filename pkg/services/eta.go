@@ -0,0 +1,90 @@
+package services
+
+import (
+	"car-backend/pkg/geo"
+	"car-backend/pkg/models"
+	"context"
+	"time"
+)
+
+// TravelTimeEstimator estimates how long it takes to drive between two points.
+// Implementations may call out to a routing service; the default uses straight-line distance.
+type TravelTimeEstimator interface {
+	Estimate(ctx context.Context, from, to geo.Point) (time.Duration, error)
+}
+
+// AverageSpeedEstimator estimates travel time from distance and an average speed
+type AverageSpeedEstimator struct {
+	// SpeedKmh is the assumed average driving speed
+	SpeedKmh float64
+	// DetourFactor scales straight-line distance to approximate road distance
+	DetourFactor float64
+}
+
+func NewAverageSpeedEstimator() *AverageSpeedEstimator {
+	return &AverageSpeedEstimator{SpeedKmh: 40, DetourFactor: 1.3}
+}
+
+func (e *AverageSpeedEstimator) Estimate(ctx context.Context, from, to geo.Point) (time.Duration, error) {
+	meters := geo.DistanceMeters(from, to) * e.DetourFactor
+	hours := meters / 1000 / e.SpeedKmh
+	return time.Duration(hours * float64(time.Hour)), nil
+}
+
+// ETACalculator computes arrival times for the stops a ride has yet to reach
+type ETACalculator struct {
+	estimator TravelTimeEstimator
+
+	// DwellTime is how long the car is expected to wait at each intermediate stop
+	DwellTime time.Duration
+}
+
+func NewETACalculator(estimator TravelTimeEstimator) *ETACalculator {
+	return &ETACalculator{estimator: estimator, DwellTime: time.Minute}
+}
+
+// Compute walks the remaining stops in order from the driver's latest location.
+// It returns nil when the ride is not active or has no known location.
+func (c *ETACalculator) Compute(ctx context.Context, ride *models.CarpoolRide, now time.Time) ([]models.StopETA, error) {
+	if ride.Status != models.RideStatusScheduled && ride.Status != models.RideStatusInProgress {
+		return nil, nil
+	}
+	if ride.LocationLat == 0 && ride.LocationLng == 0 {
+		return nil, nil
+	}
+
+	from := geo.Point{Lat: ride.LocationLat, Lng: ride.LocationLng}
+	at := now
+	distance := 0.0
+	var etas []models.StopETA
+
+	for _, stop := range ride.Stops {
+		if stop.ArrivedAt != nil || stop.Lat == nil || stop.Lng == nil {
+			continue
+		}
+
+		to := geo.Point{Lat: *stop.Lat, Lng: *stop.Lng}
+		travel, err := c.estimator.Estimate(ctx, from, to)
+		if err != nil {
+			return nil, err
+		}
+		at = at.Add(travel)
+		distance += geo.DistanceMeters(from, to)
+
+		etas = append(etas, models.StopETA{
+			StopID:      stop.ID,
+			StopOrder:   stop.StopOrder,
+			Address:     stop.Address,
+			DistanceM:   distance,
+			ETA:         at,
+			ScheduledAt: stop.ScheduledAt,
+		})
+
+		if stop.StopType == models.StopTypeIntermediate {
+			at = at.Add(c.DwellTime)
+		}
+		from = to
+	}
+
+	return etas, nil
+}
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"bytes"
+	"car-backend/pkg/geo"
+	"car-backend/pkg/models"
+	"errors"
+	"math"
+	"sort"
+
+	"github.com/google/uuid"
+)
+
+var ErrNoRiders = errors.New("ride has no riders to split the expense with")
+
+// SplitExpense divides amount among the ride's riders by rule, in minor units
+// that sum exactly to amount. seats holds the seats each member takes for the
+// per-seat rule; riders without an entry take one. When the rule gives every
+// rider no weight, such as per mile on a ride without coordinates, the split
+// falls back to equal. The rule actually applied is returned.
+func SplitExpense(amount int64, rule string, ride *models.CarpoolRide, seats map[uuid.UUID]int) ([]models.ExpenseShare, string, error) {
+	var riders []uuid.UUID
+	for userID, role := range ride.Participants() {
+		if role == models.RideRoleRider {
+			riders = append(riders, userID)
+		}
+	}
+	if len(riders) == 0 {
+		return nil, "", ErrNoRiders
+	}
+	sort.Slice(riders, func(i, j int) bool { return bytes.Compare(riders[i][:], riders[j][:]) < 0 })
+
+	weights := make([]float64, len(riders))
+	var total float64
+	for i, userID := range riders {
+		switch rule {
+		case models.SplitRulePerMile:
+			weights[i] = riderMeters(ride, userID)
+		case models.SplitRulePerSeat:
+			weights[i] = 1
+			if n, ok := seats[userID]; ok {
+				weights[i] = float64(n)
+			}
+		default:
+			weights[i] = 1
+		}
+		total += weights[i]
+	}
+	if total == 0 {
+		rule = models.SplitRuleEqual
+		for i := range weights {
+			weights[i] = 1
+		}
+		total = float64(len(weights))
+	}
+
+	shares := make([]models.ExpenseShare, len(riders))
+	for i, amountMinor := range allocate(amount, weights, total) {
+		shares[i] = models.ExpenseShare{UserID: riders[i], AmountMinor: amountMinor}
+	}
+	return shares, rule, nil
+}
+
+// allocate splits amount in proportion to weights using the largest remainder
+// method, so the parts are whole and sum to amount. Ties go to the earlier weight.
+func allocate(amount int64, weights []float64, total float64) []int64 {
+	parts := make([]int64, len(weights))
+	remainders := make([]float64, len(weights))
+	var allocated int64
+	for i, w := range weights {
+		exact := float64(amount) * w / total
+		parts[i] = int64(math.Floor(exact))
+		remainders[i] = exact - float64(parts[i])
+		allocated += parts[i]
+	}
+
+	order := make([]int, len(weights))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return remainders[order[a]] > remainders[order[b]] })
+	for i := 0; allocated < amount; i++ {
+		parts[order[i%len(order)]]++
+		allocated++
+	}
+	return parts
+}
+
+// riderMeters is how far a rider rode: from their first stop to their last, or
+// to the ride's final stop when they have only one. Stops without coordinates
+// are skipped.
+func riderMeters(ride *models.CarpoolRide, userID uuid.UUID) float64 {
+	stops := append([]models.Stop(nil), ride.Stops...)
+	sort.SliceStable(stops, func(i, j int) bool { return stops[i].StopOrder < stops[j].StopOrder })
+
+	first, last := -1, -1
+	for i, stop := range stops {
+		if stop.UserID == userID {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+	if first < 0 {
+		return 0
+	}
+	if first == last {
+		last = len(stops) - 1
+	}
+
+	var meters float64
+	var prev *geo.Point
+	for _, stop := range stops[first : last+1] {
+		if stop.Lat == nil || stop.Lng == nil {
+			continue
+		}
+		point := geo.Point{Lat: *stop.Lat, Lng: *stop.Lng}
+		if prev != nil {
+			meters += geo.DistanceMeters(*prev, point)
+		}
+		prev = &point
+	}
+	return meters
+}
+
+// SettleUp suggests transfers that bring every balance to zero, per currency.
+// Members whose debt exactly matches another's credit are paired first, then
+// the largest debtor repeatedly pays the largest creditor. This needs at most
+// one transfer fewer than there are members with a balance; finding the true
+// minimum is NP-hard and not worth it at carpool sizes.
+func SettleUp(balances []models.MemberBalance) []models.Transfer {
+	byCurrency := map[string][]models.MemberBalance{}
+	var currencies []string
+	for _, b := range balances {
+		if b.NetMinor == 0 {
+			continue
+		}
+		if _, ok := byCurrency[b.Currency]; !ok {
+			currencies = append(currencies, b.Currency)
+		}
+		byCurrency[b.Currency] = append(byCurrency[b.Currency], b)
+	}
+	sort.Strings(currencies)
+
+	transfers := []models.Transfer{}
+	for _, currency := range currencies {
+		transfers = append(transfers, settleCurrency(currency, byCurrency[currency])...)
+	}
+	return transfers
+}
+
+func settleCurrency(currency string, balances []models.MemberBalance) []models.Transfer {
+	net := make([]int64, len(balances))
+	for i, b := range balances {
+		net[i] = b.NetMinor
+	}
+
+	var transfers []models.Transfer
+	pay := func(from, to int, amount int64) {
+		transfers = append(transfers, models.Transfer{
+			FromUserID:  balances[from].UserID,
+			ToUserID:    balances[to].UserID,
+			AmountMinor: amount,
+			Currency:    currency,
+		})
+		net[from] += amount
+		net[to] -= amount
+	}
+
+	for d := range net {
+		for c := range net {
+			if net[d] < 0 && net[d] == -net[c] {
+				pay(d, c, net[c])
+				break
+			}
+		}
+	}
+
+	for {
+		debtor, creditor := -1, -1
+		for i, n := range net {
+			if n < 0 && (debtor < 0 || n < net[debtor]) {
+				debtor = i
+			}
+			if n > 0 && (creditor < 0 || n > net[creditor]) {
+				creditor = i
+			}
+		}
+		if debtor < 0 || creditor < 0 {
+			return transfers
+		}
+
+		amount := net[creditor]
+		if -net[debtor] < amount {
+			amount = -net[debtor]
+		}
+		pay(debtor, creditor, amount)
+	}
+}
@@ -0,0 +1,238 @@
+package services
+
+import (
+	"car-backend/pkg/models"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+var (
+	driverID = uuid.MustParse("00000000-0000-0000-0000-000000000001")
+	riderA   = uuid.MustParse("00000000-0000-0000-0000-00000000000a")
+	riderB   = uuid.MustParse("00000000-0000-0000-0000-00000000000b")
+	riderC   = uuid.MustParse("00000000-0000-0000-0000-00000000000c")
+)
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name    string
+		amount  int64
+		weights []float64
+		want    []int64
+	}{
+		{"even split", 10, []float64{1, 1}, []int64{5, 5}},
+		{"tied remainders go to the earlier weight", 100, []float64{1, 1, 1}, []int64{34, 33, 33}},
+		{"largest remainder gets the extra unit", 100, []float64{1, 2}, []int64{33, 67}},
+		{"less than one unit each", 2, []float64{1, 1, 1}, []int64{1, 1, 0}},
+		{"zero amount", 0, []float64{1, 3}, []int64{0, 0}},
+		{"uneven weights", 1000, []float64{3, 3, 1}, []int64{429, 428, 143}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var total float64
+			for _, w := range tt.weights {
+				total += w
+			}
+
+			got := allocate(tt.amount, tt.weights, total)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("allocate(%d, %v) = %v, want %v", tt.amount, tt.weights, got, tt.want)
+			}
+			var sum int64
+			for _, part := range got {
+				sum += part
+			}
+			if sum != tt.amount {
+				t.Fatalf("parts sum to %d, want %d", sum, tt.amount)
+			}
+		})
+	}
+}
+
+func TestSplitExpense(t *testing.T) {
+	// Stops along the equator, so distances are proportional to longitude
+	stop := func(userID uuid.UUID, order int, lng float64) models.Stop {
+		lat := 0.0
+		return models.Stop{UserID: userID, StopOrder: order, Lat: &lat, Lng: &lng}
+	}
+	noCoords := func(userID uuid.UUID, order int) models.Stop {
+		return models.Stop{UserID: userID, StopOrder: order}
+	}
+
+	tests := []struct {
+		name     string
+		amount   int64
+		rule     string
+		stops    []models.Stop
+		seats    map[uuid.UUID]int
+		want     []models.ExpenseShare
+		wantRule string
+		wantErr  error
+	}{
+		{
+			name:     "equal split ordered by rider",
+			amount:   101,
+			rule:     models.SplitRuleEqual,
+			stops:    []models.Stop{noCoords(riderB, 1), noCoords(riderA, 2)},
+			want:     []models.ExpenseShare{{UserID: riderA, AmountMinor: 51}, {UserID: riderB, AmountMinor: 50}},
+			wantRule: models.SplitRuleEqual,
+		},
+		{
+			name:     "driver's own stop does not make them a rider",
+			amount:   90,
+			rule:     models.SplitRuleEqual,
+			stops:    []models.Stop{noCoords(driverID, 0), noCoords(riderA, 1), noCoords(riderB, 2), noCoords(riderC, 3)},
+			want:     []models.ExpenseShare{{UserID: riderA, AmountMinor: 30}, {UserID: riderB, AmountMinor: 30}, {UserID: riderC, AmountMinor: 30}},
+			wantRule: models.SplitRuleEqual,
+		},
+		{
+			name:     "per seat defaults missing riders to one seat",
+			amount:   100,
+			rule:     models.SplitRulePerSeat,
+			stops:    []models.Stop{noCoords(riderA, 1), noCoords(riderB, 2)},
+			seats:    map[uuid.UUID]int{riderA: 2},
+			want:     []models.ExpenseShare{{UserID: riderA, AmountMinor: 67}, {UserID: riderB, AmountMinor: 33}},
+			wantRule: models.SplitRulePerSeat,
+		},
+		{
+			name:   "per mile weights by distance ridden",
+			amount: 90,
+			rule:   models.SplitRulePerMile,
+			stops: []models.Stop{
+				stop(driverID, 0, 0),
+				stop(riderA, 1, 1),
+				stop(riderB, 2, 2),
+				stop(uuid.Nil, 3, 3),
+			},
+			want:     []models.ExpenseShare{{UserID: riderA, AmountMinor: 60}, {UserID: riderB, AmountMinor: 30}},
+			wantRule: models.SplitRulePerMile,
+		},
+		{
+			name:     "per mile without coordinates falls back to equal",
+			amount:   10,
+			rule:     models.SplitRulePerMile,
+			stops:    []models.Stop{noCoords(riderA, 1), noCoords(riderB, 2)},
+			want:     []models.ExpenseShare{{UserID: riderA, AmountMinor: 5}, {UserID: riderB, AmountMinor: 5}},
+			wantRule: models.SplitRuleEqual,
+		},
+		{
+			name:    "no riders",
+			amount:  100,
+			rule:    models.SplitRuleEqual,
+			stops:   []models.Stop{noCoords(driverID, 0)},
+			wantErr: ErrNoRiders,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ride := &models.CarpoolRide{DriverID: driverID, Stops: tt.stops}
+
+			shares, rule, err := SplitExpense(tt.amount, tt.rule, ride, tt.seats)
+			if err != tt.wantErr {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if rule != tt.wantRule {
+				t.Errorf("rule = %s, want %s", rule, tt.wantRule)
+			}
+			if !reflect.DeepEqual(shares, tt.want) {
+				t.Errorf("shares = %v, want %v", shares, tt.want)
+			}
+		})
+	}
+}
+
+func TestSettleUp(t *testing.T) {
+	balance := func(userID uuid.UUID, currency string, net int64) models.MemberBalance {
+		return models.MemberBalance{UserID: userID, Currency: currency, NetMinor: net}
+	}
+	transfer := func(from, to uuid.UUID, amount int64, currency string) models.Transfer {
+		return models.Transfer{FromUserID: from, ToUserID: to, AmountMinor: amount, Currency: currency}
+	}
+
+	tests := []struct {
+		name     string
+		balances []models.MemberBalance
+		want     []models.Transfer
+	}{
+		{
+			name: "no balances",
+			want: []models.Transfer{},
+		},
+		{
+			name:     "settled members are skipped",
+			balances: []models.MemberBalance{balance(riderA, "USD", 0), balance(riderB, "USD", 0)},
+			want:     []models.Transfer{},
+		},
+		{
+			name: "exact matches are paired first",
+			balances: []models.MemberBalance{
+				balance(riderA, "USD", -50),
+				balance(riderB, "USD", 20),
+				balance(riderC, "USD", -20),
+				balance(driverID, "USD", 50),
+			},
+			want: []models.Transfer{
+				transfer(riderA, driverID, 50, "USD"),
+				transfer(riderC, riderB, 20, "USD"),
+			},
+		},
+		{
+			name: "largest debtor pays largest creditor",
+			balances: []models.MemberBalance{
+				balance(driverID, "USD", 100),
+				balance(riderA, "USD", -60),
+				balance(riderB, "USD", -30),
+				balance(riderC, "USD", -10),
+			},
+			want: []models.Transfer{
+				transfer(riderA, driverID, 60, "USD"),
+				transfer(riderB, driverID, 30, "USD"),
+				transfer(riderC, driverID, 10, "USD"),
+			},
+		},
+		{
+			name: "currencies settle separately in code order",
+			balances: []models.MemberBalance{
+				balance(driverID, "USD", 30),
+				balance(riderA, "USD", -30),
+				balance(driverID, "EUR", -15),
+				balance(riderB, "EUR", 15),
+			},
+			want: []models.Transfer{
+				transfer(driverID, riderB, 15, "EUR"),
+				transfer(riderA, driverID, 30, "USD"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SettleUp(tt.balances)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("SettleUp() = %v, want %v", got, tt.want)
+			}
+
+			// Applying the transfers must leave every balance at zero
+			net := map[string]int64{}
+			for _, b := range tt.balances {
+				net[b.Currency+b.UserID.String()] += b.NetMinor
+			}
+			for _, tr := range got {
+				net[tr.Currency+tr.FromUserID.String()] += tr.AmountMinor
+				net[tr.Currency+tr.ToUserID.String()] -= tr.AmountMinor
+			}
+			for key, n := range net {
+				if n != 0 {
+					t.Errorf("%s left at %d after transfers", key, n)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"car-backend/pkg/geo"
+	"car-backend/pkg/models"
+	"car-backend/pkg/repository"
+	"context"
+	"database/sql"
+	"log"
+
+	"github.com/google/uuid"
+)
+
+// Geofencer turns driver location pings into arriving, arrived and departed events
+// for each stop and advances the ride state machine accordingly.
+type Geofencer struct {
+	rideRepo    *repository.CarPoolRideRepository
+	carpoolRepo *repository.CarPoolRepository
+	events      StopEventSink
+
+	// ArrivedRadiusM is the default radius around a stop that counts as arrived
+	ArrivedRadiusM float64
+	// ArrivingRadiusM is the radius around a stop at which members are told the car is close
+	ArrivingRadiusM float64
+	// DepartedFactor scales the arrived radius to give hysteresis before a departure is detected
+	DepartedFactor float64
+}
+
+func NewGeofencer(rideRepo *repository.CarPoolRideRepository, carpoolRepo *repository.CarPoolRepository, events StopEventSink) *Geofencer {
+	return &Geofencer{
+		rideRepo:        rideRepo,
+		carpoolRepo:     carpoolRepo,
+		events:          events,
+		ArrivedRadiusM:  75,
+		ArrivingRadiusM: 800,
+		DepartedFactor:  1.5,
+	}
+}
+
+// ProcessLocation evaluates the ride's stops against the driver's current position
+// and returns any new events it emitted.
+func (g *Geofencer) ProcessLocation(ctx context.Context, ride *models.CarpoolRide, lat, lng float64) ([]models.StopEvent, error) {
+	seen, err := g.rideRepo.ListStopEvents(ctx, ride.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	here := geo.Point{Lat: lat, Lng: lng}
+	var emitted []models.StopEvent
+
+	for _, stop := range ride.Stops {
+		if stop.Lat == nil || stop.Lng == nil || stop.DepartedAt != nil {
+			continue
+		}
+
+		radius := g.ArrivedRadiusM
+		if stop.GeofenceRadiusM != nil && *stop.GeofenceRadiusM > 0 {
+			radius = *stop.GeofenceRadiusM
+		}
+		distance := geo.DistanceMeters(here, geo.Point{Lat: *stop.Lat, Lng: *stop.Lng})
+
+		var eventTypes []string
+		switch {
+		case distance <= radius:
+			eventTypes = []string{models.StopEventArriving, models.StopEventArrived}
+		case distance <= g.ArrivingRadiusM:
+			eventTypes = []string{models.StopEventArriving}
+		}
+		arrived := stop.ArrivedAt != nil || seen[stop.ID][models.StopEventArrived]
+		if distance > radius*g.DepartedFactor && arrived {
+			eventTypes = append(eventTypes, models.StopEventDeparted)
+		}
+
+		for _, eventType := range eventTypes {
+			if seen[stop.ID][eventType] {
+				continue
+			}
+			event := models.StopEvent{
+				CarpoolID:     ride.CarpoolID,
+				CarpoolRideID: ride.ID,
+				CarpoolStopID: stop.ID,
+				StopType:      stop.StopType,
+				EventType:     eventType,
+				Lat:           lat,
+				Lng:           lng,
+			}
+			created, err := g.rideRepo.RecordStopEvent(ctx, &event)
+			if err != nil {
+				return emitted, err
+			}
+			if !created {
+				continue
+			}
+
+			if err := g.advance(ctx, ride, stop, eventType); err != nil {
+				return emitted, err
+			}
+			emitted = append(emitted, event)
+		}
+	}
+
+	if len(emitted) > 0 {
+		g.notify(ctx, ride.CarpoolID, emitted)
+	}
+
+	return emitted, nil
+}
+
+// advance moves the ride state machine forward in response to a new stop event
+func (g *Geofencer) advance(ctx context.Context, ride *models.CarpoolRide, stop models.Stop, eventType string) error {
+	var err error
+	switch eventType {
+	case models.StopEventArrived:
+		// Reaching a pickup or the destination means the ride is under way even
+		// when its departure from START was never detected
+		if stop.StopType != models.StopTypeStart && ride.Status == models.RideStatusScheduled {
+			err = g.rideRepo.StartRide(ctx, ride.ID)
+			if err == nil || err == sql.ErrNoRows {
+				// A concurrent manual start leaves the ride in progress too
+				err = nil
+				ride.Status = models.RideStatusInProgress
+			}
+		}
+		if err == nil {
+			err = g.rideRepo.MarkStopArrived(ctx, ride.ID, stop.ID)
+		}
+		if err == nil && stop.StopType == models.StopTypeDestination {
+			err = g.rideRepo.CompleteRide(ctx, ride.ID)
+			if err == nil {
+				ride.Status = models.RideStatusCompleted
+			}
+		}
+	case models.StopEventDeparted:
+		if stop.StopType == models.StopTypeStart && ride.Status == models.RideStatusScheduled {
+			err = g.rideRepo.StartRide(ctx, ride.ID)
+			if err == nil || err == sql.ErrNoRows {
+				// A concurrent manual start still leaves the departure to record
+				err = nil
+				ride.Status = models.RideStatusInProgress
+			}
+		}
+		if err == nil {
+			err = g.rideRepo.MarkStopDeparted(ctx, ride.ID, stop.ID)
+		}
+	}
+
+	// The ride may already have been advanced manually
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	return err
+}
+
+func (g *Geofencer) notify(ctx context.Context, carpoolID uuid.UUID, events []models.StopEvent) {
+	members, err := g.carpoolRepo.ListMemberIDs(ctx, carpoolID)
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to list members of carpool %s: %v\"}", carpoolID, err)
+		return
+	}
+
+	for _, event := range events {
+		if err := g.events.SendStopEvent(ctx, members, event); err != nil {
+			log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to send stop event for stop %s: %v\"}", event.CarpoolStopID, err)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"car-backend/pkg/models"
+	"car-backend/pkg/realtime"
+	"car-backend/pkg/repository"
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/google/uuid"
+)
+
+// InAppChannel stores notifications in the recipient's inbox and pushes them to
+// the user's realtime topic so open apps update without polling.
+type InAppChannel struct {
+	repo *repository.NotificationRepository
+	hub  *realtime.Hub
+}
+
+func NewInAppChannel(repo *repository.NotificationRepository, hub *realtime.Hub) *InAppChannel {
+	return &InAppChannel{repo: repo, hub: hub}
+}
+
+func (c *InAppChannel) Send(ctx context.Context, recipient models.NotificationRecipient, notification models.Notification) error {
+	// Only account holders have an inbox
+	if recipient.UserID == uuid.Nil {
+		return nil
+	}
+
+	entry := &models.FeedNotification{
+		UserID:        recipient.UserID,
+		Type:          notification.Type,
+		Title:         notification.Title,
+		Body:          notification.Body,
+		Data:          notification.Data,
+		CarpoolID:     dataUUID(notification.Data, "carpool_id"),
+		CarpoolRideID: dataUUID(notification.Data, "carpool_ride_id"),
+		InviteID:      dataUUID(notification.Data, "invite_id"),
+	}
+	entry.Link = feedLink(entry)
+
+	if err := c.repo.Create(ctx, entry); err != nil {
+		return err
+	}
+
+	count, err := c.repo.UnreadCount(ctx, recipient.UserID)
+	if err != nil {
+		log.Printf("{\"severity\":\"WARNING\",\"message\":\"Failed to count unread notifications: %v\"}", err)
+		return nil
+	}
+	c.hub.Publish(realtime.UserTopic(recipient.UserID), "notification.created", models.NotificationFeedEvent{Notification: entry, UnreadCount: count})
+
+	return nil
+}
+
+// feedLink is the app path an inbox entry opens, the most specific resource first
+func feedLink(entry *models.FeedNotification) string {
+	switch {
+	case entry.InviteID != nil:
+		return fmt.Sprintf("/invites/%s", entry.InviteID)
+	case entry.CarpoolRideID != nil && entry.CarpoolID != nil:
+		return fmt.Sprintf("/carpools/%s/rides/%s", entry.CarpoolID, entry.CarpoolRideID)
+	case entry.CarpoolID != nil:
+		return fmt.Sprintf("/carpools/%s", entry.CarpoolID)
+	}
+	return ""
+}
+
+func dataUUID(data map[string]string, key string) *uuid.UUID {
+	id, err := uuid.Parse(data[key])
+	if err != nil || id == uuid.Nil {
+		return nil
+	}
+	return &id
+}
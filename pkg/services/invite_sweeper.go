@@ -0,0 +1,67 @@
+package services
+
+import (
+	"car-backend/pkg/repository"
+	"context"
+	"log"
+	"time"
+)
+
+// InviteSweeper expires stale invites and queues one reminder for each invite
+// before it expires; the outbox delivers the reminders
+type InviteSweeper struct {
+	inviteRepo *repository.InviteRepository
+
+	// ReminderLead is how long before expiry the reminder is sent
+	ReminderLead time.Duration
+	// Interval is how often the sweeper runs
+	Interval time.Duration
+}
+
+func NewInviteSweeper(inviteRepo *repository.InviteRepository) *InviteSweeper {
+	return &InviteSweeper{
+		inviteRepo:   inviteRepo,
+		ReminderLead: 24 * time.Hour,
+		Interval:     15 * time.Minute,
+	}
+}
+
+// Run sweeps invites every Interval until the context is cancelled
+func (s *InviteSweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Sweep(ctx, time.Now()); err != nil {
+			log.Printf("{\"severity\":\"ERROR\",\"message\":\"Invite sweep failed: %v\"}", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep expires invites past their expiry and queues due reminders as of now
+func (s *InviteSweeper) Sweep(ctx context.Context, now time.Time) error {
+	expired, err := s.inviteRepo.ExpireInvites(ctx, now)
+	if err != nil {
+		return err
+	}
+	if expired > 0 {
+		log.Printf("{\"severity\":\"INFO\",\"message\":\"Expired %d invites\"}", expired)
+	}
+
+	due, err := s.inviteRepo.ClaimInviteReminders(ctx, now, now.Add(s.ReminderLead))
+	if err != nil {
+		return err
+	}
+
+	if len(due) > 0 {
+		log.Printf("{\"severity\":\"INFO\",\"message\":\"Queued %d invite reminders\"}", len(due))
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidInviteToken = errors.New("invalid invite token")
+
+// codeAlphabet leaves out characters that are easy to misread when typed
+const codeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// InviteTokenSigner issues and verifies signed invite link tokens.
+// A token encodes the link id and expiry and is signed with HMAC-SHA256.
+type InviteTokenSigner struct {
+	secret []byte
+}
+
+func NewInviteTokenSigner(secret string) *InviteTokenSigner {
+	return &InviteTokenSigner{secret: []byte(secret)}
+}
+
+// Sign returns the token for an invite link
+func (s *InviteTokenSigner) Sign(linkID uuid.UUID, expiresAt time.Time) string {
+	payload := fmt.Sprintf("%s.%d", linkID, expiresAt.Unix())
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + s.signature(payload)
+}
+
+// Verify checks the token's signature and expiry and returns the link id it was issued for
+func (s *InviteTokenSigner) Verify(token string, now time.Time) (uuid.UUID, error) {
+	encoded, signature, found := strings.Cut(token, ".")
+	if !found {
+		return uuid.Nil, ErrInvalidInviteToken
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return uuid.Nil, ErrInvalidInviteToken
+	}
+	payload := string(raw)
+
+	if !hmac.Equal([]byte(signature), []byte(s.signature(payload))) {
+		return uuid.Nil, ErrInvalidInviteToken
+	}
+
+	id, expiry, found := strings.Cut(payload, ".")
+	if !found {
+		return uuid.Nil, ErrInvalidInviteToken
+	}
+	linkID, err := uuid.Parse(id)
+	if err != nil {
+		return uuid.Nil, ErrInvalidInviteToken
+	}
+	expiresAt, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || !now.Before(time.Unix(expiresAt, 0)) {
+		return uuid.Nil, ErrInvalidInviteToken
+	}
+
+	return linkID, nil
+}
+
+func (s *InviteTokenSigner) signature(payload string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// NewInviteCode returns a random short code for typing into the app
+func NewInviteCode() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	for i, b := range buf {
+		buf[i] = codeAlphabet[int(b)%len(codeAlphabet)]
+	}
+	return string(buf), nil
+}
@@ -0,0 +1,278 @@
+package services
+
+import (
+	"car-backend/pkg/geo"
+	"car-backend/pkg/models"
+	"car-backend/pkg/repository"
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Weights of each factor in a match score; they sum to 1
+const (
+	weightProximity   = 0.35
+	weightSchedule    = 0.25
+	weightPreferences = 0.15
+	weightSeats       = 0.10
+	weightSocial      = 0.15
+)
+
+// MatchingService scores existing carpools for a user
+type MatchingService struct {
+	carpoolRepo *repository.CarPoolRepository
+
+	// MaxDistanceKm is the origin or destination distance at which proximity scores zero
+	MaxDistanceKm float64
+	// MaxTimeDifference is the departure time difference at which schedule scores zero
+	MaxTimeDifference time.Duration
+	// CandidateLimit caps how many carpools are scored per request
+	CandidateLimit int
+}
+
+func NewMatchingService(carpoolRepo *repository.CarPoolRepository) *MatchingService {
+	return &MatchingService{
+		carpoolRepo:       carpoolRepo,
+		MaxDistanceKm:     10,
+		MaxTimeDifference: time.Hour,
+		CandidateLimit:    500,
+	}
+}
+
+// Recommend returns the user's best matches among the carpools they can see,
+// highest score first, only those of the organization when one is given
+func (s *MatchingService) Recommend(ctx context.Context, user *models.User, organizationID *uuid.UUID, limit int) ([]models.CarpoolRecommendation, error) {
+	candidates, err := s.carpoolRepo.ListMatchCandidates(ctx, user.ID, organizationID, s.matchArea(user), s.CandidateLimit)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.carpoolRepo.AttachMemberRatings(ctx, candidates); err != nil {
+		return nil, err
+	}
+
+	mutual, err := s.carpoolRepo.MutualMemberCounts(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	recommendations := make([]models.CarpoolRecommendation, 0, len(candidates))
+	for _, carpool := range candidates {
+		recommendations = append(recommendations, s.Score(user, carpool, mutual[carpool.ID]))
+	}
+
+	sort.SliceStable(recommendations, func(i, j int) bool {
+		return recommendations[i].Score > recommendations[j].Score
+	})
+	if limit > 0 && len(recommendations) > limit {
+		recommendations = recommendations[:limit]
+	}
+
+	return recommendations, nil
+}
+
+// matchArea limits candidates to carpools that can score on proximity or school,
+// so the candidate limit is spent on those rather than on the newest carpools
+func (s *MatchingService) matchArea(user *models.User) repository.MatchArea {
+	area := repository.MatchArea{SchoolName: user.SchoolName}
+	radius := s.MaxDistanceKm * 1000
+	if user.HomeLat != nil && user.HomeLng != nil {
+		b := geo.BoundsAround(geo.Point{Lat: *user.HomeLat, Lng: *user.HomeLng}, radius)
+		area.Origin = &b
+	}
+	if user.DestinationLat != nil && user.DestinationLng != nil {
+		b := geo.BoundsAround(geo.Point{Lat: *user.DestinationLat, Lng: *user.DestinationLng}, radius)
+		area.Destination = &b
+	}
+	return area
+}
+
+// Score rates how well a carpool fits a user on a 0-100 scale
+func (s *MatchingService) Score(user *models.User, carpool models.Carpool, mutualMembers int) models.CarpoolRecommendation {
+	components := []models.MatchScoreComponent{
+		s.proximity(user, carpool),
+		s.schedule(user, carpool),
+		preferences(user, carpool),
+		seats(carpool),
+		social(user, carpool, mutualMembers),
+	}
+
+	total := 0.0
+	for _, c := range components {
+		total += c.Score * c.Weight
+	}
+
+	return models.CarpoolRecommendation{
+		Carpool:    carpool,
+		Score:      math.Round(total*1000) / 10,
+		Components: components,
+	}
+}
+
+func (s *MatchingService) proximity(user *models.User, carpool models.Carpool) models.MatchScoreComponent {
+	c := models.MatchScoreComponent{Factor: "proximity", Weight: weightProximity}
+
+	var scores []float64
+	var parts []string
+	if d, ok := distanceKm(user.HomeLat, user.HomeLng, carpool.OriginLat, carpool.OriginLng); ok {
+		scores = append(scores, math.Max(0, 1-d/s.MaxDistanceKm))
+		parts = append(parts, fmt.Sprintf("starts %.1f km from your home", d))
+	}
+	if d, ok := distanceKm(user.DestinationLat, user.DestinationLng, carpool.DestinationLat, carpool.DestinationLng); ok {
+		scores = append(scores, math.Max(0, 1-d/s.MaxDistanceKm))
+		parts = append(parts, fmt.Sprintf("ends %.1f km from your destination", d))
+	}
+
+	if len(scores) == 0 {
+		c.Explanation = "Add home and destination locations to your profile to match on route"
+		return c
+	}
+	c.Score = average(scores)
+	c.Explanation = "Carpool " + strings.Join(parts, " and ")
+	return c
+}
+
+func (s *MatchingService) schedule(user *models.User, carpool models.Carpool) models.MatchScoreComponent {
+	c := models.MatchScoreComponent{Factor: "schedule", Weight: weightSchedule}
+
+	var scores []float64
+	var parts []string
+
+	userDays, carpoolDays := parseDays(user.PreferredDays), parseDays(carpool.ScheduleDays)
+	if len(userDays) > 0 && len(carpoolDays) > 0 {
+		shared := 0
+		for day := range userDays {
+			if carpoolDays[day] {
+				shared++
+			}
+		}
+		scores = append(scores, float64(shared)/float64(len(userDays)))
+		parts = append(parts, fmt.Sprintf("runs on %d of your %d days", shared, len(userDays)))
+	}
+
+	userTime, okUser := parseClock(user.PreferredDepartureTime)
+	carpoolTime, okCarpool := parseClock(carpool.DepartureTime)
+	if okUser && okCarpool {
+		diff := userTime - carpoolTime
+		if diff < 0 {
+			diff = -diff
+		}
+		scores = append(scores, math.Max(0, 1-diff.Minutes()/s.MaxTimeDifference.Minutes()))
+		parts = append(parts, fmt.Sprintf("departs %d minutes from your preferred time", int(diff.Minutes())))
+	}
+
+	if len(scores) == 0 {
+		c.Explanation = "Add preferred days and departure time to your profile to match on schedule"
+		return c
+	}
+	c.Score = average(scores)
+	c.Explanation = "Carpool " + strings.Join(parts, " and ")
+	return c
+}
+
+func preferences(user *models.User, carpool models.Carpool) models.MatchScoreComponent {
+	c := models.MatchScoreComponent{Factor: "preferences", Weight: weightPreferences}
+
+	checks, compatible := 0, 0
+	var conflicts []string
+
+	if user.MusicPreference != "" && carpool.MusicPreference != "" {
+		checks++
+		if strings.EqualFold(user.MusicPreference, carpool.MusicPreference) {
+			compatible++
+		} else {
+			conflicts = append(conflicts, "music")
+		}
+	}
+
+	checks++
+	if !carpool.SmokingAllowed || user.SmokingOK {
+		compatible++
+	} else {
+		conflicts = append(conflicts, "smoking")
+	}
+
+	checks++
+	if !carpool.PetsAllowed || user.PetsOK {
+		compatible++
+	} else {
+		conflicts = append(conflicts, "pets")
+	}
+
+	c.Score = float64(compatible) / float64(checks)
+	if len(conflicts) == 0 {
+		c.Explanation = "All preferences are compatible"
+	} else {
+		c.Explanation = "Preferences differ on " + strings.Join(conflicts, ", ")
+	}
+	return c
+}
+
+func seats(carpool models.Carpool) models.MatchScoreComponent {
+	c := models.MatchScoreComponent{Factor: "seats", Weight: weightSeats}
+	// Two or more open seats scores fully so groups of siblings can join together
+	c.Score = math.Min(1, float64(carpool.AvailableSeats)/2)
+	c.Explanation = fmt.Sprintf("%d seat(s) available", carpool.AvailableSeats)
+	return c
+}
+
+func social(user *models.User, carpool models.Carpool, mutualMembers int) models.MatchScoreComponent {
+	c := models.MatchScoreComponent{Factor: "social", Weight: weightSocial}
+
+	var parts []string
+	if user.SchoolName != "" && strings.EqualFold(user.SchoolName, carpool.SchoolName) {
+		c.Score += 0.5
+		parts = append(parts, "goes to "+carpool.SchoolName)
+	}
+	if mutualMembers > 0 {
+		c.Score += 0.5 * math.Min(1, float64(mutualMembers)/3)
+		parts = append(parts, fmt.Sprintf("includes %d member(s) from your other carpools", mutualMembers))
+	}
+
+	if len(parts) == 0 {
+		c.Explanation = "No shared school or mutual members"
+		return c
+	}
+	c.Explanation = "Carpool " + strings.Join(parts, " and ")
+	return c
+}
+
+func distanceKm(lat1, lng1, lat2, lng2 *float64) (float64, bool) {
+	if lat1 == nil || lng1 == nil || lat2 == nil || lng2 == nil {
+		return 0, false
+	}
+	return geo.DistanceMeters(geo.Point{Lat: *lat1, Lng: *lng1}, geo.Point{Lat: *lat2, Lng: *lng2}) / 1000, true
+}
+
+// parseDays reads a comma separated day list such as "MON,WED,FRI"
+func parseDays(days string) map[string]bool {
+	set := make(map[string]bool)
+	for _, day := range strings.Split(days, ",") {
+		day = strings.ToUpper(strings.TrimSpace(day))
+		if len(day) >= 3 {
+			set[day[:3]] = true
+		}
+	}
+	return set
+}
+
+// parseClock reads an "HH:MM" time of day as an offset from midnight
+func parseClock(value string) (time.Duration, bool) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, true
+}
+
+func average(values []float64) float64 {
+	total := 0.0
+	for _, v := range values {
+		total += v
+	}
+	return total / float64(len(values))
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"car-backend/pkg/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LogChannel writes notifications to the structured log. It stands in for real
+// push, email and SMS providers during development.
+type LogChannel struct {
+	Name string
+}
+
+func (c LogChannel) Send(ctx context.Context, recipient models.NotificationRecipient, notification models.Notification) error {
+	log.Printf("{\"severity\":\"INFO\",\"message\":\"Notification %s via %s to %s: %s\"}",
+		notification.Type, c.Name, recipientLabel(recipient), notification.Title)
+	return nil
+}
+
+// FileChannel appends each notification as a JSON line to a file, so development
+// and tests can inspect exactly what would have been sent.
+type FileChannel struct {
+	Name string
+	path string
+	mu   sync.Mutex
+}
+
+func NewFileChannel(name, path string) *FileChannel {
+	return &FileChannel{Name: name, path: path}
+}
+
+type fileChannelRecord struct {
+	Channel      string                       `json:"channel"`
+	SentAt       time.Time                    `json:"sent_at"`
+	Recipient    models.NotificationRecipient `json:"recipient"`
+	Notification models.Notification          `json:"notification"`
+}
+
+func (c *FileChannel) Send(ctx context.Context, recipient models.NotificationRecipient, notification models.Notification) error {
+	line, err := json.Marshal(fileChannelRecord{
+		Channel:      c.Name,
+		SentAt:       time.Now(),
+		Recipient:    recipient,
+		Notification: notification,
+	})
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f, err := os.OpenFile(c.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open notification file: %w", err)
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+func recipientLabel(recipient models.NotificationRecipient) string {
+	switch {
+	case recipient.UserID != uuid.Nil:
+		return recipient.UserID.String()
+	case recipient.Email != "":
+		return recipient.Email
+	default:
+		return recipient.Phone
+	}
+}
@@ -0,0 +1,448 @@
+package services
+
+import (
+	"car-backend/pkg/models"
+	"car-backend/pkg/repository"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// NotificationChannel delivers notifications over one medium such as push or email
+type NotificationChannel interface {
+	Send(ctx context.Context, recipient models.NotificationRecipient, notification models.Notification) error
+}
+
+// Notifier routes notifications to users over the channels their preferences
+// allow. During quiet hours push and SMS are dropped in favour of the in-app
+// inbox unless the event is urgent.
+// It also implements AlertSink and StopEventSink.
+type Notifier struct {
+	userRepo    *repository.UserRepository
+	carpoolRepo *repository.CarPoolRepository
+	channels    map[string]NotificationChannel
+
+	// Now returns the current time; it is replaceable so quiet hours can be exercised
+	Now func() time.Time
+}
+
+func NewNotifier(userRepo *repository.UserRepository, carpoolRepo *repository.CarPoolRepository) *Notifier {
+	return &Notifier{
+		userRepo:    userRepo,
+		carpoolRepo: carpoolRepo,
+		channels:    make(map[string]NotificationChannel),
+		Now:         time.Now,
+	}
+}
+
+// RegisterChannel sets the channel used for a delivery medium, replacing any previous one
+func (n *Notifier) RegisterChannel(name string, channel NotificationChannel) {
+	n.channels[name] = channel
+}
+
+// Notify delivers the notification to each user. A failure for one user or
+// channel does not stop delivery to the others; all failures are returned together.
+func (n *Notifier) Notify(ctx context.Context, userIDs []uuid.UUID, notification models.Notification) error {
+	var errs []error
+	for _, userID := range userIDs {
+		if err := n.notifyUser(ctx, userID, notification); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// NotifyCarpool delivers the notification to every member of the carpool
+func (n *Notifier) NotifyCarpool(ctx context.Context, carpoolID uuid.UUID, notification models.Notification) error {
+	members, err := n.carpoolRepo.ListMemberIDs(ctx, carpoolID)
+	if err != nil {
+		return err
+	}
+	return n.Notify(ctx, members, notification)
+}
+
+// NotifyAddress delivers a notification to someone without an account over the
+// channels their address supports.
+func (n *Notifier) NotifyAddress(ctx context.Context, recipient models.NotificationRecipient, notification models.Notification) error {
+	var channels []string
+	if recipient.Email != "" {
+		channels = append(channels, models.ChannelEmail)
+	}
+	if recipient.Phone != "" {
+		channels = append(channels, models.ChannelSMS)
+	}
+	return n.deliver(ctx, recipient, channels, notification)
+}
+
+func (n *Notifier) notifyUser(ctx context.Context, userID uuid.UUID, notification models.Notification) error {
+	user, err := n.userRepo.GetByID(ctx, userID.String())
+	if err != nil {
+		return fmt.Errorf("failed to load user %s: %w", userID, err)
+	}
+	settings, err := n.userRepo.GetNotificationSettings(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to load notification settings for %s: %w", userID, err)
+	}
+
+	quiet := !models.UrgentNotifications[notification.Type] && inQuietHours(settings, n.Now())
+
+	var channels []string
+	inApp, silenced := false, false
+	for _, channel := range enabledChannels(settings, notification.Type) {
+		if quiet && (channel == models.ChannelPush || channel == models.ChannelSMS) {
+			silenced = true
+			continue
+		}
+		inApp = inApp || channel == models.ChannelInApp
+		channels = append(channels, channel)
+	}
+	// What quiet hours silenced still lands in the inbox for the morning
+	if silenced && !inApp {
+		channels = append(channels, models.ChannelInApp)
+	}
+
+	recipient := models.NotificationRecipient{
+		UserID: user.ID,
+		Name:   user.DisplayName,
+		Email:  user.Email,
+		Phone:  user.Phone,
+	}
+	if recipient.Name == "" {
+		recipient.Name = user.Name
+	}
+
+	return n.deliver(ctx, recipient, channels, notification)
+}
+
+// deliver sends the notification over each channel. When it follows from an
+// outbox event, channels that already delivered it are skipped on a retry.
+func (n *Notifier) deliver(ctx context.Context, recipient models.NotificationRecipient, channels []string, notification models.Notification) error {
+	who := recipient.UserID.String()
+	if recipient.UserID == uuid.Nil {
+		who = recipient.Email + "|" + recipient.Phone
+	}
+
+	var errs []error
+	for _, name := range channels {
+		channel, ok := n.channels[name]
+		if !ok {
+			continue
+		}
+		err := OncePerEvent(ctx, who+"/"+name, func() error {
+			return channel.Send(ctx, recipient, notification)
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s delivery of %s failed: %w", name, notification.Type, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// enabledChannels applies the user's overrides to the event's default channels
+func enabledChannels(settings *models.NotificationSettings, eventType string) []string {
+	enabled := make(map[string]bool)
+	for _, channel := range models.DefaultNotificationChannels[eventType] {
+		enabled[channel] = true
+	}
+	for channel, on := range settings.Preferences[eventType] {
+		enabled[channel] = on
+	}
+
+	var channels []string
+	for _, channel := range []string{models.ChannelInApp, models.ChannelPush, models.ChannelEmail, models.ChannelSMS} {
+		if enabled[channel] {
+			channels = append(channels, channel)
+		}
+	}
+	return channels
+}
+
+// inQuietHours reports whether now falls inside the user's quiet hours in their timezone
+func inQuietHours(settings *models.NotificationSettings, now time.Time) bool {
+	if settings.QuietHoursStart == "" || settings.QuietHoursEnd == "" {
+		return false
+	}
+
+	start, err := time.Parse("15:04", settings.QuietHoursStart)
+	if err != nil {
+		return false
+	}
+	end, err := time.Parse("15:04", settings.QuietHoursEnd)
+	if err != nil {
+		return false
+	}
+
+	now = now.In(userLocation(settings))
+
+	minute := now.Hour()*60 + now.Minute()
+	from := start.Hour()*60 + start.Minute()
+	to := end.Hour()*60 + end.Minute()
+
+	if from <= to {
+		return minute >= from && minute < to
+	}
+	// The window wraps past midnight, e.g. 21:00 to 07:00
+	return minute >= from || minute < to
+}
+
+func (n *Notifier) SendRideAlert(ctx context.Context, userIDs []uuid.UUID, alert models.RideAlert) error {
+	return n.Notify(ctx, userIDs, models.Notification{
+		Type:  models.NotificationRideAlert,
+		Title: "Ride alert",
+		Body:  alert.Message,
+		Data: map[string]string{
+			"carpool_id":      alert.CarpoolID.String(),
+			"carpool_ride_id": alert.CarpoolRideID.String(),
+			"incident_type":   alert.IncidentType,
+		},
+	})
+}
+
+// SendStopEvent notifies members when the ride is approaching a pickup or has
+// reached the destination. Other stop events are not notified.
+func (n *Notifier) SendStopEvent(ctx context.Context, userIDs []uuid.UUID, event models.StopEvent) error {
+	notification := models.Notification{
+		Data: map[string]string{
+			"carpool_id":      event.CarpoolID.String(),
+			"carpool_ride_id": event.CarpoolRideID.String(),
+			"carpool_stop_id": event.CarpoolStopID.String(),
+		},
+	}
+
+	switch {
+	case event.EventType == models.StopEventArrived && event.StopType == models.StopTypeDestination:
+		notification.Type = models.NotificationChildDroppedOff
+		notification.Title = "Dropped off"
+		notification.Body = "The ride has arrived at its destination"
+	case event.EventType == models.StopEventArriving && event.StopType == models.StopTypeIntermediate:
+		notification.Type = models.NotificationRideArriving
+		notification.Title = "Driver arriving"
+		notification.Body = "The driver is almost at the pickup"
+	default:
+		return nil
+	}
+
+	return n.Notify(ctx, userIDs, notification)
+}
+
+// onInviteReminder tells the recipient their invite is about to expire
+func (n *Notifier) onInviteReminder(ctx context.Context, event models.OutboxEvent) error {
+	var payload models.InviteEvent
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		return err
+	}
+	invite := payload.Invite
+
+	notification := models.Notification{
+		Type:  models.NotificationInviteExpiring,
+		Title: "Your carpool invite expires soon",
+		Body:  fmt.Sprintf("Your invite expires on %s", invite.ExpiresAt.Format("Jan 2 at 15:04 MST")),
+		Data: map[string]string{
+			"invite_id":  invite.ID.String(),
+			"carpool_id": invite.CarpoolID.String(),
+		},
+	}
+
+	if invite.ToUser != nil {
+		return n.Notify(ctx, []uuid.UUID{*invite.ToUser}, notification)
+	}
+	return n.NotifyAddress(ctx, models.NotificationRecipient{Email: invite.ToEmail, Phone: invite.ToPhone}, notification)
+}
+
+// SubscribeOutbox registers the notifications that follow from domain events, so
+// they are sent even when the server stops right after the change commits
+func (n *Notifier) SubscribeOutbox(d *OutboxDispatcher) {
+	d.Subscribe(models.EventInviteCreated, "notifier", n.onInviteCreated)
+	d.Subscribe(models.EventInviteAccepted, "notifier", n.onInviteAccepted)
+	d.Subscribe(models.EventInviteReminder, "notifier", n.onInviteReminder)
+	d.Subscribe(models.EventRideStarted, "notifier", n.onRideStarted)
+	d.Subscribe(models.EventRideReminder, "notifier", n.onRideReminder)
+	d.Subscribe(models.EventRideCancelled, "notifier", n.onRideCancelled)
+	d.Subscribe(models.EventWaitlistPromoted, "notifier", n.onWaitlistPromoted)
+}
+
+func (n *Notifier) onInviteCreated(ctx context.Context, event models.OutboxEvent) error {
+	var payload models.InviteEvent
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		return err
+	}
+	invite := payload.Invite
+
+	notification := models.Notification{
+		Type:  models.NotificationInviteReceived,
+		Title: "You've been invited to a carpool",
+		Body:  invite.Message,
+		Data: map[string]string{
+			"invite_id":  invite.ID.String(),
+			"carpool_id": invite.CarpoolID.String(),
+		},
+	}
+
+	if invite.ToUser != nil {
+		return n.Notify(ctx, []uuid.UUID{*invite.ToUser}, notification)
+	}
+	return n.NotifyAddress(ctx, models.NotificationRecipient{Email: invite.ToEmail, Phone: invite.ToPhone}, notification)
+}
+
+func (n *Notifier) onInviteAccepted(ctx context.Context, event models.OutboxEvent) error {
+	var payload models.InviteEvent
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		return err
+	}
+	invite := payload.Invite
+
+	data := map[string]string{
+		"invite_id":  invite.ID.String(),
+		"carpool_id": invite.CarpoolID.String(),
+	}
+	if invite.ToUser != nil {
+		data["user_id"] = invite.ToUser.String()
+	}
+
+	return n.Notify(ctx, []uuid.UUID{invite.FromUser}, models.Notification{
+		Type:  models.NotificationInviteAccepted,
+		Title: "Your carpool invite was accepted",
+		Data:  data,
+	})
+}
+
+// onWaitlistPromoted tells a waitlisted requester a seat freed up and they are in
+func (n *Notifier) onWaitlistPromoted(ctx context.Context, event models.OutboxEvent) error {
+	var payload models.MembershipEvent
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		return err
+	}
+
+	return n.Notify(ctx, []uuid.UUID{payload.UserID}, models.Notification{
+		Type:  models.NotificationJoinedCarpool,
+		Title: "A seat opened up",
+		Body:  "You've been moved off the waitlist and into the carpool",
+		Data: map[string]string{
+			"carpool_id":      payload.CarpoolID.String(),
+			"join_request_id": event.AggregateID.String(),
+		},
+	})
+}
+
+func (n *Notifier) onRideStarted(ctx context.Context, event models.OutboxEvent) error {
+	var payload models.RideEvent
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		return err
+	}
+
+	return n.NotifyCarpool(ctx, payload.CarpoolID, models.Notification{
+		Type:  models.NotificationRideStarted,
+		Title: "Ride started",
+		Body:  "The driver is on the way",
+		Data: map[string]string{
+			"carpool_id":      payload.CarpoolID.String(),
+			"carpool_ride_id": payload.RideID.String(),
+		},
+	})
+}
+
+// onRideReminder reminds the driver or the riders of an upcoming ride, with the
+// start time in each recipient's own timezone
+func (n *Notifier) onRideReminder(ctx context.Context, event models.OutboxEvent) error {
+	var payload models.RideReminderEvent
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		return err
+	}
+
+	recipients := []uuid.UUID{payload.DriverID}
+	title := "You're driving soon"
+	if payload.Kind == models.RideReminderRiders {
+		members, err := n.carpoolRepo.ListMemberIDs(ctx, payload.CarpoolID)
+		if err != nil {
+			return err
+		}
+		recipients = recipients[:0]
+		for _, member := range members {
+			if member != payload.DriverID {
+				recipients = append(recipients, member)
+			}
+		}
+		title = "Your carpool leaves soon"
+	}
+
+	var errs []error
+	for _, userID := range recipients {
+		settings, err := n.userRepo.GetNotificationSettings(ctx, userID)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		departure := payload.ScheduledAt.In(userLocation(settings))
+
+		err = n.notifyUser(ctx, userID, models.Notification{
+			Type:  models.NotificationRideReminder,
+			Title: title,
+			Body:  fmt.Sprintf("Departure is scheduled for %s", departure.Format("Mon Jan 2 at 15:04 MST")),
+			Data: map[string]string{
+				"carpool_id":      payload.CarpoolID.String(),
+				"carpool_ride_id": payload.RideID.String(),
+			},
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// onRideCancelled tells the carpool a ride is off, with its date in each
+// member's own timezone
+func (n *Notifier) onRideCancelled(ctx context.Context, event models.OutboxEvent) error {
+	var payload models.RideEvent
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		return err
+	}
+
+	members, err := n.carpoolRepo.ListMemberIDs(ctx, payload.CarpoolID)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, userID := range members {
+		body := "A ride has been cancelled"
+		if payload.ScheduledAt != nil {
+			settings, err := n.userRepo.GetNotificationSettings(ctx, userID)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			body = fmt.Sprintf("The ride on %s has been cancelled", payload.ScheduledAt.In(userLocation(settings)).Format("Mon Jan 2"))
+		}
+		if payload.Reason != "" {
+			body += ": " + payload.Reason
+		}
+
+		err := n.notifyUser(ctx, userID, models.Notification{
+			Type:  models.NotificationScheduleChanged,
+			Title: "Ride cancelled",
+			Body:  body,
+			Data: map[string]string{
+				"carpool_id":      payload.CarpoolID.String(),
+				"carpool_ride_id": payload.RideID.String(),
+			},
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// userLocation is the timezone from the user's settings, or UTC when it is not a known zone
+func userLocation(settings *models.NotificationSettings) *time.Location {
+	loc, err := time.LoadLocation(settings.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
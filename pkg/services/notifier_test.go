@@ -0,0 +1,55 @@
+package services
+
+import (
+	"car-backend/pkg/models"
+	"testing"
+	"time"
+)
+
+func TestInQuietHours(t *testing.T) {
+	if _, err := time.LoadLocation("America/Los_Angeles"); err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+	// 2026-10-19 is during daylight saving time, when Los Angeles is UTC-7
+	at := func(hour, minute int) time.Time {
+		return time.Date(2026, 10, 19, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name     string
+		start    string
+		end      string
+		timezone string
+		now      time.Time
+		want     bool
+	}{
+		{"no quiet hours", "", "", "UTC", at(3, 0), false},
+		{"only a start", "22:00", "", "UTC", at(23, 0), false},
+		{"invalid start", "10pm", "07:00", "UTC", at(23, 0), false},
+		{"inside a daytime window", "12:00", "14:00", "UTC", at(13, 0), true},
+		{"before a daytime window", "12:00", "14:00", "UTC", at(11, 59), false},
+		{"start is inclusive", "12:00", "14:00", "UTC", at(12, 0), true},
+		{"end is exclusive", "12:00", "14:00", "UTC", at(14, 0), false},
+		{"overnight window before midnight", "21:00", "07:00", "UTC", at(22, 30), true},
+		{"overnight window after midnight", "21:00", "07:00", "UTC", at(6, 59), true},
+		{"outside an overnight window", "21:00", "07:00", "UTC", at(12, 0), false},
+		{"overnight window ends at its end time", "21:00", "07:00", "UTC", at(7, 0), false},
+		{"evaluated in the user's timezone", "21:00", "07:00", "America/Los_Angeles", at(5, 0), true},
+		{"daytime in UTC is night for the user", "21:00", "07:00", "America/Los_Angeles", at(13, 0), true},
+		{"night in UTC is daytime for the user", "21:00", "07:00", "America/Los_Angeles", at(22, 0), false},
+		{"unknown timezone falls back to UTC", "21:00", "07:00", "Mars/Olympus", at(22, 0), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := &models.NotificationSettings{
+				QuietHoursStart: tt.start,
+				QuietHoursEnd:   tt.end,
+				Timezone:        tt.timezone,
+			}
+			if got := inQuietHours(settings, tt.now); got != tt.want {
+				t.Errorf("inQuietHours(%s-%s %s, %s) = %v, want %v", tt.start, tt.end, tt.timezone, tt.now.Format(time.RFC3339), got, tt.want)
+			}
+		})
+	}
+}
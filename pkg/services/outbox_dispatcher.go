@@ -0,0 +1,195 @@
+package services
+
+import (
+	"car-backend/pkg/models"
+	"car-backend/pkg/repository"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OutboxHandler handles one domain event. Events are delivered at least once, so
+// handlers must tolerate seeing the same event again after a failure or crash.
+type OutboxHandler func(ctx context.Context, event models.OutboxEvent) error
+
+// OutboxDispatcher delivers outbox events to in-process subscribers. Each
+// subscriber's success is recorded, so when one fails only the subscribers that
+// have not handled the event yet see it again. An event is settled once every
+// subscriber handled it; until then it is retried with exponential backoff and
+// dead-lettered after MaxAttempts.
+type OutboxDispatcher struct {
+	outboxRepo  *repository.OutboxRepository
+	subscribers map[string][]outboxSubscriber
+
+	// Interval is how often the outbox is polled when it is idle
+	Interval time.Duration
+	// BatchSize is how many events are claimed per poll
+	BatchSize int
+	// MaxAttempts is how many deliveries are tried before an event is dead-lettered
+	MaxAttempts int
+	// RetryBackoff is the wait after the first failure; it doubles on each further failure
+	RetryBackoff time.Duration
+	// MaxRetryBackoff caps the wait between attempts
+	MaxRetryBackoff time.Duration
+	// Lease is how long a claimed event is hidden from other dispatchers
+	Lease time.Duration
+}
+
+func NewOutboxDispatcher(outboxRepo *repository.OutboxRepository) *OutboxDispatcher {
+	return &OutboxDispatcher{
+		outboxRepo:      outboxRepo,
+		subscribers:     make(map[string][]outboxSubscriber),
+		Interval:        2 * time.Second,
+		BatchSize:       50,
+		MaxAttempts:     10,
+		RetryBackoff:    10 * time.Second,
+		MaxRetryBackoff: time.Hour,
+		Lease:           5 * time.Minute,
+	}
+}
+
+type outboxSubscriber struct {
+	name    string
+	handler OutboxHandler
+}
+
+// Subscribe adds a handler for an event type under a name that identifies its
+// deliveries, so the name must stay stable across releases and be unique per
+// event type. Subscribe before calling Run.
+func (d *OutboxDispatcher) Subscribe(eventType, name string, handler OutboxHandler) {
+	d.subscribers[eventType] = append(d.subscribers[eventType], outboxSubscriber{name: name, handler: handler})
+}
+
+// Run dispatches events until the context is cancelled. A full batch is followed
+// straight away by the next one so a backlog drains without waiting on the ticker.
+func (d *OutboxDispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := d.Dispatch(ctx)
+		if err != nil {
+			log.Printf("{\"severity\":\"ERROR\",\"message\":\"Outbox dispatch failed: %v\"}", err)
+		}
+		if err == nil && n == d.BatchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Dispatch delivers one batch of due events and returns how many were claimed
+func (d *OutboxDispatcher) Dispatch(ctx context.Context) (int, error) {
+	events, err := d.outboxRepo.ClaimEvents(ctx, d.BatchSize, d.Lease)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, event := range events {
+		if err := d.settle(ctx, event, d.deliver(ctx, event)); err != nil {
+			log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to settle outbox event %s: %v\"}", event.ID, err)
+		}
+	}
+
+	return len(events), nil
+}
+
+// deliver runs the subscribers of the event that have not handled it yet,
+// recording each success and collecting the failures
+func (d *OutboxDispatcher) deliver(ctx context.Context, event models.OutboxEvent) error {
+	done, err := d.outboxRepo.ListDeliveries(ctx, event.ID)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, sub := range d.subscribers[event.EventType] {
+		if done[sub.name] {
+			continue
+		}
+
+		delivery := &outboxDelivery{repo: d.outboxRepo, eventID: event.ID, prefix: sub.name + "/", done: done}
+		if err := safeHandle(context.WithValue(ctx, outboxDeliveryKey{}, delivery), sub.handler, event); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", sub.name, err))
+			continue
+		}
+		if err := d.outboxRepo.RecordDelivery(ctx, event.ID, sub.name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+type outboxDeliveryKey struct{}
+
+// outboxDelivery is the subscriber delivery in progress, carried in the context
+// passed to the subscriber
+type outboxDelivery struct {
+	repo    *repository.OutboxRepository
+	eventID uuid.UUID
+	prefix  string
+	done    map[string]bool
+}
+
+// OncePerEvent runs a step of a subscriber's work unless it already succeeded
+// for the outbox event being delivered. Subscribers with side effects that
+// cannot be repeated safely, such as sending a message, wrap each one so a retry
+// after a later step failed does not repeat the earlier ones. Outside outbox
+// delivery it just runs fn.
+func OncePerEvent(ctx context.Context, step string, fn func() error) error {
+	delivery, ok := ctx.Value(outboxDeliveryKey{}).(*outboxDelivery)
+	if !ok {
+		return fn()
+	}
+
+	key := delivery.prefix + step
+	if delivery.done[key] {
+		return nil
+	}
+	if err := fn(); err != nil {
+		return err
+	}
+	delivery.done[key] = true
+	return delivery.repo.RecordDelivery(ctx, delivery.eventID, key)
+}
+
+// settle records the outcome of a delivery attempt
+func (d *OutboxDispatcher) settle(ctx context.Context, event models.OutboxEvent, deliveryErr error) error {
+	if deliveryErr == nil {
+		return d.outboxRepo.MarkDelivered(ctx, event.ID)
+	}
+
+	if event.Attempts >= d.MaxAttempts {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Dead-lettering %s event %s after %d attempts: %v\"}",
+			event.EventType, event.ID, event.Attempts, deliveryErr)
+		return d.outboxRepo.DeadLetter(ctx, event.ID, deliveryErr.Error())
+	}
+
+	backoff := d.RetryBackoff << (event.Attempts - 1)
+	if backoff <= 0 || backoff > d.MaxRetryBackoff {
+		backoff = d.MaxRetryBackoff
+	}
+	log.Printf("{\"severity\":\"WARNING\",\"message\":\"Delivery of %s event %s failed (attempt %d), retrying in %s: %v\"}",
+		event.EventType, event.ID, event.Attempts, backoff, deliveryErr)
+	return d.outboxRepo.MarkFailed(ctx, event.ID, deliveryErr.Error(), time.Now().Add(backoff))
+}
+
+// safeHandle turns a panicking subscriber into a failed delivery instead of
+// taking the dispatcher down
+func safeHandle(ctx context.Context, handler OutboxHandler, event models.OutboxEvent) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("subscriber panicked: %v", r)
+		}
+	}()
+	return handler(ctx, event)
+}
@@ -0,0 +1,237 @@
+package services
+
+import (
+	"bytes"
+	"car-backend/pkg/models"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrInvalidPaymentWebhook = errors.New("invalid payment webhook")
+
+// PaymentProvider creates payment intents with a payment service and reads the
+// webhooks it sends as intents change status
+type PaymentProvider interface {
+	// Name identifies the provider in stored payments and webhook routes
+	Name() string
+	// CreatePaymentIntent asks the provider to collect a payment. Calls with the
+	// same IdempotencyKey return the same intent.
+	CreatePaymentIntent(ctx context.Context, params PaymentIntentParams) (*PaymentIntent, error)
+	// ParseWebhook verifies a webhook's signature and returns the event it carries
+	ParseWebhook(header http.Header, body []byte) (*PaymentWebhookEvent, error)
+}
+
+type PaymentIntentParams struct {
+	AmountMinor    int64
+	Currency       string
+	Description    string
+	IdempotencyKey string
+}
+
+// PaymentIntent is the provider's handle on a payment. The client secret lets
+// the app confirm it with the provider's SDK.
+type PaymentIntent struct {
+	ID           string
+	ClientSecret string
+}
+
+// PaymentWebhookEvent reports an intent's new status, one of the models.PaymentStatus values
+type PaymentWebhookEvent struct {
+	ID            string
+	IntentID      string
+	Status        string
+	FailureReason string
+}
+
+// fakeWebhookTolerance is how far a fake webhook's timestamp may drift from our clock
+const fakeWebhookTolerance = 5 * time.Minute
+
+// FakePaymentProvider stands in for a real payment service in local development
+// and integration tests. Intents live in memory. Webhooks are signed with
+// HMAC-SHA256 over "<unix time>.<body>" in a Fake-Signature header, the way
+// real providers sign theirs.
+type FakePaymentProvider struct {
+	secret []byte
+	client *http.Client
+
+	// WebhookURL, when set, is sent a signed succeeded event for each new
+	// intent after ConfirmDelay, as if the payer confirmed it in the app
+	WebhookURL   string
+	ConfirmDelay time.Duration
+
+	mu      sync.Mutex
+	intents map[string]*PaymentIntent
+}
+
+func NewFakePaymentProvider(secret string) *FakePaymentProvider {
+	return &FakePaymentProvider{
+		secret:       []byte(secret),
+		client:       &http.Client{Timeout: 10 * time.Second},
+		ConfirmDelay: 2 * time.Second,
+		intents:      map[string]*PaymentIntent{},
+	}
+}
+
+func (p *FakePaymentProvider) Name() string {
+	return "fake"
+}
+
+func (p *FakePaymentProvider) CreatePaymentIntent(ctx context.Context, params PaymentIntentParams) (*PaymentIntent, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if intent, ok := p.intents[params.IdempotencyKey]; ok {
+		return intent, nil
+	}
+
+	id, err := randomHex(12)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	intent := &PaymentIntent{ID: "pi_fake_" + id, ClientSecret: "pi_fake_" + id + "_secret_" + secret}
+	p.intents[params.IdempotencyKey] = intent
+
+	if p.WebhookURL != "" {
+		go p.confirm(intent.ID)
+	}
+
+	return intent, nil
+}
+
+// confirm delivers the succeeded event for an intent to WebhookURL
+func (p *FakePaymentProvider) confirm(intentID string) {
+	time.Sleep(p.ConfirmDelay)
+
+	eventID, err := randomHex(12)
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Fake payment provider failed to create event: %v\"}", err)
+		return
+	}
+	header, body, err := p.SignedWebhook(PaymentWebhookEvent{
+		ID:       "evt_fake_" + eventID,
+		IntentID: intentID,
+		Status:   models.PaymentStatusSucceeded,
+	}, time.Now())
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Fake payment provider failed to sign webhook: %v\"}", err)
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodPost, p.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Fake payment provider failed to build webhook: %v\"}", err)
+		return
+	}
+	req.Header = header
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Fake payment provider failed to deliver webhook: %v\"}", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("{\"severity\":\"WARNING\",\"message\":\"Fake payment webhook for %s returned %d\"}", intentID, resp.StatusCode)
+	}
+}
+
+// fakeWebhookBody is the JSON the fake provider sends
+type fakeWebhookBody struct {
+	ID            string `json:"id"`
+	IntentID      string `json:"intent_id"`
+	Status        string `json:"status"`
+	FailureReason string `json:"failure_reason,omitempty"`
+}
+
+// SignedWebhook builds the request headers and body the fake provider would
+// send for event, so tests can drive the webhook endpoint directly
+func (p *FakePaymentProvider) SignedWebhook(event PaymentWebhookEvent, now time.Time) (http.Header, []byte, error) {
+	body, err := json.Marshal(fakeWebhookBody{
+		ID:            event.ID,
+		IntentID:      event.IntentID,
+		Status:        event.Status,
+		FailureReason: event.FailureReason,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set("Fake-Signature", fmt.Sprintf("t=%s,v1=%s", timestamp, p.signature(timestamp, body)))
+	return header, body, nil
+}
+
+func (p *FakePaymentProvider) ParseWebhook(header http.Header, body []byte) (*PaymentWebhookEvent, error) {
+	var timestamp, signature string
+	for _, part := range strings.Split(header.Get("Fake-Signature"), ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signature = value
+		}
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidPaymentWebhook
+	}
+	if drift := time.Since(time.Unix(seconds, 0)); drift > fakeWebhookTolerance || drift < -fakeWebhookTolerance {
+		return nil, ErrInvalidPaymentWebhook
+	}
+	if !hmac.Equal([]byte(signature), []byte(p.signature(timestamp, body))) {
+		return nil, ErrInvalidPaymentWebhook
+	}
+
+	var data fakeWebhookBody
+	if err := json.Unmarshal(body, &data); err != nil || data.ID == "" || data.IntentID == "" {
+		return nil, ErrInvalidPaymentWebhook
+	}
+	switch data.Status {
+	case models.PaymentStatusPending, models.PaymentStatusSucceeded, models.PaymentStatusFailed, models.PaymentStatusCanceled:
+	default:
+		return nil, ErrInvalidPaymentWebhook
+	}
+
+	return &PaymentWebhookEvent{
+		ID:            data.ID,
+		IntentID:      data.IntentID,
+		Status:        data.Status,
+		FailureReason: data.FailureReason,
+	}, nil
+}
+
+func (p *FakePaymentProvider) signature(timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func randomHex(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
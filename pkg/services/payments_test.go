@@ -0,0 +1,115 @@
+package services
+
+import (
+	"car-backend/pkg/models"
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFakePaymentProviderParseWebhook(t *testing.T) {
+	succeeded := PaymentWebhookEvent{ID: "evt_1", IntentID: "pi_1", Status: models.PaymentStatusSucceeded}
+	failed := PaymentWebhookEvent{ID: "evt_2", IntentID: "pi_1", Status: models.PaymentStatusFailed, FailureReason: "card declined"}
+
+	tests := []struct {
+		name     string
+		event    PaymentWebhookEvent
+		signer   string
+		signedAt time.Duration
+		tamper   func(header http.Header, body []byte) (http.Header, []byte)
+		wantErr  bool
+	}{
+		{name: "fresh signature", event: succeeded},
+		{name: "failure reason carried through", event: failed},
+		{name: "within tolerance in the past", event: succeeded, signedAt: -fakeWebhookTolerance + time.Minute},
+		{name: "within tolerance in the future", event: succeeded, signedAt: fakeWebhookTolerance - time.Minute},
+		{name: "too old", event: succeeded, signedAt: -fakeWebhookTolerance - time.Minute, wantErr: true},
+		{name: "too far in the future", event: succeeded, signedAt: fakeWebhookTolerance + time.Minute, wantErr: true},
+		{name: "signed with another secret", event: succeeded, signer: "other", wantErr: true},
+		{
+			name:  "body changed after signing",
+			event: succeeded,
+			tamper: func(header http.Header, body []byte) (http.Header, []byte) {
+				return header, []byte(`{"id":"evt_1","intent_id":"pi_2","status":"SUCCEEDED"}`)
+			},
+			wantErr: true,
+		},
+		{
+			name:  "missing signature header",
+			event: succeeded,
+			tamper: func(header http.Header, body []byte) (http.Header, []byte) {
+				header.Del("Fake-Signature")
+				return header, body
+			},
+			wantErr: true,
+		},
+		{
+			name:  "timestamp is not a number",
+			event: succeeded,
+			tamper: func(header http.Header, body []byte) (http.Header, []byte) {
+				header.Set("Fake-Signature", "t=soon,v1=00")
+				return header, body
+			},
+			wantErr: true,
+		},
+		{name: "unknown status", event: PaymentWebhookEvent{ID: "evt_3", IntentID: "pi_1", Status: "REFUNDED"}, wantErr: true},
+		{name: "missing intent", event: PaymentWebhookEvent{ID: "evt_4", Status: models.PaymentStatusSucceeded}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer := tt.signer
+			if signer == "" {
+				signer = "secret"
+			}
+			header, body, err := NewFakePaymentProvider(signer).SignedWebhook(tt.event, time.Now().Add(tt.signedAt))
+			if err != nil {
+				t.Fatalf("SignedWebhook() error = %v", err)
+			}
+			if tt.tamper != nil {
+				header, body = tt.tamper(header, body)
+			}
+
+			got, err := NewFakePaymentProvider("secret").ParseWebhook(header, body)
+			if tt.wantErr {
+				if err != ErrInvalidPaymentWebhook {
+					t.Fatalf("ParseWebhook() error = %v, want %v", err, ErrInvalidPaymentWebhook)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseWebhook() error = %v", err)
+			}
+			if !reflect.DeepEqual(*got, tt.event) {
+				t.Errorf("ParseWebhook() = %+v, want %+v", *got, tt.event)
+			}
+		})
+	}
+}
+
+func TestFakePaymentProviderIdempotentIntents(t *testing.T) {
+	provider := NewFakePaymentProvider("secret")
+	ctx := context.Background()
+
+	first, err := provider.CreatePaymentIntent(ctx, PaymentIntentParams{AmountMinor: 500, Currency: "USD", IdempotencyKey: "a"})
+	if err != nil {
+		t.Fatalf("CreatePaymentIntent() error = %v", err)
+	}
+	again, err := provider.CreatePaymentIntent(ctx, PaymentIntentParams{AmountMinor: 500, Currency: "USD", IdempotencyKey: "a"})
+	if err != nil {
+		t.Fatalf("CreatePaymentIntent() error = %v", err)
+	}
+	other, err := provider.CreatePaymentIntent(ctx, PaymentIntentParams{AmountMinor: 500, Currency: "USD", IdempotencyKey: "b"})
+	if err != nil {
+		t.Fatalf("CreatePaymentIntent() error = %v", err)
+	}
+
+	if again.ID != first.ID {
+		t.Errorf("same idempotency key gave intent %s, want %s", again.ID, first.ID)
+	}
+	if other.ID == first.ID {
+		t.Errorf("different idempotency keys gave the same intent %s", first.ID)
+	}
+}
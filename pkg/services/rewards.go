@@ -0,0 +1,271 @@
+package services
+
+import (
+	"car-backend/pkg/models"
+	"car-backend/pkg/repository"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PointRule awards Points for every completed ride it matches
+type PointRule struct {
+	Reason  string
+	Points  int
+	Matches func(ride repository.RewardRide) bool
+}
+
+// BadgeRule awards Badge once Metric reaches Threshold
+type BadgeRule struct {
+	Badge     models.Badge
+	Metric    func(stats repository.RewardStats) int
+	Threshold int
+}
+
+// DefaultPointRules reward every ride, taking a driving turn and being on time
+var DefaultPointRules = []PointRule{
+	{Reason: models.RewardReasonRideCompleted, Points: 10, Matches: func(repository.RewardRide) bool { return true }},
+	{Reason: models.RewardReasonDrivingTurn, Points: 15, Matches: func(ride repository.RewardRide) bool { return ride.Role == models.RideRoleDriver }},
+	{Reason: models.RewardReasonOnTime, Points: 5, Matches: func(ride repository.RewardRide) bool { return ride.OnTime }},
+}
+
+var DefaultBadgeRules = []BadgeRule{
+	{
+		Badge:     models.Badge{Code: "FIRST_RIDE", Name: "First ride", Description: "Completed a first carpool ride"},
+		Metric:    func(s repository.RewardStats) int { return s.RidesCompleted },
+		Threshold: 1,
+	},
+	{
+		Badge:     models.Badge{Code: "RIDES_DRIVEN_10", Name: "10 rides driven", Description: "Drove 10 carpool rides"},
+		Metric:    func(s repository.RewardStats) int { return s.RidesDriven },
+		Threshold: 10,
+	},
+	{
+		Badge:     models.Badge{Code: "RIDES_DRIVEN_50", Name: "50 rides driven", Description: "Drove 50 carpool rides"},
+		Metric:    func(s repository.RewardStats) int { return s.RidesDriven },
+		Threshold: 50,
+	},
+	{
+		Badge:     models.Badge{Code: "RIDES_100", Name: "100 rides", Description: "Completed 100 carpool rides"},
+		Metric:    func(s repository.RewardStats) int { return s.RidesCompleted },
+		Threshold: 100,
+	},
+	{
+		Badge:     models.Badge{Code: "ON_TIME_STREAK_10", Name: "Always on time", Description: "10 rides in a row without being late"},
+		Metric:    func(s repository.RewardStats) int { return s.BestStreak },
+		Threshold: 10,
+	},
+	{
+		Badge:     models.Badge{Code: "PERFECT_WEEK", Name: "Perfect week", Description: "A full week of rides, all on time"},
+		Metric:    func(s repository.RewardStats) int { return s.PerfectWeeks },
+		Threshold: 1,
+	},
+}
+
+// RewardsEngine awards points, badges and on-time streaks as rides complete.
+// A completion earns points for that ride alone, then the participants' totals
+// and streaks are recomputed in one query. Perfect weeks are awarded by Run
+// once the week is over. Points are keyed by what earned them and badges are
+// awarded once, so replayed events award nothing new.
+type RewardsEngine struct {
+	rewardsRepo *repository.RewardsRepository
+	rideRepo    *repository.CarPoolRideRepository
+
+	PointRules []PointRule
+	BadgeRules []BadgeRule
+	// PerfectWeekRides is how many rides, all on time, make a week perfect. Weeks
+	// run Monday to Sunday in the user's timezone and count once they are over.
+	PerfectWeekRides  int
+	PerfectWeekPoints int
+	// PerfectWeekLookback is how far back Run looks for finished weeks, so a
+	// missed run is caught up on the next one
+	PerfectWeekLookback time.Duration
+	// Interval is how often finished weeks are checked
+	Interval time.Duration
+}
+
+func NewRewardsEngine(rewardsRepo *repository.RewardsRepository, rideRepo *repository.CarPoolRideRepository) *RewardsEngine {
+	return &RewardsEngine{
+		rewardsRepo:         rewardsRepo,
+		rideRepo:            rideRepo,
+		PointRules:          DefaultPointRules,
+		BadgeRules:          DefaultBadgeRules,
+		PerfectWeekRides:    5,
+		PerfectWeekPoints:   50,
+		PerfectWeekLookback: 15 * 24 * time.Hour,
+		Interval:            time.Hour,
+	}
+}
+
+// SubscribeOutbox registers the events that earn rewards
+func (e *RewardsEngine) SubscribeOutbox(d *OutboxDispatcher) {
+	d.Subscribe(models.EventRideCompleted, "rewards", e.onRideCompleted)
+}
+
+func (e *RewardsEngine) onRideCompleted(ctx context.Context, event models.OutboxEvent) error {
+	var payload models.RideEvent
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		return err
+	}
+
+	ride, err := e.rideRepo.GetCarpoolRide(ctx, payload.RideID)
+	if err != nil {
+		return err
+	}
+	if ride == nil {
+		return nil
+	}
+
+	for userID := range ride.Participants() {
+		if err := e.Evaluate(ctx, userID, payload.RideID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Evaluate awards the user's points for a completed ride and brings their
+// streaks and badges up to date
+func (e *RewardsEngine) Evaluate(ctx context.Context, userID, rideID uuid.UUID) error {
+	ride, err := e.rewardsRepo.GetRewardRide(ctx, userID, rideID)
+	if err != nil {
+		return err
+	}
+	if ride == nil {
+		return nil
+	}
+
+	for _, rule := range e.PointRules {
+		if !rule.Matches(*ride) {
+			continue
+		}
+		source := fmt.Sprintf("%s:%s", rule.Reason, ride.RideID)
+		if _, err := e.rewardsRepo.AwardPoints(ctx, userID, &ride.CarpoolID, source, rule.Reason, rule.Points, ride.OccurredAt); err != nil {
+			return err
+		}
+	}
+
+	return e.refresh(ctx, userID)
+}
+
+// refresh recomputes the user's streaks and awards any badges they now qualify for
+func (e *RewardsEngine) refresh(ctx context.Context, userID uuid.UUID) error {
+	stats, err := e.rewardsRepo.GetRewardStats(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := e.rewardsRepo.SetStreaks(ctx, userID, stats.CurrentStreak, stats.BestStreak); err != nil {
+		return err
+	}
+
+	for _, rule := range e.BadgeRules {
+		if rule.Metric(*stats) < rule.Threshold {
+			continue
+		}
+		awarded, err := e.rewardsRepo.AwardBadge(ctx, userID, rule.Badge.Code)
+		if err != nil {
+			return err
+		}
+		if awarded {
+			log.Printf("{\"severity\":\"INFO\",\"message\":\"User %s earned badge %s\"}", userID, rule.Badge.Code)
+		}
+	}
+
+	return nil
+}
+
+// Run awards perfect weeks every Interval until the context is cancelled
+func (e *RewardsEngine) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := e.AwardPerfectWeeks(ctx, time.Now()); err != nil {
+			log.Printf("{\"severity\":\"ERROR\",\"message\":\"Perfect week awards failed: %v\"}", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// AwardPerfectWeeks awards points for every perfect week that ended within
+// PerfectWeekLookback of now. Weeks already awarded are skipped.
+func (e *RewardsEngine) AwardPerfectWeeks(ctx context.Context, now time.Time) error {
+	weeks, err := e.rewardsRepo.ListPerfectWeeks(ctx, now.Add(-e.PerfectWeekLookback), now, e.PerfectWeekRides)
+	if err != nil {
+		return err
+	}
+
+	for _, week := range weeks {
+		source := fmt.Sprintf("%s:%s", models.RewardReasonPerfectWeek, week.Start.Format("2006-01-02"))
+		awarded, err := e.rewardsRepo.AwardPoints(ctx, week.UserID, nil, source, models.RewardReasonPerfectWeek, e.PerfectWeekPoints, week.End)
+		if err != nil {
+			return err
+		}
+		if !awarded {
+			continue
+		}
+		if err := e.refresh(ctx, week.UserID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// weekStart returns midnight on the Monday starting t's week, in t's location
+func weekStart(t time.Time) time.Time {
+	offset := (int(t.Weekday()) + 6) % 7
+	return time.Date(t.Year(), t.Month(), t.Day()-offset, 0, 0, 0, 0, t.Location())
+}
+
+// Profile returns the user's points, streaks and badges with their names
+func (e *RewardsEngine) Profile(ctx context.Context, userID uuid.UUID) (*models.RewardProfile, error) {
+	profile, err := e.rewardsRepo.GetProfile(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	badges := make(map[string]models.Badge, len(e.BadgeRules))
+	for _, rule := range e.BadgeRules {
+		badges[rule.Badge.Code] = rule.Badge
+	}
+	for i, badge := range profile.Badges {
+		if known, ok := badges[badge.Code]; ok {
+			profile.Badges[i].Badge = known
+		} else {
+			// Retired rules keep their badges
+			profile.Badges[i].Name = badge.Code
+		}
+	}
+	return profile, nil
+}
+
+// Leaderboard ranks users by points earned in the carpool or the school's
+// carpools visible to the viewer during the current week or month in loc, or ever
+func (e *RewardsEngine) Leaderboard(ctx context.Context, carpoolID *uuid.UUID, school *string, viewerID uuid.UUID, period string, loc *time.Location, limit int) (*models.LeaderboardResponse, error) {
+	var since *time.Time
+	now := time.Now().In(loc)
+	switch period {
+	case models.LeaderboardPeriodWeek:
+		start := weekStart(now)
+		since = &start
+	case models.LeaderboardPeriodMonth:
+		start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
+		since = &start
+	}
+
+	entries, err := e.rewardsRepo.Leaderboard(ctx, carpoolID, school, viewerID, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	return &models.LeaderboardResponse{Period: period, Entries: entries}, nil
+}
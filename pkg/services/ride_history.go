@@ -0,0 +1,71 @@
+package services
+
+import (
+	"car-backend/pkg/models"
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var rideHistoryCSVHeader = []string{
+	"date", "carpool", "ride_id", "status", "role", "driver",
+	"from", "to", "stops", "scheduled_at", "started_at", "completed_at",
+	"miles_saved", "attendance",
+}
+
+// WriteRideHistoryCSV writes ride history as CSV for reimbursement records, one row
+// per ride with times in the given timezone. Attendance is the user's own.
+func WriteRideHistoryCSV(w io.Writer, userID uuid.UUID, rides []models.RideHistoryEntry, loc *time.Location) error {
+	out := csv.NewWriter(w)
+	if err := out.Write(rideHistoryCSVHeader); err != nil {
+		return err
+	}
+
+	for _, ride := range rides {
+		var from, to string
+		if n := len(ride.Stops); n > 0 {
+			from, to = ride.Stops[0].Address, ride.Stops[n-1].Address
+		}
+
+		var attendance string
+		for _, a := range ride.Attendance {
+			if a.UserID == userID {
+				attendance = a.Status
+				break
+			}
+		}
+
+		record := []string{
+			ride.OccurredAt().In(loc).Format("2006-01-02"),
+			ride.CarpoolName,
+			ride.ID.String(),
+			rideStatusLabels[ride.Status],
+			ride.Role,
+			ride.DriverName,
+			from,
+			to,
+			strconv.Itoa(len(ride.Stops)),
+			csvTime(ride.ScheduledAt, loc),
+			csvTime(ride.StartedAt, loc),
+			csvTime(ride.CompletedAt, loc),
+			strconv.FormatFloat(ride.MilesSaved, 'f', 1, 64),
+			attendance,
+		}
+		if err := out.Write(record); err != nil {
+			return err
+		}
+	}
+
+	out.Flush()
+	return out.Error()
+}
+
+func csvTime(t *time.Time, loc *time.Location) string {
+	if t == nil {
+		return ""
+	}
+	return t.In(loc).Format("2006-01-02 15:04")
+}
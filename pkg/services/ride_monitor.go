@@ -0,0 +1,133 @@
+package services
+
+import (
+	"car-backend/pkg/models"
+	"car-backend/pkg/repository"
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RideMonitor periodically flags late stops and drivers who never started a scheduled ride
+type RideMonitor struct {
+	rideRepo     *repository.CarPoolRideRepository
+	carpoolRepo  *repository.CarPoolRepository
+	incidentRepo *repository.IncidentRepository
+	alerts       AlertSink
+
+	// LateTolerance is how long past a stop's scheduled time before it is flagged late
+	LateTolerance time.Duration
+	// NoShowTolerance is how long past a ride's scheduled time before an unstarted ride is a driver no-show
+	NoShowTolerance time.Duration
+	// NoShowWindow is how far back the monitor looks for unstarted rides and
+	// overdue stops; older ones are left alone
+	NoShowWindow time.Duration
+	// BatchSize caps how many unstarted rides, and how many overdue stops, one
+	// check flags
+	BatchSize int
+	// Interval is how often the monitor checks rides
+	Interval time.Duration
+}
+
+func NewRideMonitor(rideRepo *repository.CarPoolRideRepository, carpoolRepo *repository.CarPoolRepository, incidentRepo *repository.IncidentRepository, alerts AlertSink) *RideMonitor {
+	return &RideMonitor{
+		rideRepo:        rideRepo,
+		carpoolRepo:     carpoolRepo,
+		incidentRepo:    incidentRepo,
+		alerts:          alerts,
+		LateTolerance:   10 * time.Minute,
+		NoShowTolerance: 15 * time.Minute,
+		NoShowWindow:    24 * time.Hour,
+		BatchSize:       500,
+		Interval:        time.Minute,
+	}
+}
+
+// Run checks rides every Interval until the context is cancelled
+func (m *RideMonitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := m.Check(ctx, time.Now()); err != nil {
+			log.Printf("{\"severity\":\"ERROR\",\"message\":\"Ride monitor check failed: %v\"}", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check runs a single pass of late and no-show detection as of now
+func (m *RideMonitor) Check(ctx context.Context, now time.Time) error {
+	cutoff := now.Add(-m.NoShowTolerance)
+	unstarted, err := m.rideRepo.ListUnstartedRides(ctx, cutoff.Add(-m.NoShowWindow), cutoff, m.BatchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, ride := range unstarted {
+		incident := &models.RideIncident{
+			CarpoolRideID: ride.ID,
+			UserID:        ride.DriverID,
+			IncidentType:  models.IncidentTypeDriverNoShow,
+			Details:       fmt.Sprintf("Ride scheduled for %s was not started", ride.ScheduledAt.Format(time.RFC3339)),
+		}
+		m.flag(ctx, ride.CarpoolID, incident, "The driver has not started today's ride")
+	}
+
+	lateCutoff := now.Add(-m.LateTolerance)
+	overdue, err := m.rideRepo.ListOverdueStops(ctx, lateCutoff.Add(-m.NoShowWindow), lateCutoff, m.BatchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, o := range overdue {
+		stopID := o.Stop.ID
+		incident := &models.RideIncident{
+			CarpoolRideID: o.Stop.CarpoolRideID,
+			CarpoolStopID: &stopID,
+			UserID:        o.DriverID,
+			IncidentType:  models.IncidentTypeLate,
+			Details:       fmt.Sprintf("Stop %d scheduled for %s not reached", o.Stop.StopOrder, o.Stop.ScheduledAt.Format(time.RFC3339)),
+		}
+		m.flag(ctx, o.CarpoolID, incident, fmt.Sprintf("The ride is running late for the stop at %s", o.Stop.Address))
+	}
+
+	return nil
+}
+
+// flag records the incident and alerts the carpool the first time it is seen
+func (m *RideMonitor) flag(ctx context.Context, carpoolID uuid.UUID, incident *models.RideIncident, message string) {
+	created, err := m.incidentRepo.RecordIncident(ctx, incident)
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to record incident for ride %s: %v\"}", incident.CarpoolRideID, err)
+		return
+	}
+	if !created {
+		return
+	}
+
+	members, err := m.carpoolRepo.ListMemberIDs(ctx, carpoolID)
+	if err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to list members of carpool %s: %v\"}", carpoolID, err)
+		return
+	}
+
+	alert := models.RideAlert{
+		CarpoolID:     carpoolID,
+		CarpoolRideID: incident.CarpoolRideID,
+		CarpoolStopID: incident.CarpoolStopID,
+		IncidentType:  incident.IncidentType,
+		Message:       message,
+	}
+	if err := m.alerts.SendRideAlert(ctx, members, alert); err != nil {
+		log.Printf("{\"severity\":\"ERROR\",\"message\":\"Failed to send ride alert for ride %s: %v\"}", incident.CarpoolRideID, err)
+	}
+}
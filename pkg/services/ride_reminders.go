@@ -0,0 +1,109 @@
+package services
+
+import (
+	"car-backend/pkg/models"
+	"car-backend/pkg/repository"
+	"context"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RideReminderScheduler reminds the driver of a scheduled ride the evening
+// before, in the driver's timezone, and its riders shortly before it starts.
+// Claims are made in the database, so any number of instances can run it
+// without sending a reminder twice.
+type RideReminderScheduler struct {
+	rideRepo *repository.CarPoolRideRepository
+
+	// DriverTimeOfDay is when on the evening before the ride the driver is
+	// reminded, as an offset from local midnight. Rides scheduled after that
+	// time has passed remind the driver straight away.
+	DriverTimeOfDay time.Duration
+	// RiderLead is how long before the ride the riders are reminded
+	RiderLead time.Duration
+	// Interval is how often due reminders are looked for
+	Interval time.Duration
+}
+
+func NewRideReminderScheduler(rideRepo *repository.CarPoolRideRepository) *RideReminderScheduler {
+	return &RideReminderScheduler{
+		rideRepo:        rideRepo,
+		DriverTimeOfDay: 19 * time.Hour,
+		RiderLead:       15 * time.Minute,
+		Interval:        time.Minute,
+	}
+}
+
+// Run claims due reminders every Interval until the context is cancelled
+func (s *RideReminderScheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Schedule(ctx, time.Now()); err != nil {
+			log.Printf("{\"severity\":\"ERROR\",\"message\":\"Ride reminder scheduling failed: %v\"}", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Schedule claims the reminders due as of now. Delivery happens through the
+// outbox, so a reminder claimed just before a crash is still sent.
+func (s *RideReminderScheduler) Schedule(ctx context.Context, now time.Time) error {
+	// The evening before is at most two days ahead whatever the timezone
+	drivers, err := s.rideRepo.ListReminderCandidates(ctx, models.RideReminderDriver, now, now.Add(48*time.Hour))
+	if err != nil {
+		return err
+	}
+	var due []uuid.UUID
+	for _, c := range drivers {
+		if !now.Before(s.driverReminderAt(c.ScheduledAt, c.DriverTimezone)) {
+			due = append(due, c.RideID)
+		}
+	}
+	if err := s.claim(ctx, models.RideReminderDriver, due); err != nil {
+		return err
+	}
+
+	riders, err := s.rideRepo.ListReminderCandidates(ctx, models.RideReminderRiders, now, now.Add(s.RiderLead))
+	if err != nil {
+		return err
+	}
+	due = due[:0]
+	for _, c := range riders {
+		due = append(due, c.RideID)
+	}
+	return s.claim(ctx, models.RideReminderRiders, due)
+}
+
+func (s *RideReminderScheduler) claim(ctx context.Context, kind string, rideIDs []uuid.UUID) error {
+	claimed, err := s.rideRepo.ClaimRideReminders(ctx, kind, rideIDs)
+	if err != nil {
+		return err
+	}
+	if len(claimed) > 0 {
+		log.Printf("{\"severity\":\"INFO\",\"message\":\"Queued %d %s ride reminders\"}", len(claimed), kind)
+	}
+	return nil
+}
+
+// driverReminderAt is DriverTimeOfDay on the day before the ride, in the
+// driver's timezone
+func (s *RideReminderScheduler) driverReminderAt(scheduledAt time.Time, timezone string) time.Time {
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	local := scheduledAt.In(loc)
+	// Build the wall-clock time rather than adding to midnight, which is off by
+	// an hour on days the clocks change
+	hour, minute := int(s.DriverTimeOfDay/time.Hour), int(s.DriverTimeOfDay%time.Hour/time.Minute)
+	return time.Date(local.Year(), local.Month(), local.Day()-1, hour, minute, 0, 0, loc)
+}
@@ -0,0 +1,367 @@
+package services
+
+import (
+	"car-backend/pkg/geo"
+	"car-backend/pkg/models"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	SolverExact     = "exact"
+	SolverHeuristic = "heuristic"
+)
+
+var ErrInfeasibleConstraints = errors.New("pickup constraints cannot all be satisfied")
+
+// RouteOptimizer proposes the pickup order that minimises total distance between
+// the START and DESTINATION stops while respecting ordering constraints.
+type RouteOptimizer struct {
+	estimator TravelTimeEstimator
+
+	// ExactLimit is the largest number of pickups solved exactly; above it a heuristic is used
+	ExactLimit int
+}
+
+func NewRouteOptimizer(estimator TravelTimeEstimator) *RouteOptimizer {
+	return &RouteOptimizer{estimator: estimator, ExactLimit: 12}
+}
+
+// Optimize returns the proposed stop order with its distance and time savings
+func (o *RouteOptimizer) Optimize(ctx context.Context, req models.OptimizeRouteRequest) (*models.OptimizedRoute, error) {
+	start, dest, pickups, err := splitStops(req.Stops)
+	if err != nil {
+		return nil, err
+	}
+
+	preds, err := pickupPredecessors(pickups, req.PickupFirst, req.Precedence)
+	if err != nil {
+		return nil, err
+	}
+
+	// Index 0 is START, 1..n are pickups and n+1 is DESTINATION
+	points := make([]geo.Point, 0, len(pickups)+2)
+	points = append(points, stopPoint(start))
+	for _, p := range pickups {
+		points = append(points, stopPoint(p))
+	}
+	points = append(points, stopPoint(dest))
+
+	dist := make([][]float64, len(points))
+	for i := range points {
+		dist[i] = make([]float64, len(points))
+		for j := range points {
+			dist[i][j] = geo.DistanceMeters(points[i], points[j])
+		}
+	}
+
+	var order []int
+	solver := SolverExact
+	if len(pickups) <= o.ExactLimit {
+		order, err = solveExact(dist, preds)
+	} else {
+		solver = SolverHeuristic
+		order, err = solveHeuristic(dist, preds)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The submitted order is the baseline the savings are measured against
+	original := make([]int, len(pickups))
+	for i := range original {
+		original[i] = i
+	}
+
+	route := &models.OptimizedRoute{Solver: solver}
+	route.TotalDistanceM = routeDistance(dist, order)
+	route.OriginalDistanceM = routeDistance(dist, original)
+
+	duration, err := o.routeDuration(ctx, points, order)
+	if err != nil {
+		return nil, err
+	}
+	originalDuration, err := o.routeDuration(ctx, points, original)
+	if err != nil {
+		return nil, err
+	}
+	route.EstimatedDurationSec = int64(duration.Seconds())
+	route.OriginalDurationSec = int64(originalDuration.Seconds())
+	route.DistanceSavedM = math.Max(0, route.OriginalDistanceM-route.TotalDistanceM)
+	route.TimeSavedSec = max(0, route.OriginalDurationSec-route.EstimatedDurationSec)
+
+	route.Stops = make([]models.StopRequest, 0, len(req.Stops))
+	start.StopOrder = 1
+	route.Stops = append(route.Stops, start)
+	for i, idx := range order {
+		stop := pickups[idx]
+		stop.StopOrder = i + 2
+		route.Stops = append(route.Stops, stop)
+	}
+	dest.StopOrder = len(order) + 2
+	route.Stops = append(route.Stops, dest)
+
+	return route, nil
+}
+
+func (o *RouteOptimizer) routeDuration(ctx context.Context, points []geo.Point, order []int) (time.Duration, error) {
+	var total time.Duration
+	prev := 0
+	for _, idx := range append(pickupNodes(order), len(points)-1) {
+		d, err := o.estimator.Estimate(ctx, points[prev], points[idx])
+		if err != nil {
+			return 0, err
+		}
+		total += d
+		prev = idx
+	}
+	return total, nil
+}
+
+// splitStops separates START and DESTINATION from the pickups, keeping the
+// pickups in their submitted stop order.
+func splitStops(stops []models.StopRequest) (start, dest models.StopRequest, pickups []models.StopRequest, err error) {
+	var haveStart, haveDest bool
+	for _, stop := range stops {
+		if stop.Lat == nil || stop.Lng == nil {
+			return start, dest, nil, fmt.Errorf("stop %q has no coordinates", stop.Address)
+		}
+		switch stop.StopType {
+		case models.StopTypeStart:
+			if haveStart {
+				return start, dest, nil, errors.New("route has more than one START stop")
+			}
+			start, haveStart = stop, true
+		case models.StopTypeDestination:
+			if haveDest {
+				return start, dest, nil, errors.New("route has more than one DESTINATION stop")
+			}
+			dest, haveDest = stop, true
+		default:
+			pickups = append(pickups, stop)
+		}
+	}
+	if !haveStart || !haveDest {
+		return start, dest, nil, errors.New("route needs a START and a DESTINATION stop")
+	}
+
+	sort.SliceStable(pickups, func(i, j int) bool { return pickups[i].StopOrder < pickups[j].StopOrder })
+	return start, dest, pickups, nil
+}
+
+// pickupPredecessors builds, for each pickup, the bitmask of pickups that must come before it
+func pickupPredecessors(pickups []models.StopRequest, first []uuid.UUID, precedence []models.PrecedenceConstraint) ([]uint64, error) {
+	if len(pickups) > 64 {
+		return nil, errors.New("too many pickups to optimize")
+	}
+
+	byUser := make(map[uuid.UUID][]int)
+	for i, p := range pickups {
+		if p.UserID != uuid.Nil {
+			byUser[p.UserID] = append(byUser[p.UserID], i)
+		}
+	}
+
+	lookup := func(userID uuid.UUID) ([]int, error) {
+		idx, ok := byUser[userID]
+		if !ok {
+			return nil, fmt.Errorf("no pickup for user %s", userID)
+		}
+		return idx, nil
+	}
+
+	preds := make([]uint64, len(pickups))
+
+	var firstMask uint64
+	for _, userID := range first {
+		idx, err := lookup(userID)
+		if err != nil {
+			return nil, err
+		}
+		for _, i := range idx {
+			firstMask |= 1 << i
+		}
+	}
+	for i := range pickups {
+		if firstMask&(1<<i) == 0 {
+			preds[i] |= firstMask
+		}
+	}
+
+	for _, c := range precedence {
+		before, err := lookup(c.BeforeUserID)
+		if err != nil {
+			return nil, err
+		}
+		after, err := lookup(c.AfterUserID)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range after {
+			for _, b := range before {
+				if a == b {
+					return nil, ErrInfeasibleConstraints
+				}
+				preds[a] |= 1 << b
+			}
+		}
+	}
+
+	return preds, nil
+}
+
+// solveExact finds the optimal pickup order with the Held-Karp dynamic program
+func solveExact(dist [][]float64, preds []uint64) ([]int, error) {
+	n := len(preds)
+	dest := n + 1
+	if n == 0 {
+		return []int{}, nil
+	}
+
+	full := 1<<n - 1
+	cost := make([][]float64, 1<<n)
+	parent := make([][]int, 1<<n)
+	for mask := range cost {
+		cost[mask] = make([]float64, n)
+		parent[mask] = make([]int, n)
+		for j := range cost[mask] {
+			cost[mask][j] = math.Inf(1)
+			parent[mask][j] = -1
+		}
+	}
+
+	for j := 0; j < n; j++ {
+		if preds[j] == 0 {
+			cost[1<<j][j] = dist[0][j+1]
+		}
+	}
+
+	for mask := 1; mask <= full; mask++ {
+		for last := 0; last < n; last++ {
+			if mask&(1<<last) == 0 || math.IsInf(cost[mask][last], 1) {
+				continue
+			}
+			for next := 0; next < n; next++ {
+				if mask&(1<<next) != 0 || preds[next]&^uint64(mask) != 0 {
+					continue
+				}
+				nextMask := mask | 1<<next
+				c := cost[mask][last] + dist[last+1][next+1]
+				if c < cost[nextMask][next] {
+					cost[nextMask][next] = c
+					parent[nextMask][next] = last
+				}
+			}
+		}
+	}
+
+	best, bestLast := math.Inf(1), -1
+	for last := 0; last < n; last++ {
+		c := cost[full][last] + dist[last+1][dest]
+		if c < best {
+			best, bestLast = c, last
+		}
+	}
+	if bestLast < 0 {
+		return nil, ErrInfeasibleConstraints
+	}
+
+	order := make([]int, n)
+	mask, last := full, bestLast
+	for i := n - 1; i >= 0; i-- {
+		order[i] = last
+		prev := parent[mask][last]
+		mask &^= 1 << last
+		last = prev
+	}
+
+	return order, nil
+}
+
+// solveHeuristic builds a feasible order by nearest neighbour and improves it with 2-opt
+func solveHeuristic(dist [][]float64, preds []uint64) ([]int, error) {
+	n := len(preds)
+	order := make([]int, 0, n)
+	var visited uint64
+	current := 0
+
+	for len(order) < n {
+		best, bestDist := -1, math.Inf(1)
+		for j := 0; j < n; j++ {
+			if visited&(1<<j) != 0 || preds[j]&^visited != 0 {
+				continue
+			}
+			if d := dist[current][j+1]; d < bestDist {
+				best, bestDist = j, d
+			}
+		}
+		if best < 0 {
+			return nil, ErrInfeasibleConstraints
+		}
+		order = append(order, best)
+		visited |= 1 << best
+		current = best + 1
+	}
+
+	length := routeDistance(dist, order)
+	for improved := true; improved; {
+		improved = false
+		for i := 0; i < n-1; i++ {
+			for k := i + 1; k < n; k++ {
+				candidate := append([]int(nil), order...)
+				for a, b := i, k; a < b; a, b = a+1, b-1 {
+					candidate[a], candidate[b] = candidate[b], candidate[a]
+				}
+				if !feasible(candidate, preds) {
+					continue
+				}
+				if l := routeDistance(dist, candidate); l < length-1e-6 {
+					order, length, improved = candidate, l, true
+				}
+			}
+		}
+	}
+
+	return order, nil
+}
+
+func feasible(order []int, preds []uint64) bool {
+	var visited uint64
+	for _, j := range order {
+		if preds[j]&^visited != 0 {
+			return false
+		}
+		visited |= 1 << j
+	}
+	return true
+}
+
+// routeDistance is the length of START -> pickups in order -> DESTINATION
+func routeDistance(dist [][]float64, order []int) float64 {
+	total := 0.0
+	prev := 0
+	for _, idx := range append(pickupNodes(order), len(dist)-1) {
+		total += dist[prev][idx]
+		prev = idx
+	}
+	return total
+}
+
+// pickupNodes maps pickup indexes to their node index in the distance matrix
+func pickupNodes(order []int) []int {
+	nodes := make([]int, len(order))
+	for i, idx := range order {
+		nodes[i] = idx + 1
+	}
+	return nodes
+}
+
+func stopPoint(stop models.StopRequest) geo.Point {
+	return geo.Point{Lat: *stop.Lat, Lng: *stop.Lng}
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"car-backend/pkg/models"
+	"car-backend/pkg/repository"
+	"context"
+	"math"
+	"time"
+)
+
+// SavingsCalculator turns the miles carpooling saved into fuel, CO2 and cost
+// figures for schools and employers promoting carpooling
+type SavingsCalculator struct {
+	savingsRepo *repository.SavingsRepository
+
+	// KgCO2PerGallon is the CO2 emitted burning a gallon of fuel
+	KgCO2PerGallon float64
+	// FuelPriceMinorPerGallon is the fuel price used for cost saved, in minor
+	// units of Currency
+	FuelPriceMinorPerGallon int64
+	Currency                string
+	// DefaultMPG is the fuel economy assumed when the driver has not set one
+	DefaultMPG float64
+}
+
+func NewSavingsCalculator(savingsRepo *repository.SavingsRepository) *SavingsCalculator {
+	return &SavingsCalculator{
+		savingsRepo:             savingsRepo,
+		KgCO2PerGallon:          8.887, // EPA figure for gasoline
+		FuelPriceMinorPerGallon: 350,
+		Currency:                "USD",
+		DefaultMPG:              25.4,
+	}
+}
+
+// Report totals the savings of the rides in scope over [from, to), bucketed by
+// day, week or month in loc
+func (c *SavingsCalculator) Report(ctx context.Context, scope repository.SavingsScope, from, to time.Time, bucket string, loc *time.Location) (*models.SavingsReport, error) {
+	rows, err := c.savingsRepo.ListRideSavings(ctx, scope, from, to, bucket, loc, c.DefaultMPG)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.SavingsReport{
+		From:   from,
+		To:     to,
+		Bucket: bucket,
+		Factors: models.SavingsFactors{
+			KgCO2PerGallon:          c.KgCO2PerGallon,
+			FuelPriceMinorPerGallon: c.FuelPriceMinorPerGallon,
+			Currency:                c.Currency,
+			DefaultMPG:              c.DefaultMPG,
+		},
+		Buckets: []models.SavingsBucket{},
+	}
+
+	var miles, gallons float64
+	var rides int
+	var costMinor int64
+	for _, row := range rows {
+		figures := c.figures(row.Rides, row.Miles, row.Gallons)
+		report.Buckets = append(report.Buckets, models.SavingsBucket{
+			Start:          row.Start,
+			SavingsFigures: figures,
+		})
+		rides += row.Rides
+		miles += row.Miles
+		gallons += row.Gallons
+		costMinor += figures.FuelCostSavedMinor
+	}
+	// The total cost is the sum of the buckets so the two always agree
+	report.Totals = c.figures(rides, miles, gallons)
+	report.Totals.FuelCostSavedMinor = costMinor
+
+	return report, nil
+}
+
+func (c *SavingsCalculator) figures(rides int, miles, gallons float64) models.SavingsFigures {
+	return models.SavingsFigures{
+		Rides:              rides,
+		MilesSaved:         round2(miles),
+		FuelGallonsSaved:   round2(gallons),
+		CO2KgAvoided:       round2(gallons * c.KgCO2PerGallon),
+		FuelCostSavedMinor: int64(math.Round(gallons * float64(c.FuelPriceMinorPerGallon))),
+	}
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}